@@ -2,6 +2,10 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -10,18 +14,523 @@ type RemoteGitService interface {
 	SendInlineComments(comments []*InlineComment, pullRequestInfo *PullRequestInfo) error
 }
 
+// ReactionTracker is implemented by providers that can report reactions left on earlier gitex comments.
+type ReactionTracker interface {
+	GetReactionStats(pullRequestInfo *PullRequestInfo) (*ReactionStats, error)
+}
+
+// PullRequestFinder is implemented by providers that can look up the open pull request for a branch.
+type PullRequestFinder interface {
+	FindPullRequestURL(remoteURL, branch string) (string, error)
+}
+
+// CommitStatusReporter is implemented by providers that can report the review outcome as a commit status.
+type CommitStatusReporter interface {
+	SetCommitStatus(pullRequestInfo *PullRequestInfo, status *CommitStatus) error
+}
+
+// CompareDiffFetcher is implemented by providers that can return the unified diff of a pull request without a clone.
+type CompareDiffFetcher interface {
+	CompareDiff(pullRequestInfo *PullRequestInfo) (string, error)
+}
+
+// Labeler is implemented by providers that can label a pull request, creating the label when the repository lacks it.
+type Labeler interface {
+	AddLabel(pullRequestInfo *PullRequestInfo, label string) error
+}
+
+// IdentityResolver is implemented by providers that can tell which user the API key belongs to.
+type IdentityResolver interface {
+	AuthenticatedUser() (string, error)
+}
+
+// OwnerResolver is implemented by providers that can list the CODEOWNERS handles the API key's user answers to:
+// @user and the @org/team or @group/subgroup handles of its teams or groups.
+type OwnerResolver interface {
+	OwnerHandles() ([]string, error)
+}
+
+// ThreadTracker is implemented by providers that can list the threads earlier gitex runs opened on a pull request,
+// with whether they were resolved since.
+type ThreadTracker interface {
+	PriorThreads(pullRequestInfo *PullRequestInfo) ([]*PriorThread, error)
+}
+
+// PriorThread is a thread an earlier gitex run opened on a diff line. NewLine is 0 for a thread on a removed line,
+// OldLine is 0 otherwise.
+type PriorThread struct {
+	Path     string
+	NewLine  int64
+	OldLine  int64
+	Resolved bool
+}
+
+// PullRequestCommenter is implemented by providers that can post a general comment on a pull request, outside the
+// diff.
+type PullRequestCommenter interface {
+	CommentOnPullRequest(pullRequestInfo *PullRequestInfo, body string) error
+}
+
+// BlobLinker is implemented by providers that can link to lines of a file of the pull request's repository.
+type BlobLinker interface {
+	BlobURL(pullRequestInfo *PullRequestInfo, sha, path string, start, end int64) string
+}
+
 type Config struct {
-	VcsApiKey    string
-	VcsRemoteUrl string
-	AiModel      string
-	AiApiKey     string
-	Verbose      bool
-	CI           bool
-	HomeDir      string
-	BinDir       string
+	VcsApiKey           string
+	VcsRemoteUrl        string
+	VcsProvider         string
+	AiModel             string
+	AiModelChain        []string
+	AiApiKey            string
+	Verbose             bool
+	CI                  bool
+	HomeDir             string
+	BinDir              string
+	CodexHome           string
+	CodexVersion        string
+	SubPath             string
+	TrackReactions      bool
+	ConsolidatedReview  bool
+	SingleCommentMode   bool
+	RequestsPerSecond   float64
+	CommentConcurrency  int
+	CommentRetries      int
+	RepoPath            string
+	DroppedReport       string
+	CommitStatus        bool
+	StatusContext       string
+	Exclude             []string
+	Include             []string
+	ReviewGenerated     bool
+	GeneratedPatterns   []string
+	DiffContext         int
+	DiffAlgorithm       string
+	AiAgent             string
+	ReplayFile          string
+	MinHunkLines        int
+	FailFast            bool
+	VerifyLineContent   bool
+	LineMatchThreshold  float64
+	ExpectUser          string
+	TopFiles            int
+	MaxFiles            int
+	MaxDiffBytes        int
+	RepoContext         int
+	OnTooManyFiles      string
+	OutputFormat        string
+	MaxAiProcesses      int
+	SummaryMode         string
+	CloneRetries        int
+	RunRetries          int
+	CloneDepth          int
+	NoClone             bool
+	ApplyLabel          string
+	SplitLongComments   bool
+	CloneFallback       string
+	CloneTags           string
+	GitTransport        string
+	SSHKey              string
+	LinkifyReferences   bool
+	Serve               bool
+	LineOffsetTolerance int
+	OnCrossHunk         string
+	BaseTag             string
+	DrainTimeout        time.Duration
+	CloneTimeout        time.Duration
+	AgentTimeout        time.Duration
+	ApiTimeout          time.Duration
+	PendingFile         string
+	DiffFile            string
+	BaseSha             string
+	HeadSha             string
+	DryRun              bool
+	OwnFilesOnly        bool
+	SummaryFile         string
+	OutputFile          string
+	PostSummary         bool
+	MaxCommentsPerFile  int
+	SummaryFileList     bool
+	OwnershipFile       string
+	RedactPatternsFile  string
+	SkipOpenThreads     bool
+	ReviewDescription   bool
+	SkipConflicts       bool
+	AiEnv               []string
+	MinDiffLines        int
+	IgnoreMarker        string
+	Tone                string
+	Files               []string
+	Commits             []string
+	IncludeHunk         bool
+	UsePartialOnTimeout bool
+	PostHook            string
+	PostHookTimeout     time.Duration
+	RetryMax            int
+	RetryWaitMin        time.Duration
+	RetryWaitMax        time.Duration
+}
+
+// Validate checks required fields and conflicting options up front, so a misconfigured run fails before any
+// network work. All problems are reported in a single error.
+func (c *Config) Validate() error {
+	var problems []string
+	if c.VcsApiKey == "" && !c.Serve && c.DiffFile == "" {
+		problems = append(problems, "vcs api key is required")
+	}
+
+	switch {
+	case c.VcsProvider == "":
+	case slices.Contains(VCSProviderTypes, VCSProviderType(c.VcsProvider)):
+		if c.VcsRemoteUrl == "" {
+			problems = append(problems, "vcs provider names the provider at the vcs url, which is not set")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported vcs provider %q, use %s", c.VcsProvider, listNames(VCSProviderTypes)))
+	}
+
+	agent := AIAgentType(c.AiAgent)
+	if agent == "" {
+		agent = AIAgentTypeCodex
+	}
+	switch {
+	case agent == AIAgentTypeReplay:
+		if c.ReplayFile == "" {
+			problems = append(problems, "replay agent requires a replay file")
+		}
+	case slices.Contains(AIAgentTypes, agent):
+		if c.AiApiKey == "" && !c.DryRun {
+			problems = append(problems, "ai api key is required")
+		}
+		if c.AiModel == "" && len(c.AiModelChain) == 0 {
+			problems = append(problems, "ai model is required")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported ai agent %q, use %s", c.AiAgent, listNames(AIAgentTypes)))
+	}
+	for _, env := range c.AiEnv {
+		key, _, ok := strings.Cut(env, "=")
+		switch {
+		case !ok || key == "" || strings.ContainsAny(key, " \t"):
+			problems = append(problems, fmt.Sprintf("ai env %q must be KEY=VALUE", env))
+		case key == "CODEX_HOME":
+			problems = append(problems, "ai env cannot set CODEX_HOME, use -codex-home")
+		}
+	}
+	if len(c.AiModelChain) > 0 && agent != AIAgentTypeCodex {
+		problems = append(problems, "ai model chain is only supported by the codex agent")
+	}
+	if len(c.AiModelChain) > 0 && c.AiModel != "" && c.AiModel != c.AiModelChain[0] {
+		problems = append(problems, "ai model chain replaces ai model, set only one of them")
+	}
+	if c.ReplayFile != "" && agent != AIAgentTypeReplay {
+		problems = append(problems, "replay file is only used by the replay agent")
+	}
+
+	if c.ReviewGenerated && c.GeneratedPatterns != nil {
+		problems = append(problems, "generated patterns have no effect when generated files are reviewed")
+	}
+	if c.RequestsPerSecond < 0 {
+		problems = append(problems, "requests per second must not be negative")
+	}
+	if c.CommentConcurrency < 0 {
+		problems = append(problems, "comment concurrency must not be negative")
+	}
+	if c.CommentRetries < 0 {
+		problems = append(problems, "comment retries must not be negative")
+	}
+	if c.DiffContext < 0 {
+		problems = append(problems, "diff context must not be negative")
+	}
+	switch c.DiffAlgorithm {
+	case "", "myers":
+	case "minimal", "patience", "histogram":
+		if AIAgentType(c.AiAgent) == AIAgentTypeOpenAI {
+			problems = append(problems, fmt.Sprintf("diff algorithm %q is not supported by the openai agent, it only diffs with myers", c.DiffAlgorithm))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported diff algorithm %q, use myers, minimal, patience or histogram", c.DiffAlgorithm))
+	}
+	if c.MinHunkLines < 0 {
+		problems = append(problems, "min hunk lines must not be negative")
+	}
+	switch c.OutputFormat {
+	case "", "text", "github-actions", "json":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported output format %q", c.OutputFormat))
+	}
+	switch c.Tone {
+	case "", "concise", "friendly", "strict":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported tone %q", c.Tone))
+	}
+	switch c.SummaryMode {
+	case "", "inline", "checklist":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported summary mode %q", c.SummaryMode))
+	}
+	// single comment mode keeps the checklist in one comment
+	checklist := c.SummaryMode == "checklist" || c.SingleCommentMode
+	if c.SingleCommentMode && c.SummaryMode == "inline" {
+		problems = append(problems, "single comment mode posts the checklist, it cannot be used with the inline summary mode")
+	}
+	if checklist && c.ConsolidatedReview {
+		problems = append(problems, "consolidated review has no effect in checklist summary mode")
+	}
+	if c.IncludeHunk && checklist {
+		problems = append(problems, "include hunk has no effect in checklist summary mode")
+	}
+	if c.MaxAiProcesses < 0 {
+		problems = append(problems, "max ai processes must not be negative")
+	}
+	if strings.Contains(c.ApplyLabel, ",") {
+		problems = append(problems, "apply label must be a single label without commas")
+	}
+	if c.OwnFilesOnly && c.NoClone {
+		problems = append(problems, "own files only reads CODEOWNERS from the clone, it cannot be used with no clone")
+	}
+	if c.SkipOpenThreads && c.ConsolidatedReview {
+		problems = append(problems, "skip open threads cannot be used with consolidated review, which resolves the previous run's threads")
+	}
+	if c.BaseTag != "" && c.NoClone {
+		problems = append(problems, "base tag needs a clone, it cannot be used with no clone")
+	}
+	switch c.CloneFallback {
+	case "", "commit", "default-branch", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported clone fallback %q", c.CloneFallback))
+	}
+	switch c.CloneTags {
+	case "", "none", "all":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported clone tags %q", c.CloneTags))
+	}
+	switch c.GitTransport {
+	case "", "https", "ssh":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported git transport %q", c.GitTransport))
+	}
+	if c.SSHKey != "" && c.GitTransport != "ssh" {
+		problems = append(problems, "ssh key is only used with the ssh git transport")
+	}
+	if c.CloneDepth < 0 {
+		problems = append(problems, "clone depth must not be negative")
+	}
+	if c.CloneRetries < 0 {
+		problems = append(problems, "clone retries must not be negative")
+	}
+	if c.RunRetries < 0 {
+		problems = append(problems, "run retries must not be negative")
+	}
+	if c.RedactPatternsFile != "" && !c.NoClone && !c.Serve && c.DiffFile == "" {
+		problems = append(problems, "redact patterns file needs no clone, serve or a diff file, with a clone the agent reads the unredacted checkout")
+	}
+	if c.LinkifyReferences && (c.Serve || c.DiffFile != "") {
+		problems = append(problems, "linkify references needs a pull request, serve and diff file have no repository to link to")
+	}
+	if c.OutputFile != "" && (c.Serve || c.DiffFile != "") {
+		problems = append(problems, "output file is only written for pull request reviews, serve and diff file print the comments")
+	}
+	if c.RunRetries > 0 && c.Serve {
+		problems = append(problems, "run retries has no effect in serve mode, the client retries a failed review")
+	}
+	if strings.ContainsAny(c.IgnoreMarker, "\r\n") {
+		problems = append(problems, "ignore marker must be a single line")
+	}
+	if c.MinDiffLines < 0 {
+		problems = append(problems, "min diff lines must not be negative")
+	}
+	if len(c.Files) > 0 && c.TopFiles > 0 {
+		problems = append(problems, "top files has no effect when the files to review are named")
+	}
+	if len(c.Files) > 0 && (c.Serve || c.DiffFile != "") {
+		problems = append(problems, "files only narrow pull request reviews, not serve mode or a diff file")
+	}
+	if len(c.Commits) > 0 && (c.NoClone || c.BaseTag != "") {
+		problems = append(problems, "commits are reviewed in a clone of their own range, they cannot be used with no clone or base tag")
+	}
+	if len(c.Commits) > 0 && (c.Serve || c.DiffFile != "") {
+		problems = append(problems, "commits only narrow pull request reviews, not serve mode or a diff file")
+	}
+	if c.TopFiles < 0 {
+		problems = append(problems, "top files must not be negative")
+	}
+	if c.MaxFiles < 0 {
+		problems = append(problems, "max files must not be negative")
+	}
+	if c.MaxDiffBytes < 0 {
+		problems = append(problems, "max diff bytes must not be negative")
+	}
+	if c.MaxDiffBytes > 0 && (c.Serve || c.DiffFile != "") {
+		problems = append(problems, "max diff bytes only limits pull request reviews, not serve mode or a diff file")
+	}
+	if c.RepoContext < 0 {
+		problems = append(problems, "repo context must not be negative")
+	}
+	if c.RepoContext > 0 && (c.Serve || c.DiffFile != "") {
+		problems = append(problems, "repo context is built from the checkout, which serve mode and a diff file have not")
+	}
+	if c.MaxFiles > 0 && c.TopFiles > 0 {
+		problems = append(problems, "max files has no effect with top files, which always limits the review")
+	}
+	switch c.OnTooManyFiles {
+	case "", "largest", "abort":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported too many files handling %q, use largest or abort", c.OnTooManyFiles))
+	}
+	if c.MaxCommentsPerFile < 0 {
+		problems = append(problems, "max comments per file must not be negative")
+	}
+	if c.MaxCommentsPerFile > 0 && checklist {
+		problems = append(problems, "max comments per file has no effect in checklist summary mode")
+	}
+	if c.LineOffsetTolerance < 0 {
+		problems = append(problems, "line offset tolerance must not be negative")
+	}
+	if c.UsePartialOnTimeout && c.Serve {
+		problems = append(problems, "use partial on timeout has no effect in serve mode")
+	}
+	switch c.OnCrossHunk {
+	case "", "clamp", "split", "drop":
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported cross-hunk handling %q, use clamp, split or drop", c.OnCrossHunk))
+	}
+	if c.RetryMax < 0 {
+		problems = append(problems, "retry max must not be negative")
+	}
+	if c.RetryWaitMin < 0 || c.RetryWaitMax < 0 {
+		problems = append(problems, "retry waits must not be negative")
+	}
+	if c.RetryWaitMin > 0 && c.RetryWaitMax > 0 && c.RetryWaitMin > c.RetryWaitMax {
+		problems = append(problems, "retry wait min must not exceed retry wait max")
+	}
+	if c.PostHookTimeout < 0 {
+		problems = append(problems, "post hook timeout must not be negative")
+	}
+	if c.PostHook != "" && c.Serve {
+		problems = append(problems, "post hook is not run in serve mode")
+	}
+	if c.DrainTimeout < 0 {
+		problems = append(problems, "drain timeout must not be negative")
+	}
+	if c.CloneTimeout < 0 {
+		problems = append(problems, "clone timeout must not be negative")
+	}
+	if c.AgentTimeout < 0 {
+		problems = append(problems, "agent timeout must not be negative")
+	}
+	if c.ApiTimeout < 0 {
+		problems = append(problems, "api timeout must not be negative")
+	}
+	if c.PendingFile != "" && !c.Serve {
+		problems = append(problems, "pending file is only used in serve mode")
+	}
+	if c.DiffFile != "" && c.Serve {
+		problems = append(problems, "diff file cannot be used with serve mode")
+	}
+	if (c.BaseSha != "" || c.HeadSha != "") && c.DiffFile == "" {
+		problems = append(problems, "base and head sha are only used with a diff file")
+	}
+	if c.LineMatchThreshold < 0 || c.LineMatchThreshold > 1 {
+		problems = append(problems, "line match threshold must be between 0 and 1")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
 }
+
+// listNames joins names for a message, "a, b or c".
+func listNames[T ~string](names []T) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = string(name)
+	}
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " or " + parts[len(parts)-1]
+}
+
 type GeneratePRInlineCommentsOptions struct {
 	SandBoxDir, BaseSha, StartSha, HeadSha string
+	SubPath                                string
+	Exclude                                []string
+	Include                                []string
+	DiffContext                            int
+	DiffAlgorithm                          string
+	// DiffFile holds the pull request diff when SandBoxDir is not a checkout of the repository.
+	DiffFile string
+	// PathContext holds what the repository wants reviewers to know about the changed areas, one note per area.
+	PathContext []string
+	// KeepPartial asks the agent to return the complete comments it saved when ctx ends before it finishes, together
+	// with ErrReviewTruncated.
+	KeepPartial bool
+	// RepoContext lists the files of the repository with their top-level symbols, so the review knows what exists
+	// beyond the diff. Empty without -repo-context.
+	RepoContext string
+	// Commits, when set, are the commits of the range the review covers, each reviewed against its first parent.
+	Commits []string
+	// Provider is where the comments are posted. The agent is only asked for the position fields it uses, all of them
+	// when it is empty.
+	Provider VCSProviderType
+}
+
+// ErrReviewTruncated is returned with the comments an agent saved before it was stopped, see KeepPartial.
+var ErrReviewTruncated = errors.New("review truncated")
+
+// DescriptionReviewer is implemented by AI agents that can check the title and description of a pull request against
+// its changes.
+type DescriptionReviewer interface {
+	ReviewDescriptionWithContext(ctx context.Context, options *ReviewDescriptionOptions) (string, error)
+}
+
+// ReviewDescriptionOptions describes the pull request whose description is reviewed. The sandbox and diff fields mean
+// the same as in GeneratePRInlineCommentsOptions.
+type ReviewDescriptionOptions struct {
+	SandBoxDir, BaseSha, HeadSha string
+	SubPath                      string
+	Exclude                      []string
+	Include                      []string
+	DiffFile                     string
+	Title, Description           string
+}
+
+// CommitCloner is implemented by version control services that can clone a commit when its branch cannot be cloned.
+type CommitCloner interface {
+	CloneCommitWithContext(ctx context.Context, path, repoUrl, sha string) error
+	CloneDefaultBranchWithContext(ctx context.Context, path, repoUrl, sha string) error
+}
+
+// CommitFetcher is implemented by version control services that can fetch a commit a shallow clone is missing.
+type CommitFetcher interface {
+	FetchCommitWithContext(ctx context.Context, path, sha string) error
+}
+
+// SessionAgent is implemented by AI agents that can stay logged in across several review calls, used by long-running
+// modes to skip a login per review.
+type SessionAgent interface {
+	StartSession(ctx context.Context) error
+	EndSession(ctx context.Context) error
+}
+
+// RepoIndexer is implemented by version control services that can list the files of a checkout with their top-level
+// symbols in at most maxBytes, leaving out the files skip reports.
+type RepoIndexer interface {
+	RepoIndex(ctx context.Context, path string, maxBytes int, skip func(path string) bool) (string, error)
+}
+
+// CommitSelector is implemented by version control services that can review a selection of a pull request's commits
+// instead of its whole range.
+type CommitSelector interface {
+	ResolveCommits(ctx context.Context, path, baseSha, headSha string, revs []string) ([]string, error)
+	CommitsDiff(ctx context.Context, path string, shas []string) (string, error)
+}
+
+// TagResolver is implemented by version control services that can resolve a tag to its commit in a clone.
+type TagResolver interface {
+	ResolveTag(ctx context.Context, path, tag string) (string, error)
 }
 
 type AIAgentService interface {
@@ -32,13 +541,21 @@ type AIAgentService interface {
 type VersionControlService interface {
 	CloneRepo(path, repoUrl, ref string) error
 	CloneRepoWithContext(ctx context.Context, path, repoUrl, ref string) error
+	GetLocalRepoInfo(path string) (*LocalRepoInfo, error)
+	Diff(ctx context.Context, path, baseSha, headSha string) (string, error)
 }
 
 type InlineComment struct {
-	Body      *string                `url:"body,omitempty" json:"body,omitempty"`
-	CommitID  *string                `url:"commit_id,omitempty" json:"commit_id,omitempty"`
-	CreatedAt *time.Time             `url:"created_at,omitempty" json:"created_at,omitempty"`
-	Position  *InlineCommentPosition `url:"position,omitempty" json:"position,omitempty"`
+	Body        *string                `url:"body,omitempty" json:"body,omitempty"`
+	CommitID    *string                `url:"commit_id,omitempty" json:"commit_id,omitempty"`
+	CreatedAt   *time.Time             `url:"created_at,omitempty" json:"created_at,omitempty"`
+	Position    *InlineCommentPosition `url:"position,omitempty" json:"position,omitempty"`
+	Suggestion  *string                `url:"-" json:"suggestion,omitempty"`
+	Confidence  string                 `url:"-" json:"confidence,omitempty"`
+	LineContent string                 `url:"-" json:"line_content,omitempty"`
+	Category    string                 `url:"-" json:"category,omitempty"`
+	Folded      bool                   `url:"-" json:"folded,omitempty"`
+	Hunk        string                 `url:"-" json:"hunk,omitempty"`
 }
 
 type InlineCommentPosition struct {
@@ -57,6 +574,18 @@ type InlineCommentPosition struct {
 	Y            *float64          `url:"y,omitempty" json:"y,omitempty"`
 	CommentType  string            `url:"comment_type,omitempty" json:"comment_type,omitempty"`
 	LineType     string            `url:"line_type,omitempty" json:"line_type,omitempty"`
+	DeletedFile  bool              `url:"-" json:"deleted_file,omitempty"`
+}
+
+// Position types. Image positions point at a pixel of a changed image instead of a line.
+const (
+	PositionTypeText  = "text"
+	PositionTypeImage = "image"
+)
+
+// IsImage reports whether the position targets a point on an image rather than a line.
+func (p *InlineCommentPosition) IsImage() bool {
+	return p.PositionType != nil && *p.PositionType == PositionTypeImage
 }
 
 type LineRangeOptions struct {
@@ -76,14 +605,110 @@ type PullRequestInfo struct {
 	StartSha       string `json:"start_sha"`
 	HeadSha        string `json:"head_sha"`
 	ProjectHttpUrl string `json:"project_http_url"`
+	ProjectSshUrl  string `json:"project_ssh_url,omitempty"`
+	ProjectWebUrl  string `json:"project_web_url"`
 	SourceBranch   string `json:"source_branch"`
 	TargetBranch   string `json:"target_branch"`
 	ProjectId      int64  `json:"project_id"`
 	ProjectPath    string `json:"project_path"`
 	PullRequestId  int64  `json:"pull_request_id"`
 	Owner          string `json:"owner"`
+	Title          string `json:"title,omitempty"`
+	Description    string `json:"description,omitempty"`
+	// MergeStatus tells whether the pull request merges cleanly, one of the MergeStatus constants, empty when the
+	// provider did not say.
+	MergeStatus string `json:"merge_status,omitempty"`
+	// MergeQueueSha is the temporary merge commit a pull request waiting in a GitHub merge queue is tested with, and
+	// MergeQueueBaseSha the commit it merges onto. The review covers that commit instead of the head when they are set.
+	MergeQueueSha     string `json:"merge_queue_sha,omitempty"`
+	MergeQueueBaseSha string `json:"merge_queue_base_sha,omitempty"`
+	// ChangedFiles is filled by the review when summaries list the changed files.
+	ChangedFiles []ChangedFile `json:"changed_files,omitempty"`
+}
+
+// Merge statuses of a pull request.
+const (
+	MergeStatusClean    = "clean"
+	MergeStatusConflict = "conflict"
+	// MergeStatusChecking means the provider is still computing whether the pull request merges cleanly.
+	MergeStatusChecking = "checking"
+)
+
+// ChangedFile is a file of the reviewed diff with its added and removed line counts.
+type ChangedFile struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// maxChangedFilesRows keeps the changed files table of huge pull requests below comment size limits.
+const maxChangedFilesRows = 50
+
+// ChangedFilesTable renders the changed files as a markdown table followed by a blank line, or "" when there are
+// none.
+func (p *PullRequestInfo) ChangedFilesTable() string {
+	if len(p.ChangedFiles) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("| File | Added | Removed |\n|---|---:|---:|\n")
+	for i, file := range p.ChangedFiles {
+		if i == maxChangedFilesRows {
+			fmt.Fprintf(&sb, "| …and %d more files | | |\n", len(p.ChangedFiles)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "| `%s` | +%d | -%d |\n", file.Path, file.Added, file.Removed)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+type LocalRepoInfo struct {
+	RemoteUrl string `json:"remote_url"`
+	Branch    string `json:"branch"`
+}
+
+type CommitStatusState string
+
+const (
+	CommitStatusPending CommitStatusState = "pending"
+	CommitStatusSuccess CommitStatusState = "success"
+	CommitStatusFailure CommitStatusState = "failure"
+)
+
+type CommitStatus struct {
+	State       CommitStatusState `json:"state"`
+	Context     string            `json:"context"`
+	Description string            `json:"description"`
+}
+
+type ReactionStats struct {
+	Comments   int `json:"comments"`
+	ThumbsUp   int `json:"thumbs_up"`
+	ThumbsDown int `json:"thumbs_down"`
 }
 
 type AIAgentType string
+
+const (
+	AIAgentTypeCodex  AIAgentType = "codex"
+	AIAgentTypeClaude AIAgentType = "claude"
+	AIAgentTypeOpenAI AIAgentType = "openai"
+	AIAgentTypeReplay AIAgentType = "replay"
+)
+
+// AIAgentTypes are the agents a review can run with, Validate accepts no others.
+var AIAgentTypes = []AIAgentType{AIAgentTypeCodex, AIAgentTypeClaude, AIAgentTypeOpenAI, AIAgentTypeReplay}
+
 type VersionControlType string
 type VCSProviderType string
+
+const (
+	VCSProviderTypeGitlab  VCSProviderType = "gitlab"
+	VCSProviderTypeGithub  VCSProviderType = "github"
+	VCSProviderTypeGitea   VCSProviderType = "gitea"
+	VCSProviderTypeUnknown VCSProviderType = "unknown"
+)
+
+// VCSProviderTypes are the providers gitex reviews pull requests on, the ones a configuration may name.
+var VCSProviderTypes = []VCSProviderType{VCSProviderTypeGithub, VCSProviderTypeGitlab, VCSProviderTypeGitea}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{VcsApiKey: "vcs", AiApiKey: "ai", AiModel: "model"}
+	}
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr []string
+	}{
+		{name: "valid codex config", modify: func(c *Config) {}},
+		{name: "valid replay config", modify: func(c *Config) {
+			*c = Config{VcsApiKey: "vcs", AiAgent: "replay", ReplayFile: "comments.json"}
+		}},
+		{name: "missing vcs key", modify: func(c *Config) { c.VcsApiKey = "" }, wantErr: []string{"vcs api key is required"}},
+		{name: "max comments per file", modify: func(c *Config) { c.MaxCommentsPerFile = 3 }},
+		{name: "max comments per file with checklist", modify: func(c *Config) { c.MaxCommentsPerFile, c.SummaryMode = 3, "checklist" },
+			wantErr: []string{"max comments per file has no effect in checklist summary mode"}},
+		{name: "own files only without clone", modify: func(c *Config) { c.OwnFilesOnly, c.NoClone = true, true },
+			wantErr: []string{"own files only reads CODEOWNERS from the clone"}},
+		{name: "dry run without ai key", modify: func(c *Config) { c.AiApiKey, c.DryRun = "", true }},
+		{name: "serve without vcs key", modify: func(c *Config) { c.VcsApiKey, c.Serve = "", true }},
+		{name: "pending file without serve", modify: func(c *Config) { c.PendingFile = "pending.jsonl" },
+			wantErr: []string{"pending file is only used in serve mode"}},
+		{name: "negative drain timeout", modify: func(c *Config) { c.Serve, c.DrainTimeout = true, -time.Second },
+			wantErr: []string{"drain timeout must not be negative"}},
+		{name: "negative clone timeout", modify: func(c *Config) { c.CloneTimeout = -time.Second },
+			wantErr: []string{"clone timeout must not be negative"}},
+		{name: "negative agent timeout", modify: func(c *Config) { c.AgentTimeout = -time.Second },
+			wantErr: []string{"agent timeout must not be negative"}},
+		{name: "negative api timeout", modify: func(c *Config) { c.ApiTimeout = -time.Second },
+			wantErr: []string{"api timeout must not be negative"}},
+		{name: "negative retry settings", modify: func(c *Config) { c.RetryMax, c.RetryWaitMin = -1, -time.Second },
+			wantErr: []string{"retry max must not be negative", "retry waits must not be negative"}},
+		{name: "retry wait min above max", modify: func(c *Config) { c.RetryWaitMin, c.RetryWaitMax = time.Minute, time.Second },
+			wantErr: []string{"retry wait min must not exceed retry wait max"}},
+		{name: "skip open threads with consolidated review", modify: func(c *Config) { c.SkipOpenThreads, c.ConsolidatedReview = true, true },
+			wantErr: []string{"skip open threads cannot be used with consolidated review, which resolves the previous run's threads"}},
+		{name: "negative post hook timeout", modify: func(c *Config) { c.PostHook, c.PostHookTimeout = "notify.sh", -time.Second },
+			wantErr: []string{"post hook timeout must not be negative"}},
+		{name: "post hook in serve mode", modify: func(c *Config) { c.PostHook, c.Serve = "notify.sh", true },
+			wantErr: []string{"post hook is not run in serve mode"}},
+		{name: "redaction with a clone", modify: func(c *Config) { c.RedactPatternsFile = "redact.txt" },
+			wantErr: []string{"redact patterns file needs no clone, serve or a diff file"}},
+		{name: "redaction without a clone", modify: func(c *Config) { c.RedactPatternsFile, c.NoClone = "redact.txt", true }},
+		{name: "output file with a diff file", modify: func(c *Config) { c.OutputFile, c.DiffFile = "out/review.json", "pr.diff" },
+			wantErr: []string{"output file is only written for pull request reviews"}},
+		{name: "max files with top files", modify: func(c *Config) { c.MaxFiles, c.TopFiles = 50, 10 },
+			wantErr: []string{"max files has no effect with top files"}},
+		{name: "unknown too many files handling", modify: func(c *Config) { c.MaxFiles, c.OnTooManyFiles = 50, "skip" },
+			wantErr: []string{`unsupported too many files handling "skip", use largest or abort`}},
+		{name: "run retries in serve mode", modify: func(c *Config) { c.RunRetries, c.Serve = 2, true },
+			wantErr: []string{"run retries has no effect in serve mode"}},
+		{name: "unsupported clone tags", modify: func(c *Config) { c.CloneTags = "following" },
+			wantErr: []string{`unsupported clone tags "following"`}},
+		{name: "unsupported git transport", modify: func(c *Config) { c.GitTransport = "git" },
+			wantErr: []string{`unsupported git transport "git"`}},
+		{name: "ssh key without ssh transport", modify: func(c *Config) { c.SSHKey = "~/.ssh/id_ed25519" },
+			wantErr: []string{"ssh key is only used with the ssh git transport"}},
+		{name: "linkify references with diff file", modify: func(c *Config) { c.LinkifyReferences, c.DiffFile = true, "pr.diff" },
+			wantErr: []string{"linkify references needs a pull request, serve and diff file have no repository to link to"}},
+		{name: "commits without a clone", modify: func(c *Config) { c.Commits, c.NoClone = []string{"abc123"}, true },
+			wantErr: []string{"commits are reviewed in a clone of their own range, they cannot be used with no clone or base tag"}},
+		{name: "commits in serve mode", modify: func(c *Config) { c.Commits, c.Serve = []string{"abc123"}, true },
+			wantErr: []string{"commits only narrow pull request reviews, not serve mode or a diff file"}},
+		{name: "ai model chain with claude", modify: func(c *Config) { c.AiAgent, c.AiModel, c.AiModelChain = "claude", "", []string{"a", "b"} },
+			wantErr: []string{"ai model chain is only supported by the codex agent"}},
+		{name: "ai model chain and another ai model", modify: func(c *Config) { c.AiModelChain = []string{"a", "b"} },
+			wantErr: []string{"ai model chain replaces ai model, set only one of them"}},
+		{name: "max diff bytes with diff file", modify: func(c *Config) { c.MaxDiffBytes, c.DiffFile = 1<<20, "pr.diff" },
+			wantErr: []string{"max diff bytes only limits pull request reviews, not serve mode or a diff file"}},
+		{name: "repo context in serve mode", modify: func(c *Config) { c.RepoContext, c.Serve = 4096, true },
+			wantErr: []string{"repo context is built from the checkout, which serve mode and a diff file have not"}},
+		{name: "single comment mode with inline summary", modify: func(c *Config) { c.SingleCommentMode, c.SummaryMode = true, "inline" },
+			wantErr: []string{"single comment mode posts the checklist, it cannot be used with the inline summary mode"}},
+		{name: "single comment mode with consolidated review", modify: func(c *Config) { c.SingleCommentMode, c.ConsolidatedReview = true, true },
+			wantErr: []string{"consolidated review has no effect in checklist summary mode"}},
+		{name: "unsupported diff algorithm", modify: func(c *Config) { c.DiffAlgorithm = "word" },
+			wantErr: []string{`unsupported diff algorithm "word"`}},
+		{name: "openai agent with another diff algorithm", modify: func(c *Config) { c.AiAgent, c.DiffAlgorithm = "openai", "patience" },
+			wantErr: []string{`diff algorithm "patience" is not supported by the openai agent, it only diffs with myers`}},
+		{name: "malformed ai env", modify: func(c *Config) { c.AiEnv = []string{"HTTPS_PROXY=http://proxy", "DEBUG", "=1"} },
+			wantErr: []string{`ai env "DEBUG" must be KEY=VALUE`, `ai env "=1" must be KEY=VALUE`}},
+		{name: "ai env overriding codex home", modify: func(c *Config) { c.AiEnv = []string{"CODEX_HOME=/tmp/codex"} },
+			wantErr: []string{"ai env cannot set CODEX_HOME, use -codex-home"}},
+		{name: "negative min diff lines", modify: func(c *Config) { c.MinDiffLines = -1 },
+			wantErr: []string{"min diff lines must not be negative"}},
+		{name: "diff file in serve mode", modify: func(c *Config) { c.DiffFile = "pr.diff"; c.Serve = true },
+			wantErr: []string{"diff file cannot be used with serve mode"}},
+		{name: "head sha without diff file", modify: func(c *Config) { c.HeadSha = "abc" },
+			wantErr: []string{"base and head sha are only used with a diff file"}},
+		{name: "multi-line ignore marker", modify: func(c *Config) { c.IgnoreMarker = "gitex:\nignore" },
+			wantErr: []string{"ignore marker must be a single line"}},
+		{name: "unsupported tone", modify: func(c *Config) { c.Tone = "sarcastic" },
+			wantErr: []string{`unsupported tone "sarcastic"`}},
+		{name: "files with top files", modify: func(c *Config) { c.Files = []string{"a.go"}; c.TopFiles = 2 },
+			wantErr: []string{"top files has no effect when the files to review are named"}},
+		{name: "files in serve mode", modify: func(c *Config) { c.Files = []string{"a.go"}; c.Serve = true },
+			wantErr: []string{"files only narrow pull request reviews"}},
+		{name: "include hunk in checklist mode", modify: func(c *Config) { c.IncludeHunk = true; c.SummaryMode = "checklist" },
+			wantErr: []string{"include hunk has no effect in checklist summary mode"}},
+		{name: "unsupported vcs provider", modify: func(c *Config) { c.VcsProvider = "bitbucket"; c.VcsRemoteUrl = "https://git.example.com" },
+			wantErr: []string{`unsupported vcs provider "bitbucket", use github, gitlab or gitea`}},
+		{name: "vcs provider without vcs url", modify: func(c *Config) { c.VcsProvider = "gitea" },
+			wantErr: []string{"vcs provider names the provider at the vcs url"}},
+		{name: "missing ai key and model", modify: func(c *Config) { c.AiApiKey, c.AiModel = "", "" },
+			wantErr: []string{"ai api key is required", "ai model is required"}},
+		{name: "claude without ai key", modify: func(c *Config) { c.AiAgent, c.AiApiKey = "claude", "" },
+			wantErr: []string{"ai api key is required"}},
+		{name: "replay without file", modify: func(c *Config) { c.AiAgent = "replay" },
+			wantErr: []string{"replay agent requires a replay file"}},
+		{name: "replay file with codex", modify: func(c *Config) { c.ReplayFile = "comments.json" },
+			wantErr: []string{"replay file is only used by the replay agent"}},
+		{name: "unknown agent", modify: func(c *Config) { c.AiAgent = "gpt" }, wantErr: []string{`unsupported ai agent "gpt", use codex, claude, openai or replay`}},
+		{name: "generated patterns with review generated", modify: func(c *Config) {
+			c.ReviewGenerated = true
+			c.GeneratedPatterns = []string{"gen/"}
+		}, wantErr: []string{"generated patterns have no effect"}},
+		{name: "negative numbers", modify: func(c *Config) {
+			c.RequestsPerSecond = -1
+			c.CommentConcurrency = -1
+			c.CommentRetries = -1
+			c.DiffContext = -1
+			c.MinHunkLines = -1
+			c.CloneRetries = -1
+			c.RunRetries = -1
+			c.CloneDepth = -1
+			c.MaxCommentsPerFile = -1
+			c.MaxFiles = -1
+			c.MaxDiffBytes = -1
+			c.RepoContext = -1
+		}, wantErr: []string{"requests per second", "comment concurrency", "comment retries", "diff context", "min hunk lines", "clone retries", "run retries", "clone depth", "max comments per file", "max files", "max diff bytes", "repo context"}},
+		{name: "unknown output format", modify: func(c *Config) { c.OutputFormat = "sarif" },
+			wantErr: []string{`unsupported output format "sarif"`}},
+		{name: "several labels", modify: func(c *Config) { c.ApplyLabel = "reviewed,ai" },
+			wantErr: []string{"apply label must be a single label"}},
+		{name: "negative line offset tolerance", modify: func(c *Config) { c.LineOffsetTolerance = -1 },
+			wantErr: []string{"line offset tolerance must not be negative"}},
+		{name: "partial on timeout with serve", modify: func(c *Config) { c.UsePartialOnTimeout, c.Serve = true, true },
+			wantErr: []string{"use partial on timeout has no effect in serve mode"}},
+		{name: "unknown cross-hunk handling", modify: func(c *Config) { c.OnCrossHunk = "merge" },
+			wantErr: []string{`unsupported cross-hunk handling "merge"`}},
+		{name: "base tag without clone", modify: func(c *Config) { c.BaseTag, c.NoClone = "v1.2.3", true },
+			wantErr: []string{"base tag needs a clone"}},
+		{name: "unknown clone fallback", modify: func(c *Config) { c.CloneFallback = "tag" },
+			wantErr: []string{`unsupported clone fallback "tag"`}},
+		{name: "unknown summary mode", modify: func(c *Config) { c.SummaryMode = "digest" },
+			wantErr: []string{`unsupported summary mode "digest"`}},
+		{name: "checklist with consolidated review", modify: func(c *Config) {
+			c.SummaryMode = "checklist"
+			c.ConsolidatedReview = true
+		}, wantErr: []string{"consolidated review has no effect in checklist summary mode"}},
+		{name: "line match threshold above 1", modify: func(c *Config) { c.LineMatchThreshold = 1.5 },
+			wantErr: []string{"line match threshold must be between 0 and 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_Names(t *testing.T) {
+	for _, agent := range AIAgentTypes {
+		c := &Config{VcsApiKey: "vcs", AiApiKey: "ai", AiModel: "model", AiAgent: string(agent), ReplayFile: "comments.json"}
+		if agent != AIAgentTypeReplay {
+			c.ReplayFile = ""
+		}
+		if err := c.Validate(); err != nil {
+			t.Errorf("agent %s: unexpected error: %v", agent, err)
+		}
+	}
+	for _, provider := range VCSProviderTypes {
+		c := &Config{VcsApiKey: "vcs", AiApiKey: "ai", AiModel: "model", VcsProvider: string(provider), VcsRemoteUrl: "https://git.example.com"}
+		if err := c.Validate(); err != nil {
+			t.Errorf("provider %s: unexpected error: %v", provider, err)
+		}
+	}
+}
+
+func TestPullRequestInfo_ChangedFilesTable(t *testing.T) {
+	if got := (&PullRequestInfo{}).ChangedFilesTable(); got != "" {
+		t.Errorf("table without files = %q, want empty", got)
+	}
+
+	info := &PullRequestInfo{ChangedFiles: []ChangedFile{{Path: "main.go", Added: 3, Removed: 1}}}
+	want := "| File | Added | Removed |\n|---|---:|---:|\n| `main.go` | +3 | -1 |\n\n"
+	if got := info.ChangedFilesTable(); got != want {
+		t.Errorf("table = %q, want %q", got, want)
+	}
+
+	info.ChangedFiles = make([]ChangedFile, maxChangedFilesRows+5)
+	got := info.ChangedFilesTable()
+	if rows := strings.Count(got, "\n| `"); rows != maxChangedFilesRows {
+		t.Errorf("table has %d file rows, want %d", rows, maxChangedFilesRows)
+	}
+	if !strings.Contains(got, "…and 5 more files") {
+		t.Errorf("table does not mention the left out files: %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+const claudeVersion = "2.0.76"
+
+// claudeReviewTools are the tools the review may use without asking: reading the checkout, running git to see the
+// changes, and writing the comments and summary files.
+const claudeReviewTools = "Read,Grep,Glob,Write,Bash(git diff:*),Bash(git log:*),Bash(git show:*)"
+
+// claudeReadOnlyTools are the tools of a review that must not change anything.
+const claudeReadOnlyTools = "Read,Grep,Glob,Bash(git diff:*),Bash(git log:*),Bash(git show:*)"
+
+// ClaudeService reviews with the Claude Code CLI. It gets the same prompts as codex and writes the same comments
+// file, the API key is passed in the environment so there is no login.
+type ClaudeService struct {
+	cfg           *api.Config
+	claudeBinPath string
+	env           []string
+	commandRunner func(ctx context.Context, name string, args ...string) *exec.Cmd
+}
+
+var _ api.AIAgentService = (*ClaudeService)(nil)
+var _ api.DescriptionReviewer = (*ClaudeService)(nil)
+
+func NewClaudeService(cfg *api.Config) (*ClaudeService, error) {
+	return NewClaudeServiceWithContext(context.Background(), cfg)
+}
+
+// NewClaudeServiceWithContext is NewClaudeService with a context that cancels the claude install.
+func NewClaudeServiceWithContext(ctx context.Context, cfg *api.Config) (*ClaudeService, error) {
+	if err := util.EnsureDirectoryWritable(cfg.BinDir); err != nil {
+		return nil, fmt.Errorf("bin directory error: %w", err)
+	}
+
+	claudeConfigPath := path.Join(cfg.HomeDir, ".claude")
+	if err := util.EnsureDirectoryWritable(claudeConfigPath); err != nil {
+		return nil, fmt.Errorf("claude config directory error: %w", err)
+	}
+
+	if !isPackageInstalled(cfg.BinDir, "@anthropic-ai/claude-code", claudeVersion) {
+		ctx, cancelFunc := context.WithTimeout(ctx, time.Minute)
+		defer cancelFunc()
+
+		command := exec.CommandContext(ctx, "npm", "i", "@anthropic-ai/claude-code@"+claudeVersion, "--prefix", cfg.BinDir)
+		if err := command.Run(); err != nil {
+			return nil, fmt.Errorf("claude install error: %w", err)
+		}
+	}
+
+	return &ClaudeService{
+		cfg:           cfg,
+		claudeBinPath: path.Join(cfg.BinDir, "/node_modules/.bin/claude"),
+		env:           claudeEnv(cfg, claudeConfigPath),
+		commandRunner: exec.CommandContext,
+	}, nil
+}
+
+// claudeEnv is the environment of the claude subprocess: ours, the -ai-env additions, then its own config directory,
+// kept apart from the user's, and the API key, which exec gives precedence over earlier duplicates.
+func claudeEnv(cfg *api.Config, configDir string) []string {
+	environment := os.Environ()
+	environment = append(environment, cfg.AiEnv...)
+	return append(environment, "CLAUDE_CONFIG_DIR="+configDir, "ANTHROPIC_API_KEY="+cfg.AiApiKey)
+}
+
+func (c *ClaudeService) GeneratePRInlineComments(options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+	return c.GeneratePRInlineCommentsWithContext(context.Background(), options)
+}
+
+func (c *ClaudeService) GeneratePRInlineCommentsWithContext(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+	commentsFilePath := filepath.Join(options.SandBoxDir, commentsFileName)
+	defer func() {
+		_ = os.Remove(commentsFilePath)
+	}()
+
+	cmd := c.commandRunner(
+		ctx,
+		c.claudeBinPath,
+		"-p", inlineCommentsPrompt(c.cfg, options, commentsFilePath),
+		"--model", c.cfg.AiModel,
+		"--output-format", "text",
+		"--permission-mode", "acceptEdits",
+		"--allowedTools", claudeReviewTools,
+	)
+	var lastMessage bytes.Buffer
+	cmd.Env = c.env
+	cmd.Dir = options.SandBoxDir
+	c.attachOutput(cmd, &lastMessage)
+
+	err := cmd.Run()
+	if err != nil && options.KeepPartial && ctx.Err() != nil {
+		return partialComments(ctx, commentsFilePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating PR inline-comments: %w", err)
+	}
+	return readComments(commentsFilePath, options.SandBoxDir, options.SubPath, func() {
+		warnEmptyOutput("claude", lastMessage.String())
+	})
+}
+
+// ReviewDescriptionWithContext asks claude whether the pull request title and description match the changes and
+// whether a changelog entry is missing. It returns the review as markdown.
+func (c *ClaudeService) ReviewDescriptionWithContext(ctx context.Context, options *api.ReviewDescriptionOptions) (string, error) {
+	descriptionPath := filepath.Join(options.SandBoxDir, descriptionFileName)
+	defer func() {
+		_ = os.Remove(descriptionPath)
+	}()
+	description := fmt.Sprintf("Title: %s\n\n%s\n", options.Title, options.Description)
+	if err := os.WriteFile(descriptionPath, []byte(description), 0600); err != nil {
+		return "", fmt.Errorf("error writing description file: %w", err)
+	}
+
+	cmd := c.commandRunner(
+		ctx,
+		c.claudeBinPath,
+		"-p", descriptionPrompt(c.cfg, options, descriptionPath),
+		"--model", c.cfg.AiModel,
+		"--output-format", "text",
+		"--allowedTools", claudeReadOnlyTools,
+	)
+	var review bytes.Buffer
+	cmd.Env = c.env
+	cmd.Dir = options.SandBoxDir
+	c.attachOutput(cmd, &review)
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error reviewing PR description: %w", err)
+	}
+	text := strings.TrimSpace(review.String())
+	if text == "" {
+		return "", errors.New("claude finished without a description review")
+	}
+	return text, nil
+}
+
+// attachOutput collects the final message claude prints into lastMessage. When verbose it is shown as well, on
+// stderr in serve mode where stdout carries the protocol, together with claude's stderr.
+func (c *ClaudeService) attachOutput(cmd *exec.Cmd, lastMessage *bytes.Buffer) {
+	cmd.Stdout = lastMessage
+	cmd.Stderr = nil
+	if !c.cfg.Verbose {
+		return
+	}
+	var shown io.Writer = os.Stdout
+	if c.cfg.Serve {
+		shown = os.Stderr
+	}
+	cmd.Stdout = io.MultiWriter(lastMessage, shown)
+	cmd.Stderr = os.Stderr
+}
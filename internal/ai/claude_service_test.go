@@ -0,0 +1,171 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// newTestClaudeService creates a ClaudeService for testing without running npm install
+func newTestClaudeService(cfg *api.Config) *ClaudeService {
+	return &ClaudeService{
+		cfg:           cfg,
+		claudeBinPath: "claude",
+		env:           claudeEnv(cfg, "/tmp/claude-config"),
+		commandRunner: exec.CommandContext,
+	}
+}
+
+func TestClaudeEnv(t *testing.T) {
+	cfg := &api.Config{AiApiKey: "sk-ant", AiEnv: []string{"ANTHROPIC_API_KEY=ignored", "HTTPS_PROXY=http://proxy:3128"}}
+
+	cmd := exec.Command("sh", "-c", "echo $ANTHROPIC_API_KEY $CLAUDE_CONFIG_DIR $HTTPS_PROXY")
+	cmd.Env = claudeEnv(cfg, "/home/user/.gitex/.claude")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "sk-ant /home/user/.gitex/.claude http://proxy:3128" {
+		t.Errorf("env = %q", got)
+	}
+}
+
+func TestClaudeService_GeneratePRInlineComments(t *testing.T) {
+	t.Run("reads the comments file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		commentsFilePath := filepath.Join(tmpDir, commentsFileName)
+		commentsData, _ := json.Marshal([]*api.InlineComment{
+			{Body: util.Ptr("Test comment"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(3))}},
+		})
+
+		var gotName string
+		var gotArgs []string
+		svc := newTestClaudeService(&api.Config{AiModel: "claude-test"})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			gotName, gotArgs = name, args
+			return exec.Command("sh", "-c", "echo '"+string(commentsData)+"' > "+commentsFilePath)
+		}
+
+		comments, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{
+			BaseSha: "base123", HeadSha: "head123", SandBoxDir: tmpDir,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(comments) != 1 || *comments[0].Body != "Test comment" {
+			t.Errorf("comments = %+v", comments)
+		}
+		if gotName != "claude" {
+			t.Errorf("command = %q, want claude", gotName)
+		}
+		if i := slices.Index(gotArgs, "--model"); i < 0 || gotArgs[i+1] != "claude-test" {
+			t.Errorf("args = %v, want --model claude-test", gotArgs)
+		}
+		if i := slices.Index(gotArgs, "-p"); i < 0 || !strings.Contains(gotArgs[i+1], commentsFilePath) || !strings.Contains(gotArgs[i+1], "head123") {
+			t.Errorf("prompt does not name the comments file and head sha: %v", gotArgs)
+		}
+		if _, err := os.Stat(commentsFilePath); !os.IsNotExist(err) {
+			t.Error("expected the comments file to be removed")
+		}
+	})
+
+	t.Run("no comments file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		svc := newTestClaudeService(&api.Config{AiModel: "claude-test"})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			return exec.Command("sh", "-c", "echo 'nothing to report'")
+		}
+
+		comments, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{SandBoxDir: tmpDir})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(comments) != 0 {
+			t.Errorf("expected no comments, got %d", len(comments))
+		}
+	})
+
+	t.Run("command fails", func(t *testing.T) {
+		svc := newTestClaudeService(&api.Config{AiModel: "claude-test"})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			return exec.Command("sh", "-c", "exit 1")
+		}
+
+		_, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{SandBoxDir: t.TempDir()})
+		if err == nil || !strings.Contains(err.Error(), "error generating PR inline-comments") {
+			t.Errorf("expected a generation error, got %v", err)
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		commentsFilePath := filepath.Join(tmpDir, commentsFileName)
+		svc := newTestClaudeService(&api.Config{AiModel: "claude-test"})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			return exec.Command("sh", "-c", "echo 'not json' > "+commentsFilePath)
+		}
+
+		_, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{SandBoxDir: tmpDir})
+		if err == nil || !strings.Contains(err.Error(), "error unmarshaling comments file") {
+			t.Errorf("expected an unmarshal error, got %v", err)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		svc := newTestClaudeService(&api.Config{AiModel: "claude-test"})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			return exec.CommandContext(ctx, "sleep", "10")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := svc.GeneratePRInlineCommentsWithContext(ctx, &api.GeneratePRInlineCommentsOptions{SandBoxDir: t.TempDir()})
+		if err == nil {
+			t.Error("expected an error for a cancelled context")
+		}
+	})
+}
+
+func TestClaudeService_ReviewDescriptionWithContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	var description string
+	var gotArgs []string
+	svc := newTestClaudeService(&api.Config{AiModel: "claude-test"})
+	svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		gotArgs = args
+		data, _ := os.ReadFile(filepath.Join(tmpDir, descriptionFileName))
+		description = string(data)
+		return exec.Command("sh", "-c", "echo '  - Mention the new flag.  '")
+	}
+
+	review, err := svc.ReviewDescriptionWithContext(context.Background(), &api.ReviewDescriptionOptions{
+		SandBoxDir: tmpDir, BaseSha: "base", Title: "Add flag", Description: "Adds it.",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if review != "- Mention the new flag." {
+		t.Errorf("review = %q", review)
+	}
+	if description != "Title: Add flag\n\nAdds it.\n" {
+		t.Errorf("description file = %q", description)
+	}
+	if i := slices.Index(gotArgs, "--allowedTools"); i < 0 || strings.Contains(gotArgs[i+1], "Write") {
+		t.Errorf("description review must not be allowed to write: %v", gotArgs)
+	}
+
+	svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		return exec.Command("true")
+	}
+	if _, err := svc.ReviewDescriptionWithContext(context.Background(), &api.ReviewDescriptionOptions{SandBoxDir: tmpDir}); err == nil {
+		t.Error("expected an error for an empty review")
+	}
+}
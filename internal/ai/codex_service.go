@@ -1,12 +1,14 @@
 package ai
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/eridan-ltu/gitex/api"
 	"github.com/eridan-ltu/gitex/internal/util"
+	"io"
 	"os"
 	"os/exec"
 	"path"
@@ -16,12 +18,31 @@ import (
 )
 
 const (
-	commentsFileName = "comments.codex"
-	codexVersion     = "0.87.0"
+	commentsFileName    = "comments.codex"
+	lastMessageFileName = "last-message.codex"
 )
 
-func isCodexInstalled(binDir string) bool {
-	packageJsonPath := path.Join(binDir, "node_modules", "@openai", "codex", "package.json")
+// DefaultCodexVersion is the @openai/codex release installed when -codex-version does not pin another one.
+const DefaultCodexVersion = "0.87.0"
+
+// SummaryFileName is the plain text review summary codex writes next to the comments, relative to the sandbox.
+const SummaryFileName = "review.codex"
+
+func isCodexInstalled(binDir, version string) bool {
+	return isPackageInstalled(binDir, "@openai/codex", version)
+}
+
+// codexVersion returns the codex release the config pins, DefaultCodexVersion when it pins none.
+func codexVersion(cfg *api.Config) string {
+	if cfg.CodexVersion != "" {
+		return cfg.CodexVersion
+	}
+	return DefaultCodexVersion
+}
+
+// isPackageInstalled reports whether version of the npm package pkg is installed under binDir.
+func isPackageInstalled(binDir, pkgName, version string) bool {
+	packageJsonPath := path.Join(binDir, "node_modules", pkgName, "package.json")
 
 	data, err := os.ReadFile(packageJsonPath)
 	if err != nil {
@@ -35,7 +56,7 @@ func isCodexInstalled(binDir string) bool {
 		return false
 	}
 
-	return pkg.Version == codexVersion
+	return pkg.Version == version
 }
 
 type CodexService struct {
@@ -45,41 +66,65 @@ type CodexService struct {
 	commandRunner func(ctx context.Context, name string, args ...string) *exec.Cmd
 	loginRunner   func(ctx context.Context, apiKey, codexBinPath *string, env []string) error
 	logoutRunner  func(ctx context.Context, codexBinPath *string, env []string) error
+	// session is set while a StartSession login is active, reviews then reuse it instead of logging in themselves
+	session bool
 }
 
+var _ api.AIAgentService = (*CodexService)(nil)
+var _ api.SessionAgent = (*CodexService)(nil)
+
 func NewCodexService(cfg *api.Config) (*CodexService, error) {
+	return NewCodexServiceWithContext(context.Background(), cfg)
+}
+
+// NewCodexServiceWithContext is NewCodexService with a context that cancels the codex install.
+func NewCodexServiceWithContext(ctx context.Context, cfg *api.Config) (*CodexService, error) {
 	if err := util.EnsureDirectoryWritable(cfg.BinDir); err != nil {
 		return nil, fmt.Errorf("bin directory error: %w", err)
 	}
 
-	codexHomePath := path.Join(cfg.HomeDir, ".codex")
+	codexHomePath := codexHomeDir(cfg)
 	if err := util.EnsureDirectoryWritable(codexHomePath); err != nil {
 		return nil, fmt.Errorf("codex home directory error: %w", err)
 	}
 
-	if !isCodexInstalled(cfg.BinDir) {
-		ctx, cancelFunc := context.WithTimeout(context.Background(), time.Minute)
+	version := codexVersion(cfg)
+	if !isCodexInstalled(cfg.BinDir, version) {
+		ctx, cancelFunc := context.WithTimeout(ctx, time.Minute)
 		defer cancelFunc()
 
-		if err := defaultInstallRunner(ctx, &cfg.BinDir); err != nil {
+		if err := defaultInstallRunner(ctx, &cfg.BinDir, version); err != nil {
 			return nil, fmt.Errorf("codex install error: %w", err)
 		}
 	}
 
 	binPath := path.Join(cfg.BinDir, "/node_modules/.bin/codex")
-	environment := os.Environ()
-	environment = append(environment, "CODEX_HOME="+codexHomePath)
-
 	return &CodexService{
 		cfg:           cfg,
 		codexBinPath:  binPath,
-		env:           environment,
+		env:           codexEnv(cfg, codexHomePath),
 		commandRunner: exec.CommandContext,
 		loginRunner:   defaultLoginRunner,
 		logoutRunner:  defaultLogoutRunner,
 	}, nil
 }
 
+// codexHomeDir returns the CODEX_HOME used for the codex subprocess, isolated from the user's own codex config.
+func codexHomeDir(cfg *api.Config) string {
+	if cfg.CodexHome != "" {
+		return cfg.CodexHome
+	}
+	return path.Join(cfg.HomeDir, ".codex")
+}
+
+// codexEnv is the environment of the codex subprocess: ours, the -ai-env additions, and CODEX_HOME last, which exec
+// gives precedence over earlier duplicates.
+func codexEnv(cfg *api.Config, codexHome string) []string {
+	environment := os.Environ()
+	environment = append(environment, cfg.AiEnv...)
+	return append(environment, "CODEX_HOME="+codexHome)
+}
+
 func defaultLoginRunner(ctx context.Context, apiKey, codexBinPath *string, env []string) error {
 	loginCmd := exec.CommandContext(ctx, *codexBinPath, "login", "--with-api-key")
 	loginCmd.Stdin = strings.NewReader(*apiKey)
@@ -94,232 +139,117 @@ func defaultLogoutRunner(ctx context.Context, codexBinPath *string, env []string
 	return logoutCmd.Run()
 }
 
-func defaultInstallRunner(ctx context.Context, binDir *string) error {
-	command := exec.CommandContext(ctx, "npm", "i", "@openai/codex@"+codexVersion, "--prefix", *binDir)
+func defaultInstallRunner(ctx context.Context, binDir *string, version string) error {
+	command := exec.CommandContext(ctx, "npm", "i", "@openai/codex@"+version, "--prefix", *binDir)
 	return command.Run()
 }
 
+// StartSession logs codex in once for all following reviews until EndSession.
+func (c *CodexService) StartSession(ctx context.Context) error {
+	if err := c.loginRunner(ctx, &c.cfg.AiApiKey, &c.codexBinPath, c.env); err != nil {
+		return fmt.Errorf("codex login failed: %w", err)
+	}
+	c.session = true
+	return nil
+}
+
+// EndSession logs out the login made by StartSession.
+func (c *CodexService) EndSession(ctx context.Context) error {
+	if !c.session {
+		return nil
+	}
+	c.session = false
+	if err := c.logoutRunner(ctx, &c.codexBinPath, c.env); err != nil {
+		return fmt.Errorf("codex logout failed: %w", err)
+	}
+	return nil
+}
+
 func (c *CodexService) GeneratePRInlineComments(options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
 	return c.GeneratePRInlineCommentsWithContext(context.Background(), options)
 }
 
 func (c *CodexService) GeneratePRInlineCommentsWithContext(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
 
+	// codex resolves relative paths against its own --cd root, so hand it the exact file location
+	commentsFilePath := filepath.Join(options.SandBoxDir, commentsFileName)
+	lastMessagePath := filepath.Join(options.SandBoxDir, lastMessageFileName)
 	defer func() {
-		commentsFilePath := filepath.Join(options.SandBoxDir, commentsFileName)
 		_ = os.Remove(commentsFilePath)
+		_ = os.Remove(lastMessagePath)
 	}()
 
-	if err := c.loginRunner(ctx, &c.cfg.AiApiKey, &c.codexBinPath, c.env); err != nil {
-		return nil, fmt.Errorf("codex login failed: %w", err)
+	if !c.session {
+		if err := c.loginRunner(ctx, &c.cfg.AiApiKey, &c.codexBinPath, c.env); err != nil {
+			return nil, fmt.Errorf("codex login failed: %w", err)
+		}
+
+		defer func() {
+			_ = c.logoutRunner(ctx, &c.codexBinPath, c.env)
+		}()
 	}
 
-	defer func() {
-		_ = c.logoutRunner(ctx, &c.codexBinPath, c.env)
-	}()
+	args := []string{"exec", "--cd", options.SandBoxDir}
+	if options.DiffFile != "" {
+		// codex refuses to run outside a git repo
+		args = append(args, "--skip-git-repo-check")
+	}
 
-	cmd := c.commandRunner(
-		ctx,
-		c.codexBinPath,
-		"exec",
-		"-s", "workspace-write",
-		"--model", c.cfg.AiModel,
-		fmt.Sprintf(`
-			You are an AI code reviewer. You need to git diff %s..HEAD. You need to analyze the diff and to generate inline comments strictly in the following JSON format:
-
-				RULES:
-				
-				ABSOLUTE CONSTRAINTS (MUST FOLLOW)
-				- You may ONLY reference line numbers that explicitly appear in the diff hunks
-				- Line numbers come only from @@ -<old>,<count> +<new>,<count> @@
-				- You must compute per-line numbers by incrementing from the hunk header
-				- If a line number cannot be derived with certainty, DO NOT COMMENT
-				- DO NOT GUESS OR INFER LINE NUMBERS
-				- Do NOT assume continuity across hunks
-				- Do NOT reuse numbers from examples
-				- Do NOT comment on context outside the diff
-				- If you cannot place a valid comment with exact line numbers, SKIP it
-				
-				Single-line comments:
-				- Omit position[line_range].
-				- Include both old_path and new_path.
-				- Added line: use position[new_line] only, omit old_line.
-				- Removed line: use position[old_line] only, omit new_line.
-				- Unchanged line: include both old_line and new_line, using diff-provided line numbers.
-                - ***Do not guess; line numbers may differ due to previous changes. ***
-				- Set comment_type = SINGLE_LINE.
-				- Set line_type = ADD, REMOVE, or UNCHANGED.
-				
-                Multi-line comments:
-				- Use position[line_range] to indicate the start and end of the comment.
-				- Line numbers in start and end follow the same rules as single-line comments:
-				- Added lines: fill only new_line
-				- Removed lines: fill only old_line
-				- Unchanged lines: fill both old_line and new_line
-				- line_type = ADD, REMOVE, or UNCHANGED depending on the type of lines being commented.
-                - Set comment_type = MULTI_LINE.
-				
-				Content
-				- Comment only on lines present in the diff.
-				- Each comment should be a meaningful suggestion, improvement, or note.
-				- Always reference the exact line numbers from the diff. Never guess the lines
-				
-				Output
-				- JSON must follow this schema:
-				
-				[{
-				  "body": "<YOUR_COMMENT>",
-				  "commit_id": "%s",
-				  "position": {
-					"position_type": "text",
-					"base_sha": "%s",
-					"start_sha": "%s",
-					"head_sha": "%s",
-					"old_path": "<OLD_FILE_PATH>",
-					"new_path": "<NEW_FILE_PATH>",
-					"new_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_NEW_LINE>,
-					"old_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_OLD_LINE>,
-					"line_range": {
-					  "start": {
-						"new_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_NEW_LINE>,
-						"old_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_OLD_LINE>
-					  },
-					  "end": {
-						"new_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_NEW_LINE>,
-						"old_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_OLD_LINE>
-					  }
-					},
-					"comment_type": "SINGLE_LINE" | "MULTI_LINE",
-					"line_type": "ADD"|"REMOVE"|"UNCHANGED"
-				  }
-				}]
-				
-				Examples
-				1. Single-line added
-					@@ -41,3 +41,4 @@
-					 func add(a int, b int) int {
-					-    return a - b
-					+    return a + b
-					}
-				[{
-				  "body": "Corrected addition here.",
-				  "commit_id": "commitId",
-				  "position": {
-					"position_type": "text",
-					"base_sha": "baseSha",
-					"start_sha": "startSha",
-					"head_sha": "headSha",
-					"old_path": "math.go",
-					"new_path": "math.go",
-					"new_line": 42,
-					"comment_type": "SINGLE_LINE",
-					"line_type": "ADD"
-				  }
-				}]
-				
-				2. Single-line removed
-					@@ -40,5 +40,4 @@
-					 func add(a int, b int) int {
-					-    return a - b
-					+    return a + b
-					}
-				[{
-				  "body": "This line was incorrectly subtracting.",
-				  "commit_id": "commitId",
-				  "position": {
-					"position_type": "text",
-					"base_sha": "baseSha",
-					"start_sha": "startSha",
-					"head_sha": "headSha",
-					"old_path": "math.go",
-					"new_path": "math.go",
-					"old_line": 42,
-					"comment_type": "SINGLE_LINE",
-					"line_type": "REMOVE"
-				  }
-				}]
-				
-				3. Single-line unchanged
-
-					@@ -30,6 +30,8 @@
-					func multiply(a int, b int) int {
-						 result := a * b
-					+    fmt.Println("Debug start")   # line 34 in old file? added in new file
-					+    log.Println("Debug info")    # line 35 in new file
-						 return a / b
-					}
-
-				[{
-				  "body": "This line is unchanged but review for debug code.",
-				  "commit_id": "commitId",
-				  "position": {
-					"position_type": "text",
-					"base_sha": "baseSha",
-					"start_sha": "startSha",
-					"head_sha": "headSha",
-					"old_path": "math.go",
-					"new_path": "math.go",
-					"old_line": 34,
-					"new_line": 36,
-					"comment_type": "SINGLE_LINE",
-					"line_type": "UNCHANGED"
-				  }
-				}]
-				
-				4. Multi-line added
-
-					@@ -11,2 +11,5 @@
-					-    result := a * b
-					-    return result
-					+    result := a * b
-					+    if result < 0 {
-					+        result = 0
-					+    }
-					+    return result
-
-				[{
-				  "body": "Adding a guard for negative results; review logic.",
-				  "commit_id": "commitId",
-				  "position": {
-					"position_type": "text",
-					"base_sha": "baseSha",
-					"start_sha": "startSha",
-					"head_sha": "headSha",
-					"old_path": "math.go",
-					"new_path": "math.go",
-					"line_range": {
-					  "start": { "new_line": 11 },
-					  "end": { "new_line": 14 }
-					},
-					"comment_type": "MULTI_LINE",
-					"line_type": "ADD"
-				  }
-				}]
-			verify json validity(escape special characters).
-	        store json inside %s commentsFile.
-	        4. Generate summary review inside review.codex commentsFile as plain text.
-	        5. In the summary do not include the findings you specified in the inline comments
-			6. DO NOT PUSH ANY CHANGES.
-			`, options.BaseSha, options.HeadSha, options.BaseSha, options.StartSha, options.HeadSha, commentsFileName),
-	)
-
-	cmd.Env = c.env
-	cmd.Dir = options.SandBoxDir
-
-	if c.cfg.Verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	} else {
-		cmd.Stdout = nil
-		cmd.Stderr = nil
+	prompt := inlineCommentsPrompt(c.cfg, options, commentsFilePath)
+	models := c.models()
+	for i, model := range models {
+		cmd := c.commandRunner(
+			ctx,
+			c.codexBinPath,
+			append(args,
+				"--output-last-message", lastMessagePath,
+				"-s", "workspace-write",
+				"--model", model,
+				prompt,
+			)...,
+		)
+
+		var stderr bytes.Buffer
+		cmd.Env = c.env
+		cmd.Dir = options.SandBoxDir
+		c.attachOutput(cmd, &stderr)
+
+		err := cmd.Run()
+		if err != nil && options.KeepPartial && ctx.Err() != nil {
+			return partialComments(ctx, commentsFilePath)
+		}
+		// a model that is down fails the same way for the rest of the review, the next one in the chain may not be
+		if err != nil && ctx.Err() == nil && i < len(models)-1 && modelUnavailable(stderr.String()) {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: model %s is unavailable, falling back to %s\n", model, models[i+1])
+			_ = os.Remove(commentsFilePath)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error generating PR inline-comments: %w", err)
+		}
+		if len(models) > 1 {
+			_, _ = fmt.Fprintf(os.Stderr, "Reviewed with model %s\n", model)
+		}
+		return readComments(commentsFilePath, options.SandBoxDir, options.SubPath, func() {
+			lastMessage, _ := os.ReadFile(lastMessagePath)
+			warnEmptyOutput("codex", string(lastMessage))
+		})
 	}
+	return nil, errors.New("no ai model to review with")
+}
 
-	err := cmd.Run()
-	if err != nil {
-		return nil, fmt.Errorf("error generating PR inline-comments: %w", err)
+// readComments parses the comments file the agent wrote. An agent that wrote no comments file found nothing, when it
+// did not write the summary either warnEmpty is called so the silent run can be told apart. Comments of a review
+// scoped to subPath that point at repository paths are dropped, see dropRepoPaths.
+func readComments(commentsFilePath, sandBoxDir, subPath string, warnEmpty func()) ([]*api.InlineComment, error) {
+	commentsFile, err := os.ReadFile(commentsFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(filepath.Join(sandBoxDir, SummaryFileName)); errors.Is(err, os.ErrNotExist) {
+			warnEmpty()
+		}
+		return []*api.InlineComment{}, nil
 	}
-	commentsFile, err := os.ReadFile(filepath.Join(options.SandBoxDir, commentsFileName))
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
+	if err != nil {
 		return nil, fmt.Errorf("error reading comments file: %w", err)
 	}
 
@@ -328,5 +258,60 @@ func (c *CodexService) GeneratePRInlineCommentsWithContext(ctx context.Context,
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling comments file: %w", err)
 	}
-	return comments, nil
+	return dropRepoPaths(comments, subPath, sandBoxDir), nil
+}
+
+// dropRepoPaths drops the comments of a review scoped to subPath whose paths the agent wrote relative to the
+// repository instead of the scope. They would be posted with the sub path prepended twice. A path that only looks
+// repository relative because the scope has a directory of the same name is kept when the file exists there.
+func dropRepoPaths(comments []*api.InlineComment, subPath, sandBoxDir string) []*api.InlineComment {
+	if subPath == "" {
+		return comments
+	}
+	repoRelative := func(p *string) bool {
+		if p == nil {
+			return false
+		}
+		scoped := strings.TrimPrefix(*p, "./")
+		if !strings.HasPrefix(scoped, subPath+"/") {
+			return false
+		}
+		_, err := os.Stat(filepath.Join(sandBoxDir, subPath, filepath.FromSlash(scoped)))
+		return errors.Is(err, os.ErrNotExist)
+	}
+
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		if comment != nil && comment.Position != nil && (repoRelative(comment.Position.NewPath) || repoRelative(comment.Position.OldPath)) {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: dropping a comment on %s, its path is relative to the repository instead of %s\n",
+				util.GetOrDefault(comment.Position.NewPath, util.GetOrDefault(comment.Position.OldPath, "unknown")), subPath)
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+// attachOutput collects the stderr of codex into stderr. When verbose what codex does is shown as well, on stderr in
+// serve mode where stdout carries the protocol.
+func (c *CodexService) attachOutput(cmd *exec.Cmd, stderr *bytes.Buffer) {
+	cmd.Stderr = stderr
+	if !c.cfg.Verbose {
+		cmd.Stdout = nil
+		return
+	}
+	cmd.Stdout = os.Stdout
+	if c.cfg.Serve {
+		cmd.Stdout = os.Stderr
+	}
+	cmd.Stderr = io.MultiWriter(stderr, os.Stderr)
+}
+
+// warnEmptyOutput reports an agent run that exited successfully without writing any output, with the model's last
+// message when there is one.
+func warnEmptyOutput(agent, lastMessage string) {
+	_, _ = fmt.Fprintf(os.Stderr, "Warning: %s finished without writing comments or a summary, treating the review as having no findings\n", agent)
+	if text := strings.TrimSpace(lastMessage); text != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "Last %s message: %s\n", agent, text)
+	}
 }
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -56,6 +57,75 @@ func TestNewCodexService(t *testing.T) {
 	}
 }
 
+func TestIsCodexInstalled(t *testing.T) {
+	binDir := t.TempDir()
+	if isCodexInstalled(binDir, DefaultCodexVersion) {
+		t.Error("expected codex to be missing from an empty bin dir")
+	}
+
+	pkgDir := filepath.Join(binDir, "node_modules", "@openai", "codex")
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		t.Fatalf("failed to create package dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(pkgDir, "package.json"), []byte(`{"name": "@openai/codex", "version": "0.90.1"}`), 0644); err != nil {
+		t.Fatalf("failed to write package.json: %v", err)
+	}
+
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{version: "0.90.1", want: true},
+		{version: DefaultCodexVersion, want: false},
+		{version: "0.90", want: false},
+	}
+	for _, tt := range tests {
+		if got := isCodexInstalled(binDir, tt.version); got != tt.want {
+			t.Errorf("isCodexInstalled(%s) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestCodexVersion(t *testing.T) {
+	if got := codexVersion(&api.Config{}); got != DefaultCodexVersion {
+		t.Errorf("codexVersion = %q, want %q", got, DefaultCodexVersion)
+	}
+	if got := codexVersion(&api.Config{CodexVersion: "0.90.1"}); got != "0.90.1" {
+		t.Errorf("codexVersion = %q, want 0.90.1", got)
+	}
+}
+
+func TestCodexHomeDir(t *testing.T) {
+	t.Run("defaults to home dir", func(t *testing.T) {
+		cfg := &api.Config{HomeDir: "/home/user/.gitex"}
+		if got := codexHomeDir(cfg); got != "/home/user/.gitex/.codex" {
+			t.Errorf("codexHomeDir() = %q, want %q", got, "/home/user/.gitex/.codex")
+		}
+	})
+
+	t.Run("override", func(t *testing.T) {
+		cfg := &api.Config{HomeDir: "/home/user/.gitex", CodexHome: "/tmp/job-42/codex"}
+		if got := codexHomeDir(cfg); got != "/tmp/job-42/codex" {
+			t.Errorf("codexHomeDir() = %q, want %q", got, "/tmp/job-42/codex")
+		}
+	})
+}
+
+func TestCodexEnv(t *testing.T) {
+	t.Setenv("GITEX_TEST_PROXY", "http://old")
+	cfg := &api.Config{AiEnv: []string{"GITEX_TEST_PROXY=http://proxy:3128", "CODEX_FLAG=on", "CODEX_HOME=/ignored"}}
+
+	cmd := exec.Command("sh", "-c", "echo $GITEX_TEST_PROXY $CODEX_FLAG $CODEX_HOME")
+	cmd.Env = codexEnv(cfg, "/tmp/codex-home")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "http://proxy:3128 on /tmp/codex-home" {
+		t.Errorf("environment = %q, want the -ai-env values and CODEX_HOME", got)
+	}
+}
+
 func TestCodexService_GeneratePRInlineComments(t *testing.T) {
 	mockLoginRunner := func(ctx context.Context, apiKey, codexBinPath *string, env []string) error {
 		return nil
@@ -303,7 +373,7 @@ func TestCodexService_GeneratePRInlineComments(t *testing.T) {
 		}
 	})
 
-	t.Run("successful when comments file does not exist", func(t *testing.T) {
+	t.Run("no findings when codex writes no output", func(t *testing.T) {
 		tmpDir := t.TempDir()
 
 		cfg := &api.Config{
@@ -314,9 +384,15 @@ func TestCodexService_GeneratePRInlineComments(t *testing.T) {
 		svc := newTestCodexService(cfg)
 		svc.loginRunner = mockLoginRunner
 		svc.logoutRunner = mockLogoutRunner
+		var lastMessagePath string
 		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
-			// Command succeeds but doesn't create file
-			return exec.Command("sh", "-c", "exit 0")
+			for i, arg := range args {
+				if arg == "--output-last-message" && i+1 < len(args) {
+					lastMessagePath = args[i+1]
+				}
+			}
+			// Command succeeds but only leaves its last message
+			return exec.Command("sh", "-c", "echo 'nothing to review' > "+lastMessagePath)
 		}
 
 		options := &api.GeneratePRInlineCommentsOptions{
@@ -326,13 +402,51 @@ func TestCodexService_GeneratePRInlineComments(t *testing.T) {
 			SandBoxDir: tmpDir,
 		}
 
-		_, err := svc.GeneratePRInlineComments(options)
+		comments, err := svc.GeneratePRInlineComments(options)
 
-		if err == nil {
-			t.Error("expected error when comments file doesn't exist")
+		if err != nil {
+			t.Fatalf("expected no error when codex writes no output, got: %v", err)
 		}
-		if !strings.Contains(err.Error(), "error unmarshaling comments file") {
-			t.Errorf("expected error message to contain 'error unmarshaling comments file', got: %v", err)
+		if len(comments) != 0 {
+			t.Errorf("expected no comments, got %d", len(comments))
+		}
+		if lastMessagePath != filepath.Join(tmpDir, lastMessageFileName) {
+			t.Errorf("expected last message in the sandbox, got %q", lastMessagePath)
+		}
+		if _, err := os.Stat(lastMessagePath); !os.IsNotExist(err) {
+			t.Error("expected last message file to be removed")
+		}
+	})
+
+	t.Run("no findings when codex only writes the summary", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		cfg := &api.Config{
+			AiModel: "test-model",
+			Verbose: false,
+		}
+
+		svc := newTestCodexService(cfg)
+		svc.loginRunner = mockLoginRunner
+		svc.logoutRunner = mockLogoutRunner
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			return exec.Command("sh", "-c", "echo 'Looks good.' > "+filepath.Join(tmpDir, SummaryFileName))
+		}
+
+		options := &api.GeneratePRInlineCommentsOptions{
+			BaseSha:    "base123",
+			StartSha:   "start123",
+			HeadSha:    "head123",
+			SandBoxDir: tmpDir,
+		}
+
+		comments, err := svc.GeneratePRInlineComments(options)
+
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if len(comments) != 0 {
+			t.Errorf("expected no comments, got %d", len(comments))
 		}
 	})
 }
@@ -480,6 +594,210 @@ func TestCodexService_GeneratePRInlineCommentsWithContext(t *testing.T) {
 		}
 	})
 
+	t.Run("sandbox is passed as codex working directory", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		var capturedArgs []string
+
+		svc := newTestCodexService(&api.Config{AiModel: "gpt-4"})
+		svc.loginRunner = mockLoginRunner
+		svc.logoutRunner = mockLogoutRunner
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			capturedArgs = args
+			return exec.Command("sh", "-c", "echo '[]' > "+filepath.Join(tmpDir, commentsFileName))
+		}
+
+		options := &api.GeneratePRInlineCommentsOptions{SandBoxDir: tmpDir}
+		if _, err := svc.GeneratePRInlineCommentsWithContext(context.Background(), options); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		cdIndex := -1
+		for i, arg := range capturedArgs {
+			if arg == "--cd" {
+				cdIndex = i
+			}
+		}
+		if cdIndex == -1 || cdIndex+1 >= len(capturedArgs) || capturedArgs[cdIndex+1] != tmpDir {
+			t.Errorf("expected '--cd %s' in arguments, got %v", tmpDir, capturedArgs)
+		}
+		prompt := capturedArgs[len(capturedArgs)-1]
+		if !strings.Contains(prompt, filepath.Join(tmpDir, commentsFileName)) {
+			t.Error("expected prompt to reference the absolute comments file path")
+		}
+	})
+
+	t.Run("prompt is scoped to sub path", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		var prompt string
+
+		cfg := &api.Config{
+			AiModel: "test-model",
+			Verbose: false,
+		}
+
+		svc := newTestCodexService(cfg)
+		svc.loginRunner = mockLoginRunner
+		svc.logoutRunner = mockLogoutRunner
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			prompt = args[len(args)-1]
+			commentsFilePath := filepath.Join(tmpDir, commentsFileName)
+			return exec.Command("sh", "-c", "echo '[]' > "+commentsFilePath)
+		}
+
+		options := &api.GeneratePRInlineCommentsOptions{
+			BaseSha:     "abc123",
+			StartSha:    "def456",
+			HeadSha:     "ghi789",
+			SandBoxDir:  tmpDir,
+			SubPath:     "services/foo",
+			DiffContext: 3,
+		}
+
+		_, err := svc.GeneratePRInlineCommentsWithContext(context.Background(), options)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if !strings.Contains(prompt, "git diff --relative=services/foo abc123..HEAD") {
+			t.Error("expected prompt to contain scoped git diff command")
+		}
+		if !strings.Contains(prompt, "3 unchanged lines of context") {
+			t.Error("expected prompt to mention the diff context")
+		}
+		if !strings.Contains(prompt, "scoped to the services/foo directory") {
+			t.Error("expected prompt to mention the scope")
+		}
+	})
+
+	t.Run("repository paths of a scoped review are dropped", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		// the scope has a directory named like the sub path, comments on it are scope relative
+		nested := filepath.Join(tmpDir, "services", "foo", "services", "foo")
+		if err := os.MkdirAll(nested, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(nested, "nested.go"), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+		svc.loginRunner = mockLoginRunner
+		svc.logoutRunner = mockLogoutRunner
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			comments := `[{"body":"scoped","position":{"new_path":"main.go","new_line":1}},` +
+				`{"body":"repo","position":{"new_path":"services/foo/main.go","new_line":1}},` +
+				`{"body":"nested","position":{"new_path":"services/foo/nested.go","new_line":1}}]`
+			return exec.Command("sh", "-c", "echo '"+comments+"' > "+filepath.Join(tmpDir, commentsFileName))
+		}
+
+		comments, err := svc.GeneratePRInlineCommentsWithContext(context.Background(), &api.GeneratePRInlineCommentsOptions{
+			SandBoxDir: tmpDir,
+			SubPath:    "services/foo",
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		var bodies []string
+		for _, comment := range comments {
+			bodies = append(bodies, *comment.Body)
+		}
+		if strings.Join(bodies, ",") != "scoped,nested" {
+			t.Errorf("kept comments %v, want the scoped and the nested one", bodies)
+		}
+	})
+
+	t.Run("prompt carries path context", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		var prompt string
+
+		svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+		svc.loginRunner = mockLoginRunner
+		svc.logoutRunner = mockLogoutRunner
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			prompt = args[len(args)-1]
+			return exec.Command("sh", "-c", "echo '[]' > "+filepath.Join(tmpDir, commentsFileName))
+		}
+
+		options := &api.GeneratePRInlineCommentsOptions{
+			SandBoxDir:  tmpDir,
+			PathContext: []string{"services/billing/: PCI-sensitive, card data must never be logged", "migrations/: run on live data"},
+		}
+		if _, err := svc.GeneratePRInlineCommentsWithContext(context.Background(), options); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if !strings.Contains(prompt, "\n- services/billing/: PCI-sensitive, card data must never be logged\n- migrations/: run on live data\n") {
+			t.Errorf("expected prompt to list the path context, got:\n%s", prompt)
+		}
+	})
+
+	t.Run("prompt sets the tone", func(t *testing.T) {
+		tests := []struct {
+			tone string
+			want string
+		}{
+			{tone: "", want: toneInstructions["concise"]},
+			{tone: "friendly", want: toneInstructions["friendly"]},
+			{tone: "strict", want: toneInstructions["strict"]},
+		}
+		for _, tt := range tests {
+			tmpDir := t.TempDir()
+			var prompt string
+			svc := newTestCodexService(&api.Config{AiModel: "test-model", Tone: tt.tone})
+			svc.loginRunner = mockLoginRunner
+			svc.logoutRunner = mockLogoutRunner
+			svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+				prompt = args[len(args)-1]
+				return exec.Command("sh", "-c", "echo '[]' > "+filepath.Join(tmpDir, commentsFileName))
+			}
+
+			if _, err := svc.GeneratePRInlineCommentsWithContext(context.Background(), &api.GeneratePRInlineCommentsOptions{SandBoxDir: tmpDir}); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if !strings.Contains(prompt, tt.want) {
+				t.Errorf("tone %q: expected prompt to contain %q", tt.tone, tt.want)
+			}
+		}
+	})
+
+	t.Run("prompt reads the diff file without a checkout", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		var capturedArgs []string
+
+		svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+		svc.loginRunner = mockLoginRunner
+		svc.logoutRunner = mockLogoutRunner
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			capturedArgs = args
+			commentsFilePath := filepath.Join(tmpDir, commentsFileName)
+			return exec.Command("sh", "-c", "echo '[]' > "+commentsFilePath)
+		}
+
+		options := &api.GeneratePRInlineCommentsOptions{
+			BaseSha:    "abc123",
+			HeadSha:    "ghi789",
+			SandBoxDir: tmpDir,
+			DiffFile:   filepath.Join(tmpDir, "pr.diff"),
+		}
+
+		_, err := svc.GeneratePRInlineCommentsWithContext(context.Background(), options)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		prompt := capturedArgs[len(capturedArgs)-1]
+		if !strings.Contains(prompt, "review the pull request diff stored in "+options.DiffFile) || strings.Contains(prompt, "git diff") {
+			t.Error("expected prompt to point at the diff file instead of git diff")
+		}
+		if !slices.Contains(capturedArgs, "--skip-git-repo-check") {
+			t.Error("expected --skip-git-repo-check without a checkout")
+		}
+	})
+
 	t.Run("verbose mode outputs to stdout/stderr", func(t *testing.T) {
 		tmpDir := t.TempDir()
 		commentsFilePath := filepath.Join(tmpDir, commentsFileName)
@@ -565,3 +883,94 @@ func contains(slice []string, str string) bool {
 	}
 	return false
 }
+
+func TestCodexService_Session(t *testing.T) {
+	tmpDir := t.TempDir()
+	commentsFilePath := filepath.Join(tmpDir, commentsFileName)
+
+	var logins, logouts int
+	svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+	svc.loginRunner = func(ctx context.Context, apiKey, codexBinPath *string, env []string) error {
+		logins++
+		return nil
+	}
+	svc.logoutRunner = func(ctx context.Context, codexBinPath *string, env []string) error {
+		logouts++
+		return nil
+	}
+	svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		return exec.Command("sh", "-c", "echo '[]' > "+commentsFilePath)
+	}
+
+	if err := svc.StartSession(context.Background()); err != nil {
+		t.Fatalf("StartSession() error = %v", err)
+	}
+	options := &api.GeneratePRInlineCommentsOptions{BaseSha: "base", HeadSha: "head", SandBoxDir: tmpDir}
+	for range 3 {
+		if _, err := svc.GeneratePRInlineComments(options); err != nil {
+			t.Fatalf("GeneratePRInlineComments() error = %v", err)
+		}
+	}
+	if logins != 1 || logouts != 0 {
+		t.Errorf("during session logins = %d, logouts = %d, want 1 and 0", logins, logouts)
+	}
+
+	if err := svc.EndSession(context.Background()); err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+	if err := svc.EndSession(context.Background()); err != nil {
+		t.Fatalf("second EndSession() error = %v", err)
+	}
+	if logouts != 1 {
+		t.Errorf("logouts = %d, want 1", logouts)
+	}
+
+	if _, err := svc.GeneratePRInlineComments(options); err != nil {
+		t.Fatalf("GeneratePRInlineComments() after session error = %v", err)
+	}
+	if logins != 2 || logouts != 2 {
+		t.Errorf("after session logins = %d, logouts = %d, want 2 and 2", logins, logouts)
+	}
+}
+
+func TestCodexService_ModelChain(t *testing.T) {
+	run := func(t *testing.T, failure string) ([]string, []*api.InlineComment, error) {
+		tmpDir := t.TempDir()
+		commentsFilePath := filepath.Join(tmpDir, commentsFileName)
+		var models []string
+		svc := newTestCodexService(&api.Config{AiModel: "gpt-a", AiModelChain: []string{"gpt-a", "gpt-b", "gpt-c"}})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			model := args[slices.Index(args, "--model")+1]
+			models = append(models, model)
+			if model == "gpt-a" {
+				return exec.Command("sh", "-c", "echo '"+failure+"' >&2; exit 1")
+			}
+			return exec.Command("sh", "-c", `echo '[{"body": "`+model+`"}]' > `+commentsFilePath)
+		}
+		comments, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{BaseSha: "base123", HeadSha: "head123", SandBoxDir: tmpDir})
+		return models, comments, err
+	}
+
+	t.Run("falls back when the model is overloaded", func(t *testing.T) {
+		models, comments, err := run(t, "ERROR: unexpected status 529: model is overloaded, try again later")
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !slices.Equal(models, []string{"gpt-a", "gpt-b"}) {
+			t.Errorf("models = %v, want gpt-a then gpt-b", models)
+		}
+		if len(comments) != 1 || *comments[0].Body != "gpt-b" {
+			t.Errorf("expected the comments of gpt-b, got %v", comments)
+		}
+	})
+
+	t.Run("other failures do not fall back", func(t *testing.T) {
+		models, _, err := run(t, "ERROR: failed to read the prompt")
+		if err == nil || !strings.Contains(err.Error(), "error generating PR inline-comments") {
+			t.Errorf("expected the review to fail, got: %v", err)
+		}
+		if !slices.Equal(models, []string{"gpt-a"}) {
+			t.Errorf("models = %v, want only gpt-a", models)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestCodexService_ReviewDescriptionWithContext(t *testing.T) {
+	options := func(dir string) *api.ReviewDescriptionOptions {
+		return &api.ReviewDescriptionOptions{
+			SandBoxDir:  dir,
+			BaseSha:     "base123",
+			HeadSha:     "head123",
+			Title:       "Add retries",
+			Description: "Retries failed uploads.",
+		}
+	}
+
+	t.Run("returns the final message", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+		var gotArgs []string
+		var description []byte
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			gotArgs = args
+			description, _ = os.ReadFile(filepath.Join(tmpDir, descriptionFileName))
+			return exec.Command("sh", "-c", "printf '\\n- The description does not mention the new timeout flag.\\n' > "+filepath.Join(tmpDir, descriptionReviewFileName))
+		}
+
+		review, err := svc.ReviewDescriptionWithContext(context.Background(), options(tmpDir))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if review != "- The description does not mention the new timeout flag." {
+			t.Errorf("review = %q", review)
+		}
+		if string(description) != "Title: Add retries\n\nRetries failed uploads.\n" {
+			t.Errorf("description file = %q", description)
+		}
+		if !slices.Contains(gotArgs, "read-only") {
+			t.Errorf("expected a read-only sandbox, got args %v", gotArgs)
+		}
+		prompt := gotArgs[len(gotArgs)-1]
+		if strings.Contains(prompt, "Retries failed uploads") {
+			t.Error("the description must not be part of the prompt")
+		}
+		if !strings.Contains(prompt, "git diff base123..HEAD") {
+			t.Errorf("expected the diff command in the prompt, got %q", prompt)
+		}
+		for _, name := range []string{descriptionFileName, descriptionReviewFileName} {
+			if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+				t.Errorf("expected %s to be removed", name)
+			}
+		}
+	})
+
+	t.Run("error without a final message", func(t *testing.T) {
+		svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			return exec.Command("sh", "-c", "exit 0")
+		}
+
+		_, err := svc.ReviewDescriptionWithContext(context.Background(), options(t.TempDir()))
+		if err == nil || !strings.Contains(err.Error(), "without a description review") {
+			t.Errorf("expected missing review error, got %v", err)
+		}
+	})
+
+	t.Run("error when codex fails", func(t *testing.T) {
+		svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+		svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+			return exec.Command("sh", "-c", "exit 1")
+		}
+
+		_, err := svc.ReviewDescriptionWithContext(context.Background(), options(t.TempDir()))
+		if err == nil || !strings.Contains(err.Error(), "error reviewing PR description") {
+			t.Errorf("expected command error, got %v", err)
+		}
+	})
+}
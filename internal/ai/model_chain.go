@@ -0,0 +1,20 @@
+package ai
+
+import "regexp"
+
+// modelUnavailablePattern matches what codex prints when the model it was asked for cannot serve the request right
+// now or at all: unknown or unsupported models, overloaded or unavailable services.
+var modelUnavailablePattern = regexp.MustCompile(`(?i)model_not_found|model \S+ does not exist|(unsupported|unknown) model|model is not (available|supported)|overloaded|service unavailable|at capacity|\b(503|529)\b`)
+
+// modelUnavailable reports whether the stderr of a failed codex run blames the model rather than the review.
+func modelUnavailable(stderr string) bool {
+	return modelUnavailablePattern.MatchString(stderr)
+}
+
+// models returns the models a review tries in order, the configured chain or the single model.
+func (c *CodexService) models() []string {
+	if len(c.cfg.AiModelChain) > 0 {
+		return c.cfg.AiModelChain
+	}
+	return []string{c.cfg.AiModel}
+}
@@ -0,0 +1,23 @@
+package ai
+
+import "testing"
+
+func TestModelUnavailable(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   bool
+	}{
+		{`ERROR: {"error":{"code":"model_not_found","message":"The model gpt-x does not exist"}}`, true},
+		{"stream error: unexpected status 503 Service Unavailable", true},
+		{"ERROR: the server is overloaded, please retry", true},
+		{"ERROR: unsupported model gpt-x", true},
+		{"ERROR: unexpected status 401 Unauthorized", false},
+		{"ERROR: context window exceeded", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := modelUnavailable(tt.stderr); got != tt.want {
+			t.Errorf("modelUnavailable(%q) = %v, want %v", tt.stderr, got, tt.want)
+		}
+	}
+}
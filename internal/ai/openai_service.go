@@ -0,0 +1,224 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/vcs"
+)
+
+// openAIBaseURL is the OpenAI API the openai agent sends its reviews to.
+const openAIBaseURL = "https://api.openai.com/v1"
+
+// openAIDiffSource stands in for the diff file in the prompt, the diff is sent as the message that follows it.
+const openAIDiffSource = "the next message"
+
+// openAIOutput replaces the comments and summary files of the agents that run in the checkout.
+const openAIOutput = `verify json validity(escape special characters).
+	        Reply with one JSON object and nothing else: {"comments": <THE_COMMENTS_ARRAY_OR_[]>, "summary": "<SUMMARY_REVIEW_AS_PLAIN_TEXT>"}.
+	        In the summary do not include the findings you specified in the inline comments`
+
+// reviewDiffer builds the diffs the openai agent reviews, vcs.GitService outside of tests.
+type reviewDiffer interface {
+	ContextDiff(ctx context.Context, path, baseSha, headSha string, contextLines int) (string, error)
+	ContextCommitsDiff(ctx context.Context, path string, shas []string, contextLines int) (string, error)
+}
+
+// OpenAIService reviews with the OpenAI Responses API directly, nothing is installed. The model cannot read the
+// checkout, so it gets the diff, built with go-git's myers diff, and replies with the comments and summary.
+type OpenAIService struct {
+	cfg     *api.Config
+	client  *http.Client
+	baseURL string
+	differ  reviewDiffer
+}
+
+var _ api.AIAgentService = (*OpenAIService)(nil)
+
+func NewOpenAIService(cfg *api.Config) (*OpenAIService, error) {
+	if cfg.AiApiKey == "" {
+		return nil, errors.New("ai api key is not set")
+	}
+	return &OpenAIService{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.ApiTimeout},
+		baseURL: openAIBaseURL,
+		differ:  vcs.NewGitService(nil),
+	}, nil
+}
+
+func (o *OpenAIService) GeneratePRInlineComments(options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+	return o.GeneratePRInlineCommentsWithContext(context.Background(), options)
+}
+
+func (o *OpenAIService) GeneratePRInlineCommentsWithContext(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+	text, err := o.reviewDiff(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return []*api.InlineComment{}, nil
+	}
+
+	promptOptions := *options
+	promptOptions.DiffFile = openAIDiffSource
+	reply, err := o.respond(ctx, reviewPrompt(o.cfg, &promptOptions, openAIOutput), text)
+	if err != nil && options.KeepPartial && ctx.Err() != nil {
+		// the reply arrives whole or not at all
+		return []*api.InlineComment{}, fmt.Errorf("%w, 0 complete comments saved: %w", api.ErrReviewTruncated, ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating PR inline-comments: %w", err)
+	}
+
+	var review struct {
+		Comments []*api.InlineComment `json:"comments"`
+		Summary  string               `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(reply), &review); err != nil {
+		return nil, fmt.Errorf("error unmarshaling openai reply: %w", err)
+	}
+	if strings.TrimSpace(review.Summary) != "" {
+		if err := os.WriteFile(filepath.Join(options.SandBoxDir, SummaryFileName), []byte(review.Summary), 0600); err != nil {
+			return nil, fmt.Errorf("error writing review summary: %w", err)
+		}
+	}
+	if review.Comments == nil {
+		if strings.TrimSpace(review.Summary) == "" {
+			warnEmptyOutput("openai", reply)
+		}
+		return []*api.InlineComment{}, nil
+	}
+	return dropRepoPaths(review.Comments, options.SubPath, options.SandBoxDir), nil
+}
+
+// reviewDiff returns the diff the review covers: the diff file as it is, or the changes of the checkout with the
+// configured context lines, narrowed to the sub path and the include and exclude patterns the way the git diff of the
+// other agents is.
+func (o *OpenAIService) reviewDiff(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) (string, error) {
+	if options.DiffFile != "" {
+		data, err := os.ReadFile(options.DiffFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading diff file: %w", err)
+		}
+		return string(data), nil
+	}
+
+	scope := &diff.Scope{SubPath: options.SubPath, ContextLines: options.DiffContext}
+	var text string
+	var err error
+	if len(options.Commits) > 0 {
+		text, err = o.differ.ContextCommitsDiff(ctx, options.SandBoxDir, options.Commits, scope.Context())
+	} else {
+		text, err = o.differ.ContextDiff(ctx, options.SandBoxDir, options.BaseSha, options.HeadSha, scope.Context())
+	}
+	if err != nil {
+		return "", fmt.Errorf("error building review diff: %w", err)
+	}
+
+	excludes, err := diff.NewExcludes(options.Exclude)
+	if err != nil {
+		return "", err
+	}
+	if err := excludes.Include(options.Include); err != nil {
+		return "", err
+	}
+	scoped, err := diff.Filter(text, func(p string) bool {
+		return scope.Contains(p) && !excludes.Match(p)
+	})
+	if err != nil {
+		return "", fmt.Errorf("error scoping review diff: %w", err)
+	}
+	return scoped, nil
+}
+
+// openAIResponse is the part of a Responses API reply the review reads.
+type openAIResponse struct {
+	Output []struct {
+		Type    string `json:"type"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"output"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// respond sends the prompt and the diff as two user messages and returns the text of the reply, which the JSON
+// format keeps to a single object.
+func (o *OpenAIService) respond(ctx context.Context, prompt, diffText string) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": o.cfg.AiModel,
+		"input": []map[string]string{
+			{"role": "user", "content": prompt},
+			{"role": "user", "content": diffText},
+		},
+		"text": map[string]any{"format": map[string]string{"type": "json_object"}},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/responses", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.cfg.AiApiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading openai response: %w", err)
+	}
+
+	var parsed openAIResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", fmt.Errorf("openai returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if parsed.Error != nil {
+		return "", fmt.Errorf("openai returned %s: %s", resp.Status, parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("openai returned %s", resp.Status)
+	}
+	if parsed.IncompleteDetails != nil && parsed.IncompleteDetails.Reason != "" {
+		return "", fmt.Errorf("openai reply is incomplete: %s", parsed.IncompleteDetails.Reason)
+	}
+
+	var sb strings.Builder
+	for _, item := range parsed.Output {
+		if item.Type != "message" {
+			continue
+		}
+		for _, content := range item.Content {
+			if content.Type == "output_text" {
+				sb.WriteString(content.Text)
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return "", errors.New("openai reply has no text")
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,225 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+const openAITestDiff = `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,3 @@
+ package main
++// added
+ func main() {}
+diff --git a/vendor/lib.go b/vendor/lib.go
+--- a/vendor/lib.go
++++ b/vendor/lib.go
+@@ -1 +1 @@
+-package lib
++package vendored
+`
+
+// stubDiffer returns a fixed diff and records which diff was asked for.
+type stubDiffer struct {
+	text         string
+	commits      []string
+	base         string
+	contextLines int
+}
+
+func (s *stubDiffer) ContextDiff(ctx context.Context, path, baseSha, headSha string, contextLines int) (string, error) {
+	s.base, s.contextLines = baseSha, contextLines
+	return s.text, nil
+}
+
+func (s *stubDiffer) ContextCommitsDiff(ctx context.Context, path string, shas []string, contextLines int) (string, error) {
+	s.commits, s.contextLines = shas, contextLines
+	return s.text, nil
+}
+
+// openAIReply wraps text the way the Responses API returns a message.
+func openAIReply(text string) string {
+	data, _ := json.Marshal(map[string]any{
+		"output": []any{
+			map[string]any{"type": "reasoning"},
+			map[string]any{"type": "message", "content": []any{map[string]any{"type": "output_text", "text": text}}},
+		},
+	})
+	return string(data)
+}
+
+// newTestOpenAIService creates an OpenAIService talking to server with a stubbed diff.
+func newTestOpenAIService(server *httptest.Server, differ reviewDiffer) *OpenAIService {
+	return &OpenAIService{
+		cfg:     &api.Config{AiApiKey: "sk-test", AiModel: "gpt-test"},
+		client:  server.Client(),
+		baseURL: server.URL,
+		differ:  differ,
+	}
+}
+
+func TestOpenAIService_GeneratePRInlineComments(t *testing.T) {
+	t.Run("sends the scoped diff and reads the reply", func(t *testing.T) {
+		var got struct {
+			Model string `json:"model"`
+			Input []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"input"`
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/responses" || r.Header.Get("Authorization") != "Bearer sk-test" {
+				t.Errorf("request = %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+			}
+			_ = json.NewDecoder(r.Body).Decode(&got)
+			_, _ = w.Write([]byte(openAIReply(`{"comments": [{"body": "Explain why", "position": {"new_path": "main.go", "new_line": 2}}], "summary": "Adds a comment."}`)))
+		}))
+		defer server.Close()
+
+		tmpDir := t.TempDir()
+		differ := &stubDiffer{text: openAITestDiff}
+		svc := newTestOpenAIService(server, differ)
+		comments, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{
+			BaseSha: "base123", HeadSha: "head123", SandBoxDir: tmpDir, Exclude: []string{"vendor/**"}, DiffContext: 3,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(comments) != 1 || util.GetOrDefault(comments[0].Body, "") != "Explain why" || comments[0].Position.NewLine == nil || *comments[0].Position.NewLine != 2 {
+			t.Errorf("comments = %+v", comments)
+		}
+		if differ.base != "base123" || differ.contextLines != 3 {
+			t.Errorf("diffed against %q with %d context lines, want base123 with 3", differ.base, differ.contextLines)
+		}
+		if got.Model != "gpt-test" || len(got.Input) != 2 {
+			t.Fatalf("request = %+v", got)
+		}
+		if !strings.Contains(got.Input[0].Content, "the next message") || !strings.Contains(got.Input[0].Content, `"summary"`) {
+			t.Errorf("prompt does not point at the diff message and the reply format")
+		}
+		if !strings.Contains(got.Input[1].Content, "+// added") || strings.Contains(got.Input[1].Content, "vendor/lib.go") {
+			t.Errorf("diff = %q, want main.go only", got.Input[1].Content)
+		}
+		summary, err := os.ReadFile(filepath.Join(tmpDir, SummaryFileName))
+		if err != nil || string(summary) != "Adds a comment." {
+			t.Errorf("summary = %q, %v", summary, err)
+		}
+	})
+
+	t.Run("reviews the selected commits", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(openAIReply(`{"comments": [], "summary": "Fine."}`)))
+		}))
+		defer server.Close()
+
+		differ := &stubDiffer{text: openAITestDiff}
+		comments, err := newTestOpenAIService(server, differ).GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{
+			SandBoxDir: t.TempDir(), Commits: []string{"c1", "c2"}, DiffContext: 10,
+		})
+		if err != nil || len(comments) != 0 {
+			t.Fatalf("comments = %v, err = %v", comments, err)
+		}
+		if strings.Join(differ.commits, ",") != "c1,c2" || differ.contextLines != 10 {
+			t.Errorf("commits = %v with %d context lines, want c1,c2 with 10", differ.commits, differ.contextLines)
+		}
+	})
+
+	t.Run("sends the diff file as it is", func(t *testing.T) {
+		var sent string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Input []struct {
+					Content string `json:"content"`
+				} `json:"input"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			sent = body.Input[1].Content
+			_, _ = w.Write([]byte(openAIReply(`{"comments": []}`)))
+		}))
+		defer server.Close()
+
+		tmpDir := t.TempDir()
+		diffFile := filepath.Join(tmpDir, "pr.diff")
+		_ = os.WriteFile(diffFile, []byte(openAITestDiff), 0600)
+		_, err := newTestOpenAIService(server, &stubDiffer{}).GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{
+			SandBoxDir: tmpDir, DiffFile: diffFile,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sent != openAITestDiff {
+			t.Errorf("sent diff = %q", sent)
+		}
+	})
+
+	t.Run("skips an empty diff", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		}))
+		defer server.Close()
+
+		comments, err := newTestOpenAIService(server, &stubDiffer{text: openAITestDiff}).GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{
+			SandBoxDir: t.TempDir(), Include: []string{"docs/"},
+		})
+		if err != nil || len(comments) != 0 || calls != 0 {
+			t.Errorf("comments = %v, err = %v, calls = %d", comments, err, calls)
+		}
+	})
+
+	t.Run("reports api errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": {"message": "Incorrect API key provided"}}`))
+		}))
+		defer server.Close()
+
+		_, err := newTestOpenAIService(server, &stubDiffer{text: openAITestDiff}).GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{
+			SandBoxDir: t.TempDir(),
+		})
+		if err == nil || !strings.Contains(err.Error(), "401 Unauthorized: Incorrect API key provided") {
+			t.Errorf("error = %v", err)
+		}
+	})
+
+	t.Run("rejects a reply that is not the comments object", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(openAIReply(`I found nothing.`)))
+		}))
+		defer server.Close()
+
+		_, err := newTestOpenAIService(server, &stubDiffer{text: openAITestDiff}).GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{
+			SandBoxDir: t.TempDir(),
+		})
+		if err == nil || !strings.Contains(err.Error(), "error unmarshaling openai reply") {
+			t.Errorf("error = %v", err)
+		}
+	})
+}
+
+func TestNewOpenAIService_RequiresApiKey(t *testing.T) {
+	if _, err := NewOpenAIService(&api.Config{AiModel: "gpt-test"}); err == nil {
+		t.Error("expected an error without an api key")
+	}
+}
+
+func TestNewOpenAIService_ApiTimeout(t *testing.T) {
+	svc, err := NewOpenAIService(&api.Config{AiApiKey: "sk-test", ApiTimeout: 5 * time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if svc.client.Timeout != 5*time.Minute {
+		t.Errorf("client timeout = %v, want the api timeout", svc.client.Timeout)
+	}
+}
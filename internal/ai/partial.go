@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+// partialComments returns the complete comments of a comments file the agent was still writing when ctx ended.
+func partialComments(ctx context.Context, commentsFilePath string) ([]*api.InlineComment, error) {
+	data, err := os.ReadFile(commentsFilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading comments file: %w", err)
+	}
+	comments := parsePartialComments(data)
+	return comments, fmt.Errorf("%w, %d complete comments saved: %w", api.ErrReviewTruncated, len(comments), ctx.Err())
+}
+
+// parsePartialComments decodes the comments of a JSON array up to the first one that is cut off or malformed.
+func parsePartialComments(data []byte) []*api.InlineComment {
+	comments := []*api.InlineComment{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return comments
+	}
+	for dec.More() {
+		var comment api.InlineComment
+		if err := dec.Decode(&comment); err != nil {
+			break
+		}
+		comments = append(comments, &comment)
+	}
+	return comments
+}
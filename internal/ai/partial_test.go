@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestParsePartialComments(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantBodies []string
+	}{
+		{name: "complete array", data: `[{"body":"a"},{"body":"b"}]`, wantBodies: []string{"a", "b"}},
+		{name: "cut off in the last entry", data: `[{"body":"a"},{"body":"b"},{"body":"c`, wantBodies: []string{"a", "b"}},
+		{name: "cut off after a comma", data: `[{"body":"a"},`, wantBodies: []string{"a"}},
+		{name: "malformed entry", data: `[{"body":"a"},{"body":}]`, wantBodies: []string{"a"}},
+		{name: "only the opening bracket", data: `[`, wantBodies: nil},
+		{name: "empty", data: ``, wantBodies: nil},
+		{name: "not an array", data: `{"body":"a"}`, wantBodies: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments := parsePartialComments([]byte(tt.data))
+			if comments == nil {
+				t.Fatal("expected a non-nil slice")
+			}
+			if len(comments) != len(tt.wantBodies) {
+				t.Fatalf("got %d comments, want %d", len(comments), len(tt.wantBodies))
+			}
+			for i, want := range tt.wantBodies {
+				if comments[i].Body == nil || *comments[i].Body != want {
+					t.Errorf("comment %d body = %v, want %q", i, comments[i].Body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCodexService_KeepPartial(t *testing.T) {
+	tmpDir := t.TempDir()
+	commentsFilePath := filepath.Join(tmpDir, commentsFileName)
+	svc := newTestCodexService(&api.Config{AiModel: "test-model"})
+	svc.commandRunner = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		if err := os.WriteFile(commentsFilePath, []byte(`[{"body":"done"},{"body":"half`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return exec.CommandContext(ctx, "sleep", "10")
+	}
+
+	run := func(keepPartial bool) ([]*api.InlineComment, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		return svc.GeneratePRInlineCommentsWithContext(ctx, &api.GeneratePRInlineCommentsOptions{SandBoxDir: tmpDir, KeepPartial: keepPartial})
+	}
+
+	comments, err := run(true)
+	if !errors.Is(err, api.ErrReviewTruncated) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a truncated review after the deadline, got %v", err)
+	}
+	if len(comments) != 1 || *comments[0].Body != "done" {
+		t.Errorf("comments = %+v, want the one complete comment", comments)
+	}
+
+	comments, err = run(false)
+	if err == nil || errors.Is(err, api.ErrReviewTruncated) || comments != nil {
+		t.Errorf("without KeepPartial expected a plain error, got %v with %d comments", err, len(comments))
+	}
+}
@@ -0,0 +1,315 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// inlineCommentsPrompt asks the agent to review the diff and to save its findings as a JSON comment array in
+// commentsFilePath and its summary in SummaryFileName. Every agent gets the same prompt, so they all write the format
+// GeneratePRInlineComments parses.
+func inlineCommentsPrompt(cfg *api.Config, options *api.GeneratePRInlineCommentsOptions, commentsFilePath string) string {
+	return reviewPrompt(cfg, options, fmt.Sprintf(`verify json validity(escape special characters).
+	        store json inside %s commentsFile.
+	        4. Generate summary review inside %s commentsFile as plain text.
+	        5. In the summary do not include the findings you specified in the inline comments
+			6. DO NOT PUSH ANY CHANGES.`, commentsFilePath, SummaryFileName))
+}
+
+// reviewPrompt holds the review rules and the comment format shared by all agents, output tells the agent where its
+// comments and summary go.
+func reviewPrompt(cfg *api.Config, options *api.GeneratePRInlineCommentsOptions, output string) string {
+	scope := &diff.Scope{SubPath: options.SubPath, Exclude: options.Exclude, Include: options.Include, ContextLines: options.DiffContext, Algorithm: options.DiffAlgorithm, Commits: options.Commits}
+	var scopeNote string
+	if scope.SubPath != "" {
+		scopeNote = fmt.Sprintf(" The review is scoped to the %s directory, all paths in the diff and in your output are relative to it.", scope.SubPath)
+	}
+	scopeNote += fmt.Sprintf(" The diff shows %d unchanged lines of context around each change, read the files when you need more.", scope.Context())
+	if len(scope.Include) > 0 || len(scope.Exclude) > 0 {
+		scopeNote += " Files the pathspecs leave out of the diff are skipped on purpose, do not comment on them even when you read them."
+	}
+	task := scope.Command(options.BaseSha)
+	if options.DiffFile != "" {
+		// without a checkout there is nothing to read beyond the diff
+		task = fmt.Sprintf("review the pull request diff stored in %s", options.DiffFile)
+		scopeNote = " The repository is not checked out, base the review on the diff alone."
+	}
+	if len(options.PathContext) > 0 {
+		scopeNote += " The maintainers describe the changed areas as follows, review them with the scrutiny they call for:\n- " +
+			strings.Join(options.PathContext, "\n- ") + "\n"
+	}
+	if options.RepoContext != "" {
+		scopeNote += " The repository holds these files with their top-level declarations, check them before suggesting code that may already exist elsewhere:\n" +
+			options.RepoContext
+	}
+
+	var sb strings.Builder
+	err := reviewPromptTemplate.Execute(&sb, reviewPromptData{
+		Task:         task,
+		ScopeNote:    scopeNote,
+		Tone:         toneInstruction(cfg),
+		BaseSha:      options.BaseSha,
+		StartSha:     options.StartSha,
+		HeadSha:      options.HeadSha,
+		Output:       output,
+		WithStartSha: anchorsOnStartCommit(options.Provider),
+		WithImages:   commentsOnImages(options.Provider),
+	})
+	if err != nil {
+		// the template and its data are fixed, executing it only fails on a mistake in them
+		panic(err)
+	}
+	return sb.String()
+}
+
+// reviewPromptData fills reviewPromptTemplate.
+type reviewPromptData struct {
+	Task      string
+	ScopeNote string
+	Tone      string
+	BaseSha   string
+	StartSha  string
+	HeadSha   string
+	Output    string
+	// WithStartSha asks for the start commit of the merge request diff, WithImages for comments on images.
+	WithStartSha bool
+	WithImages   bool
+}
+
+var reviewPromptTemplate = template.Must(template.New("review").Parse(`
+			You are an AI code reviewer. You need to {{.Task}}.{{.ScopeNote}} You need to analyze the diff and to generate inline comments strictly in the following JSON format:
+
+				RULES:
+				
+				ABSOLUTE CONSTRAINTS (MUST FOLLOW)
+				- You may ONLY reference line numbers that explicitly appear in the diff hunks
+				- Line numbers come only from @@ -<old>,<count> +<new>,<count> @@
+				- You must compute per-line numbers by incrementing from the hunk header
+				- If a line number cannot be derived with certainty, DO NOT COMMENT
+				- DO NOT GUESS OR INFER LINE NUMBERS
+				- Do NOT assume continuity across hunks
+				- Do NOT reuse numbers from examples
+				- Do NOT comment on context outside the diff
+				- If you cannot place a valid comment with exact line numbers, SKIP it
+				
+				Single-line comments:
+				- Omit position[line_range].
+				- Include both old_path and new_path.
+				- For renamed files old_path is the path before the rename and new_path the path after it.
+				- Added line: use position[new_line] only, omit old_line.
+				- Removed line: use position[old_line] only, omit new_line.
+				- Unchanged line: include both old_line and new_line, using diff-provided line numbers.
+                - ***Do not guess; line numbers may differ due to previous changes. ***
+				- Set comment_type = SINGLE_LINE.
+				- Set line_type = ADD, REMOVE, or UNCHANGED.
+				
+				Deleted files (diff shows +++ /dev/null):
+				- Set deleted_file = true and use the deleted file path as both old_path and new_path.
+				- Use old_line only and set line_type = REMOVE.
+				{{- if .WithImages}}
+				
+				Images (diff shows Binary files ... differ for a .png, .jpg, .gif or similar):
+				- Only comment on an image when you can see a concrete problem in it.
+				- Set position_type = image and omit new_line, old_line, line_range, comment_type and line_type.
+				- Set width and height to the image size in pixels and x, y to the point you comment on, 0 <= x <= width, 0 <= y <= height.
+				- Use the changed image path as both old_path and new_path.
+				{{- end}}
+				
+                Multi-line comments:
+				- Use position[line_range] to indicate the start and end of the comment.
+				- Line numbers in start and end follow the same rules as single-line comments:
+				- Added lines: fill only new_line
+				- Removed lines: fill only old_line
+				- Unchanged lines: fill both old_line and new_line
+				- line_type = ADD, REMOVE, or UNCHANGED depending on the type of lines being commented.
+                - Set comment_type = MULTI_LINE.
+				
+				Content
+				- Comment only on lines present in the diff.
+				- Each comment should be a meaningful suggestion, improvement, or note.
+				- {{.Tone}} The tone must not change which findings you report.
+				- Always reference the exact line numbers from the diff. Never guess the lines
+				- When you propose a concrete fix, put the full replacement code for the commented lines in suggestion.
+				- Set confidence = high only if the fix is certainly correct and complete, otherwise medium or low.
+				- Set category to the one id that fits the finding best: correctness, nil-safety, error-handling, concurrency, security, performance, resource-leak, api-misuse, maintainability.
+				- Set line_content to the exact text of the commented line without the diff +/-/space prefix, for multi-line comments the last line.
+				
+				Output
+				- JSON must follow this schema:
+				
+				[{
+				  "body": "<YOUR_COMMENT>",
+				  "suggestion": "<OPTIONAL_REPLACEMENT_CODE>",
+				  "confidence": "high"|"medium"|"low",
+				  "line_content": "<TEXT_OF_THE_COMMENTED_LINE>",
+				  "category": "<CATEGORY_ID>",
+				  "commit_id": "{{.HeadSha}}",
+				  "position": {
+					{{- if .WithImages}}
+					"position_type": "text" | "image",
+					{{- end}}
+					"base_sha": "{{.BaseSha}}",
+					{{- if .WithStartSha}}
+					"start_sha": "{{.StartSha}}",
+					{{- end}}
+					"head_sha": "{{.HeadSha}}",
+					"old_path": "<OLD_FILE_PATH>",
+					"new_path": "<NEW_FILE_PATH>",
+					"new_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_NEW_LINE>,
+					"old_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_OLD_LINE>,
+					"line_range": {
+					  "start": {
+						"new_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_NEW_LINE>,
+						"old_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_OLD_LINE>
+					  },
+					  "end": {
+						"new_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_NEW_LINE>,
+						"old_line": <LINE_TO_COMMENT_IF_COMMENT_BELONGS_TO_OLD_LINE>
+					  }
+					},
+					"comment_type": "SINGLE_LINE" | "MULTI_LINE",
+					"line_type": "ADD"|"REMOVE"|"UNCHANGED",
+					"deleted_file": true | false
+					{{- if .WithImages}},
+					"width": <IMAGE_WIDTH_IF_POSITION_TYPE_IS_IMAGE>,
+					"height": <IMAGE_HEIGHT_IF_POSITION_TYPE_IS_IMAGE>,
+					"x": <X_IF_POSITION_TYPE_IS_IMAGE>,
+					"y": <Y_IF_POSITION_TYPE_IS_IMAGE>
+					{{- end}}
+				  }
+				}]
+				
+				Examples
+				1. Single-line added
+					@@ -41,3 +41,4 @@
+					 func add(a int, b int) int {
+					-    return a - b
+					+    return a + b
+					}
+				[{
+				  "body": "Corrected addition here.",
+				  "commit_id": "commitId",
+				  "position": {
+					{{- if .WithImages}}
+					"position_type": "text",
+					{{- end}}
+					"base_sha": "baseSha",
+					{{- if .WithStartSha}}
+					"start_sha": "startSha",
+					{{- end}}
+					"head_sha": "headSha",
+					"old_path": "math.go",
+					"new_path": "math.go",
+					"new_line": 42,
+					"comment_type": "SINGLE_LINE",
+					"line_type": "ADD"
+				  }
+				}]
+				
+				2. Single-line removed
+					@@ -40,5 +40,4 @@
+					 func add(a int, b int) int {
+					-    return a - b
+					+    return a + b
+					}
+				[{
+				  "body": "This line was incorrectly subtracting.",
+				  "commit_id": "commitId",
+				  "position": {
+					{{- if .WithImages}}
+					"position_type": "text",
+					{{- end}}
+					"base_sha": "baseSha",
+					{{- if .WithStartSha}}
+					"start_sha": "startSha",
+					{{- end}}
+					"head_sha": "headSha",
+					"old_path": "math.go",
+					"new_path": "math.go",
+					"old_line": 42,
+					"comment_type": "SINGLE_LINE",
+					"line_type": "REMOVE"
+				  }
+				}]
+				
+				3. Single-line unchanged
+
+					@@ -30,6 +30,8 @@
+					func multiply(a int, b int) int {
+						 result := a * b
+					+    fmt.Println("Debug start")   # line 34 in old file? added in new file
+					+    log.Println("Debug info")    # line 35 in new file
+						 return a / b
+					}
+
+				[{
+				  "body": "This line is unchanged but review for debug code.",
+				  "commit_id": "commitId",
+				  "position": {
+					{{- if .WithImages}}
+					"position_type": "text",
+					{{- end}}
+					"base_sha": "baseSha",
+					{{- if .WithStartSha}}
+					"start_sha": "startSha",
+					{{- end}}
+					"head_sha": "headSha",
+					"old_path": "math.go",
+					"new_path": "math.go",
+					"old_line": 34,
+					"new_line": 36,
+					"comment_type": "SINGLE_LINE",
+					"line_type": "UNCHANGED"
+				  }
+				}]
+				
+				4. Multi-line added
+
+					@@ -11,2 +11,5 @@
+					-    result := a * b
+					-    return result
+					+    result := a * b
+					+    if result < 0 {
+					+        result = 0
+					+    }
+					+    return result
+
+				[{
+				  "body": "Adding a guard for negative results; review logic.",
+				  "commit_id": "commitId",
+				  "position": {
+					{{- if .WithImages}}
+					"position_type": "text",
+					{{- end}}
+					"base_sha": "baseSha",
+					{{- if .WithStartSha}}
+					"start_sha": "startSha",
+					{{- end}}
+					"head_sha": "headSha",
+					"old_path": "math.go",
+					"new_path": "math.go",
+					"line_range": {
+					  "start": { "new_line": 11 },
+					  "end": { "new_line": 14 }
+					},
+					"comment_type": "MULTI_LINE",
+					"line_type": "ADD"
+				  }
+				}]
+			{{.Output}}
+			`))
+
+// anchorsOnStartCommit reports whether comments of the provider are anchored on the start commit of the merge request
+// diff as well, GitLab's are. GitHub and Gitea anchor them on lines of the head and base commits only.
+func anchorsOnStartCommit(provider api.VCSProviderType) bool {
+	return provider != api.VCSProviderTypeGithub && provider != api.VCSProviderTypeGitea
+}
+
+// commentsOnImages reports whether the provider takes comments on images, Gitea has none.
+func commentsOnImages(provider api.VCSProviderType) bool {
+	return provider != api.VCSProviderTypeGitea
+}
@@ -0,0 +1,76 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestInlineCommentsPrompt_Provider(t *testing.T) {
+	tests := []struct {
+		provider     api.VCSProviderType
+		wantStartSha bool
+		wantImages   bool
+	}{
+		{provider: "", wantStartSha: true, wantImages: true},
+		{provider: "gitlab", wantStartSha: true, wantImages: true},
+		{provider: "github", wantStartSha: false, wantImages: true},
+		{provider: "gitea", wantStartSha: false, wantImages: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.provider), func(t *testing.T) {
+			prompt := inlineCommentsPrompt(&api.Config{}, &api.GeneratePRInlineCommentsOptions{
+				BaseSha: "base123", StartSha: "start123", HeadSha: "head123", Provider: tt.provider,
+			}, "comments.json")
+
+			if got := strings.Contains(prompt, `"start_sha"`); got != tt.wantStartSha {
+				t.Errorf("asks for start_sha = %v, want %v", got, tt.wantStartSha)
+			}
+			if got := strings.Contains(prompt, "Images (") && strings.Contains(prompt, `"width":`); got != tt.wantImages {
+				t.Errorf("asks for image positions = %v, want %v", got, tt.wantImages)
+			}
+			if got := strings.Contains(prompt, `"position_type"`); got != tt.wantImages {
+				t.Errorf("asks for position_type = %v, want %v", got, tt.wantImages)
+			}
+			for _, want := range []string{`"base_sha": "base123"`, `"head_sha": "head123"`, `"new_line"`, "Multi-line comments:", "comments.json"} {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("prompt lacks %s", want)
+				}
+			}
+		})
+	}
+}
+
+func TestInlineCommentsPrompt_Include(t *testing.T) {
+	prompt := inlineCommentsPrompt(&api.Config{}, &api.GeneratePRInlineCommentsOptions{
+		BaseSha: "base123", HeadSha: "head123", Include: []string{"**/*.go"}, Exclude: []string{"**/vendor/**"},
+	}, "comments.json")
+
+	for _, want := range []string{"base123..HEAD -- ':(top,glob)**/*.go' ':(top,exclude,glob)**/vendor/**'", "skipped on purpose"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %s", want)
+		}
+	}
+}
+
+func TestInlineCommentsPrompt_RepoContext(t *testing.T) {
+	options := &api.GeneratePRInlineCommentsOptions{BaseSha: "base123", HeadSha: "head123"}
+	if prompt := inlineCommentsPrompt(&api.Config{}, options, "comments.json"); strings.Contains(prompt, "top-level declarations") {
+		t.Error("prompt mentions the repository index without one")
+	}
+
+	options.RepoContext = "- api/client.go: Client, NewClient\n"
+	prompt := inlineCommentsPrompt(&api.Config{}, options, "comments.json")
+	if !strings.Contains(prompt, "may already exist elsewhere:\n- api/client.go: Client, NewClient\n") {
+		t.Error("prompt lacks the repository index")
+	}
+}
+
+func TestInlineCommentsPrompt_NoContext(t *testing.T) {
+	prompt := inlineCommentsPrompt(&api.Config{}, &api.GeneratePRInlineCommentsOptions{BaseSha: "base123", HeadSha: "head123"}, "comments.json")
+	if !strings.Contains(prompt, "0 unchanged lines of context") || !strings.Contains(prompt, "git diff -U0 base123..HEAD") {
+		t.Error("expected a diff without context lines for a context of 0")
+	}
+}
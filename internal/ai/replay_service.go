@@ -0,0 +1,47 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+// ReplayService returns comments saved from an earlier run instead of running a model, for hermetic tests and CI.
+type ReplayService struct {
+	replayFile string
+}
+
+var _ api.AIAgentService = (*ReplayService)(nil)
+
+func NewReplayService(cfg *api.Config) (*ReplayService, error) {
+	if cfg.ReplayFile == "" {
+		return nil, errors.New("replay file is not set")
+	}
+	return &ReplayService{
+		replayFile: cfg.ReplayFile,
+	}, nil
+}
+
+func (r *ReplayService) GeneratePRInlineComments(options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+	return r.GeneratePRInlineCommentsWithContext(context.Background(), options)
+}
+
+func (r *ReplayService) GeneratePRInlineCommentsWithContext(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(r.replayFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replay file: %w", err)
+	}
+
+	var comments []*api.InlineComment
+	if err := json.Unmarshal(data, &comments); err != nil {
+		return nil, fmt.Errorf("error unmarshaling replay file: %w", err)
+	}
+	return comments, nil
+}
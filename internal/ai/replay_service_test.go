@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestNewReplayService(t *testing.T) {
+	t.Run("requires replay file", func(t *testing.T) {
+		if _, err := NewReplayService(&api.Config{}); err == nil {
+			t.Error("expected error when replay file is not set")
+		}
+	})
+
+	t.Run("stores replay file", func(t *testing.T) {
+		svc, err := NewReplayService(&api.Config{ReplayFile: "comments.json"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if svc.replayFile != "comments.json" {
+			t.Errorf("replayFile = %q, want %q", svc.replayFile, "comments.json")
+		}
+	})
+}
+
+func TestReplayService_GeneratePRInlineComments(t *testing.T) {
+	writeFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "comments.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write replay file: %v", err)
+		}
+		return path
+	}
+
+	t.Run("returns saved comments", func(t *testing.T) {
+		path := writeFile(t, `[{"body": "finding", "position": {"new_path": "main.go", "new_line": 7, "line_type": "ADD"}}]`)
+		svc := &ReplayService{replayFile: path}
+
+		comments, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(comments) != 1 {
+			t.Fatalf("expected 1 comment, got %d", len(comments))
+		}
+		if *comments[0].Body != "finding" || *comments[0].Position.NewPath != "main.go" || *comments[0].Position.NewLine != 7 {
+			t.Errorf("unexpected comment: %+v", comments[0])
+		}
+	})
+
+	t.Run("error when file is missing", func(t *testing.T) {
+		svc := &ReplayService{replayFile: filepath.Join(t.TempDir(), "missing.json")}
+		if _, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{}); err == nil {
+			t.Error("expected error for missing file")
+		}
+	})
+
+	t.Run("error on invalid json", func(t *testing.T) {
+		svc := &ReplayService{replayFile: writeFile(t, `not json`)}
+		if _, err := svc.GeneratePRInlineComments(&api.GeneratePRInlineCommentsOptions{}); err == nil {
+			t.Error("expected error for invalid json")
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		svc := &ReplayService{replayFile: writeFile(t, `[]`)}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := svc.GeneratePRInlineCommentsWithContext(ctx, &api.GeneratePRInlineCommentsOptions{}); err == nil {
+			t.Error("expected error for cancelled context")
+		}
+	})
+}
@@ -0,0 +1,18 @@
+package ai
+
+import "github.com/eridan-ltu/gitex/api"
+
+// toneInstructions tell the model how to phrase comments. They only change the wording, never what is reported.
+var toneInstructions = map[string]string{
+	"concise":  "Phrase every comment in one or two plain sentences: the problem, then the fix. No greetings, praise or filler.",
+	"friendly": "Phrase every comment as a collegial suggestion, explain briefly why it matters, and acknowledge when the surrounding code is good.",
+	"strict":   "Phrase every comment as a direct, unambiguous requirement, state the risk it addresses, and do not soften the wording.",
+}
+
+// toneInstruction returns the phrasing instruction of the configured tone, concise when none is set.
+func toneInstruction(cfg *api.Config) string {
+	if instruction, ok := toneInstructions[cfg.Tone]; ok {
+		return instruction
+	}
+	return toneInstructions["concise"]
+}
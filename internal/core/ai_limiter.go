@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"runtime"
+)
+
+// aiLimiter caps how many AI agent invocations run at once across the reviews of one App or Server. Every
+// GeneratePRInlineComments call takes one slot, so a review split into several agent calls holds one slot per call
+// and never more than the limit in total.
+type aiLimiter struct {
+	slots chan struct{}
+}
+
+// newAILimiter allows max concurrent invocations, one per CPU when max is not positive.
+func newAILimiter(max int) *aiLimiter {
+	if max <= 0 {
+		max = runtime.NumCPU()
+	}
+	return &aiLimiter{slots: make(chan struct{}, max)}
+}
+
+// acquire blocks until a slot is free or ctx is done. onWait is called once when the caller has to wait.
+func (l *aiLimiter) acquire(ctx context.Context, onWait func()) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if onWait != nil {
+		onWait()
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *aiLimiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAILimiter(t *testing.T) {
+	t.Run("defaults to the cpu count", func(t *testing.T) {
+		if got := cap(newAILimiter(0).slots); got != runtime.NumCPU() {
+			t.Errorf("slots = %d, want %d", got, runtime.NumCPU())
+		}
+	})
+
+	t.Run("waits for a released slot", func(t *testing.T) {
+		l := newAILimiter(1)
+		if err := l.acquire(context.Background(), func() { t.Error("first acquire should not wait") }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		waited := make(chan struct{})
+		acquired := make(chan error)
+		go func() {
+			acquired <- l.acquire(context.Background(), func() { close(waited) })
+		}()
+		<-waited
+		l.release()
+		if err := <-acquired; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("gives up when the context is done", func(t *testing.T) {
+		l := newAILimiter(1)
+		_ = l.acquire(context.Background(), nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := l.acquire(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded, got %v", err)
+		}
+	})
+}
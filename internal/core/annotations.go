@@ -0,0 +1,79 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// Output formats for the findings of a run, next to the comments posted on the pull request.
+const (
+	OutputFormatText          = "text"
+	OutputFormatGitHubActions = "github-actions"
+	OutputFormatJSON          = "json"
+)
+
+// writeCommentsJSON prints the comments as an indented JSON array, as the agent returned them after filtering, to see
+// exactly what is posted when tuning prompts.
+func writeCommentsJSON(w io.Writer, comments []*api.InlineComment) error {
+	if comments == nil {
+		comments = []*api.InlineComment{}
+	}
+	data, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode comments: %w", err)
+	}
+	_, _ = fmt.Fprintf(w, "%s\n", data)
+	return nil
+}
+
+// writeGitHubAnnotations prints the comments as GitHub Actions workflow commands, which Actions shows in the log and
+// on the changed files. Lines only exist in the head commit, so comments on removed lines annotate the whole file.
+func writeGitHubAnnotations(w io.Writer, comments []*api.InlineComment) {
+	for _, comment := range comments {
+		if comment == nil || comment.Position == nil {
+			continue
+		}
+		props := []string{"file=" + escapeAnnotationProperty(commentPath(comment))}
+		if start, end := annotationLines(comment.Position); start > 0 {
+			props = append(props, fmt.Sprintf("line=%d", start))
+			if end > start {
+				props = append(props, fmt.Sprintf("endLine=%d", end))
+			}
+		}
+		title := "gitex"
+		if comment.Category != "" {
+			title += " " + comment.Category
+		}
+		props = append(props, "title="+escapeAnnotationProperty(title))
+		_, _ = fmt.Fprintf(w, "::warning %s::%s\n", strings.Join(props, ","), escapeAnnotationData(util.GetOrDefault(comment.Body, "")))
+	}
+}
+
+func annotationLines(pos *api.InlineCommentPosition) (int64, int64) {
+	if pos.IsImage() || pos.DeletedFile {
+		return 0, 0
+	}
+	if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.Start != nil && pos.LineRange.End != nil {
+		if pos.LineRange.Start.NewLine != nil && pos.LineRange.End.NewLine != nil {
+			return *pos.LineRange.Start.NewLine, *pos.LineRange.End.NewLine
+		}
+		return 0, 0
+	}
+	if pos.NewLine != nil {
+		return *pos.NewLine, *pos.NewLine
+	}
+	return 0, 0
+}
+
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
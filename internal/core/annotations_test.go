@@ -0,0 +1,54 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestWriteGitHubAnnotations(t *testing.T) {
+	comments := []*api.InlineComment{
+		{
+			Body:     util.Ptr("Possible nil dereference\n100% sure"),
+			Category: "nil-safety",
+			Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(12))},
+		},
+		{
+			Body: util.Ptr("block"),
+			Position: &api.InlineCommentPosition{
+				NewPath:     util.Ptr("dir,a/b:c.go"),
+				CommentType: "MULTI_LINE",
+				LineRange: &api.LineRangeOptions{
+					Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(3))},
+					End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(5))},
+				},
+			},
+		},
+		{
+			Body:     util.Ptr("removed check"),
+			Position: &api.InlineCommentPosition{OldPath: util.Ptr("old.go"), OldLine: util.Ptr(int64(4))},
+		},
+		nil,
+	}
+
+	var out bytes.Buffer
+	writeGitHubAnnotations(&out, comments)
+
+	want := []string{
+		"::warning file=main.go,line=12,title=gitex nil-safety::Possible nil dereference%0A100%25 sure",
+		"::warning file=dir%2Ca/b%3Ac.go,line=3,endLine=5,title=gitex::block",
+		"::warning file=old.go,title=gitex::removed check",
+	}
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("got %d annotations, want %d:\n%s", len(got), len(want), out.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("annotation %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
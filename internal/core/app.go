@@ -2,62 +2,225 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
-	"regexp"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+	"github.com/eridan-ltu/gitex/internal/vcs"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+	"golang.org/x/sync/errgroup"
 )
 
-var sanitizeRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+// ErrDiffNotReady is returned when the provider has not computed the diff refs of a freshly opened pull request.
+var ErrDiffNotReady = errors.New("PR diff not ready yet, retry shortly")
+
+// Clone fallbacks used when the source branch of a pull request cannot be cloned. The empty default clones the commit.
+const (
+	CloneFallbackCommit        = "commit"
+	CloneFallbackDefaultBranch = "default-branch"
+	CloneFallbackNone          = "none"
+)
+
+// Tags a clone fetches. The empty default fetches none.
+const (
+	CloneTagsNone = "none"
+	CloneTagsAll  = "all"
+)
+
+// Transports the repository is cloned over. The empty default clones over https with the api key.
+const (
+	GitTransportHTTPS = "https"
+	GitTransportSSH   = "ssh"
+)
+
+// Timeouts of the clone and of the AI agent review when -clone-timeout and -agent-timeout are not set.
+const (
+	DefaultCloneTimeout = 2 * time.Minute
+	DefaultAgentTimeout = 10 * time.Minute
+)
+
+// diffFileName is the file the pull request diff is stored in when the repository is not cloned.
+const diffFileName = "pr.diff"
+
+// diffRefsRetryDelays is how long to wait before each refetch of a pull request that has no base or head sha.
+var diffRefsRetryDelays = []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
 
 type App struct {
-	factory ServiceFactoryInterface
-	stdout  io.Writer
-	stderr  io.Writer
+	cfg       *api.Config
+	factory   ServiceFactoryInterface
+	stdout    io.Writer
+	stderr    io.Writer
+	aiLimiter *aiLimiter
+	// ignoreSignals leaves SIGINT and SIGTERM to the embedding process
+	ignoreSignals bool
+}
+
+// AppOption customizes an App created by NewAppWithOptions.
+type AppOption func(*App)
+
+// WithoutSignalHandler keeps Run from stopping the review on SIGINT and SIGTERM, for processes that embed gitex and
+// handle signals themselves. The review then only stops when the context passed to RunWithContext is done.
+func WithoutSignalHandler() AppOption {
+	return func(a *App) {
+		a.ignoreSignals = true
+	}
+}
+
+// WithWriters sends the progress output to stdout and warnings to stderr instead of the process's.
+func WithWriters(stdout, stderr io.Writer) AppOption {
+	return func(a *App) {
+		a.stdout = stdout
+		a.stderr = stderr
+	}
+}
+
+// WithServerAILimiter makes the App take its AI process slots from s, so reviews run next to a serving Server stay
+// within one -max-ai-processes limit.
+func WithServerAILimiter(s *Server) AppOption {
+	return func(a *App) {
+		a.aiLimiter = s.aiLimiter
+	}
 }
 
-func NewApp(factory ServiceFactoryInterface) *App {
+func NewApp(cfg *api.Config, factory ServiceFactoryInterface) *App {
 	return &App{
-		factory: factory,
-		stdout:  os.Stdout,
-		stderr:  os.Stderr,
+		cfg:       cfg,
+		factory:   factory,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		aiLimiter: newAILimiter(cfg.MaxAiProcesses),
 	}
 }
 
 // NewAppWithWriters for testing purposes only for now
-func NewAppWithWriters(factory ServiceFactoryInterface, stdout, stderr io.Writer) *App {
+func NewAppWithWriters(cfg *api.Config, factory ServiceFactoryInterface, stdout, stderr io.Writer) *App {
 	return &App{
-		factory: factory,
-		stdout:  stdout,
-		stderr:  stderr,
+		cfg:       cfg,
+		factory:   factory,
+		stdout:    stdout,
+		stderr:    stderr,
+		aiLimiter: newAILimiter(cfg.MaxAiProcesses),
+	}
+}
+
+// NewAppWithOptions is NewApp customized by opts, for embedding gitex in another program.
+func NewAppWithOptions(cfg *api.Config, factory ServiceFactoryInterface, opts ...AppOption) *App {
+	a := NewApp(cfg, factory)
+	for _, opt := range opts {
+		opt(a)
 	}
+	return a
 }
 
 func (a *App) Run(mrUrl string) error {
-	vcsProviderType, err := a.factory.DetectVCSProviderType(mrUrl)
+	return a.RunWithContext(context.Background(), mrUrl)
+}
+
+// RunWithContext is Run with a context that stops the clone and the review when it is done. A run that failed
+// transiently before posting anything is repeated from scratch up to RunRetries times.
+func (a *App) RunWithContext(runCtx context.Context, mrUrl string) error {
+	return a.runWithRetries(runCtx, mrUrl)
+}
+
+// runOnce is a single attempt of a run, recording in attempt what a retry has to know about it.
+func (a *App) runOnce(runCtx context.Context, mrUrl string, attempt *runAttempt) (err error) {
+	if err := a.cfg.Validate(); err != nil {
+		return err
+	}
+	scope, err := diff.NewScope(a.cfg.SubPath)
 	if err != nil {
-		return fmt.Errorf("failed to detect VCS provider type: %w", err)
+		return fmt.Errorf("invalid subpath: %w", err)
 	}
-	if vcsProviderType == VCSProviderTypeUnknown {
-		return fmt.Errorf("unsupported VCS provider for URL: %s", mrUrl)
+	excludes, err := newExcludes(a.cfg)
+	if err != nil {
+		return err
+	}
+	scope.Exclude = excludes.Globs()
+	scope.Include = excludes.IncludeGlobs()
+	scope.ContextLines = a.cfg.DiffContext
+	scope.Algorithm = a.cfg.DiffAlgorithm
+	if a.cfg.StatusContext != "" {
+		if err := vcs_provider.ValidateStatusContext(a.cfg.StatusContext); err != nil {
+			return fmt.Errorf("invalid status context: %w", err)
+		}
+	}
+	redactor, err := loadRedactor(a.cfg.RedactPatternsFile)
+	if err != nil {
+		return err
+	}
+	if a.cfg.OutputFile != "" {
+		if err := checkOutputFile(a.cfg.OutputFile); err != nil {
+			return err
+		}
+	}
+	var ownershipAreas []ownershipArea
+	if a.cfg.OwnershipFile != "" {
+		ownershipAreas, err = loadOwnershipContext(a.cfg.OwnershipFile)
+		if err != nil {
+			return err
+		}
 	}
-	_, _ = fmt.Fprintf(a.stdout, "VCS provider type: %s\n", vcsProviderType)
 
-	vcsProviderService, err := a.factory.CreateVCSProvider(vcsProviderType)
+	if mrUrl == "" {
+		mrUrl, err = a.detectPullRequestURL()
+		if err != nil {
+			return fmt.Errorf("failed to detect pull request: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stdout, "Detected pull request: %s\n", mrUrl)
+	}
+
+	vcsProviderType, vcsProviderService, err := a.createVCSProvider(mrUrl)
 	if err != nil {
-		return fmt.Errorf("failed to create VCS provider service: %w", err)
+		return err
+	}
+	if err := a.checkIdentity(vcsProviderService, vcsProviderType); err != nil {
+		return err
 	}
 
-	prInfo, err := vcsProviderService.GetPullRequestInfo(&mrUrl)
+	prInfo, err := a.getPullRequestInfo(runCtx, vcsProviderService, mrUrl)
 	if err != nil {
-		return fmt.Errorf("failed to get PR info: %w", err)
+		return err
+	}
+
+	switch {
+	case prInfo.MergeStatus == api.MergeStatusConflict && a.cfg.SkipConflicts:
+		_, _ = fmt.Fprintln(a.stdout, "PR has merge conflicts, skipping the review until they are resolved")
+		return nil
+	case prInfo.MergeStatus == api.MergeStatusConflict:
+		_, _ = fmt.Fprintln(a.stderr, "Warning: PR has merge conflicts, its diff may change once they are resolved")
+	case prInfo.MergeStatus == api.MergeStatusChecking && a.cfg.SkipConflicts:
+		_, _ = fmt.Fprintln(a.stderr, "Warning: PR mergeability is still being computed, reviewing anyway")
 	}
 
+	if a.cfg.TrackReactions {
+		a.reportReactions(vcsProviderService, vcsProviderType, prInfo)
+	}
+	var ownerHandles []string
+	if a.cfg.OwnFilesOnly {
+		ownerHandles, err = a.resolveOwnerHandles(vcsProviderService, vcsProviderType)
+		if err != nil {
+			return err
+		}
+	}
+
+	status := a.newCommitStatus(vcsProviderService, vcsProviderType, prInfo)
+	status.set(api.CommitStatusPending, "Review in progress")
+	defer func() {
+		if err != nil {
+			status.set(api.CommitStatusFailure, "Review failed")
+		}
+	}()
+
 	tempDir, err := os.MkdirTemp("", sanitizeProjectName(prInfo.ProjectName)+"-*")
 	if err != nil {
 		return fmt.Errorf("failed to create temp directory: %w", err)
@@ -68,60 +231,797 @@ func (a *App) Run(mrUrl string) error {
 		}
 	}()
 
+	compareDiff, noClone, err := a.fetchCompareDiff(vcsProviderService, vcsProviderType, prInfo)
+	if err != nil {
+		return err
+	}
+	if redactor != nil && !noClone {
+		return errors.New("redaction needs the pull request diff, refusing to clone: the agent would read the unredacted checkout")
+	}
+
 	gitService, err := a.factory.CreateVersionControlService(VCSTypeGit)
 	if err != nil {
 		return fmt.Errorf("failed to create version control service: %w", err)
 	}
 
-	cloneCtx, cloneCancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cloneCancel()
-	if err := gitService.CloneRepoWithContext(cloneCtx, tempDir, prInfo.ProjectHttpUrl, prInfo.SourceBranch); err != nil {
-		return fmt.Errorf("failed to clone repo: %w", err)
+	aiAgentType := api.AIAgentTypeCodex
+	if a.cfg.AiAgent != "" {
+		aiAgentType = api.AIAgentType(a.cfg.AiAgent)
 	}
-	_, _ = fmt.Fprintf(a.stdout, "Successfully cloned repo: %s\n", prInfo.ProjectName)
+	// a dry run without an AI key checks detection and cloning, and stands in placeholder comments for the review
+	placeholder := a.cfg.DryRun && a.cfg.AiApiKey == "" && aiAgentType != api.AIAgentTypeReplay
 
-	aiAgent, err := a.factory.CreateAiAgentService(AIAgentTypeCodex)
-	if err != nil {
-		return fmt.Errorf("failed to create agent service: %w", err)
+	// the clone and the agent setup, an npm install on a cold runner, do not depend on each other. The first
+	// failure cancels the other one and is the one reported.
+	var aiAgent api.AIAgentService
+	setup, setupCtx := errgroup.WithContext(runCtx)
+	if !noClone {
+		setup.Go(func() error {
+			cloneCtx, cloneCancel := context.WithTimeout(setupCtx, timeoutOrDefault(a.cfg.CloneTimeout, DefaultCloneTimeout))
+			defer cloneCancel()
+			if err := a.cloneRepo(cloneCtx, gitService, tempDir, prInfo); err != nil {
+				return fmt.Errorf("failed to clone repo: %w", err)
+			}
+			_, _ = fmt.Fprintf(a.stdout, "Successfully cloned repo: %s\n", prInfo.ProjectName)
+			return nil
+		})
+	}
+	if !placeholder {
+		setup.Go(func() error {
+			var err error
+			aiAgent, err = createAiAgent(setupCtx, a.factory, aiAgentType)
+			if err != nil {
+				return fmt.Errorf("failed to create agent service: %w", err)
+			}
+			return nil
+		})
+	}
+	if err := setup.Wait(); err != nil {
+		return err
 	}
 
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 10*time.Minute)
+	// the review may span more than the pull request, comments are still posted against the pull request diff
+	reviewBase, reviewHead := prInfo.BaseSha, prInfo.HeadSha
+	if prInfo.MergeQueueSha != "" {
+		reviewBase, reviewHead = prInfo.MergeQueueBaseSha, prInfo.MergeQueueSha
+		_, _ = fmt.Fprintf(a.stdout, "Reviewing merge queue commit %s\n", reviewHead)
+	}
+	if a.cfg.BaseTag != "" {
+		reviewBase, err = a.resolveBaseTag(runCtx, gitService, tempDir)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(a.stdout, "Reviewing changes since tag %s (%s)\n", a.cfg.BaseTag, reviewBase)
+	}
+	if !noClone && a.cfg.CloneDepth > 0 {
+		if err := a.fetchReviewBase(runCtx, gitService, tempDir, reviewBase); err != nil {
+			return err
+		}
+	}
+	if len(a.cfg.Commits) > 0 {
+		scope.Commits, err = a.selectCommits(runCtx, gitService, tempDir, reviewBase, reviewHead)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancelFunc := context.WithTimeout(runCtx, timeoutOrDefault(a.cfg.AgentTimeout, DefaultAgentTimeout))
 	defer cancelFunc()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
+	if !a.ignoreSignals {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		go func(done <-chan struct{}) {
+			select {
+			case <-sigChan:
+				attempt.interrupted.Store(true)
+				cancelFunc()
+			case <-done:
+			}
+		}(ctx.Done())
+		defer signal.Stop(sigChan)
+	}
+
+	var prDiff *diff.Diff
+	if placeholder || a.cfg.IncludeHunk || len(a.cfg.Files) > 0 || a.cfg.MinDiffLines > 0 || a.cfg.SummaryFileList || len(ownershipAreas) > 0 || a.cfg.TopFiles > 0 || a.cfg.MaxFiles > 0 || a.cfg.MaxDiffBytes > 0 || usesDiffFilters(a.cfg) || (a.cfg.LinkifyReferences && noClone) {
+		switch {
+		case noClone:
+			prDiff, err = diff.Parse(compareDiff)
+		case len(scope.Commits) > 0:
+			prDiff, err = a.loadCommitsDiff(ctx, gitService, tempDir, scope.Commits)
+		default:
+			prDiff, err = a.loadDiff(ctx, gitService, tempDir, reviewBase, reviewHead)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(a.stderr, "Warning: skipping diff based filters: %v\n", err)
+		}
+	}
+	if len(a.cfg.Files) > 0 {
+		if prDiff == nil {
+			return errors.New("cannot pick the files to review without the PR diff")
+		}
+		excludes, err = a.limitToFiles(prDiff, scope, excludes)
+		if err != nil {
+			return err
+		}
+		scope.Exclude = excludes.Globs()
+	}
+	if prDiff != nil && a.cfg.MinDiffLines > 0 {
+		if changed := changedLines(changedFiles(prDiff, scope, excludes)); changed < a.cfg.MinDiffLines {
+			summary := fmt.Sprintf("PR too small to review, %d changed lines", changed)
+			_, _ = fmt.Fprintln(a.stdout, summary)
+			status.set(api.CommitStatusSuccess, summary)
+			return nil
+		}
+	}
+	if prDiff != nil && a.cfg.SummaryFileList {
+		prInfo.ChangedFiles = changedFiles(prDiff, scope, excludes)
+	}
+	var skippedFiles int
+	if prDiff != nil && a.cfg.TopFiles > 0 {
+		limited, skipped, err := a.limitToTopFiles(prDiff, scope, excludes, a.cfg.TopFiles)
+		if err != nil {
+			_, _ = fmt.Fprintf(a.stderr, "Warning: reviewing all files: %v\n", err)
+		} else {
+			excludes, skippedFiles = limited, skipped
+			scope.Exclude = excludes.Globs()
+		}
+	}
+	// a note for the summaries when the file limit cut the review short
+	var limitNote string
+	if prDiff != nil && a.cfg.MaxFiles > 0 {
+		if files := len(changedFiles(prDiff, scope, excludes)); files > a.cfg.MaxFiles {
+			if a.cfg.OnTooManyFiles == TooManyFilesAbort {
+				return fmt.Errorf("PR changes %d files, more than the maximum of %d", files, a.cfg.MaxFiles)
+			}
+			limited, skipped, err := a.limitToTopFiles(prDiff, scope, excludes, a.cfg.MaxFiles)
+			if err != nil {
+				return err
+			}
+			excludes, skippedFiles = limited, skipped
+			scope.Exclude = excludes.Globs()
+			limitNote = tooManyFilesNote(a.cfg.MaxFiles, skipped)
+		}
+	}
+	var sizeSkipped []string
+	if a.cfg.MaxDiffBytes > 0 {
+		if prDiff == nil {
+			_, _ = fmt.Fprintln(a.stderr, "Warning: reviewing the whole diff, its size is unknown")
+		} else {
+			limited, skipped, err := a.limitDiffBytes(prDiff, scope, excludes, a.cfg.MaxDiffBytes)
+			if err != nil {
+				return err
+			}
+			excludes, sizeSkipped = limited, skipped
+			skippedFiles += len(skipped)
+			scope.Exclude = excludes.Globs()
+		}
+	}
+
+	// notes of areas the review skipped would only distract the model
+	var notes []string
+	if prDiff != nil && len(ownershipAreas) > 0 {
+		notes = pathContext(ownershipAreas, changedFiles(prDiff, scope, excludes))
+	}
+
+	options := &api.GeneratePRInlineCommentsOptions{
+		SandBoxDir:    tempDir,
+		BaseSha:       reviewBase,
+		StartSha:      prInfo.StartSha,
+		HeadSha:       prInfo.HeadSha,
+		SubPath:       scope.SubPath,
+		Exclude:       scope.Exclude,
+		Include:       scope.Include,
+		DiffContext:   scope.ContextLines,
+		DiffAlgorithm: scope.Algorithm,
+		PathContext:   notes,
+		KeepPartial:   a.cfg.UsePartialOnTimeout,
+		Commits:       scope.Commits,
+		Provider:      vcsProviderType,
+	}
+	if a.cfg.RepoContext > 0 {
+		if noClone {
+			_, _ = fmt.Fprintln(a.stdout, "Repository context needs a checkout, the diff was fetched without one, skipping")
+		} else {
+			options.RepoContext = a.repoContext(runCtx, gitService, tempDir)
+		}
+	}
+	var redaction *diff.Redaction
+	if noClone {
+		var redacted string
+		redacted, redaction = redactor.Redact(compareDiff)
+		if redaction.Count() > 0 {
+			_, _ = fmt.Fprintf(a.stdout, "Redacted %d values from the diff\n", redaction.Count())
+		}
+		// the stored diff is already scoped and keeps repository paths, so the comments are not restored either
+		options.DiffFile, err = writeScopedDiff(tempDir, redacted, scope, excludes)
+		if err != nil {
+			return err
+		}
+		options.SubPath = ""
+	}
+
+	var comments []*api.InlineComment
+	var truncated bool
+	if placeholder {
+		_, _ = fmt.Fprintln(a.stdout, "No AI key, dry run posts placeholder comments instead of a review")
+		comments = placeholderComments(prDiff, prInfo)
+	} else {
+		if err := a.aiLimiter.acquire(ctx, func() {
+			_, _ = fmt.Fprintln(a.stdout, "Waiting for a free AI process slot")
+		}); err != nil {
+			return fmt.Errorf("failed to wait for an AI process slot: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stdout, "Starting PR analysis at %s\n", prInfo.SourceBranch)
+		comments, err = aiAgent.GeneratePRInlineCommentsWithContext(ctx, options)
+		a.aiLimiter.release()
+		if errors.Is(err, api.ErrReviewTruncated) {
+			_, _ = fmt.Fprintf(a.stderr, "Warning: posting a truncated review: %v\n", err)
+			truncated = true
+			// the review used up the agent's time, give posting a little of its own. It still ends with the run, a
+			// canceled run posts nothing more.
+			postCtx, postCancel := context.WithTimeout(runCtx, 2*time.Minute)
+			defer postCancel()
+			ctx, err = postCtx, nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to generate inline comments: %w", err)
+		}
+		if !noClone {
+			scope.RestoreCommentPaths(comments)
+		}
+		redaction.RestoreComments(comments)
+	}
+	var descriptionReview string
+	if a.cfg.ReviewDescription && !placeholder && !truncated {
+		descriptionReview = redaction.Restore(a.reviewDescription(ctx, aiAgent, options, prInfo))
+	}
+	if reviewBase != prInfo.BaseSha {
+		// providers anchor comments on the pull request diff, not on the reviewed range
+		for _, comment := range comments {
+			if comment != nil && comment.Position != nil {
+				comment.Position.BaseSha = util.Ptr(prInfo.BaseSha)
+			}
+		}
+	}
+
+	dropped := &droppedReport{}
+	comments = validateComments(comments, dropped)
+	comments = excludeComments(comments, excludes, dropped)
+	suppressed, err := loadSuppressedCategories(tempDir)
+	if err != nil {
+		_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+	}
+	comments = suppressComments(comments, suppressed, dropped)
+	if a.cfg.IgnoreMarker != "" && !noClone {
+		comments = ignoreMarkedLines(comments, tempDir, a.cfg.IgnoreMarker, dropped)
+	}
+	if a.cfg.OwnFilesOnly {
+		owners, err := loadCodeowners(tempDir)
+		if err != nil {
+			return err
+		}
+		if owners == nil {
+			_, _ = fmt.Fprintln(a.stderr, "Warning: repository has no CODEOWNERS file, no files are owned by the token's teams")
+		}
+		comments = filterOwnedComments(comments, owners, ownerHandles, dropped)
+	}
+	comments = filterOnDiff(a.cfg, comments, prDiff, tempDir, a.stdout, dropped)
+	if a.cfg.SkipOpenThreads {
+		threads, err := a.priorThreads(vcsProviderService, vcsProviderType, prInfo)
+		switch {
+		case errors.Is(err, vcs_provider.ErrUnauthorized):
+			return err
+		case err != nil:
+			_, _ = fmt.Fprintf(a.stderr, "Warning: commenting on all lines: %v\n", err)
+		default:
+			comments = skipOpenThreads(comments, threads, dropped)
+		}
+	}
+	if len(dropped.entries) > 0 {
+		_, _ = fmt.Fprintf(a.stdout, "Dropped %d comments\n", len(dropped.entries))
+	}
+	if prDiff != nil && a.cfg.IncludeHunk {
+		attachHunks(comments, prDiff)
+	}
+	if a.cfg.LinkifyReferences {
+		a.linkifyReferences(comments, vcsProviderService, prInfo, tempDir, prDiff, noClone)
+	}
+	if a.cfg.MaxCommentsPerFile > 0 {
+		if folded := foldExcessComments(comments, a.cfg.MaxCommentsPerFile); folded > 0 {
+			_, _ = fmt.Fprintf(a.stdout, "Folded %d comments on files with more than %d into the summary\n", folded, a.cfg.MaxCommentsPerFile)
+		}
+	}
+	if a.cfg.DroppedReport != "" {
+		if err := dropped.write(a.cfg.DroppedReport); err != nil {
+			_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		}
+	}
+	if a.cfg.SummaryFile != "" {
+		written, err := writeSummaryFile(tempDir, a.cfg.SummaryFile, prInfo.ChangedFilesTable()+limitNote)
+		switch {
+		case err != nil:
+			_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		case !written:
+			_, _ = fmt.Fprintln(a.stderr, "Warning: the agent wrote no review summary, skipping the summary file")
+		}
+	}
+	var reviewSummary string
+	if a.cfg.PostSummary && !placeholder {
+		summary, err := readReviewSummary(tempDir)
+		switch {
+		case err != nil:
+			_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		case strings.TrimSpace(summary) == "":
+			_, _ = fmt.Fprintln(a.stderr, "Warning: the agent wrote no review summary, skipping the summary comment")
+		default:
+			reviewSummary = limitNote + redaction.Restore(summary)
+		}
+	}
+
+	if a.cfg.OutputFile != "" {
+		summary, err := readReviewSummary(tempDir)
+		if err != nil {
+			_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		}
+		if summary != "" {
+			summary = limitNote + redaction.Restore(summary)
+		}
+		if err := writeOutputFile(a.cfg.OutputFile, comments, strings.TrimSpace(summary)); err != nil {
+			return err
+		}
+	}
+
+	switch a.cfg.OutputFormat {
+	case OutputFormatGitHubActions:
+		writeGitHubAnnotations(a.stdout, comments)
+	case OutputFormatJSON:
+		if err := writeCommentsJSON(a.stdout, comments); err != nil {
+			_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if a.cfg.DryRun {
+		// the JSON already lists every comment
+		if a.cfg.OutputFormat != OutputFormatJSON {
+			writeDryRunComments(a.stdout, comments)
+		}
+		if descriptionReview != "" {
+			_, _ = fmt.Fprintf(a.stdout, "Would comment on the description:\n%s\n", descriptionReview)
+		}
+		if reviewSummary != "" {
+			_, _ = fmt.Fprintf(a.stdout, "Would post the review summary:\n%s\n", strings.TrimSpace(reviewSummary))
+		}
+		if truncated {
+			_, _ = fmt.Fprintf(a.stdout, "Would note that the review was truncated:\n%s\n", fmt.Sprintf(truncationNote, len(comments)))
+		}
+		if len(sizeSkipped) > 0 {
+			_, _ = fmt.Fprintf(a.stdout, "Would note the skipped large files:\n%s\n", skippedFilesNote(a.cfg.MaxDiffBytes, sizeSkipped))
+		}
+		_, _ = fmt.Fprintf(a.stdout, "Dry run finished, %d comments not posted\n", len(comments))
+		return nil
+	}
+
+	_, _ = fmt.Fprintln(a.stdout, "Pushing comments to VCS provider")
+	attempt.posted = true
+	var failed int
+	if err := vcsProviderService.SendInlineComments(comments, prInfo); err != nil {
+		if a.cfg.FailFast || errors.Is(err, vcs_provider.ErrUnauthorized) || errors.Is(err, vcs_provider.ErrPermissionDenied) {
+			return fmt.Errorf("failed to send comments: %w", err)
+		}
+		var sendErr *vcs_provider.SendError
+		if errors.As(err, &sendErr) {
+			failed = sendErr.Failed
+		}
+		a.warnSendError(err)
+	}
+	if reviewSummary != "" {
+		if err := a.postReviewSummary(vcsProviderService, vcsProviderType, prInfo, reviewSummary); err != nil {
+			return err
+		}
+	}
+	if descriptionReview != "" {
+		if err := a.postDescriptionReview(vcsProviderService, vcsProviderType, prInfo, descriptionReview); err != nil {
+			return err
+		}
+	}
+	if truncated {
+		if err := a.postTruncationNote(vcsProviderService, vcsProviderType, prInfo, len(comments)-failed); err != nil {
+			return err
+		}
+	}
+	if len(sizeSkipped) > 0 {
+		if err := a.postSkippedFilesNote(vcsProviderService, vcsProviderType, prInfo, sizeSkipped); err != nil {
+			return err
+		}
+	}
+	if a.cfg.ApplyLabel != "" {
+		if err := a.applyLabel(vcsProviderService, vcsProviderType, prInfo); err != nil {
+			return err
+		}
+	}
+	if a.cfg.PostHook != "" {
+		result := &hookResult{
+			PullRequestURL: mrUrl,
+			Provider:       vcsProviderType,
+			HeadSha:        prInfo.HeadSha,
+			Comments:       len(comments) - failed,
+			Failed:         failed,
+			Dropped:        len(dropped.entries),
+			SkippedFiles:   skippedFiles,
+			Findings:       comments,
+		}
+		if err := a.runPostHook(ctx, a.cfg.PostHook, a.cfg.PostHookTimeout, result); err != nil {
+			_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		}
+	}
+	summary := fmt.Sprintf("Review finished, %d comments", len(comments))
+	if truncated {
+		summary = fmt.Sprintf("Review truncated, %d comments", len(comments))
+	}
+	if skippedFiles > 0 {
+		summary += fmt.Sprintf(", %d files skipped", skippedFiles)
+	}
+	_, _ = fmt.Fprintln(a.stdout, summary)
+	status.set(api.CommitStatusSuccess, summary)
+	_, _ = fmt.Fprintf(a.stdout, "Finished PR analysis at %s\n", prInfo.SourceBranch)
+	return nil
+}
+
+// getPullRequestInfo fetches the pull request, refetching with backoff while the provider has not computed the
+// base and head shas yet, which happens right after a pull request is opened, or with -skip-conflicts whether it
+// merges cleanly. Canceling ctx stops the waiting.
+func (a *App) getPullRequestInfo(ctx context.Context, vcsProviderService api.RemoteGitService, mrUrl string) (*api.PullRequestInfo, error) {
+	for attempt := 0; ; attempt++ {
+		prInfo, err := vcsProviderService.GetPullRequestInfo(&mrUrl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PR info: %w", err)
+		}
+		ready := prInfo.BaseSha != "" && prInfo.HeadSha != ""
+		// skipping conflicted pull requests needs to know whether they are, a clean run does not have to wait
+		checking := a.cfg.SkipConflicts && prInfo.MergeStatus == api.MergeStatusChecking
+		if ready && !checking {
+			return prInfo, nil
+		}
+		if attempt >= len(diffRefsRetryDelays) {
+			if !ready {
+				return nil, ErrDiffNotReady
+			}
+			return prInfo, nil
+		}
+		if ready {
+			_, _ = fmt.Fprintf(a.stdout, "PR mergeability not computed yet, retrying in %s\n", diffRefsRetryDelays[attempt])
+		} else {
+			_, _ = fmt.Fprintf(a.stdout, "PR diff not ready yet, retrying in %s\n", diffRefsRetryDelays[attempt])
+		}
+		timer := time.NewTimer(diffRefsRetryDelays[attempt])
 		select {
-		case <-sigChan:
-			cancelFunc()
 		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("failed to get PR info: %w", ctx.Err())
+		case <-timer.C:
 		}
-	}()
-	defer signal.Stop(sigChan)
-
-	_, _ = fmt.Fprintf(a.stdout, "Starting PR analysis at %s\n", prInfo.SourceBranch)
-	comments, err := aiAgent.GeneratePRInlineCommentsWithContext(ctx, &api.GeneratePRInlineCommentsOptions{
-		SandBoxDir: tempDir,
-		BaseSha:    prInfo.BaseSha,
-		StartSha:   prInfo.StartSha,
-		HeadSha:    prInfo.HeadSha,
+	}
+}
+
+// loadDiff parses the reviewed changes from the cloned repository.
+func (a *App) loadDiff(ctx context.Context, gitService api.VersionControlService, repoDir, baseSha, headSha string) (*diff.Diff, error) {
+	text, err := gitService.Diff(ctx, repoDir, baseSha, headSha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute diff: %w", err)
+	}
+	return diff.Parse(text)
+}
+
+// excludePatterns layers the user patterns over the generated file defaults, which cfg.GeneratedPatterns replaces.
+func excludePatterns(cfg *api.Config) []string {
+	patterns := append([]string{}, cfg.Exclude...)
+	if cfg.ReviewGenerated {
+		return patterns
+	}
+	if cfg.GeneratedPatterns != nil {
+		return append(patterns, cfg.GeneratedPatterns...)
+	}
+	return append(patterns, diff.DefaultGeneratedPatterns...)
+}
+
+// newExcludes builds the path filter of cfg from its exclude patterns, the extra ones and its include patterns.
+func newExcludes(cfg *api.Config, extra ...string) (*diff.Excludes, error) {
+	excludes, err := diff.NewExcludes(append(excludePatterns(cfg), extra...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	if err := excludes.Include(cfg.Include); err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	return excludes, nil
+}
+
+func (a *App) createVCSProvider(rawURL string) (api.VCSProviderType, api.RemoteGitService, error) {
+	vcsProviderType, err := a.factory.DetectVCSProviderType(rawURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to detect VCS provider type: %w", err)
+	}
+	if vcsProviderType == api.VCSProviderTypeUnknown {
+		return "", nil, fmt.Errorf("unsupported VCS provider for URL: %s", rawURL)
+	}
+	_, _ = fmt.Fprintf(a.stdout, "VCS provider type: %s\n", vcsProviderType)
+
+	vcsProviderService, err := a.factory.CreateVCSProvider(vcsProviderType)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create VCS provider service: %w", err)
+	}
+	return vcsProviderType, vcsProviderService, nil
+}
+
+// detectPullRequestURL finds the open pull request of the branch checked out at cfg.RepoPath.
+func (a *App) detectPullRequestURL() (string, error) {
+	gitService, err := a.factory.CreateVersionControlService(VCSTypeGit)
+	if err != nil {
+		return "", fmt.Errorf("failed to create version control service: %w", err)
+	}
+	repoPath := a.cfg.RepoPath
+	if repoPath == "" {
+		repoPath = "."
+	}
+	repoInfo, err := gitService.GetLocalRepoInfo(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read local repo: %w", err)
+	}
+
+	vcsProviderType, vcsProviderService, err := a.createVCSProvider(repoInfo.RemoteUrl)
+	if err != nil {
+		return "", err
+	}
+	finder, ok := vcsProviderService.(api.PullRequestFinder)
+	if !ok {
+		return "", fmt.Errorf("pull request lookup is not supported for %s", vcsProviderType)
+	}
+	return finder.FindPullRequestURL(repoInfo.RemoteUrl, repoInfo.Branch)
+}
+
+// checkIdentity logs the account the API key acts as and, with cfg.ExpectUser, fails when it is another one.
+// A rejected key fails the run here instead of on the first comment.
+func (a *App) checkIdentity(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType) error {
+	resolver, ok := vcsProviderService.(api.IdentityResolver)
+	if !ok {
+		if a.cfg.ExpectUser != "" {
+			return fmt.Errorf("identity check is not supported for %s", vcsProviderType)
+		}
+		return nil
+	}
+	user, err := resolver.AuthenticatedUser()
+	if err != nil {
+		if a.cfg.ExpectUser != "" || errors.Is(err, vcs_provider.ErrUnauthorized) {
+			return fmt.Errorf("failed to check identity: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		return nil
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Acting as @%s\n", user)
+	if expected := strings.TrimPrefix(a.cfg.ExpectUser, "@"); expected != "" && !strings.EqualFold(expected, user) {
+		return fmt.Errorf("api key belongs to @%s, expected @%s", user, expected)
+	}
+	return nil
+}
+
+// linkifyReferences links the path:line references in the comments to the files at the head commit, checked against
+// the checkout or, without one, the files the pull request changes.
+func (a *App) linkifyReferences(comments []*api.InlineComment, provider api.RemoteGitService, prInfo *api.PullRequestInfo, repoDir string, prDiff *diff.Diff, noClone bool) {
+	linker, ok := provider.(api.BlobLinker)
+	if !ok {
+		_, _ = fmt.Fprintln(a.stderr, "Warning: the provider cannot link to files, leaving references as text")
+		return
+	}
+	exists := checkoutReferences(repoDir)
+	if noClone {
+		exists = diffReferences(prDiff)
+	}
+	if linked := linkifyReferences(comments, prInfo, linker, exists); linked > 0 {
+		_, _ = fmt.Fprintf(a.stdout, "Linked %d code references\n", linked)
+	}
+}
+
+// cloneUrl returns the URL the repository of the pull request is cloned from, its ssh one with the ssh transport.
+func (a *App) cloneUrl(prInfo *api.PullRequestInfo) (string, error) {
+	if a.cfg.GitTransport != GitTransportSSH {
+		return prInfo.ProjectHttpUrl, nil
+	}
+	if prInfo.ProjectSshUrl == "" {
+		return "", errors.New("provider returned no ssh url for the repository, clone over https instead")
+	}
+	return prInfo.ProjectSshUrl, nil
+}
+
+// cloneRepo clones the source branch of the pull request, or the merge queue commit of a queued one. When the branch
+// is missing from the pull request or the remote, the head commit is cloned instead as cfg.CloneFallback says.
+func (a *App) cloneRepo(ctx context.Context, gitService api.VersionControlService, dir string, prInfo *api.PullRequestInfo) error {
+	repoUrl, err := a.cloneUrl(prInfo)
+	if err != nil {
+		return err
+	}
+	if prInfo.MergeQueueSha != "" {
+		cloner, ok := gitService.(api.CommitCloner)
+		if !ok {
+			return errors.New("cannot clone the merge queue commit")
+		}
+		return cloner.CloneCommitWithContext(ctx, dir, repoUrl, prInfo.MergeQueueSha)
+	}
+	err = errors.New("pull request has no source branch")
+	if prInfo.SourceBranch != "" {
+		err = gitService.CloneRepoWithContext(ctx, dir, repoUrl, prInfo.SourceBranch)
+		if err == nil || !errors.Is(err, vcs.ErrRefNotFound) {
+			return err
+		}
+	}
+
+	cloner, ok := gitService.(api.CommitCloner)
+	if a.cfg.CloneFallback == CloneFallbackNone || !ok || prInfo.HeadSha == "" {
+		return err
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Cannot clone source branch (%v), cloning head commit %s\n", err, prInfo.HeadSha)
+	// the failed clone may have initialized a repository already
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clean up failed clone: %w", err)
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to recreate clone directory: %w", err)
+	}
+	if a.cfg.CloneFallback == CloneFallbackDefaultBranch {
+		return cloner.CloneDefaultBranchWithContext(ctx, dir, repoUrl, prInfo.HeadSha)
+	}
+	return cloner.CloneCommitWithContext(ctx, dir, repoUrl, prInfo.HeadSha)
+}
+
+// fetchReviewBase fetches the commit the review starts from into a shallow clone, which may not reach back to it.
+func (a *App) fetchReviewBase(ctx context.Context, gitService api.VersionControlService, dir, sha string) error {
+	fetcher, ok := gitService.(api.CommitFetcher)
+	if !ok || sha == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(a.cfg.CloneTimeout, DefaultCloneTimeout))
+	defer cancel()
+	if err := fetcher.FetchCommitWithContext(ctx, dir, sha); err != nil {
+		return fmt.Errorf("failed to fetch review base: %w", err)
+	}
+	return nil
+}
+
+// resolveOwnerHandles looks up the CODEOWNERS handles of the token's user and teams for -own-files-only.
+func (a *App) resolveOwnerHandles(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType) ([]string, error) {
+	resolver, ok := vcsProviderService.(api.OwnerResolver)
+	if !ok {
+		return nil, fmt.Errorf("own files only is not supported for %s", vcsProviderType)
+	}
+	handles, err := resolver.OwnerHandles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up code owners: %w", err)
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Commenting only on files owned by %s\n", strings.Join(handles, ", "))
+	return handles, nil
+}
+
+// resolveBaseTag returns the commit of cfg.BaseTag in the clone, the base of a review against a release. It takes at
+// most 2 minutes, less when ctx ends first.
+func (a *App) resolveBaseTag(ctx context.Context, gitService api.VersionControlService, repoDir string) (string, error) {
+	resolver, ok := gitService.(api.TagResolver)
+	if !ok {
+		return "", errors.New("base tag is not supported by the version control service")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	sha, err := resolver.ResolveTag(ctx, repoDir, a.cfg.BaseTag)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve base tag: %w", err)
+	}
+	return sha, nil
+}
+
+// fetchCompareDiff returns the pull request diff from the provider when cfg.NoClone is set. It reports false when
+// the repository has to be cloned after all: the provider has no compare support or the diff is truncated.
+func (a *App) fetchCompareDiff(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo) (string, bool, error) {
+	if !a.cfg.NoClone {
+		return "", false, nil
+	}
+	fetcher, ok := vcsProviderService.(api.CompareDiffFetcher)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Reviewing without a clone is not supported for %s, cloning\n", vcsProviderType)
+		return "", false, nil
+	}
+	text, err := fetcher.CompareDiff(prInfo)
+	if err != nil {
+		if errors.Is(err, vcs_provider.ErrUnauthorized) {
+			return "", false, fmt.Errorf("failed to fetch diff: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stderr, "Warning: cloning instead: %v\n", err)
+		return "", false, nil
+	}
+	_, _ = fmt.Fprintln(a.stdout, "Fetched PR diff, skipping clone")
+	return text, true, nil
+}
+
+// writeScopedDiff stores the part of the diff the review is scoped to in dir, for agents working without a checkout.
+func writeScopedDiff(dir, text string, scope *diff.Scope, excludes *diff.Excludes) (string, error) {
+	scoped, err := diff.Filter(text, func(p string) bool {
+		return scope.Contains(p) && !excludes.Match(p)
 	})
 	if err != nil {
-		return fmt.Errorf("failed to generate inline comments: %w", err)
+		return "", fmt.Errorf("failed to scope diff: %w", err)
 	}
+	diffFile := filepath.Join(dir, diffFileName)
+	if err := os.WriteFile(diffFile, []byte(scoped), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write diff: %w", err)
+	}
+	return diffFile, nil
+}
 
-	_, _ = fmt.Fprintln(a.stdout, "Pushing comments to VCS provider")
-	if err := vcsProviderService.SendInlineComments(comments, prInfo); err != nil {
+// applyLabel marks the pull request as reviewed with cfg.ApplyLabel. Only a rejected token fails the run.
+func (a *App) applyLabel(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo) error {
+	labeler, ok := vcsProviderService.(api.Labeler)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Labels are not supported for %s, skipping\n", vcsProviderType)
+		return nil
+	}
+	if err := labeler.AddLabel(prInfo, a.cfg.ApplyLabel); err != nil {
+		if errors.Is(err, vcs_provider.ErrUnauthorized) {
+			return fmt.Errorf("failed to apply label: %w", err)
+		}
 		_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+		return nil
 	}
-	_, _ = fmt.Fprintf(a.stdout, "Finished PR analysis at %s\n", prInfo.SourceBranch)
+	_, _ = fmt.Fprintf(a.stdout, "Applied label %s\n", a.cfg.ApplyLabel)
 	return nil
 }
 
+func (a *App) reportReactions(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo) {
+	tracker, ok := vcsProviderService.(api.ReactionTracker)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Reaction tracking is not supported for %s, skipping\n", vcsProviderType)
+		return
+	}
+	stats, err := tracker.GetReactionStats(prInfo)
+	if err != nil {
+		_, _ = fmt.Fprintf(a.stderr, "Warning: failed to read reactions: %v\n", err)
+		return
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Last run: %d comments, %d 👍 %d 👎\n", stats.Comments, stats.ThumbsUp, stats.ThumbsDown)
+}
+
+// sanitizeProjectName turns the project name into a temp directory prefix. Letters and digits of any script are
+// kept, so non-ASCII names stay readable, everything else, path separators and control characters included, becomes _.
 func sanitizeProjectName(name string) string {
-	sanitized := sanitizeRegex.ReplaceAllString(name, "_")
+	sanitized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
 	if sanitized == "" {
 		return "project"
 	}
 	return sanitized
 }
+
+// warnSendError prints the comments that could not be posted, each with the provider's reason.
+func (a *App) warnSendError(err error) {
+	_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+	var sendErr *vcs_provider.SendError
+	if !errors.As(err, &sendErr) {
+		return
+	}
+	for _, commentErr := range sendErr.Comments {
+		if commentErr.StatusCode != 0 {
+			_, _ = fmt.Fprintf(a.stderr, "  %s:%d: %s (status %d)\n", commentErr.Path, commentErr.Line, commentErr.Message, commentErr.StatusCode)
+		} else {
+			_, _ = fmt.Fprintf(a.stderr, "  %s:%d: %s\n", commentErr.Path, commentErr.Line, commentErr.Message)
+		}
+	}
+}
+
+// timeoutOrDefault is timeout, or d when it is unset.
+func timeoutOrDefault(timeout, d time.Duration) time.Duration {
+	if timeout == 0 {
+		return d
+	}
+	return timeout
+}
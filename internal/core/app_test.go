@@ -3,10 +3,26 @@ package core
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/ai"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+	"github.com/eridan-ltu/gitex/internal/vcs"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
 )
 
 type MockServiceFactory struct {
@@ -46,10 +62,112 @@ func (m *MockRemoteGitService) SendInlineComments(comments []*api.InlineComment,
 	return m.SendInlineCommentsFunc(comments, pullRequestInfo)
 }
 
+// MockReactionTrackingService is a MockRemoteGitService that also implements api.ReactionTracker
+type MockReactionTrackingService struct {
+	MockRemoteGitService
+	GetReactionStatsFunc func(pullRequestInfo *api.PullRequestInfo) (*api.ReactionStats, error)
+}
+
+func (m *MockReactionTrackingService) GetReactionStats(pullRequestInfo *api.PullRequestInfo) (*api.ReactionStats, error) {
+	return m.GetReactionStatsFunc(pullRequestInfo)
+}
+
+// MockPullRequestFinderService implements api.RemoteGitService and api.PullRequestFinder for testing
+type MockPullRequestFinderService struct {
+	MockRemoteGitService
+	FindPullRequestURLFunc func(remoteURL, branch string) (string, error)
+}
+
+func (m *MockPullRequestFinderService) FindPullRequestURL(remoteURL, branch string) (string, error) {
+	return m.FindPullRequestURLFunc(remoteURL, branch)
+}
+
+// MockCommitStatusService implements api.RemoteGitService and api.CommitStatusReporter for testing
+type MockCommitStatusService struct {
+	MockRemoteGitService
+	SetCommitStatusFunc func(pullRequestInfo *api.PullRequestInfo, status *api.CommitStatus) error
+}
+
+func (m *MockCommitStatusService) SetCommitStatus(pullRequestInfo *api.PullRequestInfo, status *api.CommitStatus) error {
+	return m.SetCommitStatusFunc(pullRequestInfo, status)
+}
+
+// MockIdentityService implements api.RemoteGitService and api.IdentityResolver for testing
+type MockIdentityService struct {
+	MockRemoteGitService
+	AuthenticatedUserFunc func() (string, error)
+}
+
+func (m *MockIdentityService) AuthenticatedUser() (string, error) {
+	return m.AuthenticatedUserFunc()
+}
+
+// MockCompareDiffService implements api.RemoteGitService and api.CompareDiffFetcher for testing
+type MockCompareDiffService struct {
+	MockRemoteGitService
+	CompareDiffFunc func(pullRequestInfo *api.PullRequestInfo) (string, error)
+}
+
+func (m *MockCompareDiffService) CompareDiff(pullRequestInfo *api.PullRequestInfo) (string, error) {
+	return m.CompareDiffFunc(pullRequestInfo)
+}
+
+// MockLabelerService implements api.RemoteGitService and api.Labeler for testing
+type MockLabelerService struct {
+	MockRemoteGitService
+	AddLabelFunc func(pullRequestInfo *api.PullRequestInfo, label string) error
+}
+
+func (m *MockLabelerService) AddLabel(pullRequestInfo *api.PullRequestInfo, label string) error {
+	return m.AddLabelFunc(pullRequestInfo, label)
+}
+
+// MockOwnerResolverService implements api.RemoteGitService and api.OwnerResolver for testing
+type MockOwnerResolverService struct {
+	MockRemoteGitService
+	OwnerHandlesFunc func() ([]string, error)
+}
+
+func (m *MockOwnerResolverService) OwnerHandles() ([]string, error) {
+	return m.OwnerHandlesFunc()
+}
+
+// MockThreadTrackerService implements api.RemoteGitService and api.ThreadTracker for testing
+type MockThreadTrackerService struct {
+	MockRemoteGitService
+	PriorThreadsFunc func(pullRequestInfo *api.PullRequestInfo) ([]*api.PriorThread, error)
+}
+
+func (m *MockThreadTrackerService) PriorThreads(pullRequestInfo *api.PullRequestInfo) ([]*api.PriorThread, error) {
+	return m.PriorThreadsFunc(pullRequestInfo)
+}
+
+// MockPullRequestCommenterService implements api.RemoteGitService and api.PullRequestCommenter for testing
+type MockPullRequestCommenterService struct {
+	MockRemoteGitService
+	CommentOnPullRequestFunc func(pullRequestInfo *api.PullRequestInfo, body string) error
+}
+
+func (m *MockPullRequestCommenterService) CommentOnPullRequest(pullRequestInfo *api.PullRequestInfo, body string) error {
+	return m.CommentOnPullRequestFunc(pullRequestInfo, body)
+}
+
+// MockDescriptionReviewerService implements api.AIAgentService and api.DescriptionReviewer for testing
+type MockDescriptionReviewerService struct {
+	MockAIAgentService
+	ReviewDescriptionWithContextFunc func(ctx context.Context, options *api.ReviewDescriptionOptions) (string, error)
+}
+
+func (m *MockDescriptionReviewerService) ReviewDescriptionWithContext(ctx context.Context, options *api.ReviewDescriptionOptions) (string, error) {
+	return m.ReviewDescriptionWithContextFunc(ctx, options)
+}
+
 // MockVersionControlService implements api.VersionControlService for testing
 type MockVersionControlService struct {
 	CloneRepoFunc            func(path, repoUrl, ref string) error
 	CloneRepoWithContextFunc func(ctx context.Context, path, repoUrl, ref string) error
+	GetLocalRepoInfoFunc     func(path string) (*api.LocalRepoInfo, error)
+	DiffFunc                 func(ctx context.Context, path, baseSha, headSha string) (string, error)
 }
 
 func (m *MockVersionControlService) CloneRepo(path, repoUrl, ref string) error {
@@ -60,6 +178,74 @@ func (m *MockVersionControlService) CloneRepoWithContext(ctx context.Context, pa
 	return m.CloneRepoWithContextFunc(ctx, path, repoUrl, ref)
 }
 
+func (m *MockVersionControlService) GetLocalRepoInfo(path string) (*api.LocalRepoInfo, error) {
+	return m.GetLocalRepoInfoFunc(path)
+}
+
+func (m *MockVersionControlService) Diff(ctx context.Context, path, baseSha, headSha string) (string, error) {
+	return m.DiffFunc(ctx, path, baseSha, headSha)
+}
+
+// MockCommitClonerVCS implements api.VersionControlService and api.CommitCloner for testing
+type MockCommitClonerVCS struct {
+	MockVersionControlService
+	CloneCommitWithContextFunc        func(ctx context.Context, path, repoUrl, sha string) error
+	CloneDefaultBranchWithContextFunc func(ctx context.Context, path, repoUrl, sha string) error
+}
+
+func (m *MockCommitClonerVCS) CloneCommitWithContext(ctx context.Context, path, repoUrl, sha string) error {
+	return m.CloneCommitWithContextFunc(ctx, path, repoUrl, sha)
+}
+
+func (m *MockCommitClonerVCS) CloneDefaultBranchWithContext(ctx context.Context, path, repoUrl, sha string) error {
+	return m.CloneDefaultBranchWithContextFunc(ctx, path, repoUrl, sha)
+}
+
+// MockTagResolverVCS implements api.VersionControlService and api.TagResolver for testing
+type MockTagResolverVCS struct {
+	MockVersionControlService
+	ResolveTagFunc func(ctx context.Context, path, tag string) (string, error)
+}
+
+func (m *MockTagResolverVCS) ResolveTag(ctx context.Context, path, tag string) (string, error) {
+	return m.ResolveTagFunc(ctx, path, tag)
+}
+
+// MockCommitFetcherVCS implements api.VersionControlService and api.CommitFetcher for testing
+type MockCommitFetcherVCS struct {
+	MockVersionControlService
+	FetchCommitWithContextFunc func(ctx context.Context, path, sha string) error
+}
+
+func (m *MockCommitFetcherVCS) FetchCommitWithContext(ctx context.Context, path, sha string) error {
+	return m.FetchCommitWithContextFunc(ctx, path, sha)
+}
+
+// MockCommitSelectorVCS implements api.VersionControlService and api.CommitSelector for testing
+type MockCommitSelectorVCS struct {
+	MockVersionControlService
+	ResolveCommitsFunc func(ctx context.Context, path, baseSha, headSha string, revs []string) ([]string, error)
+	CommitsDiffFunc    func(ctx context.Context, path string, shas []string) (string, error)
+}
+
+func (m *MockCommitSelectorVCS) ResolveCommits(ctx context.Context, path, baseSha, headSha string, revs []string) ([]string, error) {
+	return m.ResolveCommitsFunc(ctx, path, baseSha, headSha, revs)
+}
+
+func (m *MockCommitSelectorVCS) CommitsDiff(ctx context.Context, path string, shas []string) (string, error) {
+	return m.CommitsDiffFunc(ctx, path, shas)
+}
+
+// MockRepoIndexerVCS implements api.VersionControlService and api.RepoIndexer for testing
+type MockRepoIndexerVCS struct {
+	MockVersionControlService
+	RepoIndexFunc func(ctx context.Context, path string, maxBytes int, skip func(path string) bool) (string, error)
+}
+
+func (m *MockRepoIndexerVCS) RepoIndex(ctx context.Context, path string, maxBytes int, skip func(path string) bool) (string, error) {
+	return m.RepoIndexFunc(ctx, path, maxBytes, skip)
+}
+
 // MockAIAgentService implements api.AIAgentService for testing
 type MockAIAgentService struct {
 	GeneratePRInlineCommentsFunc            func(options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error)
@@ -74,6 +260,58 @@ func (m *MockAIAgentService) GeneratePRInlineCommentsWithContext(ctx context.Con
 	return m.GeneratePRInlineCommentsWithContextFunc(ctx, options)
 }
 
+// newMockFactory wires the given services into a factory that always detects GitHub
+func newMockFactory(provider api.RemoteGitService, vcs api.VersionControlService, ai api.AIAgentService) *MockServiceFactory {
+	return &MockServiceFactory{
+		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
+			return api.VCSProviderTypeGithub, nil
+		},
+		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
+			return provider, nil
+		},
+		CreateVersionControlServiceFunc: func(kind api.VersionControlType) (api.VersionControlService, error) {
+			return vcs, nil
+		},
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return ai, nil
+		},
+	}
+}
+
+// validConfig fills the fields Config.Validate requires, so tests only spell out what they exercise
+func validConfig(cfg *api.Config) *api.Config {
+	if cfg.VcsApiKey == "" {
+		cfg.VcsApiKey = "vcs-key"
+	}
+	if cfg.AiAgent == "" || cfg.AiAgent == string(api.AIAgentTypeCodex) {
+		cfg.AiApiKey = util.GetOrDefault(&cfg.AiApiKey, "ai-key")
+		cfg.AiModel = util.GetOrDefault(&cfg.AiModel, "model")
+	}
+	return cfg
+}
+
+// newNoopVCS returns a version control service whose clone always succeeds
+func newNoopVCS() *MockVersionControlService {
+	return &MockVersionControlService{
+		CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+			return nil
+		},
+	}
+}
+
+func TestApp_Run_InvalidConfig(t *testing.T) {
+	// the empty factory panics if Run gets past validation
+	app := NewAppWithWriters(&api.Config{AiAgent: "replay"}, &MockServiceFactory{}, io.Discard, io.Discard)
+
+	err := app.Run("https://github.com/org/repo/pull/1")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "vcs api key is required") || !strings.Contains(err.Error(), "replay file") {
+		t.Errorf("expected all problems in error, got: %v", err)
+	}
+}
+
 func TestApp_Run_DetectVCSProviderError(t *testing.T) {
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
@@ -81,7 +319,7 @@ func TestApp_Run_DetectVCSProviderError(t *testing.T) {
 		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://example.com/pr/1")
 	if err == nil {
 		t.Error("expected error when DetectVCSProviderType fails")
@@ -91,11 +329,11 @@ func TestApp_Run_DetectVCSProviderError(t *testing.T) {
 func TestApp_Run_UnknownVCSProviderError(t *testing.T) {
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeUnknown, nil
+			return api.VCSProviderTypeUnknown, nil
 		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://bitbucket.org/org/repo/pull/1")
 	if err == nil {
 		t.Error("expected error for unknown VCS provider")
@@ -105,14 +343,14 @@ func TestApp_Run_UnknownVCSProviderError(t *testing.T) {
 func TestApp_Run_CreateVCSProviderError(t *testing.T) {
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return nil, io.ErrUnexpectedEOF
 		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err == nil {
 		t.Error("expected error when CreateVCSProvider fails")
@@ -128,14 +366,14 @@ func TestApp_Run_GetPullRequestInfoError(t *testing.T) {
 
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return mockVCSProvider, nil
 		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err == nil {
 		t.Error("expected error when GetPullRequestInfo fails")
@@ -145,13 +383,13 @@ func TestApp_Run_GetPullRequestInfoError(t *testing.T) {
 func TestApp_Run_CreateVersionControlServiceError(t *testing.T) {
 	mockVCSProvider := &MockRemoteGitService{
 		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
-			return &api.PullRequestInfo{ProjectName: "test-repo"}, nil
+			return &api.PullRequestInfo{ProjectName: "test-repo", BaseSha: "base", HeadSha: "head"}, nil
 		},
 	}
 
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return mockVCSProvider, nil
@@ -161,7 +399,7 @@ func TestApp_Run_CreateVersionControlServiceError(t *testing.T) {
 		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err == nil {
 		t.Error("expected error when CreateVersionControlService fails")
@@ -171,7 +409,7 @@ func TestApp_Run_CreateVersionControlServiceError(t *testing.T) {
 func TestApp_Run_CloneRepoError(t *testing.T) {
 	mockVCSProvider := &MockRemoteGitService{
 		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
-			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main"}, nil
+			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
 		},
 	}
 
@@ -183,7 +421,7 @@ func TestApp_Run_CloneRepoError(t *testing.T) {
 
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return mockVCSProvider, nil
@@ -191,19 +429,104 @@ func TestApp_Run_CloneRepoError(t *testing.T) {
 		CreateVersionControlServiceFunc: func(kind api.VersionControlType) (api.VersionControlService, error) {
 			return mockVCS, nil
 		},
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return &MockAIAgentService{}, nil
+		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err == nil {
 		t.Error("expected error when CloneRepoWithContext fails")
 	}
 }
 
+// MockContextFactory implements contextAgentFactory for testing
+type MockContextFactory struct {
+	*MockServiceFactory
+	CreateAiAgentServiceWithContextFunc func(ctx context.Context, kind api.AIAgentType) (api.AIAgentService, error)
+}
+
+func (m *MockContextFactory) CreateAiAgentServiceWithContext(ctx context.Context, kind api.AIAgentType) (api.AIAgentService, error) {
+	return m.CreateAiAgentServiceWithContextFunc(ctx, kind)
+}
+
+func TestApp_Run_ClonesWhileCreatingAgent(t *testing.T) {
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	// each side waits for the other one to start, so running them one after the other times out
+	waitFor := func(started <-chan struct{}, what string) error {
+		select {
+		case <-started:
+			return nil
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("%s did not start", what)
+		}
+	}
+
+	t.Run("both start before either finishes", func(t *testing.T) {
+		cloneStarted, agentStarted := make(chan struct{}), make(chan struct{})
+		vcs := &MockVersionControlService{
+			CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+				close(cloneStarted)
+				return waitFor(agentStarted, "agent setup")
+			},
+		}
+		factory := newMockFactory(provider, vcs, nil)
+		factory.CreateAiAgentServiceFunc = func(kind api.AIAgentType) (api.AIAgentService, error) {
+			close(agentStarted)
+			if err := waitFor(cloneStarted, "clone"); err != nil {
+				return nil, err
+			}
+			return &MockAIAgentService{
+				GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+					return nil, nil
+				},
+			}, nil
+		}
+
+		app := NewAppWithWriters(validConfig(&api.Config{}), factory, io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("failed clone cancels the agent setup", func(t *testing.T) {
+		vcs := &MockVersionControlService{
+			CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+				return io.ErrUnexpectedEOF
+			},
+		}
+		factory := &MockContextFactory{
+			MockServiceFactory: newMockFactory(provider, vcs, nil),
+			CreateAiAgentServiceWithContextFunc: func(ctx context.Context, kind api.AIAgentType) (api.AIAgentService, error) {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(5 * time.Second):
+					return nil, errors.New("agent setup was not canceled")
+				}
+			},
+		}
+
+		app := NewAppWithWriters(validConfig(&api.Config{CloneFallback: CloneFallbackNone}), factory, io.Discard, io.Discard)
+		err := app.Run("https://github.com/org/repo/pull/1")
+		if err == nil || !strings.Contains(err.Error(), "failed to clone repo") {
+			t.Errorf("expected the clone error, got %v", err)
+		}
+	})
+}
+
 func TestApp_Run_CreateAiAgentServiceError(t *testing.T) {
 	mockVCSProvider := &MockRemoteGitService{
 		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
-			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main"}, nil
+			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
 		},
 	}
 
@@ -215,7 +538,7 @@ func TestApp_Run_CreateAiAgentServiceError(t *testing.T) {
 
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return mockVCSProvider, nil
@@ -228,7 +551,7 @@ func TestApp_Run_CreateAiAgentServiceError(t *testing.T) {
 		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err == nil {
 		t.Error("expected error when CreateAiAgentService fails")
@@ -238,7 +561,7 @@ func TestApp_Run_CreateAiAgentServiceError(t *testing.T) {
 func TestApp_Run_GeneratePRInlineCommentsError(t *testing.T) {
 	mockVCSProvider := &MockRemoteGitService{
 		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
-			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main"}, nil
+			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
 		},
 	}
 
@@ -256,7 +579,7 @@ func TestApp_Run_GeneratePRInlineCommentsError(t *testing.T) {
 
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return mockVCSProvider, nil
@@ -269,7 +592,7 @@ func TestApp_Run_GeneratePRInlineCommentsError(t *testing.T) {
 		},
 	}
 
-	app := NewAppWithWriters(mockFactory, io.Discard, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, io.Discard)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err == nil {
 		t.Error("expected error when GeneratePRInlineCommentsWithContext fails")
@@ -279,7 +602,7 @@ func TestApp_Run_GeneratePRInlineCommentsError(t *testing.T) {
 func TestApp_Run_SendInlineCommentsError(t *testing.T) {
 	mockVCSProvider := &MockRemoteGitService{
 		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
-			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main"}, nil
+			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
 		},
 		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
 			return io.ErrUnexpectedEOF
@@ -300,7 +623,7 @@ func TestApp_Run_SendInlineCommentsError(t *testing.T) {
 
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return mockVCSProvider, nil
@@ -314,7 +637,7 @@ func TestApp_Run_SendInlineCommentsError(t *testing.T) {
 	}
 
 	var stderr bytes.Buffer
-	app := NewAppWithWriters(mockFactory, io.Discard, &stderr)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, io.Discard, &stderr)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -324,6 +647,37 @@ func TestApp_Run_SendInlineCommentsError(t *testing.T) {
 	}
 }
 
+func TestApp_Run_SendInlineCommentsFatal(t *testing.T) {
+	run := func(cfg *api.Config, sendErr error) error {
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return sendErr
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				return nil, nil
+			},
+		}
+		return NewAppWithWriters(validConfig(cfg), newMockFactory(provider, newNoopVCS(), ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+	}
+
+	if err := run(&api.Config{FailFast: true}, io.ErrUnexpectedEOF); err == nil {
+		t.Error("expected error with fail-fast")
+	}
+	authErr := fmt.Errorf("%w: bad token", vcs_provider.ErrUnauthorized)
+	if err := run(&api.Config{}, authErr); !errors.Is(err, vcs_provider.ErrUnauthorized) {
+		t.Errorf("expected auth error to fail the run, got %v", err)
+	}
+	permissionErr := fmt.Errorf("%w: 403 Forbidden", vcs_provider.ErrPermissionDenied)
+	if err := run(&api.Config{}, permissionErr); !errors.Is(err, vcs_provider.ErrPermissionDenied) {
+		t.Errorf("expected permission error to fail the run, got %v", err)
+	}
+}
+
 func TestApp_Run_Success(t *testing.T) {
 	mockVCSProvider := &MockRemoteGitService{
 		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
@@ -355,7 +709,7 @@ func TestApp_Run_Success(t *testing.T) {
 
 	mockFactory := &MockServiceFactory{
 		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
-			return VCSProviderTypeGithub, nil
+			return api.VCSProviderTypeGithub, nil
 		},
 		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
 			return mockVCSProvider, nil
@@ -369,7 +723,7 @@ func TestApp_Run_Success(t *testing.T) {
 	}
 
 	var stdout bytes.Buffer
-	app := NewAppWithWriters(mockFactory, &stdout, io.Discard)
+	app := NewAppWithWriters(validConfig(&api.Config{}), mockFactory, &stdout, io.Discard)
 	err := app.Run("https://github.com/org/repo/pull/1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -381,6 +735,157 @@ func TestApp_Run_Success(t *testing.T) {
 	}
 }
 
+func TestApp_Run_SubPath(t *testing.T) {
+	var sent []*api.InlineComment
+	var receivedSubPath string
+
+	mockVCSProvider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			sent = comments
+			return nil
+		},
+	}
+
+	mockVCS := &MockVersionControlService{
+		CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+			return nil
+		},
+	}
+
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			receivedSubPath = options.SubPath
+			return []*api.InlineComment{
+				{
+					Body: util.Ptr("scoped"),
+					Position: &api.InlineCommentPosition{
+						OldPath: util.Ptr("main.go"),
+						NewPath: util.Ptr("main.go"),
+						NewLine: util.Ptr(int64(3)),
+					},
+				},
+			}, nil
+		},
+	}
+
+	mockFactory := &MockServiceFactory{
+		DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
+			return api.VCSProviderTypeGithub, nil
+		},
+		CreateVCSProviderFunc: func(kind api.VCSProviderType) (api.RemoteGitService, error) {
+			return mockVCSProvider, nil
+		},
+		CreateVersionControlServiceFunc: func(kind api.VersionControlType) (api.VersionControlService, error) {
+			return mockVCS, nil
+		},
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return mockAI, nil
+		},
+	}
+
+	t.Run("paths are restored to repository root", func(t *testing.T) {
+		app := NewAppWithWriters(validConfig(&api.Config{SubPath: "./services/foo/"}), mockFactory, io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if receivedSubPath != "services/foo" {
+			t.Errorf("SubPath = %q, want %q", receivedSubPath, "services/foo")
+		}
+		if len(sent) != 1 {
+			t.Fatalf("expected 1 comment, got %d", len(sent))
+		}
+		if got := *sent[0].Position.NewPath; got != "services/foo/main.go" {
+			t.Errorf("NewPath = %q, want %q", got, "services/foo/main.go")
+		}
+		if got := *sent[0].Position.OldPath; got != "services/foo/main.go" {
+			t.Errorf("OldPath = %q, want %q", got, "services/foo/main.go")
+		}
+	})
+
+	t.Run("invalid sub path fails before any work", func(t *testing.T) {
+		failingFactory := &MockServiceFactory{
+			DetectVCSProviderTypeFunc: func(url string) (api.VCSProviderType, error) {
+				t.Error("provider detection should not run for invalid subpath")
+				return api.VCSProviderTypeGithub, nil
+			},
+		}
+		app := NewAppWithWriters(validConfig(&api.Config{SubPath: "../outside"}), failingFactory, io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err == nil {
+			t.Error("expected error for invalid subpath")
+		}
+	})
+}
+
+func TestApp_Run_TrackReactions(t *testing.T) {
+	prInfo := &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}
+	baseProvider := MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return prInfo, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{}, nil
+		},
+	}
+
+	t.Run("reports reaction stats", func(t *testing.T) {
+		provider := &MockReactionTrackingService{
+			MockRemoteGitService: baseProvider,
+			GetReactionStatsFunc: func(pullRequestInfo *api.PullRequestInfo) (*api.ReactionStats, error) {
+				return &api.ReactionStats{Comments: 5, ThumbsUp: 3, ThumbsDown: 1}, nil
+			},
+		}
+
+		var stdout bytes.Buffer
+		app := NewAppWithWriters(validConfig(&api.Config{TrackReactions: true}), newMockFactory(provider, newNoopVCS(), mockAI), &stdout, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Contains(stdout.Bytes(), []byte("Last run: 5 comments, 3 👍 1 👎")) {
+			t.Errorf("expected reaction summary in output, got: %s", stdout.String())
+		}
+	})
+
+	t.Run("reaction errors are warnings", func(t *testing.T) {
+		provider := &MockReactionTrackingService{
+			MockRemoteGitService: baseProvider,
+			GetReactionStatsFunc: func(pullRequestInfo *api.PullRequestInfo) (*api.ReactionStats, error) {
+				return nil, io.ErrUnexpectedEOF
+			},
+		}
+
+		var stderr bytes.Buffer
+		app := NewAppWithWriters(validConfig(&api.Config{TrackReactions: true}), newMockFactory(provider, newNoopVCS(), mockAI), io.Discard, &stderr)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Contains(stderr.Bytes(), []byte("failed to read reactions")) {
+			t.Errorf("expected warning in stderr, got: %s", stderr.String())
+		}
+	})
+
+	t.Run("unsupported provider is skipped", func(t *testing.T) {
+		provider := &baseProvider
+
+		var stdout bytes.Buffer
+		app := NewAppWithWriters(validConfig(&api.Config{TrackReactions: true}), newMockFactory(provider, newNoopVCS(), mockAI), &stdout, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Contains(stdout.Bytes(), []byte("not supported")) {
+			t.Errorf("expected skip message in output, got: %s", stdout.String())
+		}
+	})
+}
+
 func TestSanitizeProjectName(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -396,6 +901,12 @@ func TestSanitizeProjectName(t *testing.T) {
 		{"", "project"},
 		{"   ", "___"},
 		{"valid123", "valid123"},
+		{"日本語プロジェクト", "日本語プロジェクト"},
+		{"数据/服务", "数据_服务"},
+		{"café-crème", "café-crème"},
+		{"cafe\u0301", "cafe\u0301"},
+		{"Ünïcödé 2", "Ünïcödé_2"},
+		{"tab\there\x00", "tab_here_"},
 	}
 
 	for _, tt := range tests {
@@ -407,3 +918,2373 @@ func TestSanitizeProjectName(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_Run_DetectPullRequest(t *testing.T) {
+	prInfo := &api.PullRequestInfo{ProjectName: "test-repo", ProjectHttpUrl: "https://github.com/org/repo.git", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{}, nil
+		},
+	}
+	newVCS := func(gotPath *string) *MockVersionControlService {
+		vcs := newNoopVCS()
+		vcs.GetLocalRepoInfoFunc = func(path string) (*api.LocalRepoInfo, error) {
+			*gotPath = path
+			return &api.LocalRepoInfo{RemoteUrl: "https://github.com/org/repo", Branch: "feature"}, nil
+		}
+		return vcs
+	}
+
+	t.Run("reviews the pull request of the current branch", func(t *testing.T) {
+		var gotRepoPath, gotBranch, gotPrUrl string
+		provider := &MockPullRequestFinderService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+					gotPrUrl = *pullRequestURL
+					return prInfo, nil
+				},
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					return nil
+				},
+			},
+			FindPullRequestURLFunc: func(remoteURL, branch string) (string, error) {
+				gotBranch = branch
+				return "https://github.com/org/repo/pull/9", nil
+			},
+		}
+
+		app := NewAppWithWriters(validConfig(&api.Config{RepoPath: "/work/repo"}), newMockFactory(provider, newVCS(&gotRepoPath), mockAI), io.Discard, io.Discard)
+		if err := app.Run(""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gotRepoPath != "/work/repo" {
+			t.Errorf("repo path = %q, want %q", gotRepoPath, "/work/repo")
+		}
+		if gotBranch != "feature" {
+			t.Errorf("branch = %q, want %q", gotBranch, "feature")
+		}
+		if gotPrUrl != "https://github.com/org/repo/pull/9" {
+			t.Errorf("pull request url = %q, want %q", gotPrUrl, "https://github.com/org/repo/pull/9")
+		}
+	})
+
+	t.Run("defaults to the working directory", func(t *testing.T) {
+		var gotRepoPath string
+		provider := &MockPullRequestFinderService{
+			FindPullRequestURLFunc: func(remoteURL, branch string) (string, error) {
+				return "", io.ErrUnexpectedEOF
+			},
+		}
+
+		app := NewAppWithWriters(validConfig(&api.Config{}), newMockFactory(provider, newVCS(&gotRepoPath), mockAI), io.Discard, io.Discard)
+		err := app.Run("")
+		if err == nil || !strings.Contains(err.Error(), "failed to detect pull request") {
+			t.Fatalf("expected detection error, got: %v", err)
+		}
+		if gotRepoPath != "." {
+			t.Errorf("repo path = %q, want %q", gotRepoPath, ".")
+		}
+	})
+
+	t.Run("provider without lookup support", func(t *testing.T) {
+		var gotRepoPath string
+		provider := &MockRemoteGitService{}
+
+		app := NewAppWithWriters(validConfig(&api.Config{}), newMockFactory(provider, newVCS(&gotRepoPath), mockAI), io.Discard, io.Discard)
+		err := app.Run("")
+		if err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Fatalf("expected unsupported error, got: %v", err)
+		}
+	})
+}
+
+func TestApp_Run_DroppedReport(t *testing.T) {
+	valid := &api.InlineComment{
+		Body:     util.Ptr("finding"),
+		Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(1))},
+	}
+	invalid := &api.InlineComment{Body: util.Ptr("no position")}
+
+	var sent []*api.InlineComment
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			sent = comments
+			return nil
+		},
+	}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{valid, invalid}, nil
+		},
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "dropped.json")
+	app := NewAppWithWriters(validConfig(&api.Config{DroppedReport: reportPath}), newMockFactory(provider, newNoopVCS(), mockAI), io.Discard, io.Discard)
+	if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(sent) != 1 || sent[0] != valid {
+		t.Errorf("expected only the valid comment to be sent, got %d", len(sent))
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"reason": "invalid"`)) || !bytes.Contains(data, []byte("no position")) {
+		t.Errorf("unexpected report: %s", data)
+	}
+}
+
+func TestApp_Run_CommitStatus(t *testing.T) {
+	newProvider := func(statuses *[]*api.CommitStatus) *MockCommitStatusService {
+		return &MockCommitStatusService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+					return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", HeadSha: "abc", BaseSha: "base"}, nil
+				},
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					return nil
+				},
+			},
+			SetCommitStatusFunc: func(pullRequestInfo *api.PullRequestInfo, status *api.CommitStatus) error {
+				*statuses = append(*statuses, status)
+				return nil
+			},
+		}
+	}
+	newAI := func(err error) *MockAIAgentService {
+		return &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				return []*api.InlineComment{}, err
+			},
+		}
+	}
+
+	t.Run("pending then success with default context", func(t *testing.T) {
+		var statuses []*api.CommitStatus
+		app := NewAppWithWriters(validConfig(&api.Config{CommitStatus: true}), newMockFactory(newProvider(&statuses), newNoopVCS(), newAI(nil)), io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(statuses) != 2 || statuses[0].State != api.CommitStatusPending || statuses[1].State != api.CommitStatusSuccess {
+			t.Fatalf("unexpected statuses: %+v", statuses)
+		}
+		if statuses[1].Context != "gitex" {
+			t.Errorf("Context = %q, want gitex", statuses[1].Context)
+		}
+	})
+
+	t.Run("failure with custom context", func(t *testing.T) {
+		var statuses []*api.CommitStatus
+		cfg := &api.Config{CommitStatus: true, StatusContext: "gitex-security"}
+		app := NewAppWithWriters(validConfig(cfg), newMockFactory(newProvider(&statuses), newNoopVCS(), newAI(io.ErrUnexpectedEOF)), io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(statuses) != 2 || statuses[1].State != api.CommitStatusFailure {
+			t.Fatalf("unexpected statuses: %+v", statuses)
+		}
+		if statuses[1].Context != "gitex-security" {
+			t.Errorf("Context = %q, want gitex-security", statuses[1].Context)
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		var statuses []*api.CommitStatus
+		app := NewAppWithWriters(validConfig(&api.Config{}), newMockFactory(newProvider(&statuses), newNoopVCS(), newAI(nil)), io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(statuses) != 0 {
+			t.Errorf("expected no statuses, got %d", len(statuses))
+		}
+	})
+
+	t.Run("invalid context is rejected", func(t *testing.T) {
+		var statuses []*api.CommitStatus
+		cfg := &api.Config{CommitStatus: true, StatusContext: "bad\ncontext"}
+		app := NewAppWithWriters(validConfig(cfg), newMockFactory(newProvider(&statuses), newNoopVCS(), newAI(nil)), io.Discard, io.Discard)
+		err := app.Run("https://github.com/org/repo/pull/1")
+		if err == nil || !strings.Contains(err.Error(), "invalid status context") {
+			t.Fatalf("expected invalid status context error, got: %v", err)
+		}
+	})
+}
+
+func TestApp_Run_Excludes(t *testing.T) {
+	comment := func(path string) *api.InlineComment {
+		return &api.InlineComment{
+			Body:     util.Ptr("finding"),
+			Position: &api.InlineCommentPosition{NewPath: util.Ptr(path), NewLine: util.Ptr(int64(1))},
+		}
+	}
+
+	run := func(t *testing.T, cfg *api.Config) ([]string, []*api.InlineComment) {
+		var gotExclude []string
+		var sent []*api.InlineComment
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				sent = comments
+				return nil
+			},
+		}
+		mockAI := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				gotExclude = options.Exclude
+				return []*api.InlineComment{comment("main.go"), comment("vendor/lib/x.go"), comment("docs/a.md")}, nil
+			},
+		}
+		app := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, newNoopVCS(), mockAI), io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return gotExclude, sent
+	}
+
+	t.Run("generated files are excluded by default under user patterns", func(t *testing.T) {
+		exclude, sent := run(t, &api.Config{Exclude: []string{"docs/"}})
+		if len(exclude) != 1+len(diff.DefaultGeneratedPatterns) || exclude[0] != "**/docs/**" {
+			t.Errorf("unexpected excludes: %v", exclude)
+		}
+		if len(sent) != 1 || *sent[0].Position.NewPath != "main.go" {
+			t.Errorf("expected only main.go comment to be sent, got %d comments", len(sent))
+		}
+	})
+
+	t.Run("review generated opts back in", func(t *testing.T) {
+		exclude, sent := run(t, &api.Config{ReviewGenerated: true})
+		if len(exclude) != 0 {
+			t.Errorf("expected no excludes, got %v", exclude)
+		}
+		if len(sent) != 3 {
+			t.Errorf("expected all comments to be sent, got %d", len(sent))
+		}
+	})
+
+	t.Run("generated patterns override the defaults", func(t *testing.T) {
+		exclude, sent := run(t, &api.Config{GeneratedPatterns: []string{"*.md"}})
+		if len(exclude) != 1 || exclude[0] != "**/*.md" {
+			t.Errorf("unexpected excludes: %v", exclude)
+		}
+		if len(sent) != 2 {
+			t.Errorf("expected 2 comments to be sent, got %d", len(sent))
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		app := NewAppWithWriters(validConfig(&api.Config{Exclude: []string{"[x]"}}), &MockServiceFactory{}, io.Discard, io.Discard)
+		err := app.Run("https://github.com/org/repo/pull/1")
+		if err == nil || !strings.Contains(err.Error(), "invalid exclude pattern") {
+			t.Fatalf("expected invalid exclude pattern error, got: %v", err)
+		}
+	})
+}
+
+func TestApp_Run_AiAgentType(t *testing.T) {
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{}, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		aiAgent string
+		want    api.AIAgentType
+	}{
+		{name: "defaults to codex", aiAgent: "", want: api.AIAgentTypeCodex},
+		{name: "configured agent", aiAgent: "replay", want: api.AIAgentTypeReplay},
+	}
+	replayFile := func(aiAgent string) string {
+		if aiAgent == string(api.AIAgentTypeReplay) {
+			return "comments.json"
+		}
+		return ""
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got api.AIAgentType
+			factory := newMockFactory(provider, newNoopVCS(), mockAI)
+			factory.CreateAiAgentServiceFunc = func(kind api.AIAgentType) (api.AIAgentService, error) {
+				got = kind
+				return mockAI, nil
+			}
+			app := NewAppWithWriters(validConfig(&api.Config{AiAgent: tt.aiAgent, ReplayFile: replayFile(tt.aiAgent)}), factory, io.Discard, io.Discard)
+			if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("agent type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_Run_MinHunkLines(t *testing.T) {
+	const prDiff = `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var a = 1
++var a = 2
+ 
+@@ -10,2 +10,5 @@
+ func f() {
++	x := 1
++	y := 2
++	z := 3
+ }
+`
+	comment := func(line int64) *api.InlineComment {
+		return &api.InlineComment{
+			Body:     util.Ptr("finding"),
+			Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(line)},
+		}
+	}
+	run := func(t *testing.T, cfg *api.Config, diffErr error) []*api.InlineComment {
+		var sent []*api.InlineComment
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				sent = comments
+				return nil
+			},
+		}
+		mockAI := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				return []*api.InlineComment{comment(2), comment(11), comment(40)}, nil
+			},
+		}
+		vcs := newNoopVCS()
+		vcs.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+			if baseSha != "base" || headSha != "head" {
+				t.Errorf("diff range = %s..%s, want base..head", baseSha, headSha)
+			}
+			return prDiff, diffErr
+		}
+		app := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, vcs, mockAI), io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return sent
+	}
+
+	t.Run("drops comments on small hunks", func(t *testing.T) {
+		sent := run(t, &api.Config{MinHunkLines: 3}, nil)
+		if len(sent) != 2 || *sent[0].Position.NewLine != 11 || *sent[1].Position.NewLine != 40 {
+			t.Errorf("expected comments on lines 11 and 40, got %d comments", len(sent))
+		}
+	})
+
+	t.Run("default keeps all comments", func(t *testing.T) {
+		sent := run(t, &api.Config{MinHunkLines: 1}, io.ErrUnexpectedEOF)
+		if len(sent) != 3 {
+			t.Errorf("expected all comments, got %d", len(sent))
+		}
+	})
+
+	t.Run("diff errors skip the filter", func(t *testing.T) {
+		sent := run(t, &api.Config{MinHunkLines: 3}, io.ErrUnexpectedEOF)
+		if len(sent) != 3 {
+			t.Errorf("expected all comments, got %d", len(sent))
+		}
+	})
+
+	t.Run("negative value is rejected", func(t *testing.T) {
+		app := NewAppWithWriters(validConfig(&api.Config{MinHunkLines: -1}), &MockServiceFactory{}, io.Discard, io.Discard)
+		if err := app.Run("https://github.com/org/repo/pull/1"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestApp_Run_DiffNotReady(t *testing.T) {
+	orig := diffRefsRetryDelays
+	diffRefsRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	defer func() { diffRefsRetryDelays = orig }()
+
+	run := func(readyAfter int) (int, error) {
+		calls := 0
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				calls++
+				info := &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main"}
+				if calls > readyAfter {
+					info.BaseSha, info.HeadSha = "base", "head"
+				}
+				return info, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return nil
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				return nil, nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{}), newMockFactory(provider, newNoopVCS(), ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		return calls, err
+	}
+
+	t.Run("refetches until the shas are computed", func(t *testing.T) {
+		calls, err := run(2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		calls, err := run(10)
+		if !errors.Is(err, ErrDiffNotReady) {
+			t.Fatalf("expected ErrDiffNotReady, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+
+	t.Run("canceling the run stops waiting", func(t *testing.T) {
+		diffRefsRetryDelays = []time.Duration{time.Minute}
+		ctx, cancel := context.WithCancel(context.Background())
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				cancel()
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main"}, nil
+			},
+		}
+		start := time.Now()
+		err := NewAppWithWriters(validConfig(&api.Config{}), newMockFactory(provider, newNoopVCS(), &MockAIAgentService{}), io.Discard, io.Discard).RunWithContext(ctx, "https://github.com/org/repo/pull/1")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("waited %s after the run was canceled", elapsed)
+		}
+	})
+}
+
+func TestApp_Run_Identity(t *testing.T) {
+	run := func(cfg *api.Config, user string, userErr error) (string, error) {
+		provider := &MockIdentityService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+					return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+				},
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					return nil
+				},
+			},
+			AuthenticatedUserFunc: func() (string, error) {
+				return user, userErr
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				return nil, nil
+			},
+		}
+		var stdout bytes.Buffer
+		err := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, newNoopVCS(), ai), &stdout, io.Discard).Run("https://github.com/org/repo/pull/1")
+		return stdout.String(), err
+	}
+
+	t.Run("logs the identity", func(t *testing.T) {
+		stdout, err := run(&api.Config{}, "gitex-bot", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stdout, "Acting as @gitex-bot") {
+			t.Errorf("expected identity in output, got %q", stdout)
+		}
+	})
+
+	t.Run("expected user matches", func(t *testing.T) {
+		if _, err := run(&api.Config{ExpectUser: "@Gitex-Bot"}, "gitex-bot", nil); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("expected user differs", func(t *testing.T) {
+		_, err := run(&api.Config{ExpectUser: "gitex-bot"}, "jdoe", nil)
+		if err == nil || !strings.Contains(err.Error(), "belongs to @jdoe") {
+			t.Errorf("expected identity mismatch, got %v", err)
+		}
+	})
+
+	t.Run("lookup failure only warns", func(t *testing.T) {
+		if _, err := run(&api.Config{}, "", io.ErrUnexpectedEOF); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejected key fails early", func(t *testing.T) {
+		_, err := run(&api.Config{}, "", fmt.Errorf("%w: bad token", vcs_provider.ErrUnauthorized))
+		if !errors.Is(err, vcs_provider.ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got %v", err)
+		}
+	})
+}
+
+func TestApp_Run_TopFiles(t *testing.T) {
+	var gotExclude []string
+	var sent []*api.InlineComment
+	var stdout bytes.Buffer
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			sent = comments
+			return nil
+		},
+	}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			gotExclude = options.Exclude
+			return []*api.InlineComment{
+				{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("big.go"), NewLine: util.Ptr(int64(1))}},
+				{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("small.go"), NewLine: util.Ptr(int64(1))}},
+			}, nil
+		},
+	}
+	vcs := newNoopVCS()
+	vcs.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+		return topFilesDiff, nil
+	}
+
+	cfg := &api.Config{TopFiles: 2, Exclude: []string{"docs/"}}
+	app := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, vcs, mockAI), &stdout, io.Discard)
+	if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Contains(gotExclude, "small.go") || !slices.Contains(gotExclude, "**/docs/**") {
+		t.Errorf("expected the skipped file and the user excludes, got %v", gotExclude)
+	}
+	if len(sent) != 1 || *sent[0].Position.NewPath != "big.go" {
+		t.Errorf("expected only the big.go comment, got %d comments", len(sent))
+	}
+	if !strings.Contains(stdout.String(), "Reviewing the 2 largest of 3 changed files, skipping 1") ||
+		!strings.Contains(stdout.String(), "1 files skipped") {
+		t.Errorf("expected the skipped count in the output, got %q", stdout.String())
+	}
+}
+
+func TestApp_Run_MaxFiles(t *testing.T) {
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	var gotExclude []string
+	agentCalls := 0
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			agentCalls++
+			gotExclude = options.Exclude
+			if err := os.WriteFile(filepath.Join(options.SandBoxDir, ai.SummaryFileName), []byte("Looks good."), 0644); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		},
+	}
+	vcs := newNoopVCS()
+	vcs.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+		return topFilesDiff, nil
+	}
+	run := func(cfg *api.Config) error {
+		gotExclude, agentCalls = nil, 0
+		cfg.Exclude = []string{"docs/"}
+		return NewAppWithWriters(validConfig(cfg), newMockFactory(provider, vcs, mockAI), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+	}
+
+	t.Run("within the limit", func(t *testing.T) {
+		if err := run(&api.Config{MaxFiles: 3}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if slices.Contains(gotExclude, "small.go") {
+			t.Errorf("a file was skipped within the limit: %v", gotExclude)
+		}
+	})
+
+	t.Run("reviews the largest files", func(t *testing.T) {
+		summaryFile := filepath.Join(t.TempDir(), "summary.txt")
+		if err := run(&api.Config{MaxFiles: 2, SummaryFile: summaryFile}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Contains(gotExclude, "small.go") {
+			t.Errorf("expected the smallest file to be skipped, got %v", gotExclude)
+		}
+		data, err := os.ReadFile(summaryFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tooManyFilesNote(2, 1) + "Looks good."; string(data) != want {
+			t.Errorf("summary file = %q, want %q", data, want)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		err := run(&api.Config{MaxFiles: 2, OnTooManyFiles: TooManyFilesAbort})
+		if err == nil || !strings.Contains(err.Error(), "PR changes 3 files, more than the maximum of 2") {
+			t.Errorf("expected the run to abort, got %v", err)
+		}
+		if agentCalls != 0 {
+			t.Errorf("agent ran %d times", agentCalls)
+		}
+	})
+}
+
+func TestApp_Run_MaxDiffBytes(t *testing.T) {
+	var gotExclude []string
+	var notes []string
+	provider := &MockPullRequestCommenterService{
+		MockRemoteGitService: MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return nil
+			},
+		},
+		CommentOnPullRequestFunc: func(pullRequestInfo *api.PullRequestInfo, body string) error {
+			notes = append(notes, body)
+			return nil
+		},
+	}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			gotExclude = options.Exclude
+			return nil, nil
+		},
+	}
+	vcs := newNoopVCS()
+	vcs.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+		return topFilesDiff, nil
+	}
+	prDiff, err := diff.Parse(topFilesDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// everything but the largest section, the deletion of gone.go, and the excluded docs
+	fits := prDiff.File("small.go").Bytes + prDiff.File("big.go").Bytes
+	run := func(maxDiffBytes int) error {
+		gotExclude, notes = nil, nil
+		cfg := validConfig(&api.Config{MaxDiffBytes: maxDiffBytes, Exclude: []string{"docs/"}})
+		return NewAppWithWriters(cfg, newMockFactory(provider, vcs, mockAI), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+	}
+
+	t.Run("within the limit", func(t *testing.T) {
+		if err := run(fits + prDiff.File("gone.go").Bytes); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if slices.Contains(gotExclude, "gone.go") || len(notes) != 0 {
+			t.Errorf("a file was skipped within the limit: %v, notes %v", gotExclude, notes)
+		}
+	})
+
+	t.Run("skips the largest file", func(t *testing.T) {
+		if err := run(fits); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Contains(gotExclude, "gone.go") || slices.Contains(gotExclude, "big.go") || slices.Contains(gotExclude, "small.go") {
+			t.Errorf("expected only gone.go to be skipped, got %v", gotExclude)
+		}
+		if want := []string{skippedFilesNote(fits, []string{"gone.go"})}; !slices.Equal(notes, want) {
+			t.Errorf("notes = %q, want %q", notes, want)
+		}
+	})
+
+	t.Run("nothing fits", func(t *testing.T) {
+		if err := run(1); err == nil || !strings.Contains(err.Error(), "no changed file fits") {
+			t.Errorf("expected the run to fail, got %v", err)
+		}
+	})
+}
+
+func TestApp_Run_Files(t *testing.T) {
+	var gotExclude []string
+	var sent []*api.InlineComment
+	var stdout, stderr bytes.Buffer
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			sent = comments
+			return nil
+		},
+	}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			gotExclude = options.Exclude
+			return []*api.InlineComment{
+				{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("big.go"), NewLine: util.Ptr(int64(1))}},
+				{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("gone.go"), OldLine: util.Ptr(int64(1))}},
+			}, nil
+		},
+	}
+	vcs := newNoopVCS()
+	vcs.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+		return topFilesDiff, nil
+	}
+
+	cfg := &api.Config{Files: []string{"big.go", "./small.go", "missing.go"}}
+	app := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, vcs, mockAI), &stdout, &stderr)
+	if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Contains(gotExclude, "gone.go") || slices.Contains(gotExclude, "small.go") {
+		t.Errorf("expected only the unnamed files excluded, got %v", gotExclude)
+	}
+	if len(sent) != 1 || *sent[0].Position.NewPath != "big.go" {
+		t.Errorf("expected only the big.go comment, got %d comments", len(sent))
+	}
+	if !strings.Contains(stdout.String(), "Reviewing 2 of 4 changed files") {
+		t.Errorf("expected the reviewed count in the output, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "not changed in the PR, or excluded: missing.go") {
+		t.Errorf("expected a warning about missing.go, got %q", stderr.String())
+	}
+
+	cfg = &api.Config{Files: []string{"missing.go"}}
+	app = NewAppWithWriters(validConfig(cfg), newMockFactory(provider, vcs, mockAI), io.Discard, io.Discard)
+	err := app.Run("https://github.com/org/repo/pull/1")
+	if err == nil || !strings.Contains(err.Error(), "none of the files to review are changed in the PR") {
+		t.Errorf("expected an error when no named file is changed, got %v", err)
+	}
+}
+
+func TestApp_Run_MinDiffLines(t *testing.T) {
+	// topFilesDiff changes 9 lines outside docs/ and 10 more in it
+	tests := []struct {
+		name       string
+		min        int
+		wantReview bool
+	}{
+		{name: "below the floor", min: 10, wantReview: false},
+		{name: "at the floor", min: 9, wantReview: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewed := false
+			var stdout bytes.Buffer
+			provider := &MockRemoteGitService{
+				GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+					return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+				},
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					return nil
+				},
+			}
+			mockAI := &MockAIAgentService{
+				GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+					reviewed = true
+					return nil, nil
+				},
+			}
+			vcs := newNoopVCS()
+			vcs.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+				return topFilesDiff, nil
+			}
+
+			cfg := &api.Config{MinDiffLines: tt.min, Exclude: []string{"docs/"}}
+			app := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, vcs, mockAI), &stdout, io.Discard)
+			if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if reviewed != tt.wantReview {
+				t.Errorf("expected reviewed %v, got %v", tt.wantReview, reviewed)
+			}
+			if skipped := strings.Contains(stdout.String(), "PR too small to review, 9 changed lines"); skipped == tt.wantReview {
+				t.Errorf("unexpected skip message in the output %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestApp_Run_MaxAiProcesses(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	mockAI := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	app := NewAppWithWriters(validConfig(&api.Config{MaxAiProcesses: 2}), newMockFactory(provider, newNoopVCS(), mockAI), io.Discard, io.Discard)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if err := app.Run("https://github.com/org/repo/pull/1"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if maxRunning > 2 {
+		t.Errorf("max concurrent AI invocations = %d, want at most 2", maxRunning)
+	}
+}
+
+func TestApp_Run_NoClone(t *testing.T) {
+	const compareDiff = "diff --git a/svc/main.go b/svc/main.go\n--- a/svc/main.go\n+++ b/svc/main.go\n@@ -1,2 +1,2 @@\n package main\n-var a = 1\n+var a = 2\n" +
+		"diff --git a/docs/readme.md b/docs/readme.md\n--- a/docs/readme.md\n+++ b/docs/readme.md\n@@ -1 +1 @@\n-old\n+new\n"
+
+	run := func(cfg *api.Config, diffErr error) (cloned bool, options *api.GeneratePRInlineCommentsOptions, diffText string, stderr string, err error) {
+		provider := &MockCompareDiffService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+					return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+				},
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					return nil
+				},
+			},
+			CompareDiffFunc: func(pullRequestInfo *api.PullRequestInfo) (string, error) {
+				return compareDiff, diffErr
+			},
+		}
+		vcs := &MockVersionControlService{
+			CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+				cloned = true
+				return nil
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, o *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				options = o
+				if o.DiffFile != "" {
+					data, _ := os.ReadFile(o.DiffFile)
+					diffText = string(data)
+				}
+				return nil, nil
+			},
+		}
+		var errOut bytes.Buffer
+		err = NewAppWithWriters(validConfig(cfg), newMockFactory(provider, vcs, ai), io.Discard, &errOut).Run("https://github.com/org/repo/pull/1")
+		return cloned, options, diffText, errOut.String(), err
+	}
+
+	t.Run("reviews the scoped compare diff", func(t *testing.T) {
+		cloned, options, diffText, _, err := run(&api.Config{NoClone: true, Exclude: []string{"docs/"}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cloned {
+			t.Error("expected no clone")
+		}
+		if options.DiffFile == "" || !strings.Contains(diffText, "svc/main.go") || strings.Contains(diffText, "docs/readme.md") {
+			t.Errorf("unexpected diff file %q:\n%s", options.DiffFile, diffText)
+		}
+	})
+
+	t.Run("truncated diff falls back to clone", func(t *testing.T) {
+		cloned, options, _, stderr, err := run(&api.Config{NoClone: true}, vcs_provider.ErrDiffTruncated)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !cloned || options.DiffFile != "" {
+			t.Errorf("expected a clone without diff file, cloned=%v diff file=%q", cloned, options.DiffFile)
+		}
+		if !strings.Contains(stderr, "cloning instead") {
+			t.Errorf("expected fallback warning, got %q", stderr)
+		}
+	})
+
+	t.Run("rejected token fails", func(t *testing.T) {
+		_, _, _, _, err := run(&api.Config{NoClone: true}, vcs_provider.ErrUnauthorized)
+		if !errors.Is(err, vcs_provider.ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got %v", err)
+		}
+	})
+
+	t.Run("clones without the flag", func(t *testing.T) {
+		cloned, _, _, _, err := run(&api.Config{}, nil)
+		if err != nil || !cloned {
+			t.Errorf("expected a clone, cloned=%v err=%v", cloned, err)
+		}
+	})
+}
+
+func TestApp_Run_ApplyLabel(t *testing.T) {
+	run := func(cfg *api.Config, genErr, labelErr error) ([]string, string, error) {
+		var labels []string
+		provider := &MockLabelerService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+					return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+				},
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					return nil
+				},
+			},
+			AddLabelFunc: func(pullRequestInfo *api.PullRequestInfo, label string) error {
+				labels = append(labels, label)
+				return labelErr
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				return nil, genErr
+			},
+		}
+		var stderr bytes.Buffer
+		err := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, newNoopVCS(), ai), io.Discard, &stderr).Run("https://github.com/org/repo/pull/1")
+		return labels, stderr.String(), err
+	}
+
+	t.Run("labels a reviewed pull request", func(t *testing.T) {
+		labels, _, err := run(&api.Config{ApplyLabel: "gitex-reviewed"}, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.Equal(labels, []string{"gitex-reviewed"}) {
+			t.Errorf("labels = %v, want [gitex-reviewed]", labels)
+		}
+	})
+
+	t.Run("no label without the flag", func(t *testing.T) {
+		if labels, _, _ := run(&api.Config{}, nil, nil); len(labels) != 0 {
+			t.Errorf("labels = %v, want none", labels)
+		}
+	})
+
+	t.Run("no label when the review fails", func(t *testing.T) {
+		labels, _, err := run(&api.Config{ApplyLabel: "gitex-reviewed"}, errors.New("agent crashed"), nil)
+		if err == nil || len(labels) != 0 {
+			t.Errorf("expected failure without label, err=%v labels=%v", err, labels)
+		}
+	})
+
+	t.Run("label failure is a warning", func(t *testing.T) {
+		_, stderr, err := run(&api.Config{ApplyLabel: "gitex-reviewed"}, nil, errors.New("label does not exist and could not be created"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stderr, "could not be created") {
+			t.Errorf("expected warning, got %q", stderr)
+		}
+	})
+
+	t.Run("rejected token fails", func(t *testing.T) {
+		_, _, err := run(&api.Config{ApplyLabel: "gitex-reviewed"}, nil, vcs_provider.ErrUnauthorized)
+		if !errors.Is(err, vcs_provider.ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got %v", err)
+		}
+	})
+}
+
+func TestApp_Run_CloneFallback(t *testing.T) {
+	run := func(cfg *api.Config, sourceBranch string, cloneErr error) ([]string, error) {
+		var clones []string
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: sourceBranch, BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return nil
+			},
+		}
+		gitService := &MockCommitClonerVCS{
+			MockVersionControlService: MockVersionControlService{
+				CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+					clones = append(clones, "branch "+ref)
+					return cloneErr
+				},
+			},
+			CloneCommitWithContextFunc: func(ctx context.Context, path, repoUrl, sha string) error {
+				clones = append(clones, "commit "+sha)
+				return nil
+			},
+			CloneDefaultBranchWithContextFunc: func(ctx context.Context, path, repoUrl, sha string) error {
+				clones = append(clones, "default branch "+sha)
+				return nil
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				return nil, nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(cfg), newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		return clones, err
+	}
+	refNotFound := &vcs.CloneError{Err: fmt.Errorf("%w: refs/heads/feature", vcs.ErrRefNotFound)}
+
+	tests := []struct {
+		name         string
+		cfg          *api.Config
+		sourceBranch string
+		cloneErr     error
+		wantClones   []string
+		wantErr      bool
+	}{
+		{name: "source branch", cfg: &api.Config{}, sourceBranch: "feature", wantClones: []string{"branch feature"}},
+		{name: "no source branch", cfg: &api.Config{}, wantClones: []string{"commit head"}},
+		{name: "deleted source branch", cfg: &api.Config{}, sourceBranch: "feature", cloneErr: refNotFound,
+			wantClones: []string{"branch feature", "commit head"}},
+		{name: "default branch fallback", cfg: &api.Config{CloneFallback: CloneFallbackDefaultBranch}, sourceBranch: "feature", cloneErr: refNotFound,
+			wantClones: []string{"branch feature", "default branch head"}},
+		{name: "fallback disabled", cfg: &api.Config{CloneFallback: CloneFallbackNone}, sourceBranch: "feature", cloneErr: refNotFound,
+			wantClones: []string{"branch feature"}, wantErr: true},
+		{name: "other clone errors do not fall back", cfg: &api.Config{}, sourceBranch: "feature", cloneErr: errors.New("authentication required"),
+			wantClones: []string{"branch feature"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clones, err := run(tt.cfg, tt.sourceBranch, tt.cloneErr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(clones, tt.wantClones) {
+				t.Errorf("clones = %v, want %v", clones, tt.wantClones)
+			}
+		})
+	}
+}
+
+func TestApp_Run_BaseTag(t *testing.T) {
+	run := func(ctx context.Context, gitService api.VersionControlService) (*api.GeneratePRInlineCommentsOptions, []*api.InlineComment, error) {
+		var options *api.GeneratePRInlineCommentsOptions
+		var sent []*api.InlineComment
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "release/1.x", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				sent = comments
+				return nil
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				options = opts
+				return []*api.InlineComment{{
+					Body: util.Ptr("finding"),
+					Position: &api.InlineCommentPosition{
+						BaseSha: util.Ptr(opts.BaseSha),
+						NewPath: util.Ptr("main.go"),
+						NewLine: util.Ptr(int64(1)),
+					},
+				}}, nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{BaseTag: "v1.2.3"}), newMockFactory(provider, gitService, ai), io.Discard, io.Discard).RunWithContext(ctx, "https://github.com/org/repo/pull/1")
+		return options, sent, err
+	}
+	resolver := func(sha string, err error) *MockTagResolverVCS {
+		return &MockTagResolverVCS{
+			MockVersionControlService: *newNoopVCS(),
+			ResolveTagFunc: func(ctx context.Context, path, tag string) (string, error) {
+				if tag != "v1.2.3" {
+					t.Errorf("tag = %q, want v1.2.3", tag)
+				}
+				return sha, err
+			},
+		}
+	}
+
+	t.Run("reviews since the tag", func(t *testing.T) {
+		options, sent, err := run(context.Background(), resolver("tagsha", nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if options.BaseSha != "tagsha" {
+			t.Errorf("review BaseSha = %q, want tagsha", options.BaseSha)
+		}
+		if len(sent) != 1 || *sent[0].Position.BaseSha != "base" {
+			t.Error("expected posted comments to keep the pull request base")
+		}
+	})
+
+	t.Run("unknown tag fails", func(t *testing.T) {
+		_, _, err := run(context.Background(), resolver("", vcs.ErrTagNotFound))
+		if !errors.Is(err, vcs.ErrTagNotFound) {
+			t.Errorf("expected ErrTagNotFound, got %v", err)
+		}
+	})
+
+	t.Run("unsupported version control service", func(t *testing.T) {
+		if _, _, err := run(context.Background(), newNoopVCS()); err == nil {
+			t.Error("expected error")
+		}
+	})
+	t.Run("canceling the run stops resolving", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		gitService := &MockTagResolverVCS{
+			MockVersionControlService: *newNoopVCS(),
+			ResolveTagFunc: func(resolveCtx context.Context, path, tag string) (string, error) {
+				cancel()
+				select {
+				case <-resolveCtx.Done():
+					return "", resolveCtx.Err()
+				case <-time.After(5 * time.Second):
+					t.Error("resolving the tag outlived the canceled run")
+					return "tagsha", nil
+				}
+			},
+		}
+		if _, _, err := run(ctx, gitService); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+func TestApp_Run_Commits(t *testing.T) {
+	// two commits change main.go, only their three added lines count
+	const commitsDiff = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n package main\n+var x = 1\n" +
+		"diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -2,1 +2,3 @@\n var x = 1\n+var y = 2\n+var z = 3\n"
+	run := func(resolveErr error, minDiffLines int) (*api.GeneratePRInlineCommentsOptions, error) {
+		var options *api.GeneratePRInlineCommentsOptions
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return nil
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				options = opts
+				return nil, nil
+			},
+		}
+		gitService := &MockCommitSelectorVCS{
+			MockVersionControlService: *newNoopVCS(),
+			ResolveCommitsFunc: func(ctx context.Context, path, baseSha, headSha string, revs []string) ([]string, error) {
+				if baseSha != "base" || headSha != "head" || !slices.Equal(revs, []string{"abc1234", "def5678"}) {
+					t.Errorf("ResolveCommits(%s, %s, %v)", baseSha, headSha, revs)
+				}
+				return []string{"abc1234000000000000000000000000000000000", "def5678000000000000000000000000000000000"}, resolveErr
+			},
+			CommitsDiffFunc: func(ctx context.Context, path string, shas []string) (string, error) {
+				return commitsDiff, nil
+			},
+		}
+		cfg := validConfig(&api.Config{Commits: []string{"abc1234", "def5678"}, MinDiffLines: minDiffLines})
+		err := NewAppWithWriters(cfg, newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		return options, err
+	}
+
+	t.Run("reviews the commits", func(t *testing.T) {
+		options, err := run(nil, 3)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if options == nil {
+			t.Fatal("expected the three lines of the commits to be reviewed")
+		}
+		if len(options.Commits) != 2 || options.Commits[0] != "abc1234000000000000000000000000000000000" {
+			t.Errorf("Commits = %v, want the resolved shas", options.Commits)
+		}
+	})
+
+	t.Run("diff based filters see only the commits", func(t *testing.T) {
+		options, err := run(nil, 4)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if options != nil {
+			t.Error("expected the review to be skipped, the commits add fewer lines than the minimum")
+		}
+	})
+
+	t.Run("commit outside the pull request fails", func(t *testing.T) {
+		if _, err := run(vcs.ErrCommitNotInRange, 0); !errors.Is(err, vcs.ErrCommitNotInRange) {
+			t.Errorf("expected ErrCommitNotInRange, got %v", err)
+		}
+	})
+}
+
+func TestApp_Run_RepoContext(t *testing.T) {
+	run := func(indexErr error) (*api.GeneratePRInlineCommentsOptions, error) {
+		var options *api.GeneratePRInlineCommentsOptions
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return nil
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				options = opts
+				return nil, nil
+			},
+		}
+		gitService := &MockRepoIndexerVCS{
+			MockVersionControlService: *newNoopVCS(),
+			RepoIndexFunc: func(ctx context.Context, path string, maxBytes int, skip func(path string) bool) (string, error) {
+				if maxBytes != 2048 {
+					t.Errorf("maxBytes = %d, want 2048", maxBytes)
+				}
+				if !skip("vendor/lib.go") || !skip("gen/api.pb.go") || skip("main.go") {
+					t.Error("expected the excluded and generated files to be skipped")
+				}
+				return "- main.go: main\n", indexErr
+			},
+		}
+		cfg := validConfig(&api.Config{RepoContext: 2048, Exclude: []string{"gen/"}})
+		err := NewAppWithWriters(cfg, newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		return options, err
+	}
+
+	t.Run("gives the agent the index", func(t *testing.T) {
+		options, err := run(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if options == nil || options.RepoContext != "- main.go: main\n" {
+			t.Errorf("options = %+v", options)
+		}
+	})
+
+	t.Run("reviews without the index when it fails", func(t *testing.T) {
+		options, err := run(errors.New("corrupt repository"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if options == nil || options.RepoContext != "" {
+			t.Errorf("options = %+v", options)
+		}
+	})
+}
+
+func TestApp_Run_DryRun(t *testing.T) {
+	const prDiff = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n package main\n+var x = 1\n" +
+		"diff --git a/old.go b/old.go\n--- a/old.go\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-package main\n"
+	run := func(t *testing.T, cfg *api.Config) string {
+		t.Helper()
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				t.Error("dry run posted comments")
+				return nil
+			},
+		}
+		gitService := newNoopVCS()
+		gitService.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+			return prDiff, nil
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				if err := os.WriteFile(filepath.Join(opts.SandBoxDir, ai.SummaryFileName), []byte("All good."), 0644); err != nil {
+					return nil, err
+				}
+				return []*api.InlineComment{{
+					Body:     util.Ptr("unused variable\nDetails"),
+					Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(2))},
+				}}, nil
+			},
+		}
+		var stdout bytes.Buffer
+		err := NewAppWithWriters(cfg, newMockFactory(provider, gitService, ai), &stdout, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return stdout.String()
+	}
+
+	t.Run("placeholder comments without an ai key", func(t *testing.T) {
+		cfg := validConfig(&api.Config{DryRun: true})
+		cfg.AiApiKey = ""
+		out := run(t, cfg)
+		if !strings.Contains(out, "Would comment on main.go:2: "+placeholderBody) {
+			t.Errorf("output missing placeholder comment:\n%s", out)
+		}
+		if strings.Contains(out, "old.go") {
+			t.Errorf("placeholder on a file without added lines:\n%s", out)
+		}
+		if !strings.Contains(out, "Dry run finished, 1 comments not posted") {
+			t.Errorf("output missing dry run summary:\n%s", out)
+		}
+	})
+
+	t.Run("summary file is written", func(t *testing.T) {
+		summaryFile := filepath.Join(t.TempDir(), "out", "summary.txt")
+		run(t, validConfig(&api.Config{DryRun: true, SummaryFile: summaryFile}))
+		if data, err := os.ReadFile(summaryFile); err != nil || string(data) != "All good." {
+			t.Errorf("summary file = %q, %v, want the agent summary", data, err)
+		}
+	})
+
+	t.Run("review is printed with an ai key", func(t *testing.T) {
+		out := run(t, validConfig(&api.Config{DryRun: true}))
+		if !strings.Contains(out, "Would comment on main.go:2: unused variable\n") {
+			t.Errorf("output missing review comment:\n%s", out)
+		}
+		if strings.Contains(out, placeholderBody) {
+			t.Errorf("placeholder used despite ai key:\n%s", out)
+		}
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		out := run(t, validConfig(&api.Config{DryRun: true, OutputFormat: OutputFormatJSON}))
+		start, end := strings.Index(out, "[\n"), strings.LastIndex(out, "\n]\n")
+		if start < 0 || end < start {
+			t.Fatalf("output missing the JSON array:\n%s", out)
+		}
+		var comments []*api.InlineComment
+		if err := json.Unmarshal([]byte(out[start:end+2]), &comments); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, out)
+		}
+		if len(comments) != 1 || *comments[0].Body != "unused variable\nDetails" || *comments[0].Position.NewPath != "main.go" {
+			t.Errorf("unexpected comments %+v", comments)
+		}
+		if strings.Contains(out, "Would comment on") {
+			t.Errorf("comment lines printed next to the JSON:\n%s", out)
+		}
+	})
+}
+
+func TestApp_Run_OwnFilesOnly(t *testing.T) {
+	prInfo := func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+		return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+	}
+	ai := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			comment := func(path string) *api.InlineComment {
+				return &api.InlineComment{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr(path), NewLine: util.Ptr(int64(1))}}
+			}
+			return []*api.InlineComment{comment("payments/charge.go"), comment("web/index.ts")}, nil
+		},
+	}
+	gitService := &MockVersionControlService{
+		CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+			return os.WriteFile(filepath.Join(path, "CODEOWNERS"), []byte("payments/ @acme/payments\nweb/ @acme/web\n"), 0644)
+		},
+	}
+
+	t.Run("comments only on owned files", func(t *testing.T) {
+		var sent []*api.InlineComment
+		provider := &MockOwnerResolverService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: prInfo,
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					sent = comments
+					return nil
+				},
+			},
+			OwnerHandlesFunc: func() ([]string, error) {
+				return []string{"@gitex-bot", "@acme/payments"}, nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{OwnFilesOnly: true}), newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(sent) != 1 || *sent[0].Position.NewPath != "payments/charge.go" {
+			t.Errorf("expected only the payments comment, got %d comments", len(sent))
+		}
+	})
+
+	t.Run("team lookup fails", func(t *testing.T) {
+		provider := &MockOwnerResolverService{
+			MockRemoteGitService: MockRemoteGitService{GetPullRequestInfoFunc: prInfo},
+			OwnerHandlesFunc: func() ([]string, error) {
+				return nil, vcs_provider.ErrUnauthorized
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{OwnFilesOnly: true}), newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if !errors.Is(err, vcs_provider.ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got %v", err)
+		}
+	})
+
+	t.Run("unsupported provider", func(t *testing.T) {
+		provider := &MockRemoteGitService{GetPullRequestInfoFunc: prInfo}
+		err := NewAppWithWriters(validConfig(&api.Config{OwnFilesOnly: true}), newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err == nil || !strings.Contains(err.Error(), "own files only is not supported") {
+			t.Errorf("expected unsupported error, got %v", err)
+		}
+	})
+}
+
+func TestApp_Run_SkipOpenThreads(t *testing.T) {
+	prInfo := func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+		return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+	}
+	ai := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			comment := func(line int64) *api.InlineComment {
+				return &api.InlineComment{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(line)}}
+			}
+			return []*api.InlineComment{comment(3), comment(7), comment(9)}, nil
+		},
+	}
+
+	t.Run("skips lines with unresolved threads", func(t *testing.T) {
+		var sent []*api.InlineComment
+		provider := &MockThreadTrackerService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: prInfo,
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					sent = comments
+					return nil
+				},
+			},
+			PriorThreadsFunc: func(pullRequestInfo *api.PullRequestInfo) ([]*api.PriorThread, error) {
+				return []*api.PriorThread{
+					{Path: "main.go", NewLine: 3},
+					{Path: "main.go", NewLine: 7, Resolved: true},
+				}, nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{SkipOpenThreads: true}), newMockFactory(provider, newNoopVCS(), ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var lines []int64
+		for _, comment := range sent {
+			lines = append(lines, *comment.Position.NewLine)
+		}
+		if !slices.Equal(lines, []int64{7, 9}) {
+			t.Errorf("sent comments on lines %v, want [7 9]", lines)
+		}
+	})
+
+	t.Run("lookup failure posts all comments", func(t *testing.T) {
+		var sent []*api.InlineComment
+		var stderr bytes.Buffer
+		provider := &MockThreadTrackerService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: prInfo,
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					sent = comments
+					return nil
+				},
+			},
+			PriorThreadsFunc: func(pullRequestInfo *api.PullRequestInfo) ([]*api.PriorThread, error) {
+				return nil, errors.New("graphql unavailable")
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{SkipOpenThreads: true}), newMockFactory(provider, newNoopVCS(), ai), io.Discard, &stderr).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(sent) != 3 {
+			t.Errorf("expected all 3 comments, got %d", len(sent))
+		}
+		if !strings.Contains(stderr.String(), "Warning: commenting on all lines: graphql unavailable") {
+			t.Errorf("expected warning, got %q", stderr.String())
+		}
+	})
+
+	t.Run("rejected token stops the run", func(t *testing.T) {
+		provider := &MockThreadTrackerService{
+			MockRemoteGitService: MockRemoteGitService{GetPullRequestInfoFunc: prInfo},
+			PriorThreadsFunc: func(pullRequestInfo *api.PullRequestInfo) ([]*api.PriorThread, error) {
+				return nil, vcs_provider.ErrUnauthorized
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{SkipOpenThreads: true}), newMockFactory(provider, newNoopVCS(), ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if !errors.Is(err, vcs_provider.ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got %v", err)
+		}
+	})
+}
+
+func TestApp_Run_RunRetries(t *testing.T) {
+	oldDelay := runRetryDelay
+	runRetryDelay = time.Millisecond
+	defer func() { runRetryDelay = oldDelay }()
+
+	agent := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(1))}}}, nil
+		},
+	}
+	networkErr := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+	newProvider := func(send func() error) *MockRemoteGitService {
+		return &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return send()
+			},
+		}
+	}
+	flakyClone := func(failures int, err error) (*MockVersionControlService, *int) {
+		clones := 0
+		gitService := newNoopVCS()
+		gitService.CloneRepoWithContextFunc = func(ctx context.Context, path, repoUrl, ref string) error {
+			clones++
+			if clones <= failures {
+				return err
+			}
+			return nil
+		}
+		return gitService, &clones
+	}
+
+	t.Run("transient clone failure is retried", func(t *testing.T) {
+		gitService, clones := flakyClone(1, &vcs.CloneError{Err: errors.New("unexpected EOF"), Transient: true})
+		var stdout, stderr bytes.Buffer
+		cfg := validConfig(&api.Config{RunRetries: 2})
+		err := NewAppWithWriters(cfg, newMockFactory(newProvider(func() error { return nil }), gitService, agent), &stdout, &stderr).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if *clones != 2 {
+			t.Errorf("clones = %d, want 2", *clones)
+		}
+		if !strings.Contains(stderr.String(), "Warning: run attempt 1 of 3 failed, retrying in 1ms") {
+			t.Errorf("expected the failed attempt to be logged, got %q", stderr.String())
+		}
+		if !strings.Contains(stdout.String(), "Run succeeded on attempt 2") {
+			t.Errorf("expected the outcome to be logged, got %q", stdout.String())
+		}
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		gitService, clones := flakyClone(5, &vcs.CloneError{Err: errors.New("unexpected EOF"), Transient: true})
+		var stderr bytes.Buffer
+		cfg := validConfig(&api.Config{RunRetries: 1})
+		err := NewAppWithWriters(cfg, newMockFactory(newProvider(func() error { return nil }), gitService, agent), io.Discard, &stderr).Run("https://github.com/org/repo/pull/1")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if *clones != 2 || !strings.Contains(stderr.String(), "Run failed after 2 attempts") {
+			t.Errorf("clones = %d, stderr %q", *clones, stderr.String())
+		}
+	})
+
+	t.Run("missing branch is not retried", func(t *testing.T) {
+		gitService, clones := flakyClone(5, &vcs.CloneError{Err: vcs.ErrRefNotFound})
+		cfg := validConfig(&api.Config{RunRetries: 2, CloneFallback: CloneFallbackNone})
+		err := NewAppWithWriters(cfg, newMockFactory(newProvider(func() error { return nil }), gitService, agent), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if *clones != 1 {
+			t.Errorf("clones = %d, want 1", *clones)
+		}
+	})
+
+	t.Run("not retried once comments were posted", func(t *testing.T) {
+		sends := 0
+		provider := newProvider(func() error {
+			sends++
+			return fmt.Errorf("failed to send comment on main.go:1: %w", networkErr)
+		})
+		cfg := validConfig(&api.Config{RunRetries: 2, FailFast: true})
+		err := NewAppWithWriters(cfg, newMockFactory(provider, newNoopVCS(), agent), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if !errors.Is(err, networkErr) {
+			t.Fatalf("expected the send error, got %v", err)
+		}
+		if sends != 1 {
+			t.Errorf("sends = %d, want 1", sends)
+		}
+	})
+}
+
+func TestApp_Run_RedactRefusesClone(t *testing.T) {
+	patternsPath := filepath.Join(t.TempDir(), "redact.txt")
+	if err := os.WriteFile(patternsPath, []byte("corp\\.example\\.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+		},
+	}
+	gitService := newNoopVCS()
+	gitService.CloneRepoWithContextFunc = func(ctx context.Context, path, repoUrl, ref string) error {
+		t.Error("cloned despite redaction")
+		return nil
+	}
+
+	// the mock provider cannot fetch the compare diff, so the review would fall back to a clone
+	cfg := validConfig(&api.Config{NoClone: true, RedactPatternsFile: patternsPath})
+	err := NewAppWithWriters(cfg, newMockFactory(provider, gitService, &MockAIAgentService{}), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+	if err == nil || !strings.Contains(err.Error(), "refusing to clone") {
+		t.Errorf("expected the clone to be refused, got %v", err)
+	}
+}
+
+func TestApp_Run_OutputFile(t *testing.T) {
+	agentCalls := 0
+	agent := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			agentCalls++
+			if err := os.WriteFile(filepath.Join(opts.SandBoxDir, ai.SummaryFileName), []byte("Looks good.\n"), 0644); err != nil {
+				return nil, err
+			}
+			return []*api.InlineComment{{
+				Body:     util.Ptr("unused variable"),
+				Category: "maintainability",
+				Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(2))},
+			}}, nil
+		},
+	}
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return &vcs_provider.SendError{Failed: 1}
+		},
+	}
+
+	t.Run("written although posting failed", func(t *testing.T) {
+		outputFile := filepath.Join(t.TempDir(), "artifacts", "review", "comments.json")
+		cfg := validConfig(&api.Config{OutputFile: outputFile})
+		err := NewAppWithWriters(cfg, newMockFactory(provider, newNoopVCS(), agent), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var output struct {
+			Comments []*api.InlineComment `json:"comments"`
+			Summary  string               `json:"summary"`
+		}
+		if err := json.Unmarshal(data, &output); err != nil {
+			t.Fatalf("output file is not JSON: %v\n%s", err, data)
+		}
+		if len(output.Comments) != 1 || *output.Comments[0].Body != "unused variable" || output.Comments[0].Category != "maintainability" ||
+			*output.Comments[0].Position.NewPath != "main.go" || *output.Comments[0].Position.NewLine != 2 {
+			t.Errorf("comments did not round-trip: %s", data)
+		}
+		if output.Summary != "Looks good." {
+			t.Errorf("summary = %q, want the agent summary", output.Summary)
+		}
+	})
+
+	t.Run("unwritable path fails before the review", func(t *testing.T) {
+		blocker := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(blocker, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		agentCalls = 0
+		cfg := validConfig(&api.Config{OutputFile: filepath.Join(blocker, "comments.json")})
+		err := NewAppWithWriters(cfg, newMockFactory(provider, newNoopVCS(), agent), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err == nil || !strings.Contains(err.Error(), "is not writable") {
+			t.Errorf("expected a not writable error, got %v", err)
+		}
+		if agentCalls != 0 {
+			t.Errorf("agent ran %d times for an unwritable output file", agentCalls)
+		}
+	})
+}
+
+func TestApp_Run_SendErrorDetails(t *testing.T) {
+	agent := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(3))}}}, nil
+		},
+	}
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return &vcs_provider.SendError{Failed: 2, Comments: []*vcs_provider.CommentError{
+				{Path: "main.go", Line: 3, StatusCode: 422, Message: "line could not be resolved", Err: errors.New("422")},
+				{Path: "util.go", Line: 7, Message: "connection reset", Err: errors.New("connection reset")},
+			}}
+		},
+	}
+
+	var stderr bytes.Buffer
+	err := NewAppWithWriters(validConfig(&api.Config{}), newMockFactory(provider, newNoopVCS(), agent), io.Discard, &stderr).Run("https://github.com/org/repo/pull/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Warning: failed to send 2 comments\n  main.go:3: line could not be resolved (status 422)\n  util.go:7: connection reset\n"
+	if !strings.Contains(stderr.String(), want) {
+		t.Errorf("expected the failed comments in the warning, got %q", stderr.String())
+	}
+}
+
+func TestApp_Run_PostHook(t *testing.T) {
+	ai := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			comment := func(line int64) *api.InlineComment {
+				return &api.InlineComment{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(line)}}
+			}
+			return []*api.InlineComment{comment(1), comment(2), comment(3)}, nil
+		},
+	}
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return &vcs_provider.SendError{Failed: 1}
+		},
+	}
+
+	t.Run("passes the result on stdin and in the environment", func(t *testing.T) {
+		resultFile := filepath.Join(t.TempDir(), "result.json")
+		var stdout bytes.Buffer
+		hook := fmt.Sprintf(`cat > %s; echo "$GITEX_PR_URL $GITEX_COMMENT_COUNT $GITEX_FAILED_COUNT"`, resultFile)
+		cfg := validConfig(&api.Config{PostHook: hook, PostHookTimeout: 10 * time.Second})
+		err := NewAppWithWriters(cfg, newMockFactory(provider, newNoopVCS(), ai), &stdout, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stdout.String(), "post-hook: https://github.com/org/repo/pull/1 2 1\n") {
+			t.Errorf("expected hook output, got %q", stdout.String())
+		}
+		data, err := os.ReadFile(resultFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result hookResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatalf("hook input is not JSON: %v", err)
+		}
+		if result.HeadSha != "head" || result.Comments != 2 || result.Failed != 1 || len(result.Findings) != 3 {
+			t.Errorf("unexpected hook input %+v", result)
+		}
+	})
+
+	t.Run("failing hook only warns", func(t *testing.T) {
+		var stderr bytes.Buffer
+		cfg := validConfig(&api.Config{PostHook: "echo boom; exit 3", PostHookTimeout: 10 * time.Second})
+		err := NewAppWithWriters(cfg, newMockFactory(provider, newNoopVCS(), ai), io.Discard, &stderr).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stderr.String(), "Warning: post hook failed: exit status 3") {
+			t.Errorf("expected warning, got %q", stderr.String())
+		}
+	})
+
+	t.Run("slow hook is killed", func(t *testing.T) {
+		var stderr bytes.Buffer
+		cfg := validConfig(&api.Config{PostHook: "sleep 10", PostHookTimeout: 100 * time.Millisecond})
+		start := time.Now()
+		err := NewAppWithWriters(cfg, newMockFactory(provider, newNoopVCS(), ai), io.Discard, &stderr).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("run took %v, the hook was not killed", elapsed)
+		}
+		if !strings.Contains(stderr.String(), "Warning: post hook did not finish in time") {
+			t.Errorf("expected timeout warning, got %q", stderr.String())
+		}
+	})
+}
+
+func TestApp_Run_ReviewDescription(t *testing.T) {
+	prInfo := func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+		return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head", Title: "Add retries", Description: "Retries uploads."}, nil
+	}
+	noComments := func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+		return nil
+	}
+	codeReview := func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+		return nil, nil
+	}
+	var reviewed *api.ReviewDescriptionOptions
+	ai := &MockDescriptionReviewerService{
+		MockAIAgentService: MockAIAgentService{GeneratePRInlineCommentsWithContextFunc: codeReview},
+		ReviewDescriptionWithContextFunc: func(ctx context.Context, options *api.ReviewDescriptionOptions) (string, error) {
+			reviewed = options
+			return "- The description does not mention the new flag.", nil
+		},
+	}
+
+	t.Run("posts the review as a general comment", func(t *testing.T) {
+		var posted string
+		provider := &MockPullRequestCommenterService{
+			MockRemoteGitService: MockRemoteGitService{GetPullRequestInfoFunc: prInfo, SendInlineCommentsFunc: noComments},
+			CommentOnPullRequestFunc: func(pullRequestInfo *api.PullRequestInfo, body string) error {
+				posted = body
+				return nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{ReviewDescription: true}), newMockFactory(provider, newNoopVCS(), ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reviewed == nil || reviewed.Title != "Add retries" || reviewed.Description != "Retries uploads." || reviewed.BaseSha != "base" {
+			t.Errorf("unexpected review options %+v", reviewed)
+		}
+		if posted != "### gitex description review\n\n- The description does not mention the new flag." {
+			t.Errorf("posted = %q", posted)
+		}
+	})
+
+	t.Run("dry run prints the review", func(t *testing.T) {
+		var stdout bytes.Buffer
+		provider := &MockPullRequestCommenterService{
+			MockRemoteGitService: MockRemoteGitService{GetPullRequestInfoFunc: prInfo, SendInlineCommentsFunc: noComments},
+			CommentOnPullRequestFunc: func(pullRequestInfo *api.PullRequestInfo, body string) error {
+				t.Error("dry run must not post")
+				return nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{ReviewDescription: true, DryRun: true}), newMockFactory(provider, newNoopVCS(), ai), &stdout, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stdout.String(), "Would comment on the description:\n- The description does not mention the new flag.\n") {
+			t.Errorf("expected the review in the output, got %q", stdout.String())
+		}
+	})
+
+	t.Run("agent without description review", func(t *testing.T) {
+		var stdout bytes.Buffer
+		provider := &MockPullRequestCommenterService{
+			MockRemoteGitService: MockRemoteGitService{GetPullRequestInfoFunc: prInfo, SendInlineCommentsFunc: noComments},
+			CommentOnPullRequestFunc: func(pullRequestInfo *api.PullRequestInfo, body string) error {
+				t.Error("nothing to post without a review")
+				return nil
+			},
+		}
+		agent := &MockAIAgentService{GeneratePRInlineCommentsWithContextFunc: codeReview}
+		err := NewAppWithWriters(validConfig(&api.Config{ReviewDescription: true}), newMockFactory(provider, newNoopVCS(), agent), &stdout, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(stdout.String(), "Description review is not supported by the AI agent, skipping") {
+			t.Errorf("expected a note, got %q", stdout.String())
+		}
+	})
+}
+
+func TestApp_Run_SkipConflicts(t *testing.T) {
+	orig := diffRefsRetryDelays
+	diffRefsRetryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	defer func() { diffRefsRetryDelays = orig }()
+
+	run := func(skipConflicts bool, statuses ...string) (calls int, reviewed bool, stdout, stderr string) {
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+				status := statuses[min(calls, len(statuses)-1)]
+				calls++
+				return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head", MergeStatus: status}, nil
+			},
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return nil
+			},
+		}
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				reviewed = true
+				return nil, nil
+			},
+		}
+		var out, errOut bytes.Buffer
+		err := NewAppWithWriters(validConfig(&api.Config{SkipConflicts: skipConflicts}), newMockFactory(provider, newNoopVCS(), ai), &out, &errOut).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return calls, reviewed, out.String(), errOut.String()
+	}
+
+	t.Run("skips a conflicted PR", func(t *testing.T) {
+		_, reviewed, stdout, _ := run(true, api.MergeStatusConflict)
+		if reviewed {
+			t.Error("expected no review")
+		}
+		if !strings.Contains(stdout, "PR has merge conflicts, skipping the review") {
+			t.Errorf("expected skip message, got %q", stdout)
+		}
+	})
+
+	t.Run("warns without the flag", func(t *testing.T) {
+		calls, reviewed, _, stderr := run(false, api.MergeStatusConflict)
+		if !reviewed || calls != 1 {
+			t.Errorf("expected one fetch and a review, got %d fetches, reviewed %v", calls, reviewed)
+		}
+		if !strings.Contains(stderr, "Warning: PR has merge conflicts") {
+			t.Errorf("expected warning, got %q", stderr)
+		}
+	})
+
+	t.Run("waits for the mergeability", func(t *testing.T) {
+		calls, reviewed, _, _ := run(true, api.MergeStatusChecking, api.MergeStatusConflict)
+		if calls != 2 || reviewed {
+			t.Errorf("expected a refetch and no review, got %d fetches, reviewed %v", calls, reviewed)
+		}
+	})
+
+	t.Run("reviews when the mergeability stays unknown", func(t *testing.T) {
+		calls, reviewed, _, stderr := run(true, api.MergeStatusChecking)
+		if calls != 3 || !reviewed {
+			t.Errorf("expected 3 fetches and a review, got %d fetches, reviewed %v", calls, reviewed)
+		}
+		if !strings.Contains(stderr, "mergeability is still being computed, reviewing anyway") {
+			t.Errorf("expected warning, got %q", stderr)
+		}
+	})
+}
+
+func TestApp_Run_OwnershipFile(t *testing.T) {
+	ownershipFile := filepath.Join(t.TempDir(), "ownership.yaml")
+	if err := os.WriteFile(ownershipFile, []byte("billing/: PCI-sensitive\nweb/: frontend\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	gitService := newNoopVCS()
+	gitService.DiffFunc = func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+		return "diff --git a/billing/charge.go b/billing/charge.go\n--- a/billing/charge.go\n+++ b/billing/charge.go\n@@ -1,1 +1,1 @@\n-a\n+b\n", nil
+	}
+	var pathContext []string
+	ai := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			pathContext = opts.PathContext
+			return nil, nil
+		},
+	}
+
+	err := NewAppWithWriters(validConfig(&api.Config{OwnershipFile: ownershipFile}), newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(pathContext, []string{"billing/: PCI-sensitive"}) {
+		t.Errorf("PathContext = %q, want only the billing note", pathContext)
+	}
+}
+
+func TestApp_Run_UsePartialOnTimeout(t *testing.T) {
+	prInfo := func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+		return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+	}
+	partial := []*api.InlineComment{{
+		Body:     util.Ptr("finding"),
+		Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(3))},
+	}}
+	var gotKeepPartial bool
+	ai := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			gotKeepPartial = options.KeepPartial
+			return partial, fmt.Errorf("%w, 1 complete comments saved: %w", api.ErrReviewTruncated, context.DeadlineExceeded)
+		},
+	}
+
+	t.Run("posts the saved comments and a note", func(t *testing.T) {
+		var sent int
+		var note string
+		var stdout bytes.Buffer
+		provider := &MockPullRequestCommenterService{
+			MockRemoteGitService: MockRemoteGitService{
+				GetPullRequestInfoFunc: prInfo,
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					sent = len(comments)
+					return nil
+				},
+			},
+			CommentOnPullRequestFunc: func(pullRequestInfo *api.PullRequestInfo, body string) error {
+				note = body
+				return nil
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{UsePartialOnTimeout: true}), newMockFactory(provider, newNoopVCS(), ai), &stdout, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !gotKeepPartial {
+			t.Error("expected the agent to be asked for partial output")
+		}
+		if sent != 1 {
+			t.Errorf("sent %d comments, want 1", sent)
+		}
+		if !strings.Contains(note, "### gitex review truncated") || !strings.Contains(note, "only the 1 comments") {
+			t.Errorf("note = %q", note)
+		}
+		if !strings.Contains(stdout.String(), "Review truncated, 1 comments") {
+			t.Errorf("expected a truncated summary, got %q", stdout.String())
+		}
+	})
+
+	t.Run("canceling the run stops what follows the review", func(t *testing.T) {
+		runCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		canceling := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				cancel()
+				return partial, fmt.Errorf("%w, 1 complete comments saved: %w", api.ErrReviewTruncated, context.Canceled)
+			},
+		}
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: prInfo,
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				return nil
+			},
+		}
+		var stdout bytes.Buffer
+		cfg := validConfig(&api.Config{UsePartialOnTimeout: true, PostHook: "echo hook ran"})
+		_ = NewAppWithWriters(cfg, newMockFactory(provider, newNoopVCS(), canceling), &stdout, io.Discard).RunWithContext(runCtx, "https://github.com/org/repo/pull/1")
+		if strings.Contains(stdout.String(), "post-hook: hook ran") {
+			t.Error("expected the post hook not to run after the run was canceled")
+		}
+	})
+
+	t.Run("fails without the flag", func(t *testing.T) {
+		provider := &MockRemoteGitService{
+			GetPullRequestInfoFunc: prInfo,
+			SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+				t.Error("nothing must be posted")
+				return nil
+			},
+		}
+		failing := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				gotKeepPartial = options.KeepPartial
+				return nil, errors.New("error generating PR inline-comments: signal: killed")
+			},
+		}
+		err := NewAppWithWriters(validConfig(&api.Config{}), newMockFactory(provider, newNoopVCS(), failing), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if gotKeepPartial {
+			t.Error("partial output must not be asked for without the flag")
+		}
+	})
+}
+
+func TestApp_Run_Timeouts(t *testing.T) {
+	tests := []struct {
+		name             string
+		cfg              *api.Config
+		wantCloneTimeout time.Duration
+		wantAgentTimeout time.Duration
+	}{
+		{name: "defaults", cfg: &api.Config{}, wantCloneTimeout: DefaultCloneTimeout, wantAgentTimeout: DefaultAgentTimeout},
+		{name: "configured", cfg: &api.Config{CloneTimeout: 5 * time.Minute, AgentTimeout: 30 * time.Minute},
+			wantCloneTimeout: 5 * time.Minute, wantAgentTimeout: 30 * time.Minute},
+	}
+
+	// remaining is how far away the deadline of ctx is, rounded to the minute to absorb the time the run took
+	remaining := func(t *testing.T, ctx context.Context) time.Duration {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("expected a deadline")
+		}
+		return time.Until(deadline).Round(time.Minute)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cloneTimeout, agentTimeout time.Duration
+			vcs := &MockVersionControlService{
+				CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+					cloneTimeout = remaining(t, ctx)
+					return nil
+				},
+			}
+			ai := &MockAIAgentService{
+				GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+					agentTimeout = remaining(t, ctx)
+					return []*api.InlineComment{}, nil
+				},
+			}
+			provider := &MockRemoteGitService{
+				GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+					return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+				},
+				SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+					return nil
+				},
+			}
+
+			err := NewAppWithWriters(validConfig(tt.cfg), newMockFactory(provider, vcs, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cloneTimeout != tt.wantCloneTimeout {
+				t.Errorf("clone timeout = %s, want %s", cloneTimeout, tt.wantCloneTimeout)
+			}
+			if agentTimeout != tt.wantAgentTimeout {
+				t.Errorf("agent timeout = %s, want %s", agentTimeout, tt.wantAgentTimeout)
+			}
+		})
+	}
+}
+
+func TestApp_Run_MergeQueue(t *testing.T) {
+	var clonedSha, diffRange string
+	var options *api.GeneratePRInlineCommentsOptions
+	var sent []*api.InlineComment
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "feature", BaseSha: "base", HeadSha: "head",
+				MergeQueueSha: "queued", MergeQueueBaseSha: "queue-base"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			sent = comments
+			return nil
+		},
+	}
+	gitService := &MockCommitClonerVCS{
+		MockVersionControlService: MockVersionControlService{
+			CloneRepoWithContextFunc: func(ctx context.Context, path, repoUrl, ref string) error {
+				t.Errorf("expected the merge queue commit to be cloned, not branch %s", ref)
+				return nil
+			},
+			DiffFunc: func(ctx context.Context, path, baseSha, headSha string) (string, error) {
+				diffRange = baseSha + ".." + headSha
+				return "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n a\n+b\n", nil
+			},
+		},
+		CloneCommitWithContextFunc: func(ctx context.Context, path, repoUrl, sha string) error {
+			clonedSha = sha
+			return nil
+		},
+	}
+	ai := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, opts *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			options = opts
+			return []*api.InlineComment{{
+				Body: util.Ptr("finding"),
+				Position: &api.InlineCommentPosition{
+					BaseSha: util.Ptr("queue-base"),
+					HeadSha: util.Ptr("head"),
+					NewPath: util.Ptr("main.go"),
+					NewLine: util.Ptr(int64(2)),
+				},
+			}}, nil
+		},
+	}
+
+	var stdout bytes.Buffer
+	cfg := validConfig(&api.Config{VerifyLineContent: true, LineMatchThreshold: DefaultLineMatchThreshold})
+	if err := NewAppWithWriters(cfg, newMockFactory(provider, gitService, ai), &stdout, io.Discard).Run("https://github.com/org/repo/pull/1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clonedSha != "queued" {
+		t.Errorf("cloned %q, want the merge queue commit", clonedSha)
+	}
+	if diffRange != "queue-base..queued" {
+		t.Errorf("diff of %s, want queue-base..queued", diffRange)
+	}
+	if options.BaseSha != "queue-base" || options.HeadSha != "head" {
+		t.Errorf("agent reviewed %s with head %s, want queue-base with the pull request head", options.BaseSha, options.HeadSha)
+	}
+	if len(sent) != 1 || *sent[0].Position.BaseSha != "base" {
+		t.Errorf("expected the comment anchored on the pull request base, got %+v", sent)
+	}
+	if !strings.Contains(stdout.String(), "Reviewing merge queue commit queued") {
+		t.Errorf("output = %q", stdout.String())
+	}
+}
+
+func TestApp_Run_CloneDepthFetchesBase(t *testing.T) {
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	ai := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{}, nil
+		},
+	}
+
+	tests := []struct {
+		name      string
+		depth     int
+		fetchErr  error
+		wantFetch []string
+		wantErr   bool
+	}{
+		{name: "full clone", depth: 0},
+		{name: "shallow clone", depth: 1, wantFetch: []string{"base"}},
+		{name: "fetch fails", depth: 1, fetchErr: errors.New("connection reset"), wantFetch: []string{"base"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetched []string
+			gitService := &MockCommitFetcherVCS{
+				MockVersionControlService: *newNoopVCS(),
+				FetchCommitWithContextFunc: func(ctx context.Context, path, sha string) error {
+					fetched = append(fetched, sha)
+					return tt.fetchErr
+				},
+			}
+			err := NewAppWithWriters(validConfig(&api.Config{CloneDepth: tt.depth}), newMockFactory(provider, gitService, ai), io.Discard, io.Discard).Run("https://github.com/org/repo/pull/1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(fetched, tt.wantFetch) {
+				t.Errorf("fetched %v, want %v", fetched, tt.wantFetch)
+			}
+		})
+	}
+}
+
+func TestApp_RunWithContext_Signals(t *testing.T) {
+	provider := &MockRemoteGitService{
+		GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+			return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+		},
+		SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+			return nil
+		},
+	}
+	// stands in for the embedding process's own handler, without it SIGINT ends the test binary
+	embedder := make(chan os.Signal, 1)
+	signal.Notify(embedder, os.Interrupt)
+	defer signal.Stop(embedder)
+
+	run := func(opts ...AppOption) (canceled bool) {
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				self, _ := os.FindProcess(os.Getpid())
+				if err := self.Signal(os.Interrupt); err != nil {
+					t.Fatal(err)
+				}
+				<-embedder
+				select {
+				case <-ctx.Done():
+					canceled = true
+				case <-time.After(100 * time.Millisecond):
+				}
+				return []*api.InlineComment{}, nil
+			},
+		}
+		opts = append(opts, WithWriters(io.Discard, io.Discard))
+		app := NewAppWithOptions(validConfig(&api.Config{}), newMockFactory(provider, newNoopVCS(), ai), opts...)
+		if err := app.RunWithContext(context.Background(), "https://github.com/org/repo/pull/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return canceled
+	}
+
+	if !run() {
+		t.Error("expected SIGINT to stop the review by default")
+	}
+	if run(WithoutSignalHandler()) {
+		t.Error("expected SIGINT to be left to the embedding process")
+	}
+
+	t.Run("context cancels the review", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ai := &MockAIAgentService{
+			GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+				cancel()
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}
+		app := NewAppWithOptions(validConfig(&api.Config{}), newMockFactory(provider, newNoopVCS(), ai), WithoutSignalHandler(), WithWriters(io.Discard, io.Discard))
+		if err := app.RunWithContext(ctx, "https://github.com/org/repo/pull/1"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the canceled context to fail the run, got %v", err)
+		}
+	})
+}
+
+func TestApp_Run_PostSummary(t *testing.T) {
+	tests := []struct {
+		name      string
+		summary   string
+		wantBody  string
+		wantWarn  string
+		wantNotes int
+	}{
+		{name: "posts the summary", summary: "Looks good overall.\n", wantBody: "### gitex review summary\n\nLooks good overall.", wantNotes: 1},
+		{name: "no summary", wantWarn: "the agent wrote no review summary, skipping the summary comment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			provider := &MockPullRequestCommenterService{
+				MockRemoteGitService: MockRemoteGitService{
+					GetPullRequestInfoFunc: func(pullRequestURL *string) (*api.PullRequestInfo, error) {
+						return &api.PullRequestInfo{ProjectName: "test-repo", SourceBranch: "main", BaseSha: "base", HeadSha: "head"}, nil
+					},
+					SendInlineCommentsFunc: func(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+						return nil
+					},
+				},
+				CommentOnPullRequestFunc: func(pullRequestInfo *api.PullRequestInfo, body string) error {
+					bodies = append(bodies, body)
+					return nil
+				},
+			}
+			agent := &MockAIAgentService{
+				GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+					if tt.summary != "" {
+						if err := os.WriteFile(filepath.Join(options.SandBoxDir, ai.SummaryFileName), []byte(tt.summary), 0600); err != nil {
+							t.Fatal(err)
+						}
+					}
+					return []*api.InlineComment{}, nil
+				},
+			}
+			var stderr bytes.Buffer
+			err := NewAppWithWriters(validConfig(&api.Config{PostSummary: true}), newMockFactory(provider, newNoopVCS(), agent), io.Discard, &stderr).Run("https://github.com/org/repo/pull/1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(bodies) != tt.wantNotes {
+				t.Fatalf("posted %d general comments, want %d", len(bodies), tt.wantNotes)
+			}
+			if tt.wantNotes > 0 && bodies[0] != tt.wantBody {
+				t.Errorf("body = %q, want %q", bodies[0], tt.wantBody)
+			}
+			if !strings.Contains(stderr.String(), tt.wantWarn) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantWarn)
+			}
+		})
+	}
+}
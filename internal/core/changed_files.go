@@ -0,0 +1,29 @@
+package core
+
+import (
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// changedFiles lists the reviewed files of the diff with their line counts, in diff order, for the summary overview.
+// Files outside the subpath and excluded files are left out like they are left out of the review.
+func changedFiles(prDiff *diff.Diff, scope *diff.Scope, excludes *diff.Excludes) []api.ChangedFile {
+	var files []api.ChangedFile
+	for _, f := range prDiff.Files {
+		p := f.Path()
+		if p == "" || !scope.Contains(p) || excludes.Match(p) {
+			continue
+		}
+		files = append(files, api.ChangedFile{Path: p, Added: f.Added, Removed: f.Removed})
+	}
+	return files
+}
+
+// changedLines sums the added and removed lines of files.
+func changedLines(files []api.ChangedFile) int {
+	total := 0
+	for _, f := range files {
+		total += f.Added + f.Removed
+	}
+	return total
+}
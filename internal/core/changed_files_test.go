@@ -0,0 +1,33 @@
+package core
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+func TestChangedFiles(t *testing.T) {
+	prDiff, err := diff.Parse("diff --git a/svc/main.go b/svc/main.go\n--- a/svc/main.go\n+++ b/svc/main.go\n@@ -1,2 +1,3 @@\n-a\n+b\n+c\n d\n" +
+		"diff --git a/svc/gone.go b/svc/gone.go\n--- a/svc/gone.go\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-x\n" +
+		"diff --git a/svc/vendor/lib.go b/svc/vendor/lib.go\n--- a/svc/vendor/lib.go\n+++ b/svc/vendor/lib.go\n@@ -1,1 +1,1 @@\n-x\n+y\n" +
+		"diff --git a/web/app.ts b/web/app.ts\n--- a/web/app.ts\n+++ b/web/app.ts\n@@ -1,1 +1,1 @@\n-x\n+y\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope, err := diff.NewScope("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	excludes, err := diff.NewExcludes([]string{"vendor/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := changedFiles(prDiff, scope, excludes)
+	want := []api.ChangedFile{{Path: "svc/main.go", Added: 2, Removed: 1}, {Path: "svc/gone.go", Removed: 1}}
+	if !slices.Equal(got, want) {
+		t.Errorf("changedFiles() = %+v, want %+v", got, want)
+	}
+}
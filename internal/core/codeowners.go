@@ -0,0 +1,115 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// codeownersFiles are the places GitHub and GitLab look for CODEOWNERS, relative to the repository root.
+var codeownersFiles = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+type codeownersRule struct {
+	pattern *diff.Excludes
+	owners  []string
+}
+
+// codeowners maps repository paths to their owners. Like on GitHub and GitLab, the last matching rule wins.
+type codeowners struct {
+	file  string
+	rules []codeownersRule
+}
+
+// loadCodeowners reads the CODEOWNERS file of the cloned repository. It returns nil when the repository has none.
+func loadCodeowners(repoDir string) (*codeowners, error) {
+	for _, name := range codeownersFiles {
+		data, err := os.ReadFile(filepath.Join(repoDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		owners, err := parseCodeowners(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		owners.file = name
+		return owners, nil
+	}
+	return nil, nil
+}
+
+// parseCodeowners reads CODEOWNERS rules, a gitignore-like pattern followed by owners. GitLab section headers are
+// skipped, their rules count like any other.
+func parseCodeowners(text string) (*codeowners, error) {
+	owners := &codeowners{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		fields := strings.Fields(line)
+		patterns := []string{fields[0]}
+		// like in gitignore a pattern without wildcards in its last part also matches a directory of that name
+		if last := fields[0][strings.LastIndex(fields[0], "/")+1:]; last != "" && !strings.ContainsAny(last, "*?") {
+			patterns = append(patterns, fields[0]+"/")
+		}
+		pattern, err := diff.NewExcludes(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		owners.rules = append(owners.rules, codeownersRule{pattern: pattern, owners: fields[1:]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return owners, nil
+}
+
+// owners returns the owners of the path, none when no rule matches or the matching rule lists nobody.
+func (c *codeowners) owners(path string) []string {
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.Match(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// filterOwnedComments drops comments on files none of the handles owns. Without a CODEOWNERS file nothing is owned.
+func filterOwnedComments(comments []*api.InlineComment, owners *codeowners, handles []string, report *droppedReport) []*api.InlineComment {
+	mine := map[string]bool{}
+	for _, handle := range handles {
+		mine[strings.ToLower(handle)] = true
+	}
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		path := commentPath(comment)
+		if owners != nil && ownedBy(owners.owners(path), mine) {
+			kept = append(kept, comment)
+			continue
+		}
+		report.add(DropReasonNotOwned, path, comment)
+	}
+	return kept
+}
+
+func ownedBy(owners []string, handles map[string]bool) bool {
+	for _, owner := range owners {
+		if handles[strings.ToLower(owner)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+const testCodeowners = `# default owners
+*                 @acme/platform
+*.md              @acme/docs # docs team reviews prose
+
+[Payments]
+/services/payments/ @acme/payments @alice
+services/payments/generated/
+docs/*            @acme/docs
+`
+
+func TestParseCodeowners(t *testing.T) {
+	owners, err := parseCodeowners(testCodeowners)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "main.go", want: []string{"@acme/platform"}},
+		{path: "api/README.md", want: []string{"@acme/docs"}},
+		{path: "services/payments/charge.go", want: []string{"@acme/payments", "@alice"}},
+		{path: "services/payments/generated/client.go", want: nil},
+		{path: "docs/guide.txt", want: []string{"@acme/docs"}},
+		{path: "docs/api/guide.txt", want: []string{"@acme/platform"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := owners.owners(tt.path); !slices.Equal(got, tt.want) {
+				t.Errorf("owners(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseCodeowners("src/[a-z]*.go @acme/platform\n"); err == nil {
+		t.Error("expected error for an unsupported pattern")
+	}
+}
+
+func TestLoadCodeowners(t *testing.T) {
+	if owners, err := loadCodeowners(t.TempDir()); owners != nil || err != nil {
+		t.Errorf("got %v, %v, want nothing for a repository without CODEOWNERS", owners, err)
+	}
+
+	repoDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoDir, ".github"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, ".github", "CODEOWNERS"), []byte(testCodeowners), 0644); err != nil {
+		t.Fatal(err)
+	}
+	owners, err := loadCodeowners(repoDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if owners == nil || owners.file != ".github/CODEOWNERS" {
+		t.Errorf("expected the .github/CODEOWNERS rules, got %+v", owners)
+	}
+}
+
+func TestFilterOwnedComments(t *testing.T) {
+	owners, err := parseCodeowners(testCodeowners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment := func(path string) *api.InlineComment {
+		return &api.InlineComment{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr(path)}}
+	}
+	payments, readme, unowned := comment("services/payments/charge.go"), comment("README.md"), comment("services/payments/generated/client.go")
+
+	report := &droppedReport{}
+	got := filterOwnedComments([]*api.InlineComment{payments, readme, unowned}, owners, []string{"@gitex-bot", "@ACME/Payments"}, report)
+	if len(got) != 1 || got[0] != payments {
+		t.Errorf("expected only the payments comment, got %d", len(got))
+	}
+	if len(report.entries) != 2 || report.entries[0].Reason != DropReasonNotOwned || report.entries[0].Detail != "README.md" {
+		t.Errorf("unexpected report %+v", report.entries)
+	}
+
+	if got := filterOwnedComments([]*api.InlineComment{payments}, nil, []string{"@acme/payments"}, &droppedReport{}); len(got) != 0 {
+		t.Error("expected all comments dropped without CODEOWNERS")
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// selectCommits resolves cfg.Commits to the commits of the review range they name. The review covers only their
+// changes, for cherry-picks or a part of a large pull request.
+func (a *App) selectCommits(ctx context.Context, gitService api.VersionControlService, repoDir, baseSha, headSha string) ([]string, error) {
+	selector, ok := gitService.(api.CommitSelector)
+	if !ok {
+		return nil, errors.New("cannot review single commits")
+	}
+	shas, err := selector.ResolveCommits(ctx, repoDir, baseSha, headSha, a.cfg.Commits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve commits: %w", err)
+	}
+	short := make([]string, len(shas))
+	for i, sha := range shas {
+		short[i] = sha[:min(len(sha), 8)]
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Reviewing commits %s\n", strings.Join(short, ", "))
+	return shas, nil
+}
+
+// loadCommitsDiff returns the union of the diffs of the commits. A file several of them change is one file with the
+// hunks of all of them.
+func (a *App) loadCommitsDiff(ctx context.Context, gitService api.VersionControlService, repoDir string, shas []string) (*diff.Diff, error) {
+	selector, ok := gitService.(api.CommitSelector)
+	if !ok {
+		return nil, errors.New("cannot diff single commits")
+	}
+	text, err := selector.CommitsDiff(ctx, repoDir, shas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute diff: %w", err)
+	}
+	parsed, err := diff.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return mergeFileDiffs(parsed), nil
+}
+
+func mergeFileDiffs(d *diff.Diff) *diff.Diff {
+	merged := &diff.Diff{}
+	byPath := map[string]*diff.FileDiff{}
+	for _, f := range d.Files {
+		if first, ok := byPath[f.Path()]; ok {
+			first.Hunks = append(first.Hunks, f.Hunks...)
+			first.Added += f.Added
+			first.Removed += f.Removed
+			continue
+		}
+		byPath[f.Path()] = f
+		merged.Files = append(merged.Files, f)
+	}
+	return merged
+}
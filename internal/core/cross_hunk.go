@@ -0,0 +1,146 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// What -on-cross-hunk does with a multi-line comment whose range spans several hunks, which providers reject.
+const (
+	// CrossHunkClamp shortens the range to the part in the hunk of its last line, where the comment is anchored.
+	CrossHunkClamp = "clamp"
+	// CrossHunkSplit posts the comment once per hunk, each on the part of the range inside that hunk.
+	CrossHunkSplit = "split"
+	// CrossHunkDrop drops the comment.
+	CrossHunkDrop = "drop"
+)
+
+// handleCrossHunkRanges applies mode to the multi-line comments whose first and last line are in different hunks of
+// the diff. Ranges the diff does not show both ends of are left alone. A suggestion replaces the whole range, so
+// clamped and split comments lose theirs.
+func handleCrossHunkRanges(comments []*api.InlineComment, prDiff *diff.Diff, mode string, out io.Writer, report *droppedReport) []*api.InlineComment {
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		hunks, start, end, ok := crossHunkRange(comment, prDiff)
+		if !ok {
+			kept = append(kept, comment)
+			continue
+		}
+		path := commentPath(comment)
+		switch mode {
+		case CrossHunkDrop:
+			report.add(DropReasonCrossHunk, fmt.Sprintf("lines %d to %d span %d hunks", lineNumber(start), lineNumber(end), len(hunks)), comment)
+		case CrossHunkSplit:
+			for i, h := range hunks {
+				from, to := edgeLine(h, sideOf(end), false), edgeLine(h, sideOf(end), true)
+				if i == 0 {
+					from, to = start, edgeLine(h, sideOf(start), true)
+				}
+				if i == len(hunks)-1 {
+					to = end
+				}
+				kept = append(kept, withRange(comment, from, to))
+			}
+			_, _ = fmt.Fprintf(out, "Split comment on %s lines %d to %d into %d comments, one per hunk\n", path, lineNumber(start), lineNumber(end), len(hunks))
+		default:
+			from := edgeLine(hunks[len(hunks)-1], sideOf(end), false)
+			kept = append(kept, withRange(comment, from, end))
+			_, _ = fmt.Fprintf(out, "Clamped comment on %s lines %d to %d to lines %d to %d\n", path, lineNumber(start), lineNumber(end), lineNumber(from), lineNumber(end))
+		}
+	}
+	return kept
+}
+
+// crossHunkRange returns the hunks from the first to the last line of a multi-line comment, and those lines, when
+// they are in different hunks.
+func crossHunkRange(comment *api.InlineComment, prDiff *diff.Diff) ([]*diff.Hunk, diff.Line, diff.Line, bool) {
+	if comment == nil || comment.Position == nil || comment.Position.CommentType != "MULTI_LINE" {
+		return nil, diff.Line{}, diff.Line{}, false
+	}
+	r := comment.Position.LineRange
+	if r == nil || r.Start == nil || r.End == nil {
+		return nil, diff.Line{}, diff.Line{}, false
+	}
+	file := prDiff.File(commentPath(comment))
+	if file == nil {
+		return nil, diff.Line{}, diff.Line{}, false
+	}
+	first, last := file.HunkAt(r.Start.NewLine, r.Start.OldLine), file.HunkAt(r.End.NewLine, r.End.OldLine)
+	start, startOk := file.Line(r.Start.NewLine, r.Start.OldLine)
+	end, endOk := file.Line(r.End.NewLine, r.End.OldLine)
+	if first == nil || last == nil || first == last || !startOk || !endOk {
+		return nil, diff.Line{}, diff.Line{}, false
+	}
+
+	var hunks []*diff.Hunk
+	for _, h := range file.Hunks {
+		if h == first || len(hunks) > 0 {
+			hunks = append(hunks, h)
+		}
+		if h == last {
+			break
+		}
+	}
+	// a range whose start lies after its end is not a cross-hunk range but a broken one, leave it to the provider
+	if len(hunks) == 0 || hunks[len(hunks)-1] != last {
+		return nil, diff.Line{}, diff.Line{}, false
+	}
+	return hunks, start, end, true
+}
+
+// withRange returns a copy of the comment on the lines from to to, a single-line comment when they are the same.
+func withRange(comment *api.InlineComment, from, to diff.Line) *api.InlineComment {
+	c := *comment
+	pos := *comment.Position
+	c.Position = &pos
+	c.Suggestion = nil
+	c.LineContent = to.Text
+
+	end := &api.LinePositionOptions{}
+	moveLinePosition(end, to)
+	pos.NewLine, pos.OldLine = end.NewLine, end.OldLine
+	pos.LineType = diffLineType(to)
+	if from == to {
+		pos.CommentType = "SINGLE_LINE"
+		pos.LineRange = nil
+		return &c
+	}
+	start := &api.LinePositionOptions{}
+	moveLinePosition(start, from)
+	pos.LineRange = &api.LineRangeOptions{Start: start, End: end}
+	return &c
+}
+
+// edgeLine returns the first or last line of the hunk that exists on the new side, or on the old side when newSide is
+// false. A hunk without lines on that side falls back to its first or last line.
+func edgeLine(h *diff.Hunk, newSide, last bool) diff.Line {
+	n := len(h.Lines)
+	for i := range n {
+		l := h.Lines[i]
+		if last {
+			l = h.Lines[n-1-i]
+		}
+		if (newSide && l.NewLine > 0) || (!newSide && l.OldLine > 0) {
+			return l
+		}
+	}
+	if last {
+		return h.Lines[n-1]
+	}
+	return h.Lines[0]
+}
+
+// sideOf reports whether the line is addressed by its new line number, as positions do for every line but removed ones.
+func sideOf(l diff.Line) bool {
+	return l.NewLine > 0
+}
+
+func lineNumber(l diff.Line) int {
+	if l.NewLine > 0 {
+		return l.NewLine
+	}
+	return l.OldLine
+}
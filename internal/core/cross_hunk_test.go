@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestHandleCrossHunkRanges(t *testing.T) {
+	prDiff, err := diff.Parse("diff --git a/pkg/list.go b/pkg/list.go\n--- a/pkg/list.go\n+++ b/pkg/list.go\n" +
+		"@@ -1,3 +1,4 @@\n a\n+b\n c\n d\n" +
+		"@@ -10,3 +11,3 @@\n j\n-k\n+K\n l\n" +
+		"@@ -20,2 +21,3 @@\n t\n+u\n v\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rangeComment := func(start, end int64) *api.InlineComment {
+		return &api.InlineComment{
+			Body:        util.Ptr("finding"),
+			Suggestion:  util.Ptr("replacement"),
+			LineContent: "original",
+			Position: &api.InlineCommentPosition{
+				NewPath:     util.Ptr("pkg/list.go"),
+				CommentType: "MULTI_LINE",
+				LineType:    "ADD",
+				LineRange: &api.LineRangeOptions{
+					Start: &api.LinePositionOptions{NewLine: util.Ptr(start)},
+					End:   &api.LinePositionOptions{NewLine: util.Ptr(end)},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		comment     *api.InlineComment
+		mode        string
+		wantRanges  []string
+		wantDropped int
+		wantLog     string
+	}{
+		{name: "range in one hunk", comment: rangeComment(2, 4), mode: CrossHunkClamp, wantRanges: []string{"2-4"}},
+		{name: "clamp to the last hunk", comment: rangeComment(2, 12), mode: CrossHunkClamp, wantRanges: []string{"11-12"},
+			wantLog: "Clamped comment on pkg/list.go lines 2 to 12 to lines 11 to 12"},
+		{name: "split over two hunks", comment: rangeComment(2, 12), mode: CrossHunkSplit, wantRanges: []string{"2-4", "11-12"},
+			wantLog: "into 2 comments"},
+		{name: "split over three hunks", comment: rangeComment(2, 21), mode: CrossHunkSplit, wantRanges: []string{"2-4", "11-13", "21"}},
+		{name: "drop", comment: rangeComment(2, 12), mode: CrossHunkDrop, wantDropped: 1},
+		{name: "end outside the diff", comment: rangeComment(2, 8), mode: CrossHunkDrop, wantRanges: []string{"2-8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			report := &droppedReport{}
+			got := handleCrossHunkRanges([]*api.InlineComment{tt.comment}, prDiff, tt.mode, &out, report)
+
+			var ranges []string
+			for _, c := range got {
+				ranges = append(ranges, commentRange(c.Position))
+			}
+			if strings.Join(ranges, ",") != strings.Join(tt.wantRanges, ",") {
+				t.Errorf("ranges = %v, want %v", ranges, tt.wantRanges)
+			}
+			if len(report.entries) != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", len(report.entries), tt.wantDropped)
+			}
+			if tt.wantDropped > 0 && report.entries[0].Reason != DropReasonCrossHunk {
+				t.Errorf("reason = %q, want %q", report.entries[0].Reason, DropReasonCrossHunk)
+			}
+			if !strings.Contains(out.String(), tt.wantLog) {
+				t.Errorf("output = %q, want it to contain %q", out.String(), tt.wantLog)
+			}
+		})
+	}
+
+	t.Run("rewritten comments", func(t *testing.T) {
+		original := rangeComment(2, 21)
+		got := handleCrossHunkRanges([]*api.InlineComment{original}, prDiff, CrossHunkSplit, &bytes.Buffer{}, &droppedReport{})
+		if original.Position.LineRange.End.NewLine == nil || *original.Position.LineRange.End.NewLine != 21 || original.Suggestion == nil {
+			t.Error("expected the original comment to be left unchanged")
+		}
+		first, last := got[0], got[len(got)-1]
+		if first.Suggestion != nil || first.LineContent != "d" || first.Position.LineType != "UNCHANGED" {
+			t.Errorf("first part = suggestion %v, line content %q, line type %q", first.Suggestion, first.LineContent, first.Position.LineType)
+		}
+		if last.Position.CommentType != "SINGLE_LINE" || *last.Position.NewLine != 21 || *last.Position.OldLine != 20 || last.LineContent != "t" {
+			t.Errorf("last part = %+v, line content %q", last.Position, last.LineContent)
+		}
+	})
+}
+
+// commentRange renders the lines a comment covers as start-end, or the line of a single-line comment.
+func commentRange(pos *api.InlineCommentPosition) string {
+	if pos.CommentType == "MULTI_LINE" {
+		return fmt.Sprintf("%d-%d", *pos.LineRange.Start.NewLine, *pos.LineRange.End.NewLine)
+	}
+	return fmt.Sprintf("%d", *pos.NewLine)
+}
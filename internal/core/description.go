@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+)
+
+// descriptionHeading starts the comment with the description review, telling it apart from the code review summary.
+const descriptionHeading = "### gitex description review\n\n"
+
+// reviewDescription asks the agent whether the pull request description matches the reviewed changes. It returns ""
+// with a warning when the agent cannot tell, the code review goes on without it.
+func (a *App) reviewDescription(ctx context.Context, aiAgent api.AIAgentService, options *api.GeneratePRInlineCommentsOptions, prInfo *api.PullRequestInfo) string {
+	reviewer, ok := aiAgent.(api.DescriptionReviewer)
+	if !ok {
+		_, _ = fmt.Fprintln(a.stdout, "Description review is not supported by the AI agent, skipping")
+		return ""
+	}
+	if err := a.aiLimiter.acquire(ctx, func() {
+		_, _ = fmt.Fprintln(a.stdout, "Waiting for a free AI process slot")
+	}); err != nil {
+		_, _ = fmt.Fprintf(a.stderr, "Warning: skipping description review: %v\n", err)
+		return ""
+	}
+	defer a.aiLimiter.release()
+
+	_, _ = fmt.Fprintln(a.stdout, "Reviewing the PR description")
+	review, err := reviewer.ReviewDescriptionWithContext(ctx, &api.ReviewDescriptionOptions{
+		SandBoxDir:  options.SandBoxDir,
+		BaseSha:     options.BaseSha,
+		HeadSha:     options.HeadSha,
+		SubPath:     options.SubPath,
+		Exclude:     options.Exclude,
+		Include:     options.Include,
+		DiffFile:    options.DiffFile,
+		Title:       prInfo.Title,
+		Description: prInfo.Description,
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(a.stderr, "Warning: skipping description review: %v\n", err)
+		return ""
+	}
+	return review
+}
+
+// postDescriptionReview posts the description review as a general comment. Only a rejected token fails the run.
+func (a *App) postDescriptionReview(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo, review string) error {
+	commenter, ok := vcsProviderService.(api.PullRequestCommenter)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Description review comments are not supported for %s, skipping\n", vcsProviderType)
+		return nil
+	}
+	if err := commenter.CommentOnPullRequest(prInfo, descriptionHeading+review); err != nil {
+		if errors.Is(err, vcs_provider.ErrUnauthorized) || errors.Is(err, vcs_provider.ErrPermissionDenied) {
+			return fmt.Errorf("failed to post description review: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
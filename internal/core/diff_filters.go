@@ -0,0 +1,35 @@
+package core
+
+import (
+	"io"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// usesDiffFilters reports whether cfg checks the generated comments against the reviewed diff.
+func usesDiffFilters(cfg *api.Config) bool {
+	return cfg.MinHunkLines > 1 || cfg.VerifyLineContent || cfg.LineOffsetTolerance > 0 || cfg.OnCrossHunk != ""
+}
+
+// filterOnDiff moves comments back onto the lines they quote and drops the ones the diff checks of cfg reject. Without
+// prDiff only the line content is checked, against the checkout in repoDir. Moved comments are reported to out.
+func filterOnDiff(cfg *api.Config, comments []*api.InlineComment, prDiff *diff.Diff, repoDir string, out io.Writer, report *droppedReport) []*api.InlineComment {
+	if prDiff != nil && cfg.LineOffsetTolerance > 0 {
+		adjustLineOffsets(comments, prDiff, cfg.LineOffsetTolerance, out)
+	}
+	if prDiff != nil && cfg.OnCrossHunk != "" {
+		comments = handleCrossHunkRanges(comments, prDiff, cfg.OnCrossHunk, out, report)
+	}
+	if prDiff != nil && cfg.MinHunkLines > 1 {
+		comments = filterSmallHunks(comments, prDiff, cfg.MinHunkLines, report)
+	}
+	if cfg.VerifyLineContent {
+		threshold := cfg.LineMatchThreshold
+		if threshold == 0 {
+			threshold = DefaultLineMatchThreshold
+		}
+		comments = verifyLineContent(comments, repoDir, prDiff, threshold, report)
+	}
+	return comments
+}
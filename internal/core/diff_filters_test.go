@@ -0,0 +1,45 @@
+package core
+
+import (
+	"io"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestFilterOnDiff(t *testing.T) {
+	prDiff, err := diff.Parse("diff --git a/math.go b/math.go\n--- a/math.go\n+++ b/math.go\n" +
+		"@@ -3,3 +3,3 @@\n func add(a, b int) int {\n-\treturn a + b\n+\treturn a - b\n }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment := func(lineContent string) *api.InlineComment {
+		return &api.InlineComment{Body: util.Ptr("finding"), LineContent: lineContent, Position: &api.InlineCommentPosition{
+			OldPath: util.Ptr("math.go"), NewPath: util.Ptr("math.go"), OldLine: util.Ptr(int64(4)),
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		cfg      *api.Config
+		wantKept int
+	}{
+		{name: "no filters", cfg: &api.Config{}, wantKept: 2},
+		{name: "unset threshold uses the default", cfg: &api.Config{VerifyLineContent: true}, wantKept: 1},
+		{name: "small hunks", cfg: &api.Config{MinHunkLines: 3}, wantKept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &droppedReport{}
+			got := filterOnDiff(tt.cfg, []*api.InlineComment{comment("return a + b"), comment("package math")}, prDiff, t.TempDir(), io.Discard, report)
+			if len(got) != tt.wantKept {
+				t.Errorf("kept %d comments, want %d", len(got), tt.wantKept)
+			}
+			if len(report.entries) != 2-tt.wantKept {
+				t.Errorf("reported %d dropped comments, want %d", len(report.entries), 2-tt.wantKept)
+			}
+		})
+	}
+}
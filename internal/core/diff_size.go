@@ -0,0 +1,95 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+)
+
+// diffSizeNote tells the pull request which files were left out of the review to keep the diff within -max-diff-bytes.
+const diffSizeNote = "### gitex skipped large files\n\nThe diff is larger than the %d bytes gitex reviews, these files were not reviewed:\n\n%s"
+
+// fitDiffBytes splits the changed files accepted by inScope into the ones whose diffs fit in maxBytes together and the
+// rest, leaving out the largest files first. Both keep the order of the diff.
+func fitDiffBytes(prDiff *diff.Diff, maxBytes int, inScope func(path string) bool) (kept, skipped []string) {
+	var files []*diff.FileDiff
+	total := 0
+	for _, f := range prDiff.Files {
+		if p := f.Path(); p != "" && inScope(p) {
+			files = append(files, f)
+			total += f.Bytes
+		}
+	}
+	bySize := append([]*diff.FileDiff{}, files...)
+	sort.SliceStable(bySize, func(i, j int) bool {
+		return bySize[i].Bytes > bySize[j].Bytes
+	})
+	left := map[*diff.FileDiff]bool{}
+	for _, f := range bySize {
+		if total <= maxBytes {
+			break
+		}
+		left[f] = true
+		total -= f.Bytes
+	}
+
+	for _, f := range files {
+		if left[f] {
+			skipped = append(skipped, f.Path())
+		} else {
+			kept = append(kept, f.Path())
+		}
+	}
+	return kept, skipped
+}
+
+// limitDiffBytes excludes the largest changed files until the diff of the rest fits in maxBytes, returning the widened
+// excludes and the skipped files. It fails when no file fits.
+func (a *App) limitDiffBytes(prDiff *diff.Diff, scope *diff.Scope, excludes *diff.Excludes, maxBytes int) (*diff.Excludes, []string, error) {
+	kept, skipped := fitDiffBytes(prDiff, maxBytes, func(p string) bool {
+		return scope.Contains(p) && !excludes.Match(p)
+	})
+	if len(skipped) == 0 {
+		return excludes, nil, nil
+	}
+	if len(kept) == 0 {
+		return nil, nil, fmt.Errorf("no changed file fits in the maximum diff size of %d bytes", maxBytes)
+	}
+
+	var patterns []string
+	for _, p := range skipped {
+		patterns = append(patterns, "/"+p)
+	}
+	limited, err := newExcludes(a.cfg, patterns...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to exclude large files: %w", err)
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Diff larger than %d bytes, skipping %d of %d changed files: %s\n", maxBytes, len(skipped), len(kept)+len(skipped), strings.Join(skipped, ", "))
+	return limited, skipped, nil
+}
+
+// skippedFilesNote formats diffSizeNote for the skipped files.
+func skippedFilesNote(maxBytes int, skipped []string) string {
+	return fmt.Sprintf(diffSizeNote, maxBytes, "- `"+strings.Join(skipped, "`\n- `")+"`")
+}
+
+// postSkippedFilesNote posts skippedFilesNote as a general comment. Only a rejected token fails the run.
+func (a *App) postSkippedFilesNote(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo, skipped []string) error {
+	commenter, ok := vcsProviderService.(api.PullRequestCommenter)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Skipped file notes are not supported for %s, skipping\n", vcsProviderType)
+		return nil
+	}
+	if err := commenter.CommentOnPullRequest(prInfo, skippedFilesNote(a.cfg.MaxDiffBytes, skipped)); err != nil {
+		if errors.Is(err, vcs_provider.ErrUnauthorized) || errors.Is(err, vcs_provider.ErrPermissionDenied) {
+			return fmt.Errorf("failed to post skipped files note: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
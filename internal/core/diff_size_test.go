@@ -0,0 +1,51 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+func TestFitDiffBytes(t *testing.T) {
+	prDiff := &diff.Diff{Files: []*diff.FileDiff{
+		{OldPath: "a.go", NewPath: "a.go", Bytes: 300},
+		{OldPath: "/dev/null", NewPath: "package-lock.json", Bytes: 5000},
+		{OldPath: "gone.go", NewPath: "/dev/null", Bytes: 1200},
+		{OldPath: "b.go", NewPath: "b.go", Bytes: 700},
+		{OldPath: "docs/huge.md", NewPath: "docs/huge.md", Bytes: 9000},
+	}}
+	notDocs := func(p string) bool { return !strings.HasPrefix(p, "docs/") }
+
+	tests := []struct {
+		name        string
+		maxBytes    int
+		wantKept    []string
+		wantSkipped []string
+	}{
+		{name: "fits", maxBytes: 7200, wantKept: []string{"a.go", "package-lock.json", "gone.go", "b.go"}},
+		{name: "largest file skipped", maxBytes: 7199, wantKept: []string{"a.go", "gone.go", "b.go"}, wantSkipped: []string{"package-lock.json"}},
+		{name: "two largest skipped", maxBytes: 1000, wantKept: []string{"a.go", "b.go"}, wantSkipped: []string{"package-lock.json", "gone.go"}},
+		{name: "only the smallest fits", maxBytes: 999, wantKept: []string{"a.go"}, wantSkipped: []string{"package-lock.json", "gone.go", "b.go"}},
+		{name: "nothing fits", maxBytes: 100, wantSkipped: []string{"a.go", "package-lock.json", "gone.go", "b.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, skipped := fitDiffBytes(prDiff, tt.maxBytes, notDocs)
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept = %v, want %v", kept, tt.wantKept)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("skipped = %v, want %v", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestSkippedFilesNote(t *testing.T) {
+	note := skippedFilesNote(1000, []string{"package-lock.json", "gone.go"})
+	if !strings.Contains(note, "1000 bytes") || !strings.HasSuffix(note, "- `package-lock.json`\n- `gone.go`") {
+		t.Errorf("unexpected note: %q", note)
+	}
+}
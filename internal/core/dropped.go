@@ -0,0 +1,161 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+type DropReason string
+
+const (
+	DropReasonInvalid      DropReason = "invalid"
+	DropReasonExcluded     DropReason = "excluded"
+	DropReasonSmallHunk    DropReason = "small_hunk"
+	DropReasonLineMismatch DropReason = "line_mismatch"
+	DropReasonSuppressed   DropReason = "suppressed"
+	DropReasonNotOwned     DropReason = "not_owned"
+	DropReasonOpenThread   DropReason = "open_thread"
+	DropReasonIgnoreMarker DropReason = "ignore_marker"
+	DropReasonCrossHunk    DropReason = "cross_hunk"
+)
+
+type droppedComment struct {
+	Reason  DropReason         `json:"reason"`
+	Detail  string             `json:"detail,omitempty"`
+	Comment *api.InlineComment `json:"comment"`
+}
+
+// droppedReport collects the comments removed by the Run pipeline, so users can see why model output did not land.
+type droppedReport struct {
+	entries []droppedComment
+}
+
+func (r *droppedReport) add(reason DropReason, detail string, comment *api.InlineComment) {
+	r.entries = append(r.entries, droppedComment{Reason: reason, Detail: detail, Comment: comment})
+}
+
+func (r *droppedReport) write(path string) error {
+	entries := r.entries
+	if entries == nil {
+		entries = []droppedComment{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode dropped comments: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write dropped comments report: %w", err)
+	}
+	return nil
+}
+
+// validateComments drops comments that no provider can place and records why.
+func validateComments(comments []*api.InlineComment, report *droppedReport) []*api.InlineComment {
+	valid := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		if detail := invalidCommentDetail(comment); detail != "" {
+			report.add(DropReasonInvalid, detail, comment)
+			continue
+		}
+		valid = append(valid, comment)
+	}
+	return valid
+}
+
+func invalidCommentDetail(comment *api.InlineComment) string {
+	if comment == nil {
+		return "empty comment"
+	}
+	if comment.Body == nil || *comment.Body == "" {
+		return "missing body"
+	}
+	pos := comment.Position
+	if pos == nil {
+		return "missing position"
+	}
+	if (pos.NewPath == nil || *pos.NewPath == "") && (pos.OldPath == nil || *pos.OldPath == "") {
+		return "missing file path"
+	}
+	if pos.IsImage() {
+		return invalidImagePositionDetail(pos)
+	}
+	if pos.PositionType != nil && *pos.PositionType != api.PositionTypeText {
+		return fmt.Sprintf("unsupported position type %q", *pos.PositionType)
+	}
+	if pos.CommentType == "MULTI_LINE" {
+		if pos.LineRange == nil || pos.LineRange.Start == nil || pos.LineRange.End == nil {
+			return "missing line range"
+		}
+		return ""
+	}
+	if pos.NewLine == nil && pos.OldLine == nil {
+		return "missing line"
+	}
+	return ""
+}
+
+func invalidImagePositionDetail(pos *api.InlineCommentPosition) string {
+	if pos.Width == nil || pos.Height == nil || pos.X == nil || pos.Y == nil {
+		return "missing image coordinates"
+	}
+	if *pos.Width <= 0 || *pos.Height <= 0 {
+		return "invalid image size"
+	}
+	if *pos.X < 0 || *pos.Y < 0 || *pos.X > float64(*pos.Width) || *pos.Y > float64(*pos.Height) {
+		return "image point outside the image"
+	}
+	return ""
+}
+
+// excludeComments drops comments on files the review was told to skip, in case the model commented on them anyway.
+func excludeComments(comments []*api.InlineComment, excludes *diff.Excludes, report *droppedReport) []*api.InlineComment {
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		p := commentPath(comment)
+		if p != "" && excludes.Match(p) {
+			report.add(DropReasonExcluded, p, comment)
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+func commentPath(comment *api.InlineComment) string {
+	if comment == nil || comment.Position == nil {
+		return ""
+	}
+	return util.GetOrDefault(comment.Position.NewPath, util.GetOrDefault(comment.Position.OldPath, ""))
+}
+
+// filterSmallHunks drops comments anchored in hunks with fewer than minLines changed lines. Comments that cannot be
+// located in the diff are kept.
+func filterSmallHunks(comments []*api.InlineComment, prDiff *diff.Diff, minLines int, report *droppedReport) []*api.InlineComment {
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		if hunk := commentHunk(comment, prDiff); hunk != nil && hunk.Changed() < minLines {
+			report.add(DropReasonSmallHunk, fmt.Sprintf("hunk has %d changed lines, minimum is %d", hunk.Changed(), minLines), comment)
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+func commentHunk(comment *api.InlineComment, prDiff *diff.Diff) *diff.Hunk {
+	file := prDiff.File(commentPath(comment))
+	if file == nil {
+		return nil
+	}
+	pos := comment.Position
+	newLine, oldLine := pos.NewLine, pos.OldLine
+	if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.End != nil {
+		newLine, oldLine = pos.LineRange.End.NewLine, pos.LineRange.End.OldLine
+	}
+	return file.HunkAt(newLine, oldLine)
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestValidateComments(t *testing.T) {
+	valid := &api.InlineComment{
+		Body:     util.Ptr("looks off"),
+		Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(3))},
+	}
+	multiLine := &api.InlineComment{
+		Body: util.Ptr("block"),
+		Position: &api.InlineCommentPosition{
+			NewPath:     util.Ptr("main.go"),
+			CommentType: "MULTI_LINE",
+			LineRange: &api.LineRangeOptions{
+				Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(1))},
+				End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(4))},
+			},
+		},
+	}
+
+	image := &api.InlineComment{
+		Body: util.Ptr("cropped"),
+		Position: &api.InlineCommentPosition{
+			NewPath:      util.Ptr("logo.png"),
+			PositionType: util.Ptr(api.PositionTypeImage),
+			Width:        util.Ptr(int64(10)),
+			Height:       util.Ptr(int64(10)),
+			X:            util.Ptr(2.0),
+			Y:            util.Ptr(3.0),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		comment    *api.InlineComment
+		wantDetail string
+	}{
+		{name: "nil comment", comment: nil, wantDetail: "empty comment"},
+		{name: "missing body", comment: &api.InlineComment{Position: valid.Position}, wantDetail: "missing body"},
+		{name: "missing position", comment: &api.InlineComment{Body: util.Ptr("x")}, wantDetail: "missing position"},
+		{
+			name:       "missing path",
+			comment:    &api.InlineComment{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{NewLine: util.Ptr(int64(1))}},
+			wantDetail: "missing file path",
+		},
+		{
+			name:       "missing line",
+			comment:    &api.InlineComment{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go")}},
+			wantDetail: "missing line",
+		},
+		{
+			name: "missing line range",
+			comment: &api.InlineComment{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("a.go"), CommentType: "MULTI_LINE",
+			}},
+			wantDetail: "missing line range",
+		},
+		{
+			name: "unsupported position type",
+			comment: &api.InlineComment{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1)), PositionType: util.Ptr("file"),
+			}},
+			wantDetail: `unsupported position type "file"`,
+		},
+		{
+			name: "image without coordinates",
+			comment: &api.InlineComment{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("logo.png"), PositionType: util.Ptr(api.PositionTypeImage), Width: util.Ptr(int64(10)),
+			}},
+			wantDetail: "missing image coordinates",
+		},
+		{
+			name: "image point outside the image",
+			comment: &api.InlineComment{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("logo.png"), PositionType: util.Ptr(api.PositionTypeImage),
+				Width: util.Ptr(int64(10)), Height: util.Ptr(int64(10)), X: util.Ptr(11.0), Y: util.Ptr(5.0),
+			}},
+			wantDetail: "image point outside the image",
+		},
+		{
+			name: "image with empty size",
+			comment: &api.InlineComment{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("logo.png"), PositionType: util.Ptr(api.PositionTypeImage),
+				Width: util.Ptr(int64(0)), Height: util.Ptr(int64(10)), X: util.Ptr(0.0), Y: util.Ptr(5.0),
+			}},
+			wantDetail: "invalid image size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &droppedReport{}
+			got := validateComments([]*api.InlineComment{valid, tt.comment, multiLine, image}, report)
+
+			if len(got) != 3 || got[0] != valid || got[1] != multiLine || got[2] != image {
+				t.Errorf("expected only the valid comments to be kept, got %d", len(got))
+			}
+			if len(report.entries) != 1 {
+				t.Fatalf("expected 1 dropped entry, got %d", len(report.entries))
+			}
+			if report.entries[0].Reason != DropReasonInvalid {
+				t.Errorf("Reason = %q, want %q", report.entries[0].Reason, DropReasonInvalid)
+			}
+			if report.entries[0].Detail != tt.wantDetail {
+				t.Errorf("Detail = %q, want %q", report.entries[0].Detail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestDroppedReport_Write(t *testing.T) {
+	t.Run("writes entries", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dropped.json")
+		report := &droppedReport{}
+		report.add(DropReasonInvalid, "missing line", &api.InlineComment{Body: util.Ptr("x")})
+
+		if err := report.write(path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read report: %v", err)
+		}
+		var entries []droppedComment
+		if err := json.Unmarshal(data, &entries); err != nil {
+			t.Fatalf("report is not valid JSON: %v", err)
+		}
+		if len(entries) != 1 || entries[0].Reason != DropReasonInvalid || entries[0].Detail != "missing line" {
+			t.Errorf("unexpected entries: %s", data)
+		}
+	})
+
+	t.Run("empty report is an empty list", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dropped.json")
+		if err := (&droppedReport{}).write(path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != "[]" {
+			t.Errorf("report = %s, want []", data)
+		}
+	})
+
+	t.Run("error on unwritable path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "dropped.json")
+		if err := (&droppedReport{}).write(path); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestExcludeComments(t *testing.T) {
+	cfg := &api.Config{Exclude: []string{"*_test.go"}, Include: []string{"internal/", "*.go"}, ReviewGenerated: true}
+	excludes, err := newExcludes(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	comment := func(oldPath, newPath string) *api.InlineComment {
+		position := &api.InlineCommentPosition{NewLine: util.Ptr(int64(1))}
+		if oldPath != "" {
+			position.OldPath = util.Ptr(oldPath)
+		}
+		if newPath != "" {
+			position.NewPath = util.Ptr(newPath)
+		}
+		return &api.InlineComment{Body: util.Ptr("x"), Position: position}
+	}
+	kept := []*api.InlineComment{
+		comment("main.go", "main.go"),
+		comment("", "internal/core/README.md"),
+		comment("old.go", ""),
+		{Body: util.Ptr("no position")},
+	}
+	excluded := []*api.InlineComment{
+		comment("", "package-lock.json"),
+		comment("main_test.go", "main_test.go"),
+		comment("docs/old.md", ""),
+	}
+
+	report := &droppedReport{}
+	got := excludeComments(append(append([]*api.InlineComment{}, kept...), excluded...), excludes, report)
+	if len(got) != len(kept) {
+		t.Fatalf("kept %d comments, want %d", len(got), len(kept))
+	}
+	for i := range kept {
+		if got[i] != kept[i] {
+			t.Errorf("comment %d = %v, want %v", i, got[i], kept[i])
+		}
+	}
+	if len(report.entries) != len(excluded) || report.entries[0].Reason != DropReasonExcluded {
+		t.Errorf("report = %+v, want %d excluded comments", report.entries, len(excluded))
+	}
+}
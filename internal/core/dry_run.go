@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+const placeholderBody = "Placeholder comment from a gitex dry run without an AI key, a review would comment on this file."
+
+// placeholderComments stands in for a review when a dry run has no AI key: one comment on the first added line of
+// every changed file, so the rest of the pipeline and the printed output can be checked.
+func placeholderComments(prDiff *diff.Diff, prInfo *api.PullRequestInfo) []*api.InlineComment {
+	if prDiff == nil {
+		return nil
+	}
+	var comments []*api.InlineComment
+	for _, file := range prDiff.Files {
+		line, ok := firstAddedLine(file)
+		if !ok {
+			continue
+		}
+		comments = append(comments, &api.InlineComment{
+			Body: util.Ptr(placeholderBody),
+			Position: &api.InlineCommentPosition{
+				PositionType: util.Ptr(api.PositionTypeText),
+				BaseSha:      util.Ptr(prInfo.BaseSha),
+				StartSha:     util.Ptr(prInfo.StartSha),
+				HeadSha:      util.Ptr(prInfo.HeadSha),
+				NewPath:      util.Ptr(file.NewPath),
+				OldPath:      util.Ptr(file.OldPath),
+				NewLine:      util.Ptr(int64(line)),
+				CommentType:  "SINGLE_LINE",
+				LineType:     "ADD",
+			},
+		})
+	}
+	return comments
+}
+
+func firstAddedLine(file *diff.FileDiff) (int, bool) {
+	for _, h := range file.Hunks {
+		for _, l := range h.Lines {
+			if l.OldLine == 0 && l.NewLine > 0 {
+				return l.NewLine, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// writeDryRunComments prints the comments a dry run would have posted, one per line with the first line of the body.
+func writeDryRunComments(w io.Writer, comments []*api.InlineComment) {
+	for _, comment := range comments {
+		location := commentPath(comment)
+		if start, _ := annotationLines(comment.Position); start > 0 {
+			location += fmt.Sprintf(":%d", start)
+		}
+		body, _, _ := strings.Cut(util.GetOrDefault(comment.Body, ""), "\n")
+		if comment.Folded {
+			_, _ = fmt.Fprintf(w, "Would list in the summary %s: %s\n", location, body)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "Would comment on %s: %s\n", location, body)
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// limitToFiles excludes every changed file but the ones named in cfg.Files, returning the widened excludes. Named
+// files the pull request does not change are reported, and it fails when it changes none of them.
+func (a *App) limitToFiles(prDiff *diff.Diff, scope *diff.Scope, excludes *diff.Excludes) (*diff.Excludes, error) {
+	named := map[string]bool{}
+	for _, f := range a.cfg.Files {
+		named[path.Clean(strings.TrimPrefix(f, "./"))] = false
+	}
+
+	var skipped []string
+	for _, f := range prDiff.Files {
+		p := f.Path()
+		if p == "" || !scope.Contains(p) || excludes.Match(p) {
+			continue
+		}
+		if _, ok := named[p]; ok {
+			named[p] = true
+		} else {
+			skipped = append(skipped, p)
+		}
+	}
+
+	var missing []string
+	reviewed := 0
+	for p, changed := range named {
+		if changed {
+			reviewed++
+		} else {
+			missing = append(missing, p)
+		}
+	}
+	if reviewed == 0 {
+		return nil, fmt.Errorf("none of the files to review are changed in the PR: %s", strings.Join(a.cfg.Files, ", "))
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		_, _ = fmt.Fprintf(a.stderr, "Warning: not changed in the PR, or excluded: %s\n", strings.Join(missing, ", "))
+	}
+	if len(skipped) == 0 {
+		return excludes, nil
+	}
+
+	var patterns []string
+	for _, p := range skipped {
+		patterns = append(patterns, "/"+p)
+	}
+	limited, err := newExcludes(a.cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exclude unnamed files: %w", err)
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Reviewing %d of %d changed files\n", reviewed, reviewed+len(skipped))
+	return limited, nil
+}
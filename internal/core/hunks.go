@@ -0,0 +1,52 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// attachHunks sets the diff hunks each comment is anchored in, for the providers to quote under the comment. A
+// multi-line comment gets every hunk from its first to its last line. Comments the diff does not cover get none.
+func attachHunks(comments []*api.InlineComment, prDiff *diff.Diff) {
+	for _, comment := range comments {
+		if comment == nil || comment.Position == nil || comment.Position.IsImage() {
+			continue
+		}
+		file := prDiff.File(commentPath(comment))
+		if file == nil {
+			continue
+		}
+		last := commentHunk(comment, prDiff)
+		if last == nil {
+			continue
+		}
+		first := last
+		pos := comment.Position
+		if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.Start != nil {
+			if h := file.HunkAt(pos.LineRange.Start.NewLine, pos.LineRange.Start.OldLine); h != nil {
+				first = h
+			}
+		}
+
+		var hunks []string
+		inRange := false
+		for _, h := range file.Hunks {
+			if h == first {
+				inRange = true
+			}
+			if inRange {
+				hunks = append(hunks, h.String())
+			}
+			if h == last {
+				break
+			}
+		}
+		// a range whose start lies after its end falls back to the last hunk
+		if len(hunks) == 0 {
+			hunks = []string{last.String()}
+		}
+		comment.Hunk = strings.Join(hunks, "\n")
+	}
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestAttachHunks(t *testing.T) {
+	prDiff, err := diff.Parse("diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n" +
+		"@@ -1,2 +1,2 @@\n package main\n-var a = 1\n+var a = 2\n" +
+		"@@ -10,1 +10,2 @@\n func f() {\n+\tx := 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := "@@ -1,2 +1,2 @@\n package main\n-var a = 1\n+var a = 2"
+	second := "@@ -10,1 +10,2 @@\n func f() {\n+\tx := 1"
+
+	multiLine := func(start, end int64) *api.InlineCommentPosition {
+		return &api.InlineCommentPosition{
+			NewPath:     util.Ptr("main.go"),
+			CommentType: "MULTI_LINE",
+			LineRange: &api.LineRangeOptions{
+				Start: &api.LinePositionOptions{NewLine: util.Ptr(start)},
+				End:   &api.LinePositionOptions{NewLine: util.Ptr(end)},
+			},
+		}
+	}
+	tests := []struct {
+		name string
+		pos  *api.InlineCommentPosition
+		want string
+	}{
+		{name: "added line", pos: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(11))}, want: second},
+		{name: "removed line", pos: &api.InlineCommentPosition{OldPath: util.Ptr("main.go"), OldLine: util.Ptr(int64(2))}, want: first},
+		{name: "range within a hunk", pos: multiLine(1, 2), want: first},
+		{name: "range across hunks", pos: multiLine(2, 11), want: first + "\n" + second},
+		{name: "line outside the diff", pos: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(5))}},
+		{name: "file outside the diff", pos: &api.InlineCommentPosition{NewPath: util.Ptr("other.go"), NewLine: util.Ptr(int64(1))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := &api.InlineComment{Body: util.Ptr("finding"), Position: tt.pos}
+			attachHunks([]*api.InlineComment{comment, nil}, prDiff)
+			if comment.Hunk != tt.want {
+				t.Errorf("Hunk = %q, want %q", comment.Hunk, tt.want)
+			}
+		})
+	}
+}
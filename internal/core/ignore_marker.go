@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+// DefaultIgnoreMarker opts a line out of the review, written in a comment on the line or the line above it.
+const DefaultIgnoreMarker = "gitex:ignore"
+
+// ignoreMarkedLines drops comments on new lines that carry the marker, or whose line above does, like linter nolint
+// directives. Lines are read from the checkout, so comments on removed lines or files that cannot be read are kept.
+func ignoreMarkedLines(comments []*api.InlineComment, repoDir, marker string, report *droppedReport) []*api.InlineComment {
+	files := map[string][]string{}
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		if comment == nil || comment.Position == nil {
+			kept = append(kept, comment)
+			continue
+		}
+		start, end := annotationLines(comment.Position)
+		if start == 0 {
+			kept = append(kept, comment)
+			continue
+		}
+		p := commentPath(comment)
+		lines, ok := files[p]
+		if !ok {
+			data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(p)))
+			if err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			files[p] = lines
+		}
+		if line, ok := markedLine(lines, start, end, marker); ok {
+			report.add(DropReasonIgnoreMarker, fmt.Sprintf("line %d has %s", line, marker), comment)
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+// markedLine returns the first line from the one above start to end that contains marker.
+func markedLine(lines []string, start, end int64, marker string) (int64, bool) {
+	for n := max(start-1, 1); n <= end && n <= int64(len(lines)); n++ {
+		if strings.Contains(lines[n-1], marker) {
+			return n, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestIgnoreMarkedLines(t *testing.T) {
+	repoDir := t.TempDir()
+	content := "package pkg\n\n// gitex:ignore the sleep is intended\ntime.Sleep(time.Second)\nx := 1\ny := 2 // gitex:ignore\nz := 3\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "main.go"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	comment := func(pos *api.InlineCommentPosition) *api.InlineComment {
+		if pos.NewPath == nil {
+			pos.NewPath = util.Ptr("main.go")
+		}
+		return &api.InlineComment{Body: util.Ptr("finding"), Position: pos}
+	}
+	tests := []struct {
+		name     string
+		comment  *api.InlineComment
+		wantKept bool
+	}{
+		{name: "marker on the line", comment: comment(&api.InlineCommentPosition{NewLine: util.Ptr(int64(6))}), wantKept: false},
+		{name: "marker on the line above", comment: comment(&api.InlineCommentPosition{NewLine: util.Ptr(int64(4))}), wantKept: false},
+		{name: "marker on the line below", comment: comment(&api.InlineCommentPosition{NewLine: util.Ptr(int64(5))}), wantKept: true},
+		{name: "unmarked line", comment: comment(&api.InlineCommentPosition{NewLine: util.Ptr(int64(1))}), wantKept: true},
+		{name: "marker inside a multi-line range", comment: comment(&api.InlineCommentPosition{
+			CommentType: "MULTI_LINE",
+			LineRange: &api.LineRangeOptions{
+				Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(5))},
+				End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(7))},
+			},
+		}), wantKept: false},
+		{name: "removed line", comment: comment(&api.InlineCommentPosition{OldLine: util.Ptr(int64(6))}), wantKept: true},
+		{name: "file missing from the checkout", comment: comment(&api.InlineCommentPosition{NewPath: util.Ptr("gone.go"), NewLine: util.Ptr(int64(1))}), wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &droppedReport{}
+			got := ignoreMarkedLines([]*api.InlineComment{tt.comment}, repoDir, DefaultIgnoreMarker, report)
+			if kept := len(got) == 1; kept != tt.wantKept {
+				t.Fatalf("kept = %v, want %v", kept, tt.wantKept)
+			}
+			if !tt.wantKept && (len(report.entries) != 1 || report.entries[0].Reason != DropReasonIgnoreMarker) {
+				t.Errorf("expected an ignore_marker drop, got %+v", report.entries)
+			}
+		})
+	}
+}
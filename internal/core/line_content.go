@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// DefaultLineMatchThreshold is the token similarity below which the claimed line content counts as a mismatch.
+const DefaultLineMatchThreshold = 0.5
+
+// verifyLineContent drops comments whose line_content does not resemble the line they are anchored to. New lines
+// are read from the checkout, old lines from the diff. Comments without line_content, or on lines that cannot be
+// read, are kept.
+func verifyLineContent(comments []*api.InlineComment, repoDir string, prDiff *diff.Diff, threshold float64, report *droppedReport) []*api.InlineComment {
+	files := map[string][]string{}
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		if comment == nil || comment.LineContent == "" || comment.Position == nil || comment.Position.IsImage() {
+			kept = append(kept, comment)
+			continue
+		}
+		actual, ok := anchoredLineText(comment, repoDir, prDiff, files)
+		if ok {
+			if score := lineSimilarity(comment.LineContent, actual); score < threshold {
+				report.add(DropReasonLineMismatch, fmt.Sprintf("line is %q, similarity %.2f", strings.TrimSpace(actual), score), comment)
+				continue
+			}
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+func anchoredLineText(comment *api.InlineComment, repoDir string, prDiff *diff.Diff, files map[string][]string) (string, bool) {
+	pos := comment.Position
+	newLine, oldLine := pos.NewLine, pos.OldLine
+	if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.End != nil {
+		newLine, oldLine = pos.LineRange.End.NewLine, pos.LineRange.End.OldLine
+	}
+	p := commentPath(comment)
+
+	if newLine != nil && !pos.DeletedFile {
+		lines, ok := files[p]
+		if !ok {
+			data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(p)))
+			if err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			files[p] = lines
+		}
+		if n := int(*newLine); n >= 1 && n <= len(lines) {
+			return lines[n-1], true
+		}
+		if lines != nil {
+			return "", false
+		}
+		// without a checkout only the new lines shown in the diff can be checked
+		oldLine = nil
+	} else {
+		newLine = nil
+	}
+	if prDiff == nil {
+		return "", false
+	}
+	file := prDiff.File(p)
+	if file == nil {
+		return "", false
+	}
+	return file.LineText(newLine, oldLine)
+}
+
+// lineSimilarity compares two lines by their identifier and number tokens, ignoring whitespace and punctuation.
+// Lines where one contains the other, e.g. a truncated quote, score 1.
+func lineSimilarity(claimed, actual string) float64 {
+	claimed, actual = strings.Join(strings.Fields(claimed), " "), strings.Join(strings.Fields(actual), " ")
+	if claimed == "" || actual == "" {
+		if claimed == actual {
+			return 1
+		}
+		return 0
+	}
+	if strings.Contains(actual, claimed) || strings.Contains(claimed, actual) {
+		return 1
+	}
+
+	a, b := lineTokens(claimed), lineTokens(actual)
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	var common int
+	for t := range a {
+		if b[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+func lineTokens(s string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		tokens[t] = true
+	}
+	return tokens
+}
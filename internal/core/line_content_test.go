@@ -0,0 +1,83 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestVerifyLineContent(t *testing.T) {
+	repoDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoDir, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "package pkg\n\nfunc add(a, b int) int {\n\treturn a - b\n}\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "pkg", "math.go"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prDiff, err := diff.Parse("diff --git a/pkg/math.go b/pkg/math.go\n--- a/pkg/math.go\n+++ b/pkg/math.go\n" +
+		"@@ -3,3 +3,3 @@\n func add(a, b int) int {\n-\treturn a + b\n+\treturn a - b\n }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment := func(lineContent string, pos *api.InlineCommentPosition) *api.InlineComment {
+		pos.NewPath = util.Ptr("pkg/math.go")
+		return &api.InlineComment{Body: util.Ptr("finding"), LineContent: lineContent, Position: pos}
+	}
+	tests := []struct {
+		name     string
+		comment  *api.InlineComment
+		wantKept bool
+	}{
+		{name: "matching new line", comment: comment("return a - b", &api.InlineCommentPosition{NewLine: util.Ptr(int64(4))}), wantKept: true},
+		{name: "truncated quote", comment: comment("return a", &api.InlineCommentPosition{NewLine: util.Ptr(int64(4))}), wantKept: true},
+		{name: "wrong line", comment: comment("func add(a, b int) int {", &api.InlineCommentPosition{NewLine: util.Ptr(int64(5))}), wantKept: false},
+		{name: "removed line from diff", comment: comment("return a + b", &api.InlineCommentPosition{OldLine: util.Ptr(int64(4))}), wantKept: true},
+		{name: "removed line mismatch", comment: comment("package pkg", &api.InlineCommentPosition{OldLine: util.Ptr(int64(4))}), wantKept: false},
+		{name: "multi-line uses the end line", comment: comment("return a - b", &api.InlineCommentPosition{
+			CommentType: "MULTI_LINE",
+			LineRange: &api.LineRangeOptions{
+				Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(3))},
+				End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(4))},
+			},
+		}), wantKept: true},
+		{name: "no line content", comment: comment("", &api.InlineCommentPosition{NewLine: util.Ptr(int64(5))}), wantKept: true},
+		{name: "line past end of file", comment: comment("anything", &api.InlineCommentPosition{NewLine: util.Ptr(int64(50))}), wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &droppedReport{}
+			got := verifyLineContent([]*api.InlineComment{tt.comment}, repoDir, prDiff, DefaultLineMatchThreshold, report)
+			if kept := len(got) == 1; kept != tt.wantKept {
+				t.Fatalf("kept = %v, want %v", kept, tt.wantKept)
+			}
+			if !tt.wantKept && (len(report.entries) != 1 || report.entries[0].Reason != DropReasonLineMismatch) {
+				t.Errorf("expected a line_mismatch entry, got %+v", report.entries)
+			}
+		})
+	}
+}
+
+func TestLineSimilarity(t *testing.T) {
+	tests := []struct {
+		claimed, actual string
+		want            float64
+	}{
+		{claimed: "return a + b", actual: "\treturn a + b", want: 1},
+		{claimed: "x := compute(a, b)", actual: "x := compute(a, c)", want: 0.6},
+		{claimed: "foo()", actual: "bar()", want: 0},
+		{claimed: "", actual: "", want: 1},
+		{claimed: "}", actual: ")", want: 0},
+	}
+	for _, tt := range tests {
+		if got := lineSimilarity(tt.claimed, tt.actual); got != tt.want {
+			t.Errorf("lineSimilarity(%q, %q) = %v, want %v", tt.claimed, tt.actual, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// adjustLineOffsets moves comments anchored on lines the diff does not show to the nearest shown line within
+// tolerance lines, for models that are systematically off by one. At equal distance the later line wins, which is
+// where a 0-based line number points to. Multi-line comments move as a whole. Comments that are in the diff, or
+// cannot be moved, are left alone, and every move is reported on out.
+func adjustLineOffsets(comments []*api.InlineComment, prDiff *diff.Diff, tolerance int, out io.Writer) {
+	for _, comment := range comments {
+		if comment == nil || comment.Position == nil || comment.Position.IsImage() {
+			continue
+		}
+		file := prDiff.File(commentPath(comment))
+		if file == nil {
+			continue
+		}
+		pos := comment.Position
+		multiLine := pos.CommentType == "MULTI_LINE"
+		points := []*api.LinePositionOptions{{NewLine: pos.NewLine, OldLine: pos.OldLine}}
+		if multiLine {
+			if pos.LineRange == nil || pos.LineRange.Start == nil || pos.LineRange.End == nil {
+				continue
+			}
+			points = []*api.LinePositionOptions{pos.LineRange.Start, pos.LineRange.End}
+		}
+		if _, ok := shiftedLines(file, points, 0); ok {
+			continue
+		}
+
+		for distance := 1; distance <= tolerance; distance++ {
+			offset := distance
+			lines, ok := shiftedLines(file, points, offset)
+			if !ok {
+				offset = -distance
+				lines, ok = shiftedLines(file, points, offset)
+			}
+			if !ok {
+				continue
+			}
+			from := anchorLine(points[len(points)-1])
+			for i, point := range points {
+				moveLinePosition(point, lines[i])
+			}
+			if !multiLine {
+				pos.NewLine, pos.OldLine = points[0].NewLine, points[0].OldLine
+			}
+			pos.LineType = diffLineType(lines[len(lines)-1])
+			_, _ = fmt.Fprintf(out, "Moved comment on %s line %d to line %d (offset %+d)\n",
+				commentPath(comment), from, anchorLine(points[len(points)-1]), offset)
+			break
+		}
+	}
+}
+
+// shiftedLines returns the diff lines the points land on when moved by offset, if the diff shows all of them.
+func shiftedLines(file *diff.FileDiff, points []*api.LinePositionOptions, offset int) ([]diff.Line, bool) {
+	lines := make([]diff.Line, 0, len(points))
+	for _, point := range points {
+		var newLine, oldLine *int64
+		switch {
+		case point.NewLine != nil:
+			newLine = util.Ptr(*point.NewLine + int64(offset))
+		case point.OldLine != nil:
+			oldLine = util.Ptr(*point.OldLine + int64(offset))
+		default:
+			return nil, false
+		}
+		line, ok := file.Line(newLine, oldLine)
+		if !ok {
+			return nil, false
+		}
+		lines = append(lines, line)
+	}
+	return lines, true
+}
+
+// moveLinePosition points the position at the diff line, keeping only the sides the line exists on.
+func moveLinePosition(point *api.LinePositionOptions, line diff.Line) {
+	point.NewLine, point.OldLine = nil, nil
+	if line.NewLine > 0 {
+		point.NewLine = util.Ptr(int64(line.NewLine))
+	}
+	if line.OldLine > 0 {
+		point.OldLine = util.Ptr(int64(line.OldLine))
+	}
+}
+
+func anchorLine(point *api.LinePositionOptions) int64 {
+	if point.NewLine != nil {
+		return *point.NewLine
+	}
+	if point.OldLine != nil {
+		return *point.OldLine
+	}
+	return 0
+}
+
+func diffLineType(line diff.Line) string {
+	switch {
+	case line.OldLine == 0:
+		return "ADD"
+	case line.NewLine == 0:
+		return "REMOVE"
+	default:
+		return "UNCHANGED"
+	}
+}
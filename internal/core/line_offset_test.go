@@ -0,0 +1,109 @@
+package core
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestAdjustLineOffsets(t *testing.T) {
+	prDiff, err := diff.Parse("diff --git a/pkg/math.go b/pkg/math.go\n--- a/pkg/math.go\n+++ b/pkg/math.go\n" +
+		"@@ -10,3 +10,3 @@\n func add(a, b int) int {\n-\treturn a + b\n+\treturn a - b\n }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment := func(path string, pos *api.InlineCommentPosition) *api.InlineComment {
+		pos.NewPath = util.Ptr(path)
+		return &api.InlineComment{Body: util.Ptr("finding"), Position: pos}
+	}
+	line := func(n int64) *int64 { return util.Ptr(n) }
+	tests := []struct {
+		name         string
+		comment      *api.InlineComment
+		tolerance    int
+		wantNew      *int64
+		wantOld      *int64
+		wantLineType string
+		wantLog      string
+	}{
+		{name: "line in diff", comment: comment("pkg/math.go", &api.InlineCommentPosition{NewLine: line(11), LineType: "ADD"}),
+			tolerance: 1, wantNew: line(11), wantLineType: "ADD"},
+		{name: "one line before the hunk", comment: comment("pkg/math.go", &api.InlineCommentPosition{NewLine: line(9), LineType: "ADD"}),
+			tolerance: 1, wantNew: line(10), wantOld: line(10), wantLineType: "UNCHANGED", wantLog: "pkg/math.go line 9 to line 10 (offset +1)"},
+		{name: "one line after the hunk", comment: comment("pkg/math.go", &api.InlineCommentPosition{NewLine: line(13), LineType: "ADD"}),
+			tolerance: 1, wantNew: line(12), wantOld: line(12), wantLineType: "UNCHANGED", wantLog: "line 13 to line 12 (offset -1)"},
+		{name: "removed line", comment: comment("pkg/math.go", &api.InlineCommentPosition{OldLine: line(8), LineType: "REMOVE"}),
+			tolerance: 3, wantNew: line(10), wantOld: line(10), wantLineType: "UNCHANGED", wantLog: "line 8 to line 10 (offset +2)"},
+		{name: "beyond tolerance", comment: comment("pkg/math.go", &api.InlineCommentPosition{NewLine: line(5), LineType: "ADD"}),
+			tolerance: 2, wantNew: line(5), wantLineType: "ADD"},
+		{name: "file not in diff", comment: comment("pkg/other.go", &api.InlineCommentPosition{NewLine: line(9), LineType: "ADD"}),
+			tolerance: 1, wantNew: line(9), wantLineType: "ADD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			adjustLineOffsets([]*api.InlineComment{tt.comment}, prDiff, tt.tolerance, &out)
+			pos := tt.comment.Position
+			if !equalLine(pos.NewLine, tt.wantNew) || !equalLine(pos.OldLine, tt.wantOld) {
+				t.Errorf("lines = new %s old %s, want new %s old %s", formatLine(pos.NewLine), formatLine(pos.OldLine),
+					formatLine(tt.wantNew), formatLine(tt.wantOld))
+			}
+			if pos.LineType != tt.wantLineType {
+				t.Errorf("LineType = %q, want %q", pos.LineType, tt.wantLineType)
+			}
+			if tt.wantLog == "" && out.Len() > 0 {
+				t.Errorf("unexpected output %q", out.String())
+			}
+			if !strings.Contains(out.String(), tt.wantLog) {
+				t.Errorf("output = %q, want it to contain %q", out.String(), tt.wantLog)
+			}
+		})
+	}
+
+	t.Run("multi-line comment moves as a whole", func(t *testing.T) {
+		multi := comment("pkg/math.go", &api.InlineCommentPosition{
+			CommentType: "MULTI_LINE",
+			LineType:    "ADD",
+			LineRange: &api.LineRangeOptions{
+				Start: &api.LinePositionOptions{NewLine: line(12)},
+				End:   &api.LinePositionOptions{NewLine: line(13)},
+			},
+		})
+		var out bytes.Buffer
+		adjustLineOffsets([]*api.InlineComment{multi}, prDiff, 1, &out)
+		lineRange := multi.Position.LineRange
+		if !equalLine(lineRange.Start.NewLine, line(11)) || lineRange.Start.OldLine != nil {
+			t.Errorf("start = new %s old %s, want new 11 only", formatLine(lineRange.Start.NewLine), formatLine(lineRange.Start.OldLine))
+		}
+		if !equalLine(lineRange.End.NewLine, line(12)) || !equalLine(lineRange.End.OldLine, line(12)) {
+			t.Errorf("end = new %s old %s, want 12 on both sides", formatLine(lineRange.End.NewLine), formatLine(lineRange.End.OldLine))
+		}
+		if multi.Position.NewLine != nil || multi.Position.OldLine != nil {
+			t.Error("multi-line comment got a single line position")
+		}
+		if !strings.Contains(out.String(), "line 13 to line 12 (offset -1)") {
+			t.Errorf("output = %q", out.String())
+		}
+	})
+}
+
+func equalLine(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func formatLine(line *int64) string {
+	if line == nil {
+		return "nil"
+	}
+	return strconv.FormatInt(*line, 10)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+type threadLine struct {
+	path    string
+	newLine int64
+	oldLine int64
+}
+
+// skipOpenThreads drops comments on lines where a thread of an earlier run is still unresolved, the author has not
+// dealt with it yet and a second thread would only repeat it. Resolved threads do not count: a finding that is back
+// after the author resolved it is posted again.
+func skipOpenThreads(comments []*api.InlineComment, threads []*api.PriorThread, report *droppedReport) []*api.InlineComment {
+	open := map[threadLine]bool{}
+	for _, thread := range threads {
+		if !thread.Resolved {
+			open[threadLine{path: thread.Path, newLine: thread.NewLine, oldLine: thread.OldLine}] = true
+		}
+	}
+	if len(open) == 0 {
+		return comments
+	}
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		if line, ok := commentThreadLine(comment); ok && open[line] {
+			report.add(DropReasonOpenThread, fmt.Sprintf("%s:%d", line.path, line.newLine+line.oldLine), comment)
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+// commentThreadLine is the line a provider anchors the comment's thread on, the last one of a multi-line comment.
+func commentThreadLine(comment *api.InlineComment) (threadLine, bool) {
+	if comment == nil || comment.Position == nil {
+		return threadLine{}, false
+	}
+	pos := comment.Position
+	anchor := &api.LinePositionOptions{NewLine: pos.NewLine, OldLine: pos.OldLine}
+	if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.End != nil {
+		anchor = pos.LineRange.End
+	}
+	line := threadLine{path: commentPath(comment)}
+	switch {
+	case anchor.NewLine != nil && pos.LineType != "REMOVE":
+		line.newLine = *anchor.NewLine
+	case anchor.OldLine != nil:
+		line.oldLine = *anchor.OldLine
+	default:
+		return threadLine{}, false
+	}
+	return line, true
+}
+
+// priorThreads lists the threads earlier runs opened, nil with a note when the provider cannot tell.
+func (a *App) priorThreads(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo) ([]*api.PriorThread, error) {
+	tracker, ok := vcsProviderService.(api.ThreadTracker)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Thread tracking is not supported for %s, commenting on all lines\n", vcsProviderType)
+		return nil, nil
+	}
+	return tracker.PriorThreads(prInfo)
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestSkipOpenThreads(t *testing.T) {
+	newLine := func(path string, line int64) *api.InlineComment {
+		return &api.InlineComment{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{NewPath: util.Ptr(path), NewLine: util.Ptr(line)}}
+	}
+	removedLine := &api.InlineComment{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{
+		NewPath: util.Ptr("main.go"), OldPath: util.Ptr("main.go"), OldLine: util.Ptr(int64(4)), LineType: "REMOVE",
+	}}
+	multiLine := &api.InlineComment{Body: util.Ptr("finding"), Position: &api.InlineCommentPosition{
+		NewPath:     util.Ptr("util.go"),
+		CommentType: "MULTI_LINE",
+		LineRange: &api.LineRangeOptions{
+			Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(10))},
+			End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(12))},
+		},
+	}}
+	comments := []*api.InlineComment{newLine("main.go", 3), newLine("main.go", 7), removedLine, multiLine, newLine("util.go", 10)}
+	threads := []*api.PriorThread{
+		{Path: "main.go", NewLine: 3},
+		{Path: "main.go", NewLine: 7, Resolved: true},
+		{Path: "main.go", OldLine: 4},
+		{Path: "util.go", NewLine: 12},
+		{Path: "other.go", NewLine: 10},
+	}
+
+	report := &droppedReport{}
+	kept := skipOpenThreads(comments, threads, report)
+
+	if len(kept) != 2 || kept[0] != comments[1] || kept[1] != comments[4] {
+		t.Errorf("kept %d comments, want the resolved line 7 and util.go:10", len(kept))
+	}
+	if len(report.entries) != 3 {
+		t.Fatalf("dropped %d comments, want 3", len(report.entries))
+	}
+	for _, entry := range report.entries {
+		if entry.Reason != DropReasonOpenThread {
+			t.Errorf("reason = %s, want %s", entry.Reason, DropReasonOpenThread)
+		}
+	}
+	if report.entries[0].Detail != "main.go:3" {
+		t.Errorf("detail = %q, want main.go:3", report.entries[0].Detail)
+	}
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// reviewOutput is what -output archives of a review, the comments as they are posted and the agent's summary.
+type reviewOutput struct {
+	Comments []*api.InlineComment `json:"comments"`
+	Summary  string               `json:"summary,omitempty"`
+}
+
+// checkOutputFile creates the parent directories of the output file and makes sure it can be written there, before
+// the review spends time on a result that could not be saved.
+func checkOutputFile(path string) error {
+	if err := util.EnsureDirectoryWritable(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("output file %s is not writable: %w", path, err)
+	}
+	return nil
+}
+
+// writeOutputFile stores the comments and the summary as indented JSON at path.
+func writeOutputFile(path string, comments []*api.InlineComment, summary string) error {
+	if comments == nil {
+		comments = []*api.InlineComment{}
+	}
+	data, err := json.MarshalIndent(reviewOutput{Comments: comments, Summary: summary}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode output file: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"gopkg.in/yaml.v3"
+)
+
+type ownershipArea struct {
+	pattern string
+	matcher *diff.Excludes
+	context string
+}
+
+// loadOwnershipContext reads an -ownership-file, a YAML mapping of gitignore-like path patterns to what reviewers
+// should know about the matching files. Areas are kept in pattern order, so prompts do not change between runs.
+func loadOwnershipContext(path string) ([]ownershipArea, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ownership file: %w", err)
+	}
+	var mapping map[string]string
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse ownership file: %w", err)
+	}
+
+	patterns := make([]string, 0, len(mapping))
+	for pattern := range mapping {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	areas := make([]ownershipArea, 0, len(patterns))
+	for _, pattern := range patterns {
+		context := strings.Join(strings.Fields(mapping[pattern]), " ")
+		if context == "" {
+			continue
+		}
+		matcher, err := diff.NewExcludes([]string{pattern})
+		if err != nil {
+			return nil, fmt.Errorf("invalid ownership file pattern: %w", err)
+		}
+		areas = append(areas, ownershipArea{pattern: pattern, matcher: matcher, context: context})
+	}
+	return areas, nil
+}
+
+// pathContext returns the notes of the areas at least one of the changed files falls into.
+func pathContext(areas []ownershipArea, files []api.ChangedFile) []string {
+	var notes []string
+	for _, area := range areas {
+		for _, file := range files {
+			if area.matcher.Match(file.Path) {
+				notes = append(notes, area.pattern+": "+area.context)
+				break
+			}
+		}
+	}
+	return notes
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func writeOwnershipFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ownership.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOwnershipContext(t *testing.T) {
+	t.Run("matches areas of the changed files", func(t *testing.T) {
+		areas, err := loadOwnershipContext(writeOwnershipFile(t, `
+services/billing/: |
+  PCI-sensitive,
+  card data must never be logged
+"*.sql": runs on live data
+docs/: ""
+web/: frontend, owned by the web team
+`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(areas) != 3 {
+			t.Fatalf("got %d areas, want 3 without the empty one", len(areas))
+		}
+
+		files := []api.ChangedFile{{Path: "services/billing/charge.go"}, {Path: "db/migrations/001.sql"}, {Path: "docs/index.md"}}
+		want := []string{"*.sql: runs on live data", "services/billing/: PCI-sensitive, card data must never be logged"}
+		if got := pathContext(areas, files); !slices.Equal(got, want) {
+			t.Errorf("pathContext() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadOwnershipContext(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("not a mapping", func(t *testing.T) {
+		if _, err := loadOwnershipContext(writeOwnershipFile(t, "- services/billing/\n")); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		if _, err := loadOwnershipContext(writeOwnershipFile(t, "\"src/[a-z]*\": sensitive\n")); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+// foldExcessComments keeps the limit best comments of every file as threads and folds the others, which the providers
+// list in the review summary instead. Higher confidence wins, then the earlier line. It returns the number of
+// folded comments.
+func foldExcessComments(comments []*api.InlineComment, limit int) int {
+	byFile := map[string][]*api.InlineComment{}
+	for _, comment := range comments {
+		path := commentPath(comment)
+		byFile[path] = append(byFile[path], comment)
+	}
+
+	folded := 0
+	for _, fileComments := range byFile {
+		if len(fileComments) <= limit {
+			continue
+		}
+		ranked := slices.Clone(fileComments)
+		slices.SortStableFunc(ranked, func(a, b *api.InlineComment) int {
+			if d := confidenceRank(b.Confidence) - confidenceRank(a.Confidence); d != 0 {
+				return d
+			}
+			return int(commentLine(a) - commentLine(b))
+		})
+		for _, comment := range ranked[limit:] {
+			comment.Folded = true
+			folded++
+		}
+	}
+	return folded
+}
+
+func confidenceRank(confidence string) int {
+	switch strings.ToLower(confidence) {
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// commentLine is the first line a comment covers, for ordering.
+func commentLine(comment *api.InlineComment) int64 {
+	pos := comment.Position
+	if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.Start != nil {
+		return anchorLine(pos.LineRange.Start)
+	}
+	return anchorLine(&api.LinePositionOptions{NewLine: pos.NewLine, OldLine: pos.OldLine})
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestFoldExcessComments(t *testing.T) {
+	comment := func(path string, line int64, confidence string) *api.InlineComment {
+		return &api.InlineComment{
+			Body:       util.Ptr("finding"),
+			Confidence: confidence,
+			Position:   &api.InlineCommentPosition{NewPath: util.Ptr(path), NewLine: util.Ptr(line)},
+		}
+	}
+	late := comment("main.go", 40, "high")
+	early := comment("main.go", 5, "")
+	middle := comment("main.go", 20, "")
+	low := comment("main.go", 1, "low")
+	other := comment("util.go", 3, "")
+	multi := comment("util.go", 0, "")
+	multi.Position.NewLine = nil
+	multi.Position.CommentType = "MULTI_LINE"
+	multi.Position.LineRange = &api.LineRangeOptions{
+		Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(1))},
+		End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(2))},
+	}
+
+	second := comment("util.go", 2, "")
+
+	comments := []*api.InlineComment{late, early, middle, low, other, multi, second}
+	if folded := foldExcessComments(comments, 2); folded != 3 {
+		t.Errorf("folded = %d, want 3", folded)
+	}
+	for _, tt := range []struct {
+		name   string
+		c      *api.InlineComment
+		folded bool
+	}{
+		{"high confidence kept despite its line", late, false},
+		{"low confidence beats unrated", low, false},
+		{"unrated line folded", early, true},
+		{"later unrated line folded", middle, true},
+		{"multi-line comment ranked by its start", multi, false},
+		{"earlier line kept", second, false},
+		{"later line folded", other, true},
+	} {
+		if tt.c.Folded != tt.folded {
+			t.Errorf("%s: Folded = %v, want %v", tt.name, tt.c.Folded, tt.folded)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+// hookResult is the review outcome a post-review hook reads on stdin.
+type hookResult struct {
+	PullRequestURL string               `json:"pull_request_url"`
+	Provider       api.VCSProviderType  `json:"provider"`
+	HeadSha        string               `json:"head_sha"`
+	Comments       int                  `json:"comments"`
+	Failed         int                  `json:"failed"`
+	Dropped        int                  `json:"dropped"`
+	SkippedFiles   int                  `json:"skipped_files"`
+	Findings       []*api.InlineComment `json:"findings"`
+}
+
+// runPostHook runs the -post-hook command through sh with the result as JSON on stdin and its key fields in GITEX_*
+// variables. Its output is printed line by line. The hook gets at most timeout, and no more than the run has left.
+func (a *App) runPostHook(ctx context.Context, command string, timeout time.Duration, result *hookResult) error {
+	input, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode post hook input: %w", err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"GITEX_PR_URL="+result.PullRequestURL,
+		"GITEX_PROVIDER="+string(result.Provider),
+		"GITEX_HEAD_SHA="+result.HeadSha,
+		"GITEX_COMMENT_COUNT="+strconv.Itoa(result.Comments),
+		"GITEX_FAILED_COUNT="+strconv.Itoa(result.Failed),
+	)
+	// a hook that backgrounds a child keeps the pipe open, stop waiting for it shortly after the hook itself exits
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		_, _ = fmt.Fprintf(a.stdout, "post-hook: %s\n", scanner.Text())
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("post hook did not finish in time: %w", ctx.Err())
+	}
+	if err != nil {
+		return fmt.Errorf("post hook failed: %w", err)
+	}
+	return nil
+}
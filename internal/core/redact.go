@@ -0,0 +1,34 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// loadRedactor reads the redact patterns file, one regular expression per line, blank lines and lines starting with
+// # are skipped. Without a file it returns nil, which redacts nothing.
+func loadRedactor(path string) (*diff.Redactor, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redact patterns file: %w", err)
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	redactor, err := diff.NewRedactor(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load redact patterns file: %w", err)
+	}
+	return redactor, nil
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// referencePattern matches path:line and path:start-end references to files, on their own or as a code span. The
+// file name needs an extension, which keeps times and ports out.
+var referencePattern = regexp.MustCompile("(`?)((?:\\./)?(?:[\\w.-]+/)*[\\w-][\\w.-]*\\.\\w+):(\\d+)(?:-(\\d+))?(`?)")
+
+// referenceExists tells whether path is a file of the head commit with at least line lines, as far as it is known.
+type referenceExists func(path string, line int64) bool
+
+// linkifyReferences turns the path:line references in the comment bodies into links to the lines at the head commit,
+// so cross-references can be followed. References to files the head commit does not have, or past their last line,
+// are left as text, as is text in code blocks. It returns how many references were linked.
+func linkifyReferences(comments []*api.InlineComment, prInfo *api.PullRequestInfo, linker api.BlobLinker, exists referenceExists) int {
+	if prInfo.ProjectWebUrl == "" || prInfo.HeadSha == "" {
+		return 0
+	}
+	linked := 0
+	for _, comment := range comments {
+		if comment == nil || comment.Body == nil {
+			continue
+		}
+		body, n := linkifyBody(*comment.Body, func(p string, start, end int64) string {
+			if !exists(p, end) {
+				return ""
+			}
+			return linker.BlobURL(prInfo, prInfo.HeadSha, p, start, end)
+		})
+		if n > 0 {
+			comment.Body = &body
+			linked += n
+		}
+	}
+	return linked
+}
+
+// linkifyBody links the references outside fenced code blocks that link returns a URL for.
+func linkifyBody(body string, link func(path string, start, end int64) string) (string, int) {
+	parts := strings.Split(body, "```")
+	linked := 0
+	// odd parts are inside a fence
+	for i := 0; i < len(parts); i += 2 {
+		var n int
+		parts[i], n = linkifyText(parts[i], link)
+		linked += n
+	}
+	return strings.Join(parts, "```"), linked
+}
+
+func linkifyText(text string, link func(path string, start, end int64) string) (string, int) {
+	var sb strings.Builder
+	linked, last := 0, 0
+	for _, m := range referencePattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[0], m[1]
+		// an unbalanced tick means the reference is part of a longer code span
+		if text[m[2]:m[3]] != text[m[10]:m[11]] {
+			continue
+		}
+		// part of a URL, a longer path or an existing link
+		if start > 0 && !strings.ContainsRune(" \t\n([\"'", rune(text[start-1])) {
+			continue
+		}
+		if end < len(text) && strings.ContainsRune("])", rune(text[end])) && start > 0 && text[start-1] == '[' {
+			continue
+		}
+		p := path.Clean(text[m[4]:m[5]])
+		first, _ := strconv.ParseInt(text[m[6]:m[7]], 10, 64)
+		lastLine := first
+		if m[8] >= 0 {
+			lastLine, _ = strconv.ParseInt(text[m[8]:m[9]], 10, 64)
+		}
+		if first == 0 || lastLine < first || !filepath.IsLocal(p) {
+			continue
+		}
+		url := link(p, first, lastLine)
+		if url == "" {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		fmt.Fprintf(&sb, "[%s](%s)", text[start:end], url)
+		last = end
+		linked++
+	}
+	if linked == 0 {
+		return text, 0
+	}
+	sb.WriteString(text[last:])
+	return sb.String(), linked
+}
+
+// checkoutReferences checks references against the files of the checkout in repoDir.
+func checkoutReferences(repoDir string) referenceExists {
+	lineCounts := map[string]int{}
+	return func(p string, line int64) bool {
+		count, ok := lineCounts[p]
+		if !ok {
+			count = -1
+			file := filepath.Join(repoDir, filepath.FromSlash(p))
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				if data, err := os.ReadFile(file); err == nil {
+					count = strings.Count(strings.TrimSuffix(string(data), "\n"), "\n") + 1
+				}
+			}
+			lineCounts[p] = count
+		}
+		return count >= 0 && line <= int64(count)
+	}
+}
+
+// diffReferences checks references against the files the pull request diff adds or changes, the only files known
+// without a checkout. Their length is not known, so any line is accepted.
+func diffReferences(prDiff *diff.Diff) referenceExists {
+	return func(p string, _ int64) bool {
+		if prDiff == nil {
+			return false
+		}
+		for _, f := range prDiff.Files {
+			if f.NewPath == p {
+				return true
+			}
+		}
+		return false
+	}
+}
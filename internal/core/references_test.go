@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+type fakeBlobLinker struct{}
+
+func (fakeBlobLinker) BlobURL(pullRequestInfo *api.PullRequestInfo, sha, path string, start, end int64) string {
+	return fmt.Sprintf("%s/blob/%s/%s#L%d-L%d", pullRequestInfo.ProjectWebUrl, sha, path, start, end)
+}
+
+func TestLinkifyReferences(t *testing.T) {
+	repoDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoDir, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "pkg", "utils.go"), []byte("package pkg\n\nfunc a() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prInfo := &api.PullRequestInfo{ProjectWebUrl: "https://github.com/owner/repo", HeadSha: "head"}
+	link := "https://github.com/owner/repo/blob/head/pkg/utils.go"
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "reference", body: "This duplicates pkg/utils.go:3.",
+			want: "This duplicates [pkg/utils.go:3](" + link + "#L3-L3)."},
+		{name: "line range in a code span", body: "See `pkg/utils.go:1-3`",
+			want: "See [`pkg/utils.go:1-3`](" + link + "#L1-L3)"},
+		{name: "dot slash prefix", body: "(./pkg/utils.go:2)",
+			want: "([./pkg/utils.go:2](" + link + "#L2-L2))"},
+		{name: "missing file", body: "Like gone.go:3.", want: "Like gone.go:3."},
+		{name: "line past the end", body: "pkg/utils.go:40", want: "pkg/utils.go:40"},
+		{name: "outside the repository", body: "../pkg/utils.go:1", want: "../pkg/utils.go:1"},
+		{name: "part of a URL", body: "https://example.com/pkg/utils.go:3", want: "https://example.com/pkg/utils.go:3"},
+		{name: "existing link", body: "[pkg/utils.go:3](https://example.com)", want: "[pkg/utils.go:3](https://example.com)"},
+		{name: "code block", body: "```\npkg/utils.go:3\n```", want: "```\npkg/utils.go:3\n```"},
+		{name: "longer code span", body: "`at pkg/utils.go:3`", want: "`at pkg/utils.go:3`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments := []*api.InlineComment{{Body: util.Ptr(tt.body)}, nil}
+			linkifyReferences(comments, prInfo, fakeBlobLinker{}, checkoutReferences(repoDir))
+			if got := *comments[0].Body; got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkifyReferences_Diff(t *testing.T) {
+	prDiff := &diff.Diff{Files: []*diff.FileDiff{
+		{OldPath: "a.go", NewPath: "a.go"},
+		{OldPath: "old.go", NewPath: "/dev/null"},
+	}}
+	comments := []*api.InlineComment{{Body: util.Ptr("Compare a.go:120 and old.go:4")}}
+	prInfo := &api.PullRequestInfo{ProjectWebUrl: "https://github.com/owner/repo", HeadSha: "head"}
+
+	if linked := linkifyReferences(comments, prInfo, fakeBlobLinker{}, diffReferences(prDiff)); linked != 1 {
+		t.Errorf("linked = %d, want 1", linked)
+	}
+	want := "Compare [a.go:120](https://github.com/owner/repo/blob/head/a.go#L120-L120) and old.go:4"
+	if got := *comments[0].Body; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
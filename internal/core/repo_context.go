@@ -0,0 +1,31 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// repoContext indexes the checkout in dir for -repo-context, leaving out the excluded and generated files. The index
+// only helps the review, so failing to build it is a warning.
+func (a *App) repoContext(ctx context.Context, gitService api.VersionControlService, dir string) string {
+	indexer, ok := gitService.(api.RepoIndexer)
+	if !ok {
+		_, _ = fmt.Fprintln(a.stdout, "Repository context is not supported by the version control service, skipping")
+		return ""
+	}
+	skipped, err := diff.NewExcludes(excludePatterns(a.cfg))
+	if err != nil {
+		_, _ = fmt.Fprintf(a.stderr, "Warning: invalid exclude pattern, reviewing without repository context: %v\n", err)
+		return ""
+	}
+	index, err := indexer.RepoIndex(ctx, dir, a.cfg.RepoContext, skipped.Match)
+	if err != nil {
+		_, _ = fmt.Fprintf(a.stderr, "Warning: reviewing without repository context: %v\n", err)
+		return ""
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Indexed the repository for context in %d bytes\n", len(index))
+	return index
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/eridan-ltu/gitex/internal/vcs"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+)
+
+// runRetryDelay is the wait before the first retry of a run, doubled for every further one.
+var runRetryDelay = 10 * time.Second
+
+// runAttempt records what one attempt of a run did that decides whether it may be repeated.
+type runAttempt struct {
+	// posted is set once comments are being sent, repeating the run would post them twice
+	posted bool
+	// interrupted is set by the signal handler, the run was stopped on purpose
+	interrupted atomic.Bool
+}
+
+// runWithRetries runs the review, repeating it with a fresh temp dir and clone after a transient failure.
+func (a *App) runWithRetries(ctx context.Context, mrUrl string) error {
+	delay := runRetryDelay
+	for attempt := 1; ; attempt++ {
+		var run runAttempt
+		err := a.runOnce(ctx, mrUrl, &run)
+		if err == nil || attempt > a.cfg.RunRetries || run.posted || run.interrupted.Load() || ctx.Err() != nil || !retryableRunError(err) {
+			if attempt > 1 {
+				a.reportRetryOutcome(attempt, err)
+			}
+			return err
+		}
+		_, _ = fmt.Fprintf(a.stderr, "Warning: run attempt %d of %d failed, retrying in %s: %v\n", attempt, a.cfg.RunRetries+1, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+func (a *App) reportRetryOutcome(attempts int, err error) {
+	if err != nil {
+		_, _ = fmt.Fprintf(a.stderr, "Run failed after %d attempts\n", attempts)
+		return
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Run succeeded on attempt %d\n", attempts)
+}
+
+// retryableRunError reports whether a failed run may pass when repeated from scratch: a network failure, a clone cut
+// off, a diff the provider has not computed yet or a crashed agent process. A rejected token, a bad URL or
+// configuration and anything else unknown would fail the same way again.
+func retryableRunError(err error) bool {
+	var cloneErr *vcs.CloneError
+	var exitErr *exec.ExitError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, vcs_provider.ErrUnauthorized), errors.Is(err, vcs_provider.ErrPermissionDenied), errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &cloneErr):
+		return cloneErr.Transient
+	case errors.Is(err, ErrDiffNotReady), errors.As(err, &exitErr), errors.As(err, &netErr):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/internal/vcs"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+)
+
+func TestRetryableRunError(t *testing.T) {
+	exitErr := exec.Command("false").Run()
+	if exitErr == nil {
+		t.Fatal("expected false to fail")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "transient clone failure", err: fmt.Errorf("failed to clone repo: %w", &vcs.CloneError{Err: errors.New("unexpected EOF"), Transient: true}), want: true},
+		{name: "missing branch", err: fmt.Errorf("failed to clone repo: %w", &vcs.CloneError{Err: vcs.ErrRefNotFound}), want: false},
+		{name: "network error", err: fmt.Errorf("failed to get merge request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), want: true},
+		{name: "crashed agent", err: fmt.Errorf("failed to generate inline comments: %w", exitErr), want: true},
+		{name: "diff not ready", err: ErrDiffNotReady, want: true},
+		{name: "rejected token", err: fmt.Errorf("failed to send comments: %w", vcs_provider.ErrUnauthorized), want: false},
+		{name: "missing permission", err: vcs_provider.ErrPermissionDenied, want: false},
+		{name: "interrupted", err: fmt.Errorf("failed to clone repo: %w", context.Canceled), want: false},
+		{name: "bad url", err: errors.New("failed to parse pull request URL: invalid URL"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableRunError(tt.err); got != tt.want {
+				t.Errorf("retryableRunError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
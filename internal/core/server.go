@@ -0,0 +1,357 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// ServeRequest is one line of the -serve protocol: a diff to review and the commits it spans.
+type ServeRequest struct {
+	Diff    string `json:"diff"`
+	BaseSha string `json:"baseSha"`
+	HeadSha string `json:"headSha"`
+}
+
+// serveError is written instead of a comment array when a request cannot be reviewed.
+type serveError struct {
+	Error string `json:"error"`
+}
+
+// Server reviews diffs sent as newline-delimited JSON requests and answers each with one line holding the JSON
+// comment array, or an error object. It is the backend for editor integrations.
+type Server struct {
+	cfg     *api.Config
+	factory ServiceFactoryInterface
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	// redactor is loaded from the redact patterns file when serving starts
+	redactor  *diff.Redactor
+	aiLimiter *aiLimiter
+}
+
+func NewServer(cfg *api.Config, factory ServiceFactoryInterface) *Server {
+	return NewServerWithIO(cfg, factory, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// NewServerWithIO for testing purposes only for now
+func NewServerWithIO(cfg *api.Config, factory ServiceFactoryInterface, stdin io.Reader, stdout, stderr io.Writer) *Server {
+	return &Server{
+		cfg:       cfg,
+		factory:   factory,
+		stdin:     stdin,
+		stdout:    stdout,
+		stderr:    stderr,
+		aiLimiter: newAILimiter(cfg.MaxAiProcesses),
+	}
+}
+
+// Serve answers requests until stdin is closed or ctx is done. Agents that support sessions log in once for the
+// whole run. Bad requests are answered with an error and do not stop the loop. When ctx is done, the running review
+// gets the drain timeout to finish and be answered; requests left unanswered are saved to the pending file.
+func (s *Server) Serve(ctx context.Context) error {
+	if err := s.cfg.Validate(); err != nil {
+		return err
+	}
+	scope, excludes, err := s.scope()
+	if err != nil {
+		return err
+	}
+	if s.redactor, err = loadRedactor(s.cfg.RedactPatternsFile); err != nil {
+		return err
+	}
+	aiAgent, endSession, err := s.startAgent(ctx)
+	if err != nil {
+		return err
+	}
+	defer endSession()
+
+	// reviews outlive ctx for the drain timeout, so a shutdown does not throw away a nearly finished review
+	workCtx, stopWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWork()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-workCtx.Done():
+			return
+		}
+		timer := time.NewTimer(s.cfg.DrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			stopWork()
+		case <-workCtx.Done():
+		}
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	stopRead := make(chan struct{})
+	defer close(stopRead)
+	go func() {
+		reader := bufio.NewReader(s.stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-stopRead:
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	_, _ = fmt.Fprintln(s.stderr, "Waiting for review requests on stdin")
+	for {
+		select {
+		case <-ctx.Done():
+			// a request read while the last review was running is not started anymore
+			select {
+			case line := <-lines:
+				if err := s.abandon(line); err != nil {
+					return err
+				}
+			default:
+			}
+			return nil
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read request: %w", err)
+		case line := <-lines:
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			if ctx.Err() != nil {
+				if err := s.abandon(line); err != nil {
+					return err
+				}
+				continue
+			}
+			var response any
+			comments, err := s.review(workCtx, aiAgent, line, scope, excludes)
+			switch {
+			case err != nil && workCtx.Err() != nil:
+				_, _ = fmt.Fprintf(s.stderr, "Review did not finish within the drain timeout of %s\n", s.cfg.DrainTimeout)
+				if err := s.abandon(line); err != nil {
+					return err
+				}
+				continue
+			case err != nil:
+				_, _ = fmt.Fprintf(s.stderr, "Request failed: %v\n", err)
+				response = serveError{Error: err.Error()}
+			default:
+				response = comments
+			}
+			if err := json.NewEncoder(s.stdout).Encode(response); err != nil {
+				return fmt.Errorf("failed to write response: %w", err)
+			}
+		}
+	}
+}
+
+// ReviewFile reviews the unified diff saved at path and prints the JSON comment array, without a clone or any
+// provider API calls. The commits the diff spans come from the config, as they are only passed on to the agent.
+func (s *Server) ReviewFile(ctx context.Context, path string) error {
+	if err := s.cfg.Validate(); err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read diff file: %w", err)
+	}
+	prDiff, err := diff.Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("diff file %s is not a unified diff: %w", path, err)
+	}
+	if len(prDiff.Files) == 0 {
+		return fmt.Errorf("diff file %s is not a unified diff: no file changes found", path)
+	}
+	scope, excludes, err := s.scope()
+	if err != nil {
+		return err
+	}
+	if s.redactor, err = loadRedactor(s.cfg.RedactPatternsFile); err != nil {
+		return err
+	}
+	aiAgent, endSession, err := s.startAgent(ctx)
+	if err != nil {
+		return err
+	}
+	defer endSession()
+
+	comments, err := s.reviewDiff(ctx, aiAgent, ServeRequest{Diff: string(content), BaseSha: s.cfg.BaseSha, HeadSha: s.cfg.HeadSha}, scope, excludes)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(s.stdout).Encode(comments); err != nil {
+		return fmt.Errorf("failed to write comments: %w", err)
+	}
+	return nil
+}
+
+// scope builds the path filters every reviewed diff goes through.
+func (s *Server) scope() (*diff.Scope, *diff.Excludes, error) {
+	excludes, err := newExcludes(s.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	scope, err := diff.NewScope(s.cfg.SubPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid subpath: %w", err)
+	}
+	scope.Exclude = excludes.Globs()
+	scope.Include = excludes.IncludeGlobs()
+	scope.ContextLines = s.cfg.DiffContext
+	scope.Algorithm = s.cfg.DiffAlgorithm
+	return scope, excludes, nil
+}
+
+// startAgent creates the agent and, for agents that support sessions, logs in once for all reviews. The returned
+// func ends the session.
+func (s *Server) startAgent(ctx context.Context) (api.AIAgentService, func(), error) {
+	aiAgentType := api.AIAgentTypeCodex
+	if s.cfg.AiAgent != "" {
+		aiAgentType = api.AIAgentType(s.cfg.AiAgent)
+	}
+	aiAgent, err := createAiAgent(ctx, s.factory, aiAgentType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create agent service: %w", err)
+	}
+	session, ok := aiAgent.(api.SessionAgent)
+	if !ok {
+		return aiAgent, func() {}, nil
+	}
+	if err := session.StartSession(ctx); err != nil {
+		return nil, nil, err
+	}
+	return aiAgent, func() {
+		// ctx may be canceled already, the logout still has to run
+		endCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := session.EndSession(endCtx); err != nil {
+			_, _ = fmt.Fprintf(s.stderr, "Warning: %v\n", err)
+		}
+	}, nil
+}
+
+// abandon answers a request the server shuts down before reviewing, and appends it to the pending file when one is
+// set, so it can be retried by piping the file into the next -serve run.
+func (s *Server) abandon(line []byte) error {
+	message := "server is shutting down"
+	if s.cfg.PendingFile != "" {
+		if err := appendPending(s.cfg.PendingFile, line); err != nil {
+			_, _ = fmt.Fprintf(s.stderr, "Warning: request lost: %v\n", err)
+		} else {
+			message += ", request saved to " + s.cfg.PendingFile
+			_, _ = fmt.Fprintf(s.stderr, "Saved unfinished request to %s\n", s.cfg.PendingFile)
+		}
+	}
+	if err := json.NewEncoder(s.stdout).Encode(serveError{Error: message}); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
+}
+
+func appendPending(path string, line []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open pending file: %w", err)
+	}
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		line = append(line, '\n')
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write pending file: %w", err)
+	}
+	return f.Close()
+}
+
+// review decodes one request and reviews its diff.
+func (s *Server) review(ctx context.Context, aiAgent api.AIAgentService, line []byte, scope *diff.Scope, excludes *diff.Excludes) ([]*api.InlineComment, error) {
+	var request ServeRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		return nil, fmt.Errorf("malformed request: %w", err)
+	}
+	if strings.TrimSpace(request.Diff) == "" {
+		return nil, errors.New("request has no diff")
+	}
+	return s.reviewDiff(ctx, aiAgent, request, scope, excludes)
+}
+
+// reviewDiff runs the agent on a diff. The diff is filtered and checked like in a pull request review, without
+// the filters that need a checkout.
+func (s *Server) reviewDiff(ctx context.Context, aiAgent api.AIAgentService, request ServeRequest, scope *diff.Scope, excludes *diff.Excludes) ([]*api.InlineComment, error) {
+	tempDir, err := os.MkdirTemp("", "gitex-serve-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			_, _ = fmt.Fprintf(s.stderr, "Failed to cleanup directory %s: %v\n", tempDir, err)
+		}
+	}()
+	redacted, redaction := s.redactor.Redact(request.Diff)
+	diffFile, err := writeScopedDiff(tempDir, redacted, scope, excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewCtx, cancel := context.WithTimeout(ctx, timeoutOrDefault(s.cfg.AgentTimeout, DefaultAgentTimeout))
+	defer cancel()
+	if err := s.aiLimiter.acquire(reviewCtx, func() {
+		_, _ = fmt.Fprintln(s.stderr, "Waiting for a free AI process slot")
+	}); err != nil {
+		return nil, fmt.Errorf("failed to wait for an AI process slot: %w", err)
+	}
+	comments, err := aiAgent.GeneratePRInlineCommentsWithContext(reviewCtx, &api.GeneratePRInlineCommentsOptions{
+		SandBoxDir:    tempDir,
+		BaseSha:       request.BaseSha,
+		StartSha:      request.BaseSha,
+		HeadSha:       request.HeadSha,
+		Exclude:       scope.Exclude,
+		Include:       scope.Include,
+		DiffContext:   scope.ContextLines,
+		DiffAlgorithm: scope.Algorithm,
+		DiffFile:      diffFile,
+	})
+	s.aiLimiter.release()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate inline comments: %w", err)
+	}
+	redaction.RestoreComments(comments)
+
+	dropped := &droppedReport{}
+	comments = validateComments(comments, dropped)
+	comments = excludeComments(comments, excludes, dropped)
+	if usesDiffFilters(s.cfg) {
+		prDiff, err := diff.Parse(request.Diff)
+		if err != nil {
+			_, _ = fmt.Fprintf(s.stderr, "Warning: skipping diff based filters: %v\n", err)
+		} else {
+			comments = filterOnDiff(s.cfg, comments, prDiff, tempDir, s.stderr, dropped)
+		}
+	}
+	if comments == nil {
+		comments = []*api.InlineComment{}
+	}
+	return comments, nil
+}
@@ -0,0 +1,386 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// MockSessionAgent implements api.AIAgentService and api.SessionAgent for testing
+type MockSessionAgent struct {
+	MockAIAgentService
+	starts, ends int
+}
+
+func (m *MockSessionAgent) StartSession(ctx context.Context) error {
+	m.starts++
+	return nil
+}
+
+func (m *MockSessionAgent) EndSession(ctx context.Context) error {
+	m.ends++
+	return nil
+}
+
+const serveTestDiff = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n package main\n+var x = 1\n"
+
+func serveRequest(t *testing.T, request ServeRequest) string {
+	t.Helper()
+	data, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) + "\n"
+}
+
+func TestServer_Serve(t *testing.T) {
+	var diffs []string
+	agent := &MockSessionAgent{MockAIAgentService: MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			data, err := os.ReadFile(options.DiffFile)
+			if err != nil {
+				return nil, err
+			}
+			diffs = append(diffs, string(data))
+			if options.HeadSha == "broken" {
+				return nil, errors.New("codex exited")
+			}
+			return []*api.InlineComment{{
+				Body: util.Ptr("unused variable"),
+				Position: &api.InlineCommentPosition{
+					PositionType: util.Ptr(api.PositionTypeText),
+					HeadSha:      util.Ptr(options.HeadSha),
+					NewPath:      util.Ptr("main.go"),
+					OldPath:      util.Ptr("main.go"),
+					NewLine:      util.Ptr(int64(2)),
+					CommentType:  "SINGLE_LINE",
+					LineType:     "ADD",
+				},
+			}}, nil
+		},
+	}}
+	factory := &MockServiceFactory{
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return agent, nil
+		},
+	}
+
+	input := serveRequest(t, ServeRequest{Diff: serveTestDiff, BaseSha: "base", HeadSha: "head"}) +
+		"{not json\n" +
+		"\n" +
+		serveRequest(t, ServeRequest{BaseSha: "base", HeadSha: "head"}) +
+		serveRequest(t, ServeRequest{Diff: serveTestDiff, BaseSha: "base", HeadSha: "broken"}) +
+		strings.TrimSuffix(serveRequest(t, ServeRequest{Diff: serveTestDiff, BaseSha: "base", HeadSha: "head2"}), "\n")
+	var stdout bytes.Buffer
+	server := NewServerWithIO(validConfig(&api.Config{Serve: true}), factory, strings.NewReader(input), &stdout, io.Discard)
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	if agent.starts != 1 || agent.ends != 1 {
+		t.Errorf("sessions started %d and ended %d times, want 1 and 1", agent.starts, agent.ends)
+	}
+	if len(diffs) != 3 || diffs[0] != serveTestDiff {
+		t.Errorf("agent got diffs %q, want the request diff 3 times", diffs)
+	}
+
+	responses := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	wantErrors := []string{"", "malformed request", "request has no diff", "codex exited", ""}
+	if len(responses) != len(wantErrors) {
+		t.Fatalf("got %d responses, want %d:\n%s", len(responses), len(wantErrors), stdout.String())
+	}
+	for i, response := range responses {
+		if wantErrors[i] != "" {
+			var got serveError
+			if err := json.Unmarshal([]byte(response), &got); err != nil || !strings.Contains(got.Error, wantErrors[i]) {
+				t.Errorf("response %d = %s, want error containing %q", i, response, wantErrors[i])
+			}
+			continue
+		}
+		var comments []*api.InlineComment
+		if err := json.Unmarshal([]byte(response), &comments); err != nil {
+			t.Fatalf("response %d = %s, want comment array: %v", i, response, err)
+		}
+		if len(comments) != 1 || *comments[0].Body != "unused variable" {
+			t.Errorf("response %d = %s, want the agent comment", i, response)
+		}
+	}
+}
+
+func TestServer_Serve_FiltersComments(t *testing.T) {
+	agent := &MockAIAgentService{
+		GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+			return []*api.InlineComment{
+				nil,
+				{
+					Body: util.Ptr("generated code"),
+					Position: &api.InlineCommentPosition{
+						PositionType: util.Ptr(api.PositionTypeText),
+						NewPath:      util.Ptr("vendor/lib.go"),
+						OldPath:      util.Ptr("vendor/lib.go"),
+						NewLine:      util.Ptr(int64(2)),
+						CommentType:  "SINGLE_LINE",
+						LineType:     "ADD",
+					},
+				},
+			}, nil
+		},
+	}
+	factory := &MockServiceFactory{
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return agent, nil
+		},
+	}
+
+	var stdout bytes.Buffer
+	input := serveRequest(t, ServeRequest{Diff: serveTestDiff, BaseSha: "base", HeadSha: "head"})
+	server := NewServerWithIO(validConfig(&api.Config{Serve: true}), factory, strings.NewReader(input), &stdout, io.Discard)
+	if err := server.Serve(context.Background()); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "[]" {
+		t.Errorf("response = %s, want []", got)
+	}
+}
+
+func TestServer_Serve_StopsOnCancel(t *testing.T) {
+	factory := &MockServiceFactory{
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return &MockAIAgentService{}, nil
+		},
+	}
+	stdin, stdinWriter := io.Pipe()
+	defer func() {
+		_ = stdinWriter.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	server := NewServerWithIO(validConfig(&api.Config{Serve: true}), factory, stdin, io.Discard, io.Discard)
+	if err := server.Serve(ctx); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+}
+
+func TestServer_Serve_Drain(t *testing.T) {
+	tests := []struct {
+		name         string
+		drainTimeout time.Duration
+		finish       bool
+		wantError    string
+		wantPending  bool
+	}{
+		{name: "running review finishes", drainTimeout: time.Minute, finish: true},
+		{name: "review past the deadline is saved", drainTimeout: 10 * time.Millisecond, wantError: "request saved to", wantPending: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			agent := &MockAIAgentService{
+				GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+					close(started)
+					if !tt.finish {
+						<-ctx.Done()
+						return nil, ctx.Err()
+					}
+					// give the shutdown a chance to cancel the review if it wrongly did
+					time.Sleep(20 * time.Millisecond)
+					if err := ctx.Err(); err != nil {
+						return nil, err
+					}
+					return []*api.InlineComment{}, nil
+				},
+			}
+			factory := &MockServiceFactory{
+				CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+					return agent, nil
+				},
+			}
+			stdin, stdinWriter := io.Pipe()
+			defer func() {
+				_ = stdinWriter.Close()
+			}()
+			request := serveRequest(t, ServeRequest{Diff: serveTestDiff, BaseSha: "base", HeadSha: "head"})
+			go func() {
+				_, _ = io.WriteString(stdinWriter, request)
+			}()
+
+			pendingFile := filepath.Join(t.TempDir(), "pending.jsonl")
+			cfg := validConfig(&api.Config{Serve: true, DrainTimeout: tt.drainTimeout, PendingFile: pendingFile})
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-started
+				cancel()
+			}()
+			var stdout bytes.Buffer
+			if err := NewServerWithIO(cfg, factory, stdin, &stdout, io.Discard).Serve(ctx); err != nil {
+				t.Fatalf("Serve() error = %v", err)
+			}
+
+			response := strings.TrimSpace(stdout.String())
+			if tt.wantError == "" && response != "[]" {
+				t.Errorf("response = %s, want []", response)
+			}
+			if tt.wantError != "" && !strings.Contains(response, tt.wantError) {
+				t.Errorf("response = %s, want error containing %q", response, tt.wantError)
+			}
+			pending, err := os.ReadFile(pendingFile)
+			if tt.wantPending && string(pending) != request {
+				t.Errorf("pending file = %q, want the request %q", pending, request)
+			}
+			if !tt.wantPending && !os.IsNotExist(err) {
+				t.Errorf("pending file written: %q", pending)
+			}
+		})
+	}
+}
+
+func TestServer_ReviewFile_Redact(t *testing.T) {
+	const secretDiff = "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n package main\n+var host = \"db.corp.example.com\"\n"
+	var seen string
+	factory := &MockServiceFactory{
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return &MockAIAgentService{
+				GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+					data, err := os.ReadFile(options.DiffFile)
+					if err != nil {
+						return nil, err
+					}
+					seen = string(data)
+					return []*api.InlineComment{{
+						Body:     util.Ptr("[REDACTED-1] is hard-coded"),
+						Position: &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(2))},
+					}}, nil
+				},
+			}, nil
+		},
+	}
+	dir := t.TempDir()
+	diffPath := filepath.Join(dir, "pr.diff")
+	patternsPath := filepath.Join(dir, "redact.txt")
+	if err := os.WriteFile(diffPath, []byte(secretDiff), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(patternsPath, []byte("# internal hosts\n[a-z0-9]+\\.corp\\.example\\.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := validConfig(&api.Config{DiffFile: diffPath, HeadSha: "head", RedactPatternsFile: patternsPath})
+
+	var stdout bytes.Buffer
+	if err := NewServerWithIO(cfg, factory, nil, &stdout, io.Discard).ReviewFile(context.Background(), diffPath); err != nil {
+		t.Fatalf("ReviewFile() error = %v", err)
+	}
+	if strings.Contains(seen, "corp.example.com") || !strings.Contains(seen, `+var host = "[REDACTED-1]"`) {
+		t.Errorf("agent saw an unredacted diff:\n%s", seen)
+	}
+	var comments []*api.InlineComment
+	if err := json.Unmarshal(stdout.Bytes(), &comments); err != nil {
+		t.Fatalf("output = %s, want comment array: %v", stdout.String(), err)
+	}
+	if len(comments) != 1 || *comments[0].Body != "db.corp.example.com is hard-coded" {
+		t.Errorf("comments = %s, want the host restored", stdout.String())
+	}
+}
+
+func TestServer_ReviewFile(t *testing.T) {
+	var gotHead string
+	created := 0
+	factory := &MockServiceFactory{
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			created++
+			return &MockAIAgentService{
+				GeneratePRInlineCommentsWithContextFunc: func(ctx context.Context, options *api.GeneratePRInlineCommentsOptions) ([]*api.InlineComment, error) {
+					gotHead = options.HeadSha
+					return []*api.InlineComment{{
+						Body: util.Ptr("unused variable"),
+						Position: &api.InlineCommentPosition{
+							PositionType: util.Ptr(api.PositionTypeText),
+							NewPath:      util.Ptr("main.go"),
+							OldPath:      util.Ptr("main.go"),
+							NewLine:      util.Ptr(int64(2)),
+							CommentType:  "SINGLE_LINE",
+							LineType:     "ADD",
+						},
+					}}, nil
+				},
+			}, nil
+		},
+	}
+	dir := t.TempDir()
+	diffPath := filepath.Join(dir, "pr.diff")
+	if err := os.WriteFile(diffPath, []byte(serveTestDiff), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	notDiffPath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notDiffPath, []byte("just some notes\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := validConfig(&api.Config{DiffFile: diffPath, BaseSha: "base", HeadSha: "head"})
+
+	var stdout bytes.Buffer
+	if err := NewServerWithIO(cfg, factory, nil, &stdout, io.Discard).ReviewFile(context.Background(), diffPath); err != nil {
+		t.Fatalf("ReviewFile() error = %v", err)
+	}
+	var comments []*api.InlineComment
+	if err := json.Unmarshal(stdout.Bytes(), &comments); err != nil {
+		t.Fatalf("output = %s, want comment array: %v", stdout.String(), err)
+	}
+	if len(comments) != 1 || gotHead != "head" {
+		t.Errorf("got %d comments for head %q, want 1 for head", len(comments), gotHead)
+	}
+
+	err := NewServerWithIO(cfg, factory, nil, io.Discard, io.Discard).ReviewFile(context.Background(), notDiffPath)
+	if err == nil || !strings.Contains(err.Error(), "is not a unified diff") {
+		t.Errorf("ReviewFile() error = %v, want not a unified diff", err)
+	}
+	if created != 1 {
+		t.Errorf("agent created %d times, want only for the valid diff", created)
+	}
+}
+
+func TestServer_ReviewFile_SharesAILimiter(t *testing.T) {
+	dir := t.TempDir()
+	diffPath := filepath.Join(dir, "pr.diff")
+	if err := os.WriteFile(diffPath, []byte(serveTestDiff), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := validConfig(&api.Config{DiffFile: diffPath, MaxAiProcesses: 1})
+	factory := &MockServiceFactory{
+		CreateAiAgentServiceFunc: func(kind api.AIAgentType) (api.AIAgentService, error) {
+			return &MockAIAgentService{}, nil
+		},
+	}
+	server := NewServerWithIO(cfg, factory, nil, io.Discard, io.Discard)
+	if app := NewApp(cfg, factory); app.aiLimiter == server.aiLimiter {
+		t.Fatal("standalone app uses the server's AI limiter")
+	}
+	if app := NewAppWithOptions(cfg, factory, WithServerAILimiter(server)); app.aiLimiter != server.aiLimiter {
+		t.Fatal("app created with WithServerAILimiter uses its own AI limiter")
+	}
+
+	limiter := server.aiLimiter
+	for range cap(limiter.slots) {
+		_ = limiter.acquire(context.Background(), nil)
+	}
+	defer func() {
+		for range cap(limiter.slots) {
+			limiter.release()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.ReviewFile(ctx, diffPath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReviewFile() error = %v, want to wait for a slot until the deadline", err)
+	}
+}
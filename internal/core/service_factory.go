@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
@@ -9,14 +10,13 @@ import (
 	"github.com/eridan-ltu/gitex/internal/ai"
 	"github.com/eridan-ltu/gitex/internal/vcs"
 	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/plumbing/transport/http"
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh"
 )
 
-const AIAgentTypeCodex api.AIAgentType = "codex"
 const VCSTypeGit api.VersionControlType = "git"
-const VCSProviderTypeGitlab api.VCSProviderType = "gitlab"
-const VCSProviderTypeGithub api.VCSProviderType = "github"
-const VCSProviderTypeUnknown api.VCSProviderType = "unknown"
 
 type ServiceFactoryInterface interface {
 	DetectVCSProviderType(url string) (api.VCSProviderType, error)
@@ -37,37 +37,117 @@ func NewServiceFactory(cfg *api.Config) *ServiceFactory {
 	}
 }
 
+// contextAgentFactory is implemented by factories whose agent setup, like the codex install, can be canceled.
+type contextAgentFactory interface {
+	CreateAiAgentServiceWithContext(ctx context.Context, kind api.AIAgentType) (api.AIAgentService, error)
+}
+
+var _ contextAgentFactory = (*ServiceFactory)(nil)
+
+// createAiAgent creates the agent with ctx when the factory supports it.
+func createAiAgent(ctx context.Context, factory ServiceFactoryInterface, kind api.AIAgentType) (api.AIAgentService, error) {
+	if f, ok := factory.(contextAgentFactory); ok {
+		return f.CreateAiAgentServiceWithContext(ctx, kind)
+	}
+	return factory.CreateAiAgentService(kind)
+}
+
 func (a *ServiceFactory) CreateAiAgentService(kind api.AIAgentType) (api.AIAgentService, error) {
+	return a.CreateAiAgentServiceWithContext(context.Background(), kind)
+}
+
+func (a *ServiceFactory) CreateAiAgentServiceWithContext(ctx context.Context, kind api.AIAgentType) (api.AIAgentService, error) {
 	switch kind {
-	case AIAgentTypeCodex:
-		codexService, err := ai.NewCodexService(a.cfg)
+	case api.AIAgentTypeCodex:
+		codexService, err := ai.NewCodexServiceWithContext(ctx, a.cfg)
 		if err != nil {
 			return nil, fmt.Errorf("error creating CodexService: %w", err)
 		}
 		return codexService, nil
+	case api.AIAgentTypeClaude:
+		claudeService, err := ai.NewClaudeServiceWithContext(ctx, a.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating ClaudeService: %w", err)
+		}
+		return claudeService, nil
+	case api.AIAgentTypeOpenAI:
+		openAIService, err := ai.NewOpenAIService(a.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating OpenAIService: %w", err)
+		}
+		return openAIService, nil
+	case api.AIAgentTypeReplay:
+		replayService, err := ai.NewReplayService(a.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating ReplayService: %w", err)
+		}
+		return replayService, nil
 	default:
-		return nil, fmt.Errorf("unsupported AI agent type: %s", kind)
+		return nil, fmt.Errorf("unsupported AI agent type: %q, supported are %s, %s, %s and %s", kind, api.AIAgentTypeCodex, api.AIAgentTypeClaude, api.AIAgentTypeOpenAI, api.AIAgentTypeReplay)
 	}
 }
 
 func (a *ServiceFactory) CreateVersionControlService(kind api.VersionControlType) (api.VersionControlService, error) {
 	switch kind {
 	case VCSTypeGit:
-		return vcs.NewGitService(&http.BasicAuth{
+		tags := plumbing.NoTags
+		if a.cfg.CloneTags == CloneTagsAll {
+			tags = plumbing.AllTags
+		}
+		depth := a.cfg.CloneDepth
+		if len(a.cfg.Commits) > 0 {
+			// the commits are checked against the history between the base and the head
+			depth = 0
+		}
+		auth, err := a.cloneAuth()
+		if err != nil {
+			return nil, err
+		}
+		return vcs.NewGitService(auth, vcs.WithCloneRetries(a.cfg.CloneRetries), vcs.WithCloneTags(tags), vcs.WithCloneDepth(depth)), nil
+	default:
+		return nil, fmt.Errorf("unsupported version control type: %s", kind)
+	}
+}
+
+// cloneAuth returns the credentials clones authenticate with: the api key over https, or over ssh the -ssh-key
+// private key, the keys of the running ssh agent without one.
+func (a *ServiceFactory) cloneAuth() (transport.AuthMethod, error) {
+	switch a.cfg.GitTransport {
+	case "", GitTransportHTTPS:
+		return &http.BasicAuth{
 			Username: "oauth",
 			Password: a.cfg.VcsApiKey,
-		}), nil
+		}, nil
+	case GitTransportSSH:
+		if a.cfg.SSHKey != "" {
+			auth, err := ssh.NewPublicKeysFromFile(ssh.DefaultUsername, a.cfg.SSHKey, "")
+			if err != nil {
+				return nil, fmt.Errorf("failed to load ssh key %s: %w", a.cfg.SSHKey, err)
+			}
+			return auth, nil
+		}
+		auth, err := ssh.NewSSHAgentAuth(ssh.DefaultUsername)
+		if err != nil {
+			return nil, fmt.Errorf("failed to use ssh agent, pass -ssh-key: %w", err)
+		}
+		return auth, nil
 	default:
-		return nil, fmt.Errorf("unsupported version control type: %s", kind)
+		return nil, fmt.Errorf("unsupported git transport: %s", a.cfg.GitTransport)
 	}
 }
 
 func (a *ServiceFactory) CreateVCSProvider(kind api.VCSProviderType) (api.RemoteGitService, error) {
 	switch kind {
-	case VCSProviderTypeGitlab:
+	case api.VCSProviderTypeGitlab:
 		return vcs_provider.NewGitLabService(a.cfg)
-	case VCSProviderTypeGithub:
+	case api.VCSProviderTypeGithub:
 		return vcs_provider.NewGitHubService(a.cfg)
+	case api.VCSProviderTypeGitea:
+		svc, err := vcs_provider.NewGiteaService(a.cfg)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
 	default:
 		return nil, fmt.Errorf("unsupported remote git service: %s", kind)
 	}
@@ -82,16 +162,33 @@ func (a *ServiceFactory) DetectVCSProviderType(rawURL string) (api.VCSProviderTy
 	host := strings.ToLower(u.Host)
 	path := strings.ToLower(u.Path)
 
+	// self-hosted instances can live on any host, -vcs-provider says what runs on the -vcs-url one
+	if a.cfg.VcsProvider != "" && a.cfg.VcsRemoteUrl != "" {
+		if remote, err := url.Parse(a.cfg.VcsRemoteUrl); err == nil && strings.EqualFold(remote.Host, u.Host) {
+			return api.VCSProviderType(a.cfg.VcsProvider), nil
+		}
+	}
+
 	if host == "github.com" {
-		return VCSProviderTypeGithub, nil
+		return api.VCSProviderTypeGithub, nil
+	}
+
+	// remote urls carry no merge request path, so fall back to well known gitlab hosts
+	if host == "gitlab.com" || strings.HasPrefix(host, "gitlab.") {
+		return api.VCSProviderTypeGitlab, nil
 	}
 
 	if strings.Contains(path, "/-/merge_requests/") {
-		return VCSProviderTypeGitlab, nil
+		return api.VCSProviderTypeGitlab, nil
+	}
+
+	// Gitea and Forgejo pull requests live under /pulls/, GitHub's under /pull/
+	if host == "codeberg.org" || strings.HasPrefix(host, "gitea.") || strings.HasPrefix(host, "forgejo.") || strings.Contains(path, "/pulls/") {
+		return api.VCSProviderTypeGitea, nil
 	}
 
 	if strings.Contains(path, "/pull/") {
-		return VCSProviderTypeGithub, nil
+		return api.VCSProviderTypeGithub, nil
 	}
-	return VCSProviderTypeUnknown, nil
+	return api.VCSProviderTypeUnknown, nil
 }
@@ -1,9 +1,18 @@
 package core
 
 import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/eridan-ltu/gitex/api"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/http"
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh"
 )
 
 func TestNewServiceFactory(t *testing.T) {
@@ -37,7 +46,12 @@ func TestCreateAiAgentService(t *testing.T) {
 	}{
 		{
 			name:        "valid codex type",
-			kind:        AIAgentTypeCodex,
+			kind:        api.AIAgentTypeCodex,
+			expectError: false,
+		},
+		{
+			name:        "valid claude type",
+			kind:        api.AIAgentTypeClaude,
 			expectError: false,
 		},
 		{
@@ -75,6 +89,53 @@ func TestCreateAiAgentService(t *testing.T) {
 	}
 }
 
+func TestCreateAiAgentService_UnknownListsAgents(t *testing.T) {
+	_, err := NewServiceFactory(&api.Config{}).CreateAiAgentService(api.AIAgentType("gpt"))
+	if err == nil || !strings.Contains(err.Error(), `"gpt", supported are codex, claude, openai and replay`) {
+		t.Errorf("expected the supported agents in the error, got %v", err)
+	}
+}
+
+func TestCreateAiAgentService_Replay(t *testing.T) {
+	t.Run("requires replay file", func(t *testing.T) {
+		factory := NewServiceFactory(&api.Config{})
+		if _, err := factory.CreateAiAgentService(api.AIAgentTypeReplay); err == nil {
+			t.Error("expected error without replay file")
+		}
+	})
+
+	t.Run("creates replay service", func(t *testing.T) {
+		factory := NewServiceFactory(&api.Config{ReplayFile: "comments.json"})
+		svc, err := factory.CreateAiAgentService(api.AIAgentTypeReplay)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if svc == nil {
+			t.Error("expected non-nil service")
+		}
+	})
+}
+
+func TestCreateAiAgentService_OpenAI(t *testing.T) {
+	t.Run("requires api key", func(t *testing.T) {
+		factory := NewServiceFactory(&api.Config{AiModel: "gpt-test"})
+		if _, err := factory.CreateAiAgentService(api.AIAgentTypeOpenAI); err == nil {
+			t.Error("expected error without api key")
+		}
+	})
+
+	t.Run("creates openai service without installing anything", func(t *testing.T) {
+		factory := NewServiceFactory(&api.Config{AiApiKey: "sk-test", AiModel: "gpt-test", BinDir: "/nonexistent"})
+		svc, err := factory.CreateAiAgentService(api.AIAgentTypeOpenAI)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if svc == nil {
+			t.Error("expected non-nil service")
+		}
+	})
+}
+
 func TestCreateVersionControlService(t *testing.T) {
 	cfg := &api.Config{
 		VcsApiKey: "test-api-key",
@@ -126,6 +187,92 @@ func TestCreateVersionControlService(t *testing.T) {
 	}
 }
 
+func TestServiceFactory_CloneAuth(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     api.Config
+		wantErr string
+		check   func(t *testing.T, auth transport.AuthMethod)
+	}{
+		{name: "https by default", cfg: api.Config{VcsApiKey: "token"}, check: func(t *testing.T, auth transport.AuthMethod) {
+			basic, ok := auth.(*http.BasicAuth)
+			if !ok || basic.Password != "token" {
+				t.Errorf("auth = %#v, want basic auth with the api key", auth)
+			}
+		}},
+		{name: "https", cfg: api.Config{VcsApiKey: "token", GitTransport: GitTransportHTTPS}, check: func(t *testing.T, auth transport.AuthMethod) {
+			if _, ok := auth.(*http.BasicAuth); !ok {
+				t.Errorf("auth = %T, want *http.BasicAuth", auth)
+			}
+		}},
+		{name: "ssh key", cfg: api.Config{GitTransport: GitTransportSSH, SSHKey: keyFile}, check: func(t *testing.T, auth transport.AuthMethod) {
+			keys, ok := auth.(*ssh.PublicKeys)
+			if !ok || keys.User != ssh.DefaultUsername {
+				t.Errorf("auth = %#v, want public keys of user git", auth)
+			}
+		}},
+		{name: "missing ssh key", cfg: api.Config{GitTransport: GitTransportSSH, SSHKey: filepath.Join(t.TempDir(), "missing")},
+			wantErr: "failed to load ssh key"},
+		{name: "ssh agent not running", cfg: api.Config{GitTransport: GitTransportSSH}, wantErr: "failed to use ssh agent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SSH_AUTH_SOCK", "")
+			auth, err := NewServiceFactory(&tt.cfg).cloneAuth()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, auth)
+		})
+	}
+}
+
+func TestDetectRemoteGitServiceType_VcsProvider(t *testing.T) {
+	factory := NewServiceFactory(&api.Config{VcsRemoteUrl: "https://git.example.com", VcsProvider: "gitea"})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected api.VCSProviderType
+	}{
+		{name: "pull request on the vcs url host", url: "https://git.example.com/user/repo/pull/3", expected: api.VCSProviderTypeGitea},
+		{name: "host is case insensitive", url: "https://GIT.example.com/user/repo", expected: api.VCSProviderTypeGitea},
+		{name: "other host", url: "https://example.com/user/repo/pull/3", expected: api.VCSProviderTypeGithub},
+		{name: "github.com", url: "https://github.com/user/repo/pull/3", expected: api.VCSProviderTypeGithub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := factory.DetectVCSProviderType(tt.url)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
 func TestCreateRemoteGitService(t *testing.T) {
 	cfg := &api.Config{}
 	factory := NewServiceFactory(cfg)
@@ -137,17 +284,22 @@ func TestCreateRemoteGitService(t *testing.T) {
 	}{
 		{
 			name:        "valid gitlab type",
-			kind:        VCSProviderTypeGitlab,
+			kind:        api.VCSProviderTypeGitlab,
 			expectError: false,
 		},
 		{
 			name:        "github type",
-			kind:        VCSProviderTypeGithub,
+			kind:        api.VCSProviderTypeGithub,
+			expectError: false,
+		},
+		{
+			name:        "gitea type",
+			kind:        api.VCSProviderTypeGitea,
 			expectError: false,
 		},
 		{
 			name:        "unknown type",
-			kind:        VCSProviderTypeUnknown,
+			kind:        api.VCSProviderTypeUnknown,
 			expectError: true,
 		},
 		{
@@ -192,43 +344,73 @@ func TestDetectRemoteGitServiceType(t *testing.T) {
 		{
 			name:        "github.com host",
 			url:         "https://github.com/user/repo",
-			expected:    VCSProviderTypeGithub,
+			expected:    api.VCSProviderTypeGithub,
 			expectError: false,
 		},
 		{
 			name:        "github.com with pull request",
 			url:         "https://github.com/user/repo/pull/123",
-			expected:    VCSProviderTypeGithub,
+			expected:    api.VCSProviderTypeGithub,
 			expectError: false,
 		},
 		{
 			name:        "gitlab merge request",
 			url:         "https://gitlab.com/user/repo/-/merge_requests/123",
-			expected:    VCSProviderTypeGitlab,
+			expected:    api.VCSProviderTypeGitlab,
 			expectError: false,
 		},
 		{
 			name:        "self-hosted gitlab",
 			url:         "https://gitlab.example.com/user/repo/-/merge_requests/456",
-			expected:    VCSProviderTypeGitlab,
+			expected:    api.VCSProviderTypeGitlab,
 			expectError: false,
 		},
 		{
 			name:        "case insensitive github",
 			url:         "https://GitHub.COM/user/repo",
-			expected:    VCSProviderTypeGithub,
+			expected:    api.VCSProviderTypeGithub,
 			expectError: false,
 		},
 		{
 			name:        "case insensitive merge request path",
 			url:         "https://example.com/user/repo/-/MERGE_REQUESTS/123",
-			expected:    VCSProviderTypeGitlab,
+			expected:    api.VCSProviderTypeGitlab,
 			expectError: false,
 		},
 		{
 			name:        "non-github pull request",
 			url:         "https://example.com/user/repo/pull/123",
-			expected:    VCSProviderTypeGithub,
+			expected:    api.VCSProviderTypeGithub,
+			expectError: false,
+		},
+		{
+			name:        "gitlab.com remote",
+			url:         "https://gitlab.com/group/project",
+			expected:    api.VCSProviderTypeGitlab,
+			expectError: false,
+		},
+		{
+			name:        "self-hosted gitlab remote",
+			url:         "https://gitlab.example.com/group/project",
+			expected:    api.VCSProviderTypeGitlab,
+			expectError: false,
+		},
+		{
+			name:        "codeberg pull request",
+			url:         "https://codeberg.org/user/repo/pulls/7",
+			expected:    api.VCSProviderTypeGitea,
+			expectError: false,
+		},
+		{
+			name:        "self-hosted gitea host",
+			url:         "https://gitea.example.com/user/repo",
+			expected:    api.VCSProviderTypeGitea,
+			expectError: false,
+		},
+		{
+			name:        "gitea pulls path",
+			url:         "https://git.example.com/user/repo/pulls/12",
+			expected:    api.VCSProviderTypeGitea,
 			expectError: false,
 		},
 		{
@@ -246,7 +428,7 @@ func TestDetectRemoteGitServiceType(t *testing.T) {
 		{
 			name:        "unsupported service",
 			url:         "https://bitbucket.org/user/repo",
-			expected:    VCSProviderTypeUnknown,
+			expected:    api.VCSProviderTypeUnknown,
 			expectError: false,
 		},
 	}
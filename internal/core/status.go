@@ -0,0 +1,54 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+const defaultStatusContext = "gitex"
+
+// commitStatus reports the run outcome on the pull request head commit. A nil commitStatus reports nothing.
+type commitStatus struct {
+	reporter api.CommitStatusReporter
+	prInfo   *api.PullRequestInfo
+	context  string
+	stderr   io.Writer
+}
+
+func (a *App) newCommitStatus(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo) *commitStatus {
+	if !a.cfg.CommitStatus || a.cfg.DryRun {
+		return nil
+	}
+	reporter, ok := vcsProviderService.(api.CommitStatusReporter)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Commit status is not supported for %s, skipping\n", vcsProviderType)
+		return nil
+	}
+	context := a.cfg.StatusContext
+	if context == "" {
+		context = defaultStatusContext
+	}
+	return &commitStatus{
+		reporter: reporter,
+		prInfo:   prInfo,
+		context:  context,
+		stderr:   a.stderr,
+	}
+}
+
+// set publishes the status, failures only warn as the review itself is more important than its status.
+func (s *commitStatus) set(state api.CommitStatusState, description string) {
+	if s == nil {
+		return
+	}
+	err := s.reporter.SetCommitStatus(s.prInfo, &api.CommitStatus{
+		State:       state,
+		Context:     s.context,
+		Description: description,
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(s.stderr, "Warning: %v\n", err)
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/ai"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+)
+
+// summaryHeading starts the comment with the review summary, telling it apart from the other general comments.
+const summaryHeading = "### gitex review summary\n\n"
+
+// readReviewSummary returns the review summary the agent left in the sandbox, "" when it wrote none, as replayed and
+// placeholder reviews do.
+func readReviewSummary(sandBoxDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(sandBoxDir, ai.SummaryFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read review summary: %w", err)
+	}
+	return string(data), nil
+}
+
+// writeSummaryFile copies the review summary the agent left in the sandbox to path after the preamble, creating its
+// parent directories. It reports whether the agent wrote a summary at all.
+func writeSummaryFile(sandBoxDir, path, preamble string) (bool, error) {
+	summary, err := readReviewSummary(sandBoxDir)
+	if err != nil || summary == "" {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("failed to create summary file directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(preamble+summary), 0644); err != nil {
+		return false, fmt.Errorf("failed to write summary file: %w", err)
+	}
+	return true, nil
+}
+
+// postReviewSummary posts the review summary as a general comment. Only a rejected token fails the run.
+func (a *App) postReviewSummary(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo, summary string) error {
+	commenter, ok := vcsProviderService.(api.PullRequestCommenter)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Summary comments are not supported for %s, skipping\n", vcsProviderType)
+		return nil
+	}
+	body := summaryHeading + prInfo.ChangedFilesTable() + strings.TrimSpace(summary)
+	if err := commenter.CommentOnPullRequest(prInfo, body); err != nil {
+		if errors.Is(err, vcs_provider.ErrUnauthorized) || errors.Is(err, vcs_provider.ErrPermissionDenied) {
+			return fmt.Errorf("failed to post review summary: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/internal/ai"
+)
+
+func TestWriteSummaryFile(t *testing.T) {
+	t.Run("copies the summary into new directories", func(t *testing.T) {
+		sandBoxDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(sandBoxDir, ai.SummaryFileName), []byte("Looks good overall.\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "artifacts", "review", "summary.txt")
+		written, err := writeSummaryFile(sandBoxDir, path, "")
+		if err != nil || !written {
+			t.Fatalf("writeSummaryFile() = %v, %v, want written", written, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != "Looks good overall.\n" {
+			t.Errorf("summary file = %q, %v", data, err)
+		}
+	})
+
+	t.Run("agent without summary", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "summary.txt")
+		written, err := writeSummaryFile(t.TempDir(), path, "")
+		if err != nil || written {
+			t.Errorf("writeSummaryFile() = %v, %v, want nothing written", written, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("summary file should not exist")
+		}
+	})
+}
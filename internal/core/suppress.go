@@ -0,0 +1,63 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"gopkg.in/yaml.v3"
+)
+
+// suppressFile lists the comment categories a repository does not want, relative to the repository root.
+const suppressFile = ".gitex/suppress.yaml"
+
+type suppressConfig struct {
+	Categories []string `yaml:"categories"`
+}
+
+// loadSuppressedCategories reads the suppressed categories of the cloned repository. A missing file suppresses
+// nothing.
+func loadSuppressedCategories(repoDir string) (map[string]bool, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, suppressFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", suppressFile, err)
+	}
+
+	var cfg suppressConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", suppressFile, err)
+	}
+	categories := map[string]bool{}
+	for _, category := range cfg.Categories {
+		if category = normalizeCategory(category); category != "" {
+			categories[category] = true
+		}
+	}
+	return categories, nil
+}
+
+// suppressComments drops comments whose category the repository suppressed. Uncategorized comments are kept.
+func suppressComments(comments []*api.InlineComment, suppressed map[string]bool, report *droppedReport) []*api.InlineComment {
+	if len(suppressed) == 0 {
+		return comments
+	}
+	kept := make([]*api.InlineComment, 0, len(comments))
+	for _, comment := range comments {
+		if category := normalizeCategory(comment.Category); suppressed[category] {
+			report.add(DropReasonSuppressed, category, comment)
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func writeSuppressFile(t *testing.T, content string) string {
+	t.Helper()
+	repoDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoDir, ".gitex"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, suppressFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return repoDir
+}
+
+func TestLoadSuppressedCategories(t *testing.T) {
+	t.Run("missing file suppresses nothing", func(t *testing.T) {
+		got, err := loadSuppressedCategories(t.TempDir())
+		if err != nil || len(got) != 0 {
+			t.Errorf("got %v, %v, want no categories", got, err)
+		}
+	})
+
+	t.Run("reads normalized categories", func(t *testing.T) {
+		got, err := loadSuppressedCategories(writeSuppressFile(t, "categories:\n  - Performance\n  - ' maintainability '\n  - ''\n"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || !got["performance"] || !got["maintainability"] {
+			t.Errorf("got %v, want performance and maintainability", got)
+		}
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		if _, err := loadSuppressedCategories(writeSuppressFile(t, "categories: [unclosed")); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestSuppressComments(t *testing.T) {
+	comment := func(category string) *api.InlineComment {
+		return &api.InlineComment{Body: util.Ptr("finding"), Category: category}
+	}
+	perf, bug, uncategorized := comment("PERFORMANCE"), comment("correctness"), comment("")
+
+	report := &droppedReport{}
+	got := suppressComments([]*api.InlineComment{perf, bug, uncategorized}, map[string]bool{"performance": true}, report)
+
+	if len(got) != 2 || got[0] != bug || got[1] != uncategorized {
+		t.Errorf("expected the correctness and uncategorized comments, got %d", len(got))
+	}
+	if len(report.entries) != 1 || report.entries[0].Reason != DropReasonSuppressed || report.entries[0].Detail != "performance" {
+		t.Errorf("unexpected report: %+v", report.entries)
+	}
+}
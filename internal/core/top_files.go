@@ -0,0 +1,72 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+// What -on-too-many-files does with a pull request changing more files than -max-files.
+const (
+	TooManyFilesLargest = "largest"
+	TooManyFilesAbort   = "abort"
+)
+
+// largestFiles splits the changed files accepted by inScope into the n with the most changed lines and the rest.
+func largestFiles(prDiff *diff.Diff, n int, inScope func(path string) bool) (kept, skipped []string) {
+	type fileSize struct {
+		path    string
+		changed int
+	}
+	var files []fileSize
+	for _, f := range prDiff.Files {
+		p := f.Path()
+		if p == "" || !inScope(p) {
+			continue
+		}
+		files = append(files, fileSize{path: p, changed: f.Added + f.Removed})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].changed != files[j].changed {
+			return files[i].changed > files[j].changed
+		}
+		return files[i].path < files[j].path
+	})
+
+	for i, f := range files {
+		if i < n {
+			kept = append(kept, f.path)
+		} else {
+			skipped = append(skipped, f.path)
+		}
+	}
+	return kept, skipped
+}
+
+// limitToTopFiles excludes every changed file but the n largest ones, returning the widened excludes and the number
+// of skipped files.
+func (a *App) limitToTopFiles(prDiff *diff.Diff, scope *diff.Scope, excludes *diff.Excludes, n int) (*diff.Excludes, int, error) {
+	kept, skipped := largestFiles(prDiff, n, func(p string) bool {
+		return scope.Contains(p) && !excludes.Match(p)
+	})
+	if len(skipped) == 0 {
+		return excludes, 0, nil
+	}
+
+	var patterns []string
+	for _, p := range skipped {
+		patterns = append(patterns, "/"+p)
+	}
+	limited, err := newExcludes(a.cfg, patterns...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to exclude skipped files: %w", err)
+	}
+	_, _ = fmt.Fprintf(a.stdout, "Reviewing the %d largest of %d changed files, skipping %d\n", len(kept), len(kept)+len(skipped), len(skipped))
+	return limited, len(skipped), nil
+}
+
+// tooManyFilesNote tells the summary reader that a pull request over -max-files was only partly reviewed.
+func tooManyFilesNote(reviewed, skipped int) string {
+	return fmt.Sprintf("Only the %d largest of %d changed files were reviewed, %d were skipped to stay within the file limit.\n\n", reviewed, reviewed+skipped, skipped)
+}
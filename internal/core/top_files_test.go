@@ -0,0 +1,67 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/internal/diff"
+)
+
+const topFilesDiff = `diff --git a/small.go b/small.go
+--- a/small.go
++++ b/small.go
+@@ -1 +1 @@
+-a
++b
+diff --git a/big.go b/big.go
+--- a/big.go
++++ b/big.go
+@@ -1,0 +1,4 @@
++a
++b
++c
++d
+diff --git a/gone.go b/gone.go
+--- a/gone.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-a
+-b
+-c
+diff --git a/docs/readme.md b/docs/readme.md
+--- a/docs/readme.md
++++ b/docs/readme.md
+@@ -1 +1,9 @@
+-a
++a
++b
++c
++d
++e
++f
++g
++h
++i
+`
+
+func TestLargestFiles(t *testing.T) {
+	prDiff, err := diff.Parse(topFilesDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notDocs := func(p string) bool { return !strings.HasPrefix(p, "docs/") }
+
+	kept, skipped := largestFiles(prDiff, 2, notDocs)
+	if !reflect.DeepEqual(kept, []string{"big.go", "gone.go"}) {
+		t.Errorf("kept = %v, want [big.go gone.go]", kept)
+	}
+	if !reflect.DeepEqual(skipped, []string{"small.go"}) {
+		t.Errorf("skipped = %v, want [small.go]", skipped)
+	}
+
+	kept, skipped = largestFiles(prDiff, 10, notDocs)
+	if len(kept) != 3 || len(skipped) != 0 {
+		t.Errorf("expected all 3 files kept, got %v and %v", kept, skipped)
+	}
+}
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/vcs_provider"
+)
+
+// truncationNote tells the pull request that the review stopped early and that its comments are not all there is.
+const truncationNote = "### gitex review truncated\n\nThe AI agent was stopped before it finished, only the %d comments it had completed were posted. Files it did not get to may still have issues, rerun gitex for a full review."
+
+// postTruncationNote posts truncationNote as a general comment. Only a rejected token fails the run.
+func (a *App) postTruncationNote(vcsProviderService api.RemoteGitService, vcsProviderType api.VCSProviderType, prInfo *api.PullRequestInfo, comments int) error {
+	commenter, ok := vcsProviderService.(api.PullRequestCommenter)
+	if !ok {
+		_, _ = fmt.Fprintf(a.stdout, "Truncation notes are not supported for %s, skipping\n", vcsProviderType)
+		return nil
+	}
+	if err := commenter.CommentOnPullRequest(prInfo, fmt.Sprintf(truncationNote, comments)); err != nil {
+		if errors.Is(err, vcs_provider.ErrUnauthorized) || errors.Is(err, vcs_provider.ErrPermissionDenied) {
+			return fmt.Errorf("failed to post truncation note: %w", err)
+		}
+		_, _ = fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
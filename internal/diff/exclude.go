@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultGeneratedPatterns lists vendored and generated files that are skipped unless generated code is reviewed.
+var DefaultGeneratedPatterns = []string{"vendor/", "node_modules/", "dist/", "*.pb.go", "*_generated.go"}
+
+// Excludes matches repository paths against gitignore-like patterns: a pattern without a slash matches at any depth,
+// a trailing slash matches a directory and everything below it, a leading slash anchors to the repository root.
+// Include patterns, in the same syntax, exclude every path none of them matches.
+type Excludes struct {
+	globs    []string
+	regexps  []*regexp.Regexp
+	includes []string
+	included []*regexp.Regexp
+}
+
+func NewExcludes(patterns []string) (*Excludes, error) {
+	e := &Excludes{}
+	for _, pattern := range patterns {
+		glob, err := toGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if glob == "" {
+			continue
+		}
+		e.globs = append(e.globs, glob)
+		e.regexps = append(e.regexps, globRegexp(glob))
+	}
+	return e, nil
+}
+
+// Include narrows the paths to the ones the patterns match, everything else is excluded. No patterns include every
+// path.
+func (e *Excludes) Include(patterns []string) error {
+	for _, pattern := range patterns {
+		glob, err := toGlob(pattern)
+		if err != nil {
+			return err
+		}
+		if glob == "" {
+			continue
+		}
+		e.includes = append(e.includes, glob)
+		e.included = append(e.included, globRegexp(glob))
+	}
+	return nil
+}
+
+// Globs returns the normalized patterns, anchored at the repository root with ** for any depth.
+func (e *Excludes) Globs() []string {
+	return e.globs
+}
+
+// IncludeGlobs returns the normalized include patterns, see Globs.
+func (e *Excludes) IncludeGlobs() []string {
+	return e.includes
+}
+
+func (e *Excludes) Match(p string) bool {
+	p = strings.TrimPrefix(p, "./")
+	if len(e.included) > 0 && !slices.ContainsFunc(e.included, func(re *regexp.Regexp) bool { return re.MatchString(p) }) {
+		return true
+	}
+	for _, re := range e.regexps {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func toGlob(pattern string) (string, error) {
+	pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "./")
+	if pattern == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(pattern, `'[]\`) {
+		return "", fmt.Errorf("pattern %q must not contain quotes, brackets or backslashes", pattern)
+	}
+
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	dir := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" || pattern == ".." || strings.HasPrefix(path.Clean(pattern), "../") {
+		return "", fmt.Errorf("pattern %q must point inside the repository", pattern)
+	}
+
+	if !anchored && !strings.Contains(pattern, "/") && !strings.HasPrefix(pattern, "**") {
+		pattern = "**/" + pattern
+	}
+	if dir {
+		pattern += "/**"
+	}
+	return pattern, nil
+}
+
+func globRegexp(glob string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			sb.WriteString("[^/]*")
+		case glob[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
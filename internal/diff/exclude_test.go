@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestNewExcludes(t *testing.T) {
+	tests := []struct {
+		name        string
+		patterns    []string
+		want        []string
+		expectError bool
+	}{
+		{name: "defaults", patterns: DefaultGeneratedPatterns, want: []string{"**/vendor/**", "**/node_modules/**", "**/dist/**", "**/*.pb.go", "**/*_generated.go"}},
+		{name: "nested pattern is anchored", patterns: []string{"docs/*.md"}, want: []string{"docs/*.md"}},
+		{name: "leading slash anchors", patterns: []string{"/dist/"}, want: []string{"dist/**"}},
+		{name: "leading dot slash", patterns: []string{"./build/"}, want: []string{"**/build/**"}},
+		{name: "explicit double star", patterns: []string{"**/testdata/**"}, want: []string{"**/testdata/**"}},
+		{name: "blank patterns are skipped", patterns: []string{"", "  "}, want: nil},
+		{name: "quote", patterns: []string{"it's"}, expectError: true},
+		{name: "bracket", patterns: []string{"[ab].go"}, expectError: true},
+		{name: "outside repository", patterns: []string{"../other/"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			excludes, err := NewExcludes(tt.patterns)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(excludes.Globs(), tt.want) {
+				t.Errorf("Globs() = %v, want %v", excludes.Globs(), tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludes_Match(t *testing.T) {
+	excludes, err := NewExcludes(append([]string{"docs/*.md", "/build/"}, DefaultGeneratedPatterns...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"vendor/github.com/x/y.go", true},
+		{"services/api/vendor/x.go", true},
+		{"web/node_modules/react/index.js", true},
+		{"dist/app.js", true},
+		{"api/v1/service.pb.go", true},
+		{"service.pb.go", true},
+		{"models_generated.go", true},
+		{"./vendor/x.go", true},
+		{"docs/intro.md", true},
+		{"docs/guides/intro.md", false},
+		{"build/out.bin", true},
+		{"tools/build/main.go", false},
+		{"main.go", false},
+		{"vendored/x.go", false},
+		{"pkg/service.go", false},
+		{"distribution/main.go", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := excludes.Match(tt.path); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludes_Include(t *testing.T) {
+	excludes, err := NewExcludes([]string{"*_test.go"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := excludes.Include([]string{"internal/", "*.go", ""}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"**/internal/**", "**/*.go"}; !slices.Equal(excludes.IncludeGlobs(), want) {
+		t.Errorf("IncludeGlobs() = %v, want %v", excludes.IncludeGlobs(), want)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"internal/core/README.md", false},
+		{"cmd/main.go", false},
+		{"docs/intro.md", true},
+		{"package-lock.json", true},
+		{"internal/core/app_test.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := excludes.Match(tt.path); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if err := excludes.Include([]string{"../other/"}); err == nil {
+		t.Error("expected error for a pattern outside the repository")
+	}
+}
@@ -0,0 +1,61 @@
+package diff
+
+import "strings"
+
+// Filter keeps the file sections of a git diff whose path passes keep. Files are matched by their new path, deleted
+// files by their old one. Text before the first file section is dropped.
+func Filter(text string, keep func(path string) bool) (string, error) {
+	var sb strings.Builder
+	var section strings.Builder
+	flush := func() error {
+		if section.Len() == 0 {
+			return nil
+		}
+		defer section.Reset()
+		parsed, err := Parse(section.String())
+		if err != nil {
+			return err
+		}
+		if len(parsed.Files) == 0 {
+			return nil
+		}
+		file := parsed.Files[0]
+		p := file.NewPath
+		if p == "" || p == "/dev/null" {
+			p = file.OldPath
+		}
+		if p == "" {
+			// binary and rename-only sections carry the paths in the diff --git line only
+			p = gitHeaderPath(section.String())
+		}
+		if keep(p) {
+			sb.WriteString(section.String())
+		}
+		return nil
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			if err := flush(); err != nil {
+				return "", err
+			}
+		}
+		if section.Len() > 0 || strings.HasPrefix(line, "diff --git ") {
+			section.WriteString(line)
+		}
+	}
+	if err := flush(); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// gitHeaderPath returns the new path of a diff --git a/<old> b/<new> line. Paths with " b/" in them are ambiguous,
+// the last occurrence is taken.
+func gitHeaderPath(section string) string {
+	header, _, _ := strings.Cut(section, "\n")
+	if i := strings.LastIndex(header, " b/"); i >= 0 {
+		return header[i+len(" b/"):]
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	text := "diff --git a/svc/a.go b/svc/a.go\n--- a/svc/a.go\n+++ b/svc/a.go\n@@ -1 +1 @@\n-a\n+b\n" +
+		"diff --git a/docs/x.md b/docs/x.md\n--- a/docs/x.md\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n" +
+		"diff --git a/svc/logo.png b/svc/logo.png\nBinary files a/svc/logo.png and b/svc/logo.png differ\n"
+
+	got, err := Filter(text, func(p string) bool { return strings.HasPrefix(p, "svc/") })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(got, "docs/x.md") {
+		t.Errorf("deleted file outside the filter kept:\n%s", got)
+	}
+	if !strings.Contains(got, "+++ b/svc/a.go\n@@ -1 +1 @@\n-a\n+b\n") || !strings.HasSuffix(got, "Binary files a/svc/logo.png and b/svc/logo.png differ\n") {
+		t.Errorf("kept files are incomplete:\n%s", got)
+	}
+
+	all, err := Filter(text, func(string) bool { return true })
+	if err != nil || all != text {
+		t.Errorf("keeping everything changed the diff: %v\n%s", err, all)
+	}
+}
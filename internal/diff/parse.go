@@ -0,0 +1,209 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Diff is a parsed unified diff.
+type Diff struct {
+	Files []*FileDiff
+}
+
+// FileDiff holds the hunks of one file. OldPath or NewPath is /dev/null for added and deleted files. Added and Removed
+// count the changed lines of all hunks, Bytes is the size of the file's section of the diff text.
+type FileDiff struct {
+	OldPath        string
+	NewPath        string
+	Hunks          []*Hunk
+	Added, Removed int
+	Bytes          int
+}
+
+// Hunk is one @@ block. Added and Removed count the changed lines, context lines are not counted.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Added, Removed     int
+	Lines              []Line
+}
+
+// Line is one line of a hunk without its diff prefix. OldLine or NewLine is 0 on the side the line is missing from.
+type Line struct {
+	OldLine, NewLine int
+	Text             string
+}
+
+// Parse reads the output of git diff.
+func Parse(text string) (*Diff, error) {
+	d := &Diff{}
+	var file *FileDiff
+	var hunk *Hunk
+	var oldLine, newLine int
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file = &FileDiff{}
+			d.Files = append(d.Files, file)
+			hunk = nil
+		case file == nil:
+			continue
+		case hunk == nil && strings.HasPrefix(line, "--- "):
+			file.OldPath = stripPathPrefix(strings.TrimPrefix(line, "--- "), "a/")
+		case hunk == nil && strings.HasPrefix(line, "+++ "):
+			file.NewPath = stripPathPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+		case hunk == nil && strings.HasPrefix(line, "rename from "):
+			file.OldPath = strings.TrimPrefix(line, "rename from ")
+		case hunk == nil && strings.HasPrefix(line, "rename to "):
+			file.NewPath = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "@@ "):
+			parsed, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			hunk = parsed
+			oldLine, newLine = hunk.OldStart, hunk.NewStart
+			file.Hunks = append(file.Hunks, hunk)
+		case hunk != nil && strings.HasPrefix(line, "+"):
+			hunk.Added++
+			file.Added++
+			hunk.Lines = append(hunk.Lines, Line{NewLine: newLine, Text: line[1:]})
+			newLine++
+		case hunk != nil && strings.HasPrefix(line, "-"):
+			hunk.Removed++
+			file.Removed++
+			hunk.Lines = append(hunk.Lines, Line{OldLine: oldLine, Text: line[1:]})
+			oldLine++
+		case hunk != nil && strings.HasPrefix(line, " "):
+			hunk.Lines = append(hunk.Lines, Line{OldLine: oldLine, NewLine: newLine, Text: line[1:]})
+			oldLine++
+			newLine++
+		}
+		if file != nil {
+			file.Bytes += len(line) + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read diff: %w", err)
+	}
+	return d, nil
+}
+
+func parseHunkHeader(line string) (*Hunk, error) {
+	m := hunkHeaderRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	atoi := func(s string, def int) int {
+		if s == "" {
+			return def
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	return &Hunk{
+		OldStart: atoi(m[1], 0),
+		OldLines: atoi(m[2], 1),
+		NewStart: atoi(m[3], 0),
+		NewLines: atoi(m[4], 1),
+	}, nil
+}
+
+func stripPathPrefix(p, prefix string) string {
+	if p == "/dev/null" {
+		return p
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+// File returns the diff of the file with the given old or new path.
+func (d *Diff) File(path string) *FileDiff {
+	path = strings.TrimPrefix(path, "./")
+	for _, f := range d.Files {
+		if f.NewPath == path || f.OldPath == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// Path is the new path of the file, or the old one when the file was deleted.
+func (f *FileDiff) Path() string {
+	if f.NewPath == "" || f.NewPath == "/dev/null" {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+// HunkAt returns the hunk covering the new line or, when that is nil, the old line.
+func (f *FileDiff) HunkAt(newLine, oldLine *int64) *Hunk {
+	for _, h := range f.Hunks {
+		if newLine != nil && h.containsNew(int(*newLine)) {
+			return h
+		}
+		if newLine == nil && oldLine != nil && h.containsOld(int(*oldLine)) {
+			return h
+		}
+	}
+	return nil
+}
+
+// LineText returns the text of the new line or, when that is nil, the old line, if the diff shows it.
+func (f *FileDiff) LineText(newLine, oldLine *int64) (string, bool) {
+	l, ok := f.Line(newLine, oldLine)
+	return l.Text, ok
+}
+
+// Line returns the new line or, when that is nil, the old line, if the diff shows it.
+func (f *FileDiff) Line(newLine, oldLine *int64) (Line, bool) {
+	for _, h := range f.Hunks {
+		for _, l := range h.Lines {
+			if newLine != nil && l.NewLine == int(*newLine) {
+				return l, true
+			}
+			if newLine == nil && oldLine != nil && l.OldLine == int(*oldLine) {
+				return l, true
+			}
+		}
+	}
+	return Line{}, false
+}
+
+// Changed is the number of added and removed lines in the hunk.
+func (h *Hunk) Changed() int {
+	return h.Added + h.Removed
+}
+
+// String renders the hunk back in unified diff format, with its header and without a trailing newline.
+func (h *Hunk) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+	for _, l := range h.Lines {
+		prefix := " "
+		switch {
+		case l.OldLine == 0:
+			prefix = "+"
+		case l.NewLine == 0:
+			prefix = "-"
+		}
+		sb.WriteString("\n" + prefix + l.Text)
+	}
+	return sb.String()
+}
+
+func (h *Hunk) containsNew(line int) bool {
+	return line >= h.NewStart && line < h.NewStart+h.NewLines
+}
+
+func (h *Hunk) containsOld(line int) bool {
+	return line >= h.OldStart && line < h.OldStart+h.OldLines
+}
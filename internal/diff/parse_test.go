@@ -0,0 +1,167 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+const sampleDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+ package main
+-var a = 1
++var a = 2
+ 
+@@ -10,2 +10,5 @@ func f() {
+ func f() {
++	x := 1
++	y := 2
++	z := 3
+ }
+diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+diff --git a/gone.go b/gone.go
+deleted file mode 100644
+--- a/gone.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+--- not a header
+-package gone
+diff --git a/single.go b/single.go
+--- a/single.go
++++ b/single.go
+@@ -5 +5 @@
+-x
++y
+`
+
+func TestParse(t *testing.T) {
+	d, err := Parse(sampleDiff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(d.Files) != 4 {
+		t.Fatalf("expected 4 files, got %d", len(d.Files))
+	}
+
+	main := d.File("main.go")
+	if main == nil || len(main.Hunks) != 2 {
+		t.Fatalf("expected main.go with 2 hunks, got %+v", main)
+	}
+	first, second := main.Hunks[0], main.Hunks[1]
+	if first.OldStart != 1 || first.OldLines != 4 || first.NewStart != 1 || first.NewLines != 4 || first.Changed() != 2 {
+		t.Errorf("unexpected first hunk: %+v", first)
+	}
+	if second.NewStart != 10 || second.NewLines != 5 || second.Added != 3 || second.Removed != 0 {
+		t.Errorf("unexpected second hunk: %+v", second)
+	}
+	if main.Added != 4 || main.Removed != 1 {
+		t.Errorf("file stats = +%d -%d, want +4 -1", main.Added, main.Removed)
+	}
+
+	renamed := d.File("old.go")
+	if renamed == nil || renamed.NewPath != "new.go" || d.File("new.go") != renamed {
+		t.Errorf("expected rename old.go -> new.go, got %+v", renamed)
+	}
+
+	gone := d.File("gone.go")
+	if gone == nil || gone.NewPath != "/dev/null" || gone.Hunks[0].Removed != 2 {
+		t.Errorf("unexpected deleted file: %+v", gone)
+	}
+	if gone.Path() != "gone.go" || main.Path() != "main.go" {
+		t.Errorf("Path() = %q and %q, want gone.go and main.go", gone.Path(), main.Path())
+	}
+
+	single := d.File("./single.go")
+	if single == nil || single.Hunks[0].OldLines != 1 || single.Hunks[0].NewLines != 1 {
+		t.Errorf("expected omitted counts to default to 1, got %+v", single)
+	}
+
+	if d.File("missing.go") != nil {
+		t.Error("expected nil for file outside the diff")
+	}
+
+	total := 0
+	for _, f := range d.Files {
+		total += f.Bytes
+	}
+	if total != len(sampleDiff) || single.Bytes != len("diff --git a/single.go b/single.go\n--- a/single.go\n+++ b/single.go\n@@ -5 +5 @@\n-x\n+y\n") {
+		t.Errorf("file sizes add up to %d bytes, want %d, single.go has %d", total, len(sampleDiff), single.Bytes)
+	}
+}
+
+func TestParse_InvalidHunkHeader(t *testing.T) {
+	if _, err := Parse("diff --git a/x b/x\n@@ broken @@\n"); err == nil {
+		t.Error("expected error for invalid hunk header")
+	}
+}
+
+func TestFileDiff_HunkAt(t *testing.T) {
+	d, err := Parse(sampleDiff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	main := d.File("main.go")
+
+	if h := main.HunkAt(util.Ptr(int64(12)), nil); h != main.Hunks[1] {
+		t.Error("expected new line 12 in second hunk")
+	}
+	if h := main.HunkAt(nil, util.Ptr(int64(2))); h != main.Hunks[0] {
+		t.Error("expected old line 2 in first hunk")
+	}
+	if h := main.HunkAt(util.Ptr(int64(7)), nil); h != nil {
+		t.Error("expected no hunk between hunks")
+	}
+	if h := main.HunkAt(nil, nil); h != nil {
+		t.Error("expected no hunk without lines")
+	}
+}
+
+func TestHunk_String(t *testing.T) {
+	d, err := Parse(sampleDiff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "@@ -1,4 +1,4 @@\n package main\n-var a = 1\n+var a = 2\n "
+	if got := d.File("main.go").Hunks[0].String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := d.File("single.go").Hunks[0].String(); got != "@@ -5,1 +5,1 @@\n-x\n+y" {
+		t.Errorf("String() = %q, want the counts spelled out", got)
+	}
+}
+
+func TestFileDiff_LineText(t *testing.T) {
+	d, err := Parse(sampleDiff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	main := d.File("main.go")
+
+	tests := []struct {
+		name             string
+		newLine, oldLine *int64
+		want             string
+		wantOK           bool
+	}{
+		{name: "added line", newLine: util.Ptr(int64(2)), want: "var a = 2", wantOK: true},
+		{name: "removed line", oldLine: util.Ptr(int64(2)), want: "var a = 1", wantOK: true},
+		{name: "context line by new number", newLine: util.Ptr(int64(10)), want: "func f() {", wantOK: true},
+		{name: "added line in second hunk", newLine: util.Ptr(int64(12)), want: "\ty := 2", wantOK: true},
+		{name: "line outside the diff", newLine: util.Ptr(int64(7))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := main.LineText(tt.newLine, tt.oldLine)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("LineText() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// Redactor replaces what configured patterns match in the lines of a diff's hunks with placeholders, so internal
+// hostnames, names or secrets do not reach a cloud model. File names and line numbers are left alone, the comments
+// have to point at the real files.
+type Redactor struct {
+	// matcher is all patterns in one alternation, so a placeholder is never matched by a later pattern
+	matcher *regexp.Regexp
+}
+
+// NewRedactor compiles the patterns, Go regular expressions. Without patterns it returns nil, which redacts nothing.
+func NewRedactor(patterns []string) (*Redactor, error) {
+	var parts []string
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		parts = append(parts, "(?:"+pattern+")")
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	return &Redactor{matcher: regexp.MustCompile(strings.Join(parts, "|"))}, nil
+}
+
+// Redaction maps the placeholders of one redacted diff back to the values they replaced.
+type Redaction struct {
+	placeholders map[string]string
+	restorer     *strings.Replacer
+}
+
+// Redact returns text with every match in its hunks replaced by a numbered placeholder, the same value always
+// getting the same one. A nil Redactor returns text unchanged and a nil Redaction.
+func (r *Redactor) Redact(text string) (string, *Redaction) {
+	if r == nil {
+		return text, nil
+	}
+	redaction := &Redaction{placeholders: map[string]string{}}
+	lines := strings.SplitAfter(text, "\n")
+	inHunk := false
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			inHunk = false
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			// the text after the line numbers is the enclosing function or section, taken from the file
+			if end := strings.Index(line[2:], "@@"); end >= 0 {
+				end += 4
+				lines[i] = line[:end] + r.matcher.ReplaceAllStringFunc(line[end:], redaction.placeholder)
+			}
+		case inHunk && line != "" && strings.ContainsRune("+- ", rune(line[0])):
+			lines[i] = line[:1] + r.matcher.ReplaceAllStringFunc(line[1:], redaction.placeholder)
+		}
+	}
+
+	var pairs []string
+	for value, placeholder := range redaction.placeholders {
+		pairs = append(pairs, placeholder, value)
+	}
+	redaction.restorer = strings.NewReplacer(pairs...)
+	return strings.Join(lines, ""), redaction
+}
+
+func (r *Redaction) placeholder(value string) string {
+	if value == "" {
+		return value
+	}
+	placeholder, ok := r.placeholders[value]
+	if !ok {
+		placeholder = fmt.Sprintf("[REDACTED-%d]", len(r.placeholders)+1)
+		r.placeholders[value] = placeholder
+	}
+	return placeholder
+}
+
+// Count returns how many distinct values were redacted.
+func (r *Redaction) Count() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.placeholders)
+}
+
+// Restore puts the redacted values back in place of their placeholders.
+func (r *Redaction) Restore(text string) string {
+	if r.Count() == 0 {
+		return text
+	}
+	return r.restorer.Replace(text)
+}
+
+// RestoreComments restores the values in what the model wrote about the redacted diff, the comments are posted to
+// the repository the values come from. The quoted line content is restored as well to be compared with the real diff.
+func (r *Redaction) RestoreComments(comments []*api.InlineComment) {
+	if r.Count() == 0 {
+		return
+	}
+	for _, comment := range comments {
+		if comment == nil {
+			continue
+		}
+		if comment.Body != nil {
+			comment.Body = util.Ptr(r.Restore(*comment.Body))
+		}
+		if comment.Suggestion != nil {
+			comment.Suggestion = util.Ptr(r.Restore(*comment.Suggestion))
+		}
+		comment.LineContent = r.Restore(comment.LineContent)
+	}
+}
@@ -0,0 +1,81 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	const text = "diff --git a/deploy/db.internal.example.com.yaml b/deploy/db.internal.example.com.yaml\n" +
+		"--- a/deploy/db.internal.example.com.yaml\n" +
+		"+++ b/deploy/db.internal.example.com.yaml\n" +
+		"@@ -1,3 +1,3 @@ host: db.internal.example.com\n" +
+		" owner: jane.doe\n" +
+		"-host: db.internal.example.com\n" +
+		"+host: db2.internal.example.com # db.internal.example.com is retired\n" +
+		"--- token: sk-12345\n"
+
+	redactor, err := NewRedactor([]string{`[a-z0-9]+\.internal\.example\.com`, `jane\.doe`, `sk-[0-9]+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	redacted, redaction := redactor.Redact(text)
+
+	want := "diff --git a/deploy/db.internal.example.com.yaml b/deploy/db.internal.example.com.yaml\n" +
+		"--- a/deploy/db.internal.example.com.yaml\n" +
+		"+++ b/deploy/db.internal.example.com.yaml\n" +
+		"@@ -1,3 +1,3 @@ host: [REDACTED-1]\n" +
+		" owner: [REDACTED-2]\n" +
+		"-host: [REDACTED-1]\n" +
+		"+host: [REDACTED-3] # [REDACTED-1] is retired\n" +
+		"--- token: [REDACTED-4]\n"
+	if redacted != want {
+		t.Errorf("Redact() =\n%s\nwant\n%s", redacted, want)
+	}
+	if redaction.Count() != 4 {
+		t.Errorf("Count() = %d, want 4", redaction.Count())
+	}
+	if got := redaction.Restore(redacted); got != text {
+		t.Errorf("Restore() =\n%s\nwant the original diff", got)
+	}
+}
+
+func TestRedactor_Nil(t *testing.T) {
+	redactor, err := NewRedactor(nil)
+	if err != nil || redactor != nil {
+		t.Fatalf("NewRedactor(nil) = %v, %v, want nil", redactor, err)
+	}
+	text, redaction := redactor.Redact("@@ -1 +1 @@\n+secret\n")
+	if text != "@@ -1 +1 @@\n+secret\n" || redaction.Count() != 0 || redaction.Restore("[REDACTED-1]") != "[REDACTED-1]" {
+		t.Errorf("nil redactor changed the text: %q", text)
+	}
+	redaction.RestoreComments([]*api.InlineComment{{Body: util.Ptr("body")}})
+}
+
+func TestNewRedactor_InvalidPattern(t *testing.T) {
+	_, err := NewRedactor([]string{`ok`, `(unclosed`})
+	if err == nil || !strings.Contains(err.Error(), `invalid redact pattern "(unclosed"`) {
+		t.Errorf("expected the invalid pattern in the error, got %v", err)
+	}
+}
+
+func TestRedaction_RestoreComments(t *testing.T) {
+	redactor, err := NewRedactor([]string{`db\.internal`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, redaction := redactor.Redact("@@ -1 +1 @@\n+host: db.internal\n")
+
+	comment := &api.InlineComment{
+		Body:        util.Ptr("[REDACTED-1] should come from config"),
+		Suggestion:  util.Ptr("host: ${DB_HOST} # was [REDACTED-1]"),
+		LineContent: "host: [REDACTED-1]",
+	}
+	redaction.RestoreComments([]*api.InlineComment{comment, nil})
+	if *comment.Body != "db.internal should come from config" || *comment.Suggestion != "host: ${DB_HOST} # was db.internal" || comment.LineContent != "host: db.internal" {
+		t.Errorf("comment not restored: %+v", comment)
+	}
+}
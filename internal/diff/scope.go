@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// DefaultContextLines is the number of context lines git diff shows around a change when not told otherwise.
+const DefaultContextLines = 3
+
+// Diff algorithms of git diff. DefaultAlgorithm is git's default, GitHub and GitLab render pull requests with it.
+const (
+	AlgorithmMyers     = "myers"
+	AlgorithmMinimal   = "minimal"
+	AlgorithmPatience  = "patience"
+	AlgorithmHistogram = "histogram"
+	DefaultAlgorithm   = AlgorithmMyers
+)
+
+// Scope narrows a review to a part of the repository. Exclude and Include hold normalized globs, see Excludes.Globs
+// and Excludes.IncludeGlobs.
+// ContextLines is the number of unchanged lines shown around each change, Algorithm the diff algorithm grouping
+// them into hunks, empty for DefaultAlgorithm. Commits narrows the review to the changes of these commits instead of
+// the whole range.
+type Scope struct {
+	SubPath      string
+	Exclude      []string
+	Include      []string
+	ContextLines int
+	Algorithm    string
+	Commits      []string
+}
+
+// NewScope validates and normalizes the sub path. An empty sub path means the whole repository.
+func NewScope(subPath string) (*Scope, error) {
+	subPath = strings.TrimSpace(subPath)
+	if subPath == "" {
+		return &Scope{}, nil
+	}
+	if path.IsAbs(subPath) {
+		return nil, fmt.Errorf("subpath %q must be relative to the repository root", subPath)
+	}
+	cleaned := path.Clean(subPath)
+	if cleaned == "." {
+		return &Scope{}, nil
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return nil, errors.New("subpath must not point outside the repository")
+	}
+	return &Scope{SubPath: cleaned}, nil
+}
+
+// Command returns the git diff invocation the reviewer should run for the scope, a git show of the commits when the
+// scope has them.
+func (s *Scope) Command(baseSha string) string {
+	cmd := "git diff"
+	if len(s.Commits) > 0 {
+		cmd = "git show --format="
+	}
+	if s.Context() != DefaultContextLines {
+		cmd += fmt.Sprintf(" -U%d", s.Context())
+	}
+	if s.Algorithm != "" && s.Algorithm != DefaultAlgorithm {
+		cmd += " --diff-algorithm=" + s.Algorithm
+	}
+	if s.SubPath != "" {
+		cmd += " --relative=" + s.SubPath
+	}
+	if len(s.Commits) > 0 {
+		cmd += " " + strings.Join(s.Commits, " ")
+	} else {
+		cmd += fmt.Sprintf(" %s..HEAD", baseSha)
+	}
+	if len(s.Exclude) == 0 && len(s.Include) == 0 {
+		return cmd
+	}
+	pathspecs := []string{cmd, "--"}
+	if len(s.Include) == 0 {
+		pathspecs = append(pathspecs, ".")
+	}
+	for _, glob := range s.Include {
+		pathspecs = append(pathspecs, fmt.Sprintf("':(top,glob)%s'", glob))
+	}
+	for _, glob := range s.Exclude {
+		pathspecs = append(pathspecs, fmt.Sprintf("':(top,exclude,glob)%s'", glob))
+	}
+	return strings.Join(pathspecs, " ")
+}
+
+// Context returns the number of context lines the diff shows, DefaultContextLines for a negative count, which
+// Config.Validate rejects. Zero shows the changed lines only.
+func (s *Scope) Context() int {
+	if s.ContextLines < 0 {
+		return DefaultContextLines
+	}
+	return s.ContextLines
+}
+
+// Contains reports whether the repository path lies under the sub path.
+func (s *Scope) Contains(p string) bool {
+	p = strings.TrimPrefix(p, "./")
+	return s.SubPath == "" || p == s.SubPath || strings.HasPrefix(p, s.SubPath+"/")
+}
+
+// ToRepoPath maps a path relative to the scope back to a path relative to the repository root. The path is always
+// taken as relative to the scope, agent output relative to the repository is dropped when it is parsed.
+func (s *Scope) ToRepoPath(p string) string {
+	if s.SubPath == "" || p == "" || p == "/dev/null" {
+		return p
+	}
+	return path.Join(s.SubPath, p)
+}
+
+// RestoreCommentPaths rewrites scope-relative comment paths so they resolve against the full repository.
+func (s *Scope) RestoreCommentPaths(comments []*api.InlineComment) {
+	if s.SubPath == "" {
+		return
+	}
+	for _, comment := range comments {
+		if comment == nil || comment.Position == nil {
+			continue
+		}
+		if comment.Position.NewPath != nil {
+			comment.Position.NewPath = util.Ptr(s.ToRepoPath(*comment.Position.NewPath))
+		}
+		if comment.Position.OldPath != nil {
+			comment.Position.OldPath = util.Ptr(s.ToRepoPath(*comment.Position.OldPath))
+		}
+	}
+}
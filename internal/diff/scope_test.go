@@ -0,0 +1,192 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestNewScope(t *testing.T) {
+	tests := []struct {
+		name        string
+		subPath     string
+		want        string
+		expectError bool
+	}{
+		{name: "empty", subPath: "", want: ""},
+		{name: "dot", subPath: ".", want: ""},
+		{name: "simple", subPath: "services/foo", want: "services/foo"},
+		{name: "trailing slash", subPath: "services/foo/", want: "services/foo"},
+		{name: "leading dot slash", subPath: "./services/foo", want: "services/foo"},
+		{name: "whitespace", subPath: "  services/foo  ", want: "services/foo"},
+		{name: "absolute", subPath: "/services/foo", expectError: true},
+		{name: "parent", subPath: "..", expectError: true},
+		{name: "escapes repo", subPath: "services/../../etc", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := NewScope(tt.subPath)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if scope.SubPath != tt.want {
+				t.Errorf("SubPath = %q, want %q", scope.SubPath, tt.want)
+			}
+		})
+	}
+}
+
+func TestScope_Command(t *testing.T) {
+	t.Run("whole repository", func(t *testing.T) {
+		scope := &Scope{ContextLines: DefaultContextLines}
+		if got := scope.Command("abc123"); got != "git diff abc123..HEAD" {
+			t.Errorf("Command() = %q", got)
+		}
+	})
+
+	t.Run("sub path", func(t *testing.T) {
+		scope := &Scope{SubPath: "services/foo", ContextLines: DefaultContextLines}
+		if got := scope.Command("abc123"); got != "git diff --relative=services/foo abc123..HEAD" {
+			t.Errorf("Command() = %q", got)
+		}
+	})
+
+	t.Run("excludes", func(t *testing.T) {
+		scope := &Scope{Exclude: []string{"**/vendor/**", "**/*.pb.go"}, ContextLines: DefaultContextLines}
+		want := "git diff abc123..HEAD -- . ':(top,exclude,glob)**/vendor/**' ':(top,exclude,glob)**/*.pb.go'"
+		if got := scope.Command("abc123"); got != want {
+			t.Errorf("Command() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("includes", func(t *testing.T) {
+		scope := &Scope{Exclude: []string{"**/vendor/**"}, Include: []string{"**/*.go", "docs/**"}, ContextLines: DefaultContextLines}
+		want := "git diff abc123..HEAD -- ':(top,glob)**/*.go' ':(top,glob)docs/**' ':(top,exclude,glob)**/vendor/**'"
+		if got := scope.Command("abc123"); got != want {
+			t.Errorf("Command() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("context lines", func(t *testing.T) {
+		scope := &Scope{SubPath: "services/foo", ContextLines: 10}
+		if got := scope.Command("abc123"); got != "git diff -U10 --relative=services/foo abc123..HEAD" {
+			t.Errorf("Command() = %q", got)
+		}
+		scope = &Scope{}
+		if got := scope.Command("abc123"); got != "git diff -U0 abc123..HEAD" {
+			t.Errorf("Command() = %q", got)
+		}
+	})
+
+	t.Run("commits", func(t *testing.T) {
+		scope := &Scope{SubPath: "services/foo", Exclude: []string{"**/vendor/**"}, ContextLines: DefaultContextLines, Commits: []string{"aaa111", "bbb222"}}
+		want := "git show --format= --relative=services/foo aaa111 bbb222 -- . ':(top,exclude,glob)**/vendor/**'"
+		if got := scope.Command("abc123"); got != want {
+			t.Errorf("Command() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("diff algorithm", func(t *testing.T) {
+		scope := &Scope{ContextLines: DefaultContextLines, Algorithm: AlgorithmHistogram}
+		if got := scope.Command("abc123"); got != "git diff --diff-algorithm=histogram abc123..HEAD" {
+			t.Errorf("Command() = %q", got)
+		}
+		scope.Algorithm = DefaultAlgorithm
+		if got := scope.Command("abc123"); got != "git diff abc123..HEAD" {
+			t.Errorf("Command() = %q", got)
+		}
+	})
+}
+
+func TestScope_ToRepoPath(t *testing.T) {
+	scope := &Scope{SubPath: "services/foo"}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"main.go", "services/foo/main.go"},
+		{"./main.go", "services/foo/main.go"},
+		{"pkg/a.go", "services/foo/pkg/a.go"},
+		{"services/foo/main.go", "services/foo/services/foo/main.go"},
+		{"", ""},
+		{"/dev/null", "/dev/null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := scope.ToRepoPath(tt.input); got != tt.expected {
+				t.Errorf("ToRepoPath(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("no sub path keeps path", func(t *testing.T) {
+		if got := (&Scope{}).ToRepoPath("main.go"); got != "main.go" {
+			t.Errorf("ToRepoPath() = %q, want %q", got, "main.go")
+		}
+	})
+}
+
+func TestScope_RestoreCommentPaths(t *testing.T) {
+	scope := &Scope{SubPath: "services/foo"}
+	comments := []*api.InlineComment{
+		nil,
+		{Body: util.Ptr("no position")},
+		{
+			Body: util.Ptr("test"),
+			Position: &api.InlineCommentPosition{
+				OldPath: util.Ptr("old.go"),
+				NewPath: util.Ptr("new.go"),
+			},
+		},
+		{
+			Body: util.Ptr("new file"),
+			Position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("added.go"),
+			},
+		},
+	}
+
+	scope.RestoreCommentPaths(comments)
+
+	if got := *comments[2].Position.OldPath; got != "services/foo/old.go" {
+		t.Errorf("OldPath = %q, want %q", got, "services/foo/old.go")
+	}
+	if got := *comments[2].Position.NewPath; got != "services/foo/new.go" {
+		t.Errorf("NewPath = %q, want %q", got, "services/foo/new.go")
+	}
+	if comments[3].Position.OldPath != nil {
+		t.Error("expected nil OldPath to stay nil")
+	}
+	if got := *comments[3].Position.NewPath; got != "services/foo/added.go" {
+		t.Errorf("NewPath = %q, want %q", got, "services/foo/added.go")
+	}
+}
+
+func TestScope_Contains(t *testing.T) {
+	scope := &Scope{SubPath: "services/foo"}
+	for p, want := range map[string]bool{
+		"services/foo":         true,
+		"services/foo/main.go": true,
+		"./services/foo/a.go":  true,
+		"services/foobar/a.go": false,
+		"main.go":              false,
+	} {
+		if got := scope.Contains(p); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", p, got, want)
+		}
+	}
+	if !(&Scope{}).Contains("anything.go") {
+		t.Error("expected the whole repository scope to contain every path")
+	}
+}
@@ -0,0 +1,119 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/http"
+)
+
+// cloneRetryDelay is the wait before the first clone retry, doubled for every further one.
+var cloneRetryDelay = 2 * time.Second
+
+// transientCloneMessages are failures git servers and proxies report as text when a large fetch is cut off.
+var transientCloneMessages = []string{
+	"early eof",
+	"rpc failed",
+	"unexpected eof",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+}
+
+// CloneError is returned by CloneRepoWithContext. Transient tells whether the last failure looked like a network
+// hiccup worth retrying, Err is the underlying go-git error.
+type CloneError struct {
+	Err       error
+	Transient bool
+	Attempts  int
+}
+
+func (e *CloneError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("error clone repo after %d attempts: %v", e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("error clone repo: %v", e.Err)
+}
+
+func (e *CloneError) Unwrap() error {
+	return e.Err
+}
+
+// isTransientCloneError separates network failures that may pass on retry from auth, not found and local errors
+// that will fail the same way again.
+func isTransientCloneError(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrRepositoryNotFound),
+		errors.Is(err, transport.ErrEmptyRemoteRepository),
+		errors.Is(err, transport.ErrInvalidAuthMethod):
+		return false
+	}
+
+	var httpErr *http.Err
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode() == 429 || httpErr.StatusCode() >= 500
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, m := range transientCloneMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearDir removes what a failed clone attempt left in path, keeping path itself.
+func clearDir(path string) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(path, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleepContext waits for d unless ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/http"
+)
+
+func TestIsTransientCloneError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "authentication", err: fmt.Errorf("%w: bad token", transport.ErrAuthenticationRequired), want: false},
+		{name: "authorization", err: transport.ErrAuthorizationFailed, want: false},
+		{name: "not found", err: transport.ErrRepositoryNotFound, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "server error", err: &http.Err{Status: 502}, want: true},
+		{name: "rate limited", err: &http.Err{Status: 429}, want: true},
+		{name: "bad request", err: &http.Err{Status: 400}, want: false},
+		{name: "unknown host", err: &net.OpError{Op: "dial", Err: &net.DNSError{IsNotFound: true}}, want: false},
+		{name: "dns timeout", err: &net.DNSError{IsTimeout: true}, want: true},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, want: true},
+		{name: "unexpected eof", err: fmt.Errorf("reading pack: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "early eof text", err: errors.New("fatal: early EOF"), want: true},
+		{name: "rpc failed text", err: errors.New("error: RPC failed; curl 18 transfer closed"), want: true},
+		{name: "local error", err: errors.New("target directory is not empty"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientCloneError(tt.err); got != tt.want {
+				t.Errorf("isTransientCloneError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitService_CloneRepoWithContext_Retries(t *testing.T) {
+	oldDelay := cloneRetryDelay
+	cloneRetryDelay = time.Millisecond
+	defer func() { cloneRetryDelay = oldDelay }()
+
+	tests := []struct {
+		name          string
+		status        int
+		retries       int
+		wantCalls     int
+		wantTransient bool
+		wantIs        error
+	}{
+		{name: "transient errors are retried", status: nethttp.StatusBadGateway, retries: 2, wantCalls: 3, wantTransient: true},
+		{name: "no retries by default", status: nethttp.StatusBadGateway, wantCalls: 1, wantTransient: true},
+		{name: "not found fails at once", status: nethttp.StatusNotFound, retries: 2, wantCalls: 1, wantIs: transport.ErrRepositoryNotFound},
+		{name: "auth fails at once", status: nethttp.StatusUnauthorized, retries: 2, wantCalls: 1, wantIs: transport.ErrAuthenticationRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+				calls++
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			path := t.TempDir()
+			svc := NewGitService(nil, WithCloneRetries(tt.retries))
+			err := svc.CloneRepoWithContext(context.Background(), path, server.URL+"/repo.git", "refs/heads/main")
+
+			var cloneErr *CloneError
+			if !errors.As(err, &cloneErr) {
+				t.Fatalf("expected *CloneError, got %v", err)
+			}
+			if calls != tt.wantCalls || cloneErr.Attempts != tt.wantCalls {
+				t.Errorf("calls = %d, attempts = %d, want %d", calls, cloneErr.Attempts, tt.wantCalls)
+			}
+			if cloneErr.Transient != tt.wantTransient {
+				t.Errorf("Transient = %v, want %v", cloneErr.Transient, tt.wantTransient)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("errors.Is(err, %v) = false, err: %v", tt.wantIs, err)
+			}
+		})
+	}
+}
+
+func TestClearDir(t *testing.T) {
+	path := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(path, ".git", "objects"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := clearDir(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected empty dir, got %v entries, err %v", len(entries), err)
+	}
+	if err := clearDir(filepath.Join(path, "missing")); err != nil {
+		t.Errorf("missing dir: unexpected error %v", err)
+	}
+}
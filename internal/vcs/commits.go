@@ -0,0 +1,113 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	fdiff "github.com/go-git/go-git/v6/plumbing/format/diff"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// ErrCommitNotInRange is returned when a commit to review is not one of the commits the pull request adds.
+var ErrCommitNotInRange = errors.New("commit is not in the pull request's history")
+
+// ResolveCommits resolves revs, full or abbreviated SHAs, to the commits they name in the repository at path. Each has
+// to be one of the commits the range adds: reachable from headSha but not from baseSha. The clone needs the history
+// between them.
+func (s *GitService) ResolveCommits(ctx context.Context, path, baseSha, headSha string, revs []string) ([]string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("error open repo: %w", err)
+	}
+	head, err := repo.CommitObject(plumbing.NewHash(headSha))
+	if err != nil {
+		return nil, fmt.Errorf("error read head commit %s: %w", headSha, err)
+	}
+	base, err := repo.CommitObject(plumbing.NewHash(baseSha))
+	if err != nil {
+		return nil, fmt.Errorf("error read base commit %s: %w", baseSha, err)
+	}
+
+	shas := make([]string, 0, len(revs))
+	for _, rev := range revs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hash, err := repo.ResolveRevision(plumbing.Revision(strings.TrimSpace(rev)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCommitNotInRange, rev)
+		}
+		commit, err := repo.CommitObject(*hash)
+		if err != nil {
+			return nil, fmt.Errorf("error read commit %s: %w", rev, err)
+		}
+		inHead, err := commit.IsAncestor(head)
+		if err != nil {
+			return nil, fmt.Errorf("error walk history of %s: %w", rev, err)
+		}
+		inBase, err := commit.IsAncestor(base)
+		if err != nil {
+			return nil, fmt.Errorf("error walk history of %s: %w", rev, err)
+		}
+		if !inHead || inBase {
+			return nil, fmt.Errorf("%w: %s", ErrCommitNotInRange, rev)
+		}
+		shas = append(shas, commit.Hash.String())
+	}
+	return shas, nil
+}
+
+// CommitsDiff returns the unified diffs of the commits against their first parents one after another, a file several
+// of them change appears once for each.
+func (s *GitService) CommitsDiff(ctx context.Context, path string, shas []string) (string, error) {
+	return s.ContextCommitsDiff(ctx, path, shas, fdiff.DefaultContextLines)
+}
+
+// ContextCommitsDiff is CommitsDiff with contextLines unchanged lines around each change.
+func (s *GitService) ContextCommitsDiff(ctx context.Context, path string, shas []string, contextLines int) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("error open repo: %w", err)
+	}
+	var sb strings.Builder
+	for _, sha := range shas {
+		commit, err := repo.CommitObject(plumbing.NewHash(sha))
+		if err != nil {
+			return "", fmt.Errorf("error read commit %s: %w", sha, err)
+		}
+		patch, err := commitPatch(ctx, commit)
+		if err != nil {
+			return "", fmt.Errorf("error diff commit %s: %w", sha, err)
+		}
+		text, err := encodePatch(patch, contextLines)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(text)
+	}
+	return sb.String(), nil
+}
+
+// commitPatch diffs a commit against its first parent, a root commit against the empty tree.
+func commitPatch(ctx context.Context, commit *object.Commit) (*object.Patch, error) {
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		return parent.PatchContext(ctx, commit)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, nil, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+	return changes.PatchContext(ctx)
+}
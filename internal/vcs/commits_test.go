@@ -0,0 +1,89 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+func TestGitService_ResolveCommits(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+	wt, _ := repo.Worktree()
+	commit := func(file, content string) string {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if _, err := wt.Add(file); err != nil {
+			t.Fatalf("failed to add file: %v", err)
+		}
+		hash, err := wt.Commit("change "+file, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		return hash.String()
+	}
+	root := commit("main.go", "package main\n")
+	base := commit("main.go", "package main\n\nvar a = 1\n")
+	first := commit("a.go", "package main\n\nvar b = 1\n")
+	second := commit("main.go", "package main\n\nvar a = 2\n")
+	head := commit("c.go", "package main\n")
+
+	svc := NewGitService(nil)
+	ctx := context.Background()
+
+	t.Run("full and abbreviated shas", func(t *testing.T) {
+		got, err := svc.ResolveCommits(ctx, dir, base, head, []string{second[:7], first})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || got[0] != second || got[1] != first {
+			t.Errorf("ResolveCommits() = %v, want [%s %s]", got, second, first)
+		}
+	})
+
+	for name, rev := range map[string]string{"base": base, "before the base": root, "unknown": "0000000000000000000000000000000000000001", "not a sha": "nope"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := svc.ResolveCommits(ctx, dir, base, head, []string{rev}); !errors.Is(err, ErrCommitNotInRange) {
+				t.Errorf("expected ErrCommitNotInRange, got %v", err)
+			}
+		})
+	}
+
+	t.Run("diff of the commits", func(t *testing.T) {
+		got, err := svc.CommitsDiff(ctx, dir, []string{first, second})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{"+++ b/a.go", "+var b = 1", "-var a = 1", "+var a = 2"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("diff lacks %q:\n%s", want, got)
+			}
+		}
+		if strings.Contains(got, "c.go") {
+			t.Errorf("diff has changes of other commits:\n%s", got)
+		}
+	})
+
+	t.Run("diff of the root commit", func(t *testing.T) {
+		got, err := svc.CommitsDiff(ctx, dir, []string{root})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(got, "+package main") {
+			t.Errorf("unexpected diff:\n%s", got)
+		}
+	})
+}
@@ -2,36 +2,364 @@ package vcs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
 	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
-	"github.com/go-git/go-git/v6/plumbing/transport/http"
+	fdiff "github.com/go-git/go-git/v6/plumbing/format/diff"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
 )
 
+var scpLikeUrlRegex = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// commitBranch is the local branch a commit cloned without its source branch is checked out on.
+const commitBranch = "refs/heads/gitex-review"
+
+// ErrTagNotFound is returned when a tag exists neither in the clone nor on its origin remote.
+var ErrTagNotFound = errors.New("tag not found")
+
+// ErrRefNotFound is returned, wrapped in *CloneError, when the branch to clone does not exist on the remote.
+var ErrRefNotFound = git.ErrRemoteRefNotFound
+
+var _ api.CommitCloner = (*GitService)(nil)
+var _ api.TagResolver = (*GitService)(nil)
+var _ api.CommitFetcher = (*GitService)(nil)
+var _ api.CommitSelector = (*GitService)(nil)
+var _ api.RepoIndexer = (*GitService)(nil)
+
 type GitService struct {
-	auth http.AuthMethod
+	auth         transport.AuthMethod
+	cloneRetries int
+	tags         plumbing.TagMode
+	depth        int
+}
+
+// Option customizes a GitService created by NewGitService.
+type Option func(*GitService)
+
+// WithCloneRetries retries a clone that failed with a transient network error up to n times, with backoff.
+func WithCloneRetries(n int) Option {
+	return func(s *GitService) {
+		s.cloneRetries = n
+	}
+}
+
+// WithCloneTags sets which tags clones fetch, plumbing.NoTags unless set. Fetching all of them is slow on repositories
+// with thousands of tags.
+func WithCloneTags(mode plumbing.TagMode) Option {
+	return func(s *GitService) {
+		s.tags = mode
+	}
+}
+
+// WithCloneDepth makes clones shallow, with only the last n commits of the cloned ref. 0 clones the full history.
+func WithCloneDepth(n int) Option {
+	return func(s *GitService) {
+		s.depth = n
+	}
 }
 
-func NewGitService(auth http.AuthMethod) *GitService {
-	return &GitService{
+// NewGitService creates a GitService cloning with auth, HTTP basic auth or SSH keys, which must match the scheme of
+// the repository URLs it is given.
+func NewGitService(auth transport.AuthMethod, opts ...Option) *GitService {
+	s := &GitService{
 		auth: auth,
+		tags: plumbing.NoTags,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *GitService) CloneRepo(path, repoUrl, ref string) error {
 	return s.CloneRepoWithContext(context.Background(), path, repoUrl, ref)
 }
 
+// CloneRepoWithContext clones ref of repoUrl into path. Failures are returned as *CloneError, transient ones are
+// retried first when the service was created WithCloneRetries.
 func (s *GitService) CloneRepoWithContext(ctx context.Context, path, repoUrl, ref string) error {
+	return s.withRetries(ctx, path, func() error {
+		_, err := git.PlainCloneContext(ctx, path, &git.CloneOptions{
+			URL:           repoUrl,
+			Auth:          s.auth,
+			ReferenceName: plumbing.ReferenceName(ref),
+			SingleBranch:  true,
+			Tags:          s.tags,
+			Depth:         s.depth,
+		})
+		return err
+	})
+}
+
+// CloneCommitWithContext fetches the commit sha of repoUrl into path and checks it out on a local branch, for pull
+// requests whose source branch is unknown or deleted. Servers that do not allow fetching commits by sha, unlike
+// GitHub and GitLab, only work when the commit is on one of their branches.
+func (s *GitService) CloneCommitWithContext(ctx context.Context, path, repoUrl, sha string) error {
+	return s.withRetries(ctx, path, func() error {
+		repo, err := git.PlainInit(path, false)
+		if err != nil {
+			return err
+		}
+		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{repoUrl}}); err != nil {
+			return err
+		}
+		fetch := func(refSpec string) error {
+			return repo.FetchContext(ctx, &git.FetchOptions{
+				RemoteName: git.DefaultRemoteName,
+				Auth:       s.auth,
+				RefSpecs:   []config.RefSpec{config.RefSpec(refSpec)},
+				Tags:       s.tags,
+				Depth:      s.depth,
+			})
+		}
+		err = fetch(sha + ":refs/remotes/origin/gitex-review")
+		if errors.Is(err, git.ErrExactSHA1NotSupported) {
+			// servers that only serve refs may still have the commit on one of their branches
+			err = fetch("+refs/heads/*:refs/remotes/origin/*")
+		}
+		if err != nil {
+			return err
+		}
+		return checkout(repo, &git.CheckoutOptions{Branch: commitBranch, Hash: plumbing.NewHash(sha), Create: true})
+	})
+}
 
-	_, err := git.PlainCloneContext(ctx, path, &git.CloneOptions{
-		URL:           repoUrl,
-		Auth:          s.auth,
-		ReferenceName: plumbing.ReferenceName(ref),
-		SingleBranch:  true,
+// CloneDefaultBranchWithContext clones the default branch of repoUrl into path and checks out the commit sha, which
+// has to be reachable from it, e.g. a pull request that was merged meanwhile. The clone is never shallow, the commit
+// may be anywhere in the history.
+func (s *GitService) CloneDefaultBranchWithContext(ctx context.Context, path, repoUrl, sha string) error {
+	return s.withRetries(ctx, path, func() error {
+		repo, err := git.PlainCloneContext(ctx, path, &git.CloneOptions{
+			URL:  repoUrl,
+			Auth: s.auth,
+			Tags: s.tags,
+		})
+		if err != nil {
+			return err
+		}
+		return checkout(repo, &git.CheckoutOptions{Hash: plumbing.NewHash(sha)})
 	})
+}
+
+// withRetries runs a clone attempt into path, retrying transient failures up to cloneRetries times. Failures are
+// returned as *CloneError.
+func (s *GitService) withRetries(ctx context.Context, path string, attemptClone func() error) error {
+	delay := cloneRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := attemptClone()
+		if err == nil {
+			return nil
+		}
+
+		cloneErr := &CloneError{Err: err, Transient: isTransientCloneError(err), Attempts: attempt}
+		if !cloneErr.Transient || attempt > s.cloneRetries || ctx.Err() != nil {
+			return cloneErr
+		}
+		// go-git leaves the partial repository behind and refuses to clone into a non-empty directory
+		if err := clearDir(path); err != nil {
+			return fmt.Errorf("error clean up failed clone: %w", err)
+		}
+		log.Printf("clone attempt %d failed, will retry in %s: %v", attempt, delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return cloneErr
+		}
+		delay *= 2
+	}
+}
+
+// ResolveTag returns the commit the tag points to in the repository at path, fetching the tag from origin when the
+// clone does not have it, e.g. a single branch clone the tag is not reachable from. Annotated tags are peeled.
+func (s *GitService) ResolveTag(ctx context.Context, path, tag string) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("error open repo: %w", err)
+	}
+	refName := plumbing.NewTagReferenceName(tag)
+	ref, err := repo.Reference(refName, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: git.DefaultRemoteName,
+			Auth:       s.auth,
+			RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", refName, refName))},
+			Tags:       plumbing.NoTags,
+		})
+		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			err = nil
+		}
+		if errors.Is(err, git.ErrRemoteRefNotFound) {
+			return "", fmt.Errorf("%w: %s", ErrTagNotFound, tag)
+		}
+		if err != nil {
+			return "", fmt.Errorf("error fetch tag %s: %w", tag, err)
+		}
+		ref, err = repo.Reference(refName, true)
+	}
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", fmt.Errorf("%w: %s", ErrTagNotFound, tag)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error read tag %s: %w", tag, err)
+	}
+
+	hash := ref.Hash()
+	if annotated, err := repo.TagObject(hash); err == nil {
+		commit, err := annotated.Commit()
+		if err != nil {
+			return "", fmt.Errorf("tag %s does not point to a commit: %w", tag, err)
+		}
+		hash = commit.Hash
+	}
+	return hash.String(), nil
+}
+
+// FetchCommitWithContext fetches the commit sha from origin into the repository at path unless it is there already,
+// e.g. the review base a shallow clone stops short of. It is fetched with the clone depth, from all branches on
+// servers that do not allow fetching commits by sha.
+func (s *GitService) FetchCommitWithContext(ctx context.Context, path, sha string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return fmt.Errorf("error open repo: %w", err)
+	}
+	if _, err := repo.CommitObject(plumbing.NewHash(sha)); err == nil {
+		return nil
+	}
+	fetch := func(refSpec string) error {
+		return repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: git.DefaultRemoteName,
+			Auth:       s.auth,
+			RefSpecs:   []config.RefSpec{config.RefSpec(refSpec)},
+			Tags:       plumbing.NoTags,
+			Depth:      s.depth,
+		})
+	}
+	err = fetch(sha + ":refs/remotes/origin/gitex-base")
+	if errors.Is(err, git.ErrExactSHA1NotSupported) {
+		err = fetch("+refs/heads/*:refs/remotes/origin/*")
+	}
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("error fetch commit %s: %w", sha, err)
+	}
+	return nil
+}
+
+func checkout(repo *git.Repository, opts *git.CheckoutOptions) error {
+	wt, err := repo.Worktree()
 	if err != nil {
-		return fmt.Errorf("error clone repo: %w", err)
+		return err
+	}
+	if err := wt.Checkout(opts); err != nil {
+		return fmt.Errorf("error checkout: %w", err)
 	}
 	return nil
 }
+
+// Diff returns the unified diff between two commits of the repository at path.
+func (s *GitService) Diff(ctx context.Context, path, baseSha, headSha string) (string, error) {
+	return s.ContextDiff(ctx, path, baseSha, headSha, fdiff.DefaultContextLines)
+}
+
+// ContextDiff is Diff with contextLines unchanged lines around each change.
+func (s *GitService) ContextDiff(ctx context.Context, path, baseSha, headSha string, contextLines int) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("error open repo: %w", err)
+	}
+	base, err := repo.CommitObject(plumbing.NewHash(baseSha))
+	if err != nil {
+		return "", fmt.Errorf("error read base commit %s: %w", baseSha, err)
+	}
+	head, err := repo.CommitObject(plumbing.NewHash(headSha))
+	if err != nil {
+		return "", fmt.Errorf("error read head commit %s: %w", headSha, err)
+	}
+	patch, err := base.PatchContext(ctx, head)
+	if err != nil {
+		return "", fmt.Errorf("error diff commits: %w", err)
+	}
+	return encodePatch(patch, contextLines)
+}
+
+// encodePatch renders patch as a unified diff with contextLines unchanged lines around each change.
+func encodePatch(patch *object.Patch, contextLines int) (string, error) {
+	var sb strings.Builder
+	if err := fdiff.NewUnifiedEncoder(&sb, contextLines).Encode(patch); err != nil {
+		return "", fmt.Errorf("error encode diff: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// GetLocalRepoInfo reads the origin remote and the checked out branch of the repository containing path.
+func (s *GitService) GetLocalRepoInfo(path string) (*api.LocalRepoInfo, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("error open repo: %w", err)
+	}
+
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return nil, fmt.Errorf("error read origin remote: %w", err)
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return nil, errors.New("origin remote has no url")
+	}
+	remoteUrl, err := NormalizeRemoteUrl(urls[0])
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("error read HEAD: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return nil, errors.New("HEAD is detached, check out a branch")
+	}
+
+	return &api.LocalRepoInfo{
+		RemoteUrl: remoteUrl,
+		Branch:    head.Name().Short(),
+	}, nil
+}
+
+// NormalizeRemoteUrl turns ssh and scp-like remotes into https urls without credentials or .git suffix,
+// so they can be handled the same way as web urls.
+func NormalizeRemoteUrl(remoteUrl string) (string, error) {
+	remoteUrl = strings.TrimSpace(remoteUrl)
+	if !strings.Contains(remoteUrl, "://") {
+		m := scpLikeUrlRegex.FindStringSubmatch(remoteUrl)
+		if m == nil {
+			return "", fmt.Errorf("unsupported remote url: %s", remoteUrl)
+		}
+		remoteUrl = "ssh://" + m[1] + "/" + strings.TrimPrefix(m[2], "/")
+	}
+
+	u, err := url.Parse(remoteUrl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse remote url: %w", err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("unsupported remote url: %s", remoteUrl)
+	}
+
+	host := u.Host
+	if u.Scheme != "http" && u.Scheme != "https" {
+		// ssh ports have nothing to do with the web port
+		host = u.Hostname()
+	}
+	scheme := "https"
+	if u.Scheme == "http" {
+		scheme = "http"
+	}
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	return scheme + "://" + host + "/" + path, nil
+}
@@ -0,0 +1,106 @@
+package vcs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// maxIndexedFileSize is the size above which a file is listed without reading its symbols, large files are rarely
+// hand written.
+const maxIndexedFileSize = 256 * 1024
+
+// maxFileSymbols caps the symbols listed for one file, so a single large file cannot take the whole index.
+const maxFileSymbols = 20
+
+// symbolPattern matches a top-level declaration starting a line in the common languages: Go funcs, methods and
+// types, Python defs and classes, JavaScript and TypeScript functions, classes and interfaces, Rust fns, structs,
+// enums and traits. The name is the first group.
+var symbolPattern = regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:pub(?:\([^)]*\))?\s+)?(?:abstract\s+)?(?:async\s+)?(?:func|type|class|def|fn|struct|enum|trait|interface|function)\s+(?:\([^)]*\)\s*)?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// RepoIndex lists the files of the head commit of the repository at path, one line each with the top-level symbols
+// declared in it, so a review knows what exists beyond the diff. Files skip reports are left out. Once the next line
+// would pass maxBytes the remaining files are only counted.
+func (s *GitService) RepoIndex(ctx context.Context, path string, maxBytes int, skip func(path string) bool) (string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", fmt.Errorf("error open repo: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("error read head: %w", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("error read head commit: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("error read head tree: %w", err)
+	}
+
+	var sb strings.Builder
+	left := 0
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skip != nil && skip(f.Name) {
+			return nil
+		}
+		if left > 0 {
+			left++
+			return nil
+		}
+		line := "- " + f.Name
+		if symbols := fileSymbols(f); len(symbols) > 0 {
+			line += ": " + strings.Join(symbols, ", ")
+		}
+		line += "\n"
+		if sb.Len()+len(line) > maxBytes {
+			left++
+			return nil
+		}
+		sb.WriteString(line)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error index repo: %w", err)
+	}
+	if left > 0 {
+		_, _ = fmt.Fprintf(&sb, "- ... %d more files\n", left)
+	}
+	return sb.String(), nil
+}
+
+// fileSymbols returns the names of the top-level declarations of a text file, the first maxFileSymbols of them.
+func fileSymbols(f *object.File) []string {
+	if f.Size > maxIndexedFileSize {
+		return nil
+	}
+	if binary, err := f.IsBinary(); err != nil || binary {
+		return nil
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var symbols []string
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxIndexedFileSize)
+	for scanner.Scan() && len(symbols) < maxFileSymbols {
+		if m := symbolPattern.FindStringSubmatch(scanner.Text()); m != nil {
+			symbols = append(symbols, m[1])
+		}
+	}
+	return symbols
+}
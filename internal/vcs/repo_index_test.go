@@ -0,0 +1,77 @@
+package vcs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+func TestGitService_RepoIndex(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+	files := map[string]string{
+		"api/client.go":      "package api\n\ntype Client struct{}\n\nfunc NewClient() *Client { return nil }\n\nfunc (c *Client) Get() {}\n\tfunc nested() {}\n",
+		"scripts/release.py": "import os\n\nclass Release:\n    def run(self):\n        pass\n\ndef main():\n    pass\n",
+		"web/app.ts":         "export async function render() {}\nexport default class App {}\nexport interface Props {}\n",
+		"vendor/lib/lib.go":  "package lib\n\nfunc Vendored() {}\n",
+		"README.md":          "# Project\n",
+		"logo.png":           "\x89PNG\x00\x00",
+	}
+	wt, _ := repo.Worktree()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			t.Fatalf("failed to add file: %v", err)
+		}
+	}
+	if _, err := wt.Commit("init", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	// untracked files are not part of the index
+	_ = os.WriteFile(filepath.Join(dir, "build.log"), []byte("func Untracked()\n"), 0644)
+
+	s := NewGitService(nil)
+	skipVendor := func(p string) bool { return strings.HasPrefix(p, "vendor/") }
+
+	t.Run("lists files with their top-level symbols", func(t *testing.T) {
+		index, err := s.RepoIndex(context.Background(), dir, 4096, skipVendor)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "- README.md\n" +
+			"- api/client.go: Client, NewClient, Get\n" +
+			"- logo.png\n" +
+			"- scripts/release.py: Release, main\n" +
+			"- web/app.ts: render, App, Props\n"
+		if index != want {
+			t.Errorf("index =\n%s\nwant\n%s", index, want)
+		}
+	})
+
+	t.Run("counts the files past the limit", func(t *testing.T) {
+		index, err := s.RepoIndex(context.Background(), dir, 60, skipVendor)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "- README.md\n- api/client.go: Client, NewClient, Get\n- ... 3 more files\n"
+		if index != want {
+			t.Errorf("index =\n%s\nwant\n%s", index, want)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package vcs_provider
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// summaryModeChecklist posts all findings as a task list in one summary comment instead of inline threads.
+const summaryModeChecklist = "checklist"
+
+// blobURLFunc builds a link to lines start to end of path at sha, in the provider's blob URL format.
+type blobURLFunc func(webURL, sha, path string, start, end int64) string
+
+// renderChecklist lists every finding as a task linking to the commented lines. Lines that only exist before the
+// change link to the base commit, everything else to the head commit.
+func renderChecklist(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo, blobURL blobURLFunc) string {
+	var sb strings.Builder
+	sb.WriteString("### gitex review\n\n")
+	sb.WriteString(pullRequestInfo.ChangedFilesTable())
+
+	var items []string
+	for _, comment := range comments {
+		if comment == nil || comment.Position == nil {
+			continue
+		}
+		items = append(items, "- [ ] "+findingItem(comment, pullRequestInfo, blobURL))
+	}
+
+	headSha := pullRequestInfo.HeadSha
+	if len(headSha) > 8 {
+		headSha = headSha[:8]
+	}
+	if len(items) == 0 {
+		fmt.Fprintf(&sb, "Reviewed `%s`: no findings.", headSha)
+	} else {
+		fmt.Fprintf(&sb, "Reviewed `%s`: %d findings.\n\n", headSha, len(items))
+		sb.WriteString(strings.Join(items, "\n"))
+	}
+	return sb.String()
+}
+
+// findingItem renders a finding as a link to the commented lines followed by the first line of its body.
+func findingItem(comment *api.InlineComment, pullRequestInfo *api.PullRequestInfo, blobURL blobURLFunc) string {
+	pos := comment.Position
+	path := util.GetOrDefault(pos.NewPath, util.GetOrDefault(pos.OldPath, "unknown"))
+	start, end, old := commentedLines(pos)
+	sha := pullRequestInfo.HeadSha
+	if old {
+		path = util.GetOrDefault(pos.OldPath, path)
+		sha = pullRequestInfo.BaseSha
+	}
+
+	location := fmt.Sprintf("`%s:%d`", path, start)
+	if pullRequestInfo.ProjectWebUrl != "" && sha != "" {
+		location = fmt.Sprintf("[%s](%s)", location, blobURL(pullRequestInfo.ProjectWebUrl, sha, path, start, end))
+	}
+	title, _, _ := strings.Cut(strings.TrimSpace(util.GetOrDefault(comment.Body, "")), "\n")
+	return location + " " + title
+}
+
+// commentedLines returns the first and last line a comment covers and whether they are old lines.
+func commentedLines(pos *api.InlineCommentPosition) (start, end int64, old bool) {
+	if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.Start != nil && pos.LineRange.End != nil {
+		rs, re := pos.LineRange.Start, pos.LineRange.End
+		if rs.NewLine != nil && re.NewLine != nil && pos.LineType != "REMOVE" {
+			return *rs.NewLine, *re.NewLine, false
+		}
+		if rs.OldLine != nil && re.OldLine != nil {
+			return *rs.OldLine, *re.OldLine, true
+		}
+	}
+	if pos.NewLine != nil && pos.LineType != "REMOVE" {
+		return *pos.NewLine, *pos.NewLine, false
+	}
+	if pos.OldLine != nil {
+		return *pos.OldLine, *pos.OldLine, true
+	}
+	return 0, 0, false
+}
+
+func githubBlobURL(webURL, sha, path string, start, end int64) string {
+	anchor := fmt.Sprintf("#L%d", start)
+	if end > start {
+		anchor += fmt.Sprintf("-L%d", end)
+	}
+	return fmt.Sprintf("%s/blob/%s/%s%s", strings.TrimRight(webURL, "/"), sha, escapePath(path), anchor)
+}
+
+func gitlabBlobURL(webURL, sha, path string, start, end int64) string {
+	anchor := fmt.Sprintf("#L%d", start)
+	if end > start {
+		anchor += fmt.Sprintf("-%d", end)
+	}
+	return fmt.Sprintf("%s/-/blob/%s/%s%s", strings.TrimRight(webURL, "/"), sha, escapePath(path), anchor)
+}
+
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
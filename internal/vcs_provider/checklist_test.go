@@ -0,0 +1,79 @@
+package vcs_provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestRenderChecklist(t *testing.T) {
+	prInfo := &api.PullRequestInfo{HeadSha: "head1234567890", BaseSha: "base123", ProjectWebUrl: "https://github.com/owner/repo"}
+
+	t.Run("no findings", func(t *testing.T) {
+		got := renderChecklist(nil, prInfo, githubBlobURL)
+		if !strings.Contains(got, "Reviewed `head1234`: no findings.") {
+			t.Errorf("unexpected checklist: %q", got)
+		}
+	})
+
+	t.Run("findings link to their lines", func(t *testing.T) {
+		comments := []*api.InlineComment{
+			nil,
+			{Body: util.Ptr("Nil check missing\nmore detail"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a b.go"), NewLine: util.Ptr(int64(7))}},
+			{Body: util.Ptr("Removed guard"), Position: &api.InlineCommentPosition{
+				OldPath: util.Ptr("old.go"), NewPath: util.Ptr("new.go"), LineType: "REMOVE", OldLine: util.Ptr(int64(3)),
+			}},
+			{Body: util.Ptr("Loop is quadratic"), Position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("c.go"), CommentType: "MULTI_LINE",
+				LineRange: &api.LineRangeOptions{
+					Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(10))},
+					End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(14))},
+				},
+			}},
+		}
+		got := renderChecklist(comments, prInfo, githubBlobURL)
+		for _, want := range []string{
+			"Reviewed `head1234`: 3 findings.",
+			"- [ ] [`a b.go:7`](https://github.com/owner/repo/blob/head1234567890/a%20b.go#L7) Nil check missing\n",
+			"- [ ] [`old.go:3`](https://github.com/owner/repo/blob/base123/old.go#L3) Removed guard",
+			"- [ ] [`c.go:10`](https://github.com/owner/repo/blob/head1234567890/c.go#L10-L14) Loop is quadratic",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("checklist missing %q:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("plain locations without a web url", func(t *testing.T) {
+		comments := []*api.InlineComment{{Body: util.Ptr("x"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1))}}}
+		got := renderChecklist(comments, &api.PullRequestInfo{HeadSha: "abc"}, githubBlobURL)
+		if !strings.Contains(got, "- [ ] `a.go:1` x") {
+			t.Errorf("unexpected checklist: %q", got)
+		}
+	})
+
+	t.Run("changed files table comes first", func(t *testing.T) {
+		info := &api.PullRequestInfo{HeadSha: "abc", ChangedFiles: []api.ChangedFile{{Path: "a.go", Added: 2}}}
+		got := renderChecklist(nil, info, githubBlobURL)
+		if !strings.HasPrefix(got, "### gitex review\n\n| File | Added | Removed |\n|---|---:|---:|\n| `a.go` | +2 | -0 |\n\nReviewed `abc`") {
+			t.Errorf("unexpected checklist: %q", got)
+		}
+	})
+}
+
+func TestGitlabBlobURL(t *testing.T) {
+	tests := []struct {
+		start, end int64
+		want       string
+	}{
+		{start: 4, end: 4, want: "https://gitlab.com/group/project/-/blob/abc/src/main.go#L4"},
+		{start: 4, end: 9, want: "https://gitlab.com/group/project/-/blob/abc/src/main.go#L4-9"},
+	}
+	for _, tt := range tests {
+		if got := gitlabBlobURL("https://gitlab.com/group/project/", "abc", "src/main.go", tt.start, tt.end); got != tt.want {
+			t.Errorf("gitlabBlobURL() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package vcs_provider
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v81/github"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// ErrUnauthorized marks failures caused by a rejected token. Every further request would fail the same way, so
+// posting stops on the first one regardless of fail-fast.
+var ErrUnauthorized = errors.New("vcs api key was rejected")
+
+// ErrPermissionDenied marks a comment rejected with 403: the token can read the pull request but not comment on it.
+// Every further comment would be rejected too, so posting stops on the first one like for ErrUnauthorized.
+var ErrPermissionDenied = errors.New("token lacks permission to comment on this PR")
+
+// ErrDiffTruncated is returned when the provider cut the pull request diff short, too many files or a file too large
+// to get a patch for. The caller has to compute the diff from a clone instead.
+var ErrDiffTruncated = errors.New("pull request diff is truncated")
+
+// SendError reports comments that could not be posted while the others were. Comments holds why each inline comment
+// failed, Failed also counts a failed summary of folded findings.
+type SendError struct {
+	Failed   int
+	Comments []*CommentError
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("failed to send %d comments", e.Failed)
+}
+
+// Unwrap returns the comment errors, so errors.Is and errors.As see through to the responses.
+func (e *SendError) Unwrap() []error {
+	errs := make([]error, len(e.Comments))
+	for i, commentErr := range e.Comments {
+		errs[i] = commentErr
+	}
+	return errs
+}
+
+// CommentError is an inline comment the provider did not accept. StatusCode is 0 when there was no response, Message
+// is the provider's explanation or the error itself.
+type CommentError struct {
+	Path       string
+	Line       int64
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func newCommentError(path string, line int64, err error) *CommentError {
+	return &CommentError{Path: path, Line: line, StatusCode: responseStatus(err), Message: responseMessage(err), Err: err}
+}
+
+func (e *CommentError) Error() string {
+	return fmt.Sprintf("failed to send comment on %s:%d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *CommentError) Unwrap() error {
+	return e.Err
+}
+
+// sortCommentErrors orders comment errors by file and line, they are collected in the order the requests finished.
+func sortCommentErrors(errs []*CommentError) {
+	slices.SortFunc(errs, func(a, b *CommentError) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), cmp.Compare(a.Line, b.Line))
+	})
+}
+
+// isAuthError reports whether err is a 401 or 403 response from any provider. Rate limit responses have their
+// own error types on GitHub and are retried before they get here.
+func isAuthError(err error) bool {
+	if isRateLimitError(err) {
+		return false
+	}
+	status := responseStatus(err)
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// commentAuthError wraps a failure to post a comment as ErrUnauthorized for a rejected token or ErrPermissionDenied
+// for a token that may not comment. It returns nil for any other error, including rate limit 403s.
+func commentAuthError(err error) error {
+	if isRateLimitError(err) {
+		return nil
+	}
+	switch responseStatus(err) {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	default:
+		return nil
+	}
+}
+
+// isRateLimitError reports whether err is a rate limit response. GitHub answers some of them with a plain 403 that
+// only its message tells apart from a permission problem.
+func isRateLimitError(err error) bool {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var ghErr *github.ErrorResponse
+	switch {
+	case errors.As(err, &rateErr), errors.As(err, &abuseErr):
+		return true
+	case responseStatus(err) == http.StatusTooManyRequests:
+		return true
+	case errors.As(err, &ghErr):
+		return strings.Contains(strings.ToLower(ghErr.Message), "rate limit")
+	default:
+		return false
+	}
+}
+
+// isNotFoundError reports whether err is a 404 response from any provider.
+func isNotFoundError(err error) bool {
+	return responseStatus(err) == http.StatusNotFound
+}
+
+// responseMessage is the message of a provider error response, with the fields GitHub rejected, or the error text when
+// there was no response.
+func responseMessage(err error) string {
+	var ghErr *github.ErrorResponse
+	var glErr *gitlab.ErrorResponse
+	var giteaErr *GiteaErrorResponse
+	switch {
+	case errors.As(err, &ghErr):
+		message := ghErr.Message
+		for _, e := range ghErr.Errors {
+			message += fmt.Sprintf("; %s.%s: %s", e.Resource, e.Field, cmp.Or(e.Message, e.Code))
+		}
+		return message
+	case errors.As(err, &giteaErr):
+		return giteaErr.Message
+	case errors.As(err, &glErr):
+		return glErr.Message
+	default:
+		return err.Error()
+	}
+}
+
+// errorResponse returns the response of a GitHub or GitLab error, nil when there was none.
+func errorResponse(err error) *http.Response {
+	var ghErr *github.ErrorResponse
+	var glErr *gitlab.ErrorResponse
+	switch {
+	case errors.As(err, &ghErr):
+		return ghErr.Response
+	case errors.As(err, &glErr):
+		return glErr.Response
+	default:
+		return nil
+	}
+}
+
+// responseStatus returns the HTTP status of an error response from any provider, 0 for any other error.
+func responseStatus(err error) int {
+	var ghErr *github.ErrorResponse
+	var glErr *gitlab.ErrorResponse
+	var giteaErr *GiteaErrorResponse
+	switch {
+	case errors.As(err, &ghErr) && ghErr.Response != nil:
+		return ghErr.Response.StatusCode
+	case errors.As(err, &giteaErr):
+		return giteaErr.StatusCode
+	case errors.As(err, &glErr) && glErr.Response != nil:
+		return glErr.Response.StatusCode
+	case errors.Is(err, gitlab.ErrNotFound):
+		// the GitLab client replaces 404 responses with a sentinel
+		return http.StatusNotFound
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,37 @@
+package vcs_provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+// splitFolded separates the comments that get a thread from the folded ones, which are only listed in a summary.
+func splitFolded(comments []*api.InlineComment) (threads, folded []*api.InlineComment) {
+	for _, comment := range comments {
+		if comment != nil && comment.Folded {
+			folded = append(folded, comment)
+			continue
+		}
+		threads = append(threads, comment)
+	}
+	return threads, folded
+}
+
+// renderFoldedSummary lists the folded findings, which were left out of the inline threads of their crowded files.
+func renderFoldedSummary(folded []*api.InlineComment, pullRequestInfo *api.PullRequestInfo, blobURL blobURLFunc) string {
+	var sb strings.Builder
+	sb.WriteString("### gitex review\n\n")
+	sb.WriteString(pullRequestInfo.ChangedFilesTable())
+	fmt.Fprintf(&sb, "%d more findings on files that already have the most comments:\n\n", len(folded))
+	items := make([]string, 0, len(folded))
+	for _, comment := range folded {
+		if comment.Position == nil {
+			continue
+		}
+		items = append(items, "- "+findingItem(comment, pullRequestInfo, blobURL))
+	}
+	sb.WriteString(strings.Join(items, "\n"))
+	return sb.String()
+}
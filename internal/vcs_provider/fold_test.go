@@ -0,0 +1,99 @@
+package vcs_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func foldTestComments() []*api.InlineComment {
+	comment := func(line int64, body string, folded bool) *api.InlineComment {
+		return &api.InlineComment{
+			Body:   util.Ptr(body),
+			Folded: folded,
+			Position: &api.InlineCommentPosition{
+				PositionType: util.Ptr("text"),
+				NewPath:      util.Ptr("main.go"),
+				OldPath:      util.Ptr("main.go"),
+				NewLine:      util.Ptr(line),
+				CommentType:  "SINGLE_LINE",
+				LineType:     "ADD",
+			},
+		}
+	}
+	return []*api.InlineComment{comment(3, "kept finding", false), comment(9, "folded finding\nDetails", true)}
+}
+
+func TestGitHubService_SendInlineComments_Folded(t *testing.T) {
+	var paths, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, fmt.Sprint(body["body"]))
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 1})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1, HeadSha: "abcdef1234567890"}
+	if err := svc.SendInlineComments(foldTestComments(), prInfo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantPaths := []string{"/api/v3/repos/owner/repo/pulls/1/comments", "/api/v3/repos/owner/repo/issues/1/comments"}
+	if strings.Join(paths, ",") != strings.Join(wantPaths, ",") {
+		t.Fatalf("paths = %v, want %v", paths, wantPaths)
+	}
+	if !strings.HasPrefix(bodies[0], "kept finding") {
+		t.Errorf("thread body = %q", bodies[0])
+	}
+	if !strings.Contains(bodies[1], "1 more findings") || !strings.Contains(bodies[1], "- `main.go:9` folded finding") {
+		t.Errorf("summary body = %q", bodies[1])
+	}
+}
+
+func TestGitLabService_SendInlineComments_Folded(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	var positioned, summaries []string
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Body     string          `json:"body"`
+			Position json.RawMessage `json:"position"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Position != nil {
+			positioned = append(positioned, body.Body)
+		} else {
+			summaries = append(summaries, body.Body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": "new", "notes": []}`)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	svc := &GitLabService{client: client}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1, HeadSha: "abcdef1234567890"}
+	if err := svc.SendInlineComments(foldTestComments(), prInfo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(positioned) != 1 || !strings.HasPrefix(positioned[0], "kept finding") {
+		t.Errorf("positioned discussions = %q, want the kept finding only", positioned)
+	}
+	if len(summaries) != 1 || !strings.Contains(summaries[0], "- `main.go:9` folded finding") {
+		t.Errorf("summary discussions = %q, want one listing the folded finding", summaries)
+	}
+}
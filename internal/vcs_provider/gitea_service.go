@@ -0,0 +1,399 @@
+package vcs_provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+// GiteaService talks to the REST API of Gitea and Forgejo, which share it. There is no client library in use, the
+// few endpoints gitex needs are called directly.
+type GiteaService struct {
+	client        *http.Client
+	apiURL        string
+	token         string
+	checklist     bool
+	singleComment bool
+	failFast      bool
+	apiTimeout    time.Duration
+}
+
+var _ api.RemoteGitService = (*GiteaService)(nil)
+var _ api.PullRequestCommenter = (*GiteaService)(nil)
+var _ api.BlobLinker = (*GiteaService)(nil)
+
+// GiteaErrorResponse is a failed Gitea API call.
+type GiteaErrorResponse struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *GiteaErrorResponse) Error() string {
+	return fmt.Sprintf("gitea api error %d: %s", e.StatusCode, e.Message)
+}
+
+type giteaUser struct {
+	Login string `json:"login"`
+}
+
+type giteaRepository struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	FullName string    `json:"full_name"`
+	CloneURL string    `json:"clone_url"`
+	SSHURL   string    `json:"ssh_url"`
+	HTMLURL  string    `json:"html_url"`
+	Owner    giteaUser `json:"owner"`
+}
+
+type giteaBranch struct {
+	Ref  string           `json:"ref"`
+	Sha  string           `json:"sha"`
+	Repo *giteaRepository `json:"repo"`
+}
+
+type giteaPullRequest struct {
+	Number    int64       `json:"number"`
+	Title     string      `json:"title"`
+	Body      string      `json:"body"`
+	Head      giteaBranch `json:"head"`
+	Base      giteaBranch `json:"base"`
+	MergeBase string      `json:"merge_base"`
+}
+
+// giteaReviewComment anchors a review comment on a line of the new file, or of the old one for removed lines. The
+// line that is not used stays 0.
+type giteaReviewComment struct {
+	Path        string `json:"path"`
+	Body        string `json:"body"`
+	NewPosition int64  `json:"new_position"`
+	OldPosition int64  `json:"old_position"`
+}
+
+type giteaReview struct {
+	CommitID string                `json:"commit_id,omitempty"`
+	Event    string                `json:"event"`
+	Body     string                `json:"body"`
+	Comments []*giteaReviewComment `json:"comments"`
+}
+
+// NewGiteaService creates the service for the instance at cfg.VcsRemoteUrl. Without it, the instance is taken from
+// the first pull request URL.
+func NewGiteaService(cfg *api.Config, opts ...Option) (*GiteaService, error) {
+	o := applyOptions(opts)
+	httpClient := o.httpClient
+	if httpClient == nil {
+		httpClient = retryingHTTPClient(cfg)
+	}
+	var apiURL string
+	if cfg.VcsRemoteUrl != "" {
+		u, err := url.Parse(cfg.VcsRemoteUrl)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid gitea url %q", cfg.VcsRemoteUrl)
+		}
+		apiURL = giteaAPIURL(u)
+	}
+	return &GiteaService{
+		client:        httpClient,
+		apiURL:        apiURL,
+		token:         cfg.VcsApiKey,
+		checklist:     cfg.SummaryMode == summaryModeChecklist || cfg.SingleCommentMode,
+		singleComment: cfg.SingleCommentMode,
+		failFast:      cfg.FailFast,
+		apiTimeout:    cfg.ApiTimeout,
+	}, nil
+}
+
+// giteaAPIURL is the API root of the instance at u, which may be served under a sub path.
+func giteaAPIURL(u *url.URL) string {
+	base := strings.TrimRight(u.Path, "/")
+	base = strings.TrimSuffix(base, "/api/v1")
+	return u.Scheme + "://" + u.Host + base + "/api/v1"
+}
+
+func (g *GiteaService) GetPullRequestInfo(pullRequestURL *string) (*api.PullRequestInfo, error) {
+	u, owner, repo, number, err := parseGiteaWebUrl(*pullRequestURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pull request URL: %w", err)
+	}
+	if g.apiURL == "" {
+		g.apiURL = giteaAPIURL(&url.URL{Scheme: u.Scheme, Host: u.Host})
+	}
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultInfoTimeout)
+	defer cancelFunc()
+
+	var pr giteaPullRequest
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/%s/pulls/%d", url.PathEscape(owner), url.PathEscape(repo), number), nil, &pr); err != nil {
+		return nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+	if pr.Head.Repo == nil || pr.Base.Repo == nil {
+		return nil, errors.New("failed to get pull request: the source or target repository is missing")
+	}
+
+	return &api.PullRequestInfo{
+		HeadSha:        pr.Head.Sha,
+		BaseSha:        pr.Base.Sha,
+		StartSha:       pr.MergeBase,
+		ProjectName:    pr.Base.Repo.Name,
+		ProjectHttpUrl: pr.Head.Repo.CloneURL,
+		ProjectSshUrl:  pr.Head.Repo.SSHURL,
+		ProjectWebUrl:  pr.Base.Repo.HTMLURL,
+		ProjectId:      pr.Base.Repo.ID,
+		ProjectPath:    pr.Base.Repo.FullName,
+		SourceBranch:   pr.Head.Ref,
+		TargetBranch:   pr.Base.Ref,
+		PullRequestId:  pr.Number,
+		Owner:          pr.Base.Repo.Owner.Login,
+		Title:          pr.Title,
+		Description:    pr.Body,
+		// mergeable is false both on conflicts and while Gitea still checks, so it cannot tell them apart
+	}, nil
+}
+
+// SendInlineComments posts each comment as a review of its own, so one rejected comment does not take the others
+// with it.
+func (g *GiteaService) SendInlineComments(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+	if g.checklist && g.singleComment {
+		return g.editSingleComment(pullRequestInfo, renderChecklist(comments, pullRequestInfo, giteaBlobURL))
+	}
+	if g.checklist {
+		return g.comment(pullRequestInfo, renderChecklist(comments, pullRequestInfo, giteaBlobURL), "review checklist")
+	}
+	comments, folded := splitFolded(comments)
+	var failed []*CommentError
+
+	for _, comment := range comments {
+		giteaComment := convertGiteaComment(comment)
+		if giteaComment == nil {
+			continue
+		}
+		giteaComment.Body = *withMarker(renderCommentBody(comment, githubSuggestionFence), commentMarker)
+		review := &giteaReview{
+			CommitID: util.GetOrDefault(comment.CommitID, pullRequestInfo.HeadSha),
+			Event:    "COMMENT",
+			Comments: []*giteaReviewComment{giteaComment},
+		}
+		ctx, cancel := requestContext(g.apiTimeout, defaultCommentTimeout)
+		err := g.do(ctx, http.MethodPost, g.pullPath(pullRequestInfo)+"/reviews", review, nil)
+		cancel()
+
+		if err != nil {
+			if authErr := commentAuthError(err); authErr != nil {
+				return authErr
+			}
+			line := giteaComment.NewPosition
+			if line == 0 {
+				line = giteaComment.OldPosition
+			}
+			log.Printf("failed to create comment on %s:%d: %v", giteaComment.Path, line, err)
+			commentErr := newCommentError(giteaComment.Path, line, err)
+			if g.failFast {
+				return commentErr
+			}
+			failed = append(failed, commentErr)
+		}
+	}
+	failedCount := len(failed)
+	if len(folded) > 0 {
+		if err := g.comment(pullRequestInfo, renderFoldedSummary(folded, pullRequestInfo, giteaBlobURL), "summary of folded findings"); err != nil {
+			if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrPermissionDenied) || g.failFast {
+				return err
+			}
+			log.Printf("%v", err)
+			failedCount++
+		}
+	}
+
+	if failedCount > 0 {
+		return &SendError{Failed: failedCount, Comments: failed}
+	}
+	return nil
+}
+
+// CommentOnPullRequest posts body in the pull request conversation.
+func (g *GiteaService) CommentOnPullRequest(pullRequestInfo *api.PullRequestInfo, body string) error {
+	return g.comment(pullRequestInfo, body, "pull request comment")
+}
+
+// comment posts body as a conversation comment, what names it in the error.
+func (g *GiteaService) comment(pullRequestInfo *api.PullRequestInfo, body, what string) error {
+	ctx, cancel := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancel()
+
+	// pull requests are issues on Gitea, their conversation is the issue's
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d/comments", url.PathEscape(pullRequestInfo.Owner), url.PathEscape(pullRequestInfo.ProjectName), pullRequestInfo.PullRequestId)
+	err := g.do(ctx, http.MethodPost, path, map[string]string{"body": *withMarker(util.Ptr(body), commentMarker)}, nil)
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to create %s: %w", what, err)
+	}
+	return nil
+}
+
+// editSingleComment edits the conversation comment an earlier run of single comment mode posted to body, or posts it
+// when there is none yet.
+func (g *GiteaService) editSingleComment(pullRequestInfo *api.PullRequestInfo, body string) error {
+	ctx, cancel := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancel()
+
+	var comments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	repoPath := fmt.Sprintf("/repos/%s/%s", url.PathEscape(pullRequestInfo.Owner), url.PathEscape(pullRequestInfo.ProjectName))
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("%s/issues/%d/comments", repoPath, pullRequestInfo.PullRequestId), nil, &comments); err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to list pull request comments: %w", err)
+	}
+	var id int64
+	for _, comment := range comments {
+		if strings.Contains(comment.Body, singleCommentMarker) {
+			id = comment.ID
+		}
+	}
+
+	body = *withMarker(util.Ptr(body), commentMarker, singleCommentMarker)
+	var err error
+	if id == 0 {
+		err = g.do(ctx, http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", repoPath, pullRequestInfo.PullRequestId), map[string]string{"body": body}, nil)
+	} else {
+		err = g.do(ctx, http.MethodPatch, fmt.Sprintf("%s/issues/comments/%d", repoPath, id), map[string]string{"body": body}, nil)
+	}
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to update review comment: %w", err)
+	}
+	return nil
+}
+
+func (g *GiteaService) pullPath(pullRequestInfo *api.PullRequestInfo) string {
+	return fmt.Sprintf("/repos/%s/%s/pulls/%d", url.PathEscape(pullRequestInfo.Owner), url.PathEscape(pullRequestInfo.ProjectName), pullRequestInfo.PullRequestId)
+}
+
+// do sends in as JSON to the API path and decodes the response into out when it is not nil. Error responses are
+// returned as *GiteaErrorResponse.
+func (g *GiteaService) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.apiURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if g.token != "" {
+		req.Header.Set("Authorization", "token "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return &GiteaErrorResponse{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// parseGiteaWebUrl splits https://host/owner/repo/pulls/N. The GitHub style /pull/N is accepted too.
+func parseGiteaWebUrl(webUrl string) (*url.URL, string, string, int64, error) {
+	u, err := url.Parse(webUrl)
+	if err != nil {
+		return nil, "", "", 0, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 || (parts[2] != "pulls" && parts[2] != "pull") {
+		return nil, "", "", 0, errors.New("failed to parse URL")
+	}
+	number, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, "", "", 0, fmt.Errorf("failed to parse pull request number: %w", err)
+	}
+	return u, parts[0], parts[1], number, nil
+}
+
+// convertGiteaComment anchors the comment on its last line, Gitea has no multi-line comments. Image comments have no
+// line to go on and are skipped.
+func convertGiteaComment(in *api.InlineComment) *giteaReviewComment {
+	if in == nil || in.Position == nil {
+		return nil
+	}
+	pos := in.Position
+	normalizeImagePosition(pos)
+	normalizeDeletedFilePosition(pos)
+	normalizePaths(pos)
+	if pos.IsImage() {
+		return nil
+	}
+
+	newLine, oldLine := pos.NewLine, pos.OldLine
+	if pos.CommentType == "MULTI_LINE" && pos.LineRange != nil && pos.LineRange.End != nil {
+		newLine, oldLine = pos.LineRange.End.NewLine, pos.LineRange.End.OldLine
+	}
+	out := &giteaReviewComment{Path: util.GetOrDefault(pos.NewPath, "")}
+	switch {
+	case newLine != nil && pos.LineType != "REMOVE":
+		out.NewPosition = *newLine
+	case oldLine != nil:
+		out.OldPosition = *oldLine
+		out.Path = util.GetOrDefault(pos.OldPath, out.Path)
+	case newLine != nil:
+		out.NewPosition = *newLine
+	default:
+		return nil
+	}
+	return out
+}
+
+func giteaBlobURL(webURL, sha, path string, start, end int64) string {
+	anchor := fmt.Sprintf("#L%d", start)
+	if end > start {
+		anchor += fmt.Sprintf("-L%d", end)
+	}
+	return fmt.Sprintf("%s/src/commit/%s/%s%s", strings.TrimRight(webURL, "/"), sha, escapePath(path), anchor)
+}
+
+// BlobURL links to lines start to end of path at sha, a single line when end is not after start.
+func (g *GiteaService) BlobURL(pullRequestInfo *api.PullRequestInfo, sha, path string, start, end int64) string {
+	return giteaBlobURL(pullRequestInfo.ProjectWebUrl, sha, path, start, end)
+}
@@ -0,0 +1,317 @@
+package vcs_provider
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestNewGiteaService(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		wantAPIURL  string
+		expectError bool
+	}{
+		{name: "no url", url: "", wantAPIURL: ""},
+		{name: "instance root", url: "https://git.example.com/", wantAPIURL: "https://git.example.com/api/v1"},
+		{name: "sub path", url: "https://example.com/git", wantAPIURL: "https://example.com/git/api/v1"},
+		{name: "api root", url: "https://git.example.com/api/v1", wantAPIURL: "https://git.example.com/api/v1"},
+		{name: "no host", url: "git.example.com", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := NewGiteaService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: tt.url})
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if svc.apiURL != tt.wantAPIURL {
+				t.Errorf("apiURL = %q, want %q", svc.apiURL, tt.wantAPIURL)
+			}
+		})
+	}
+}
+
+func TestParseGiteaWebUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		wantOwner   string
+		wantRepo    string
+		wantNumber  int64
+		expectError bool
+	}{
+		{name: "pulls path", url: "https://git.example.com/owner/repo/pulls/12", wantOwner: "owner", wantRepo: "repo", wantNumber: 12},
+		{name: "pull path", url: "https://git.example.com/owner/repo/pull/3/files", wantOwner: "owner", wantRepo: "repo", wantNumber: 3},
+		{name: "issue path", url: "https://git.example.com/owner/repo/issues/3", expectError: true},
+		{name: "bad number", url: "https://git.example.com/owner/repo/pulls/abc", expectError: true},
+		{name: "too short", url: "https://git.example.com/owner/repo", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, owner, repo, number, err := parseGiteaWebUrl(tt.url)
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if owner != tt.wantOwner || repo != tt.wantRepo || number != tt.wantNumber {
+				t.Errorf("got %s/%s#%d, want %s/%s#%d", owner, repo, number, tt.wantOwner, tt.wantRepo, tt.wantNumber)
+			}
+		})
+	}
+}
+
+func TestGiteaService_GetPullRequestInfo(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/owner/repo/pulls/12" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "not found"})
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"number":     12,
+			"title":      "Add feature",
+			"body":       "Details",
+			"merge_base": "base000",
+			"head": map[string]any{
+				"ref": "feature", "sha": "head123",
+				"repo": map[string]any{"clone_url": "https://git.example.com/fork/repo.git"},
+			},
+			"base": map[string]any{
+				"ref": "main", "sha": "base123",
+				"repo": map[string]any{
+					"id": 42, "name": "repo", "full_name": "owner/repo",
+					"html_url": "https://git.example.com/owner/repo", "owner": map[string]any{"login": "owner"},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGiteaService(&api.Config{VcsApiKey: "test-token"}, WithHTTPClient(server.Client()))
+	info, err := svc.GetPullRequestInfo(util.Ptr(server.URL + "/owner/repo/pulls/12"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth != "token test-token" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	want := api.PullRequestInfo{
+		HeadSha: "head123", BaseSha: "base123", StartSha: "base000",
+		ProjectName: "repo", ProjectHttpUrl: "https://git.example.com/fork/repo.git",
+		ProjectWebUrl: "https://git.example.com/owner/repo", ProjectId: 42, ProjectPath: "owner/repo",
+		SourceBranch: "feature", TargetBranch: "main", PullRequestId: 12, Owner: "owner",
+		Title: "Add feature", Description: "Details",
+	}
+	if !reflect.DeepEqual(*info, want) {
+		t.Errorf("info = %+v, want %+v", *info, want)
+	}
+
+	_, err = svc.GetPullRequestInfo(util.Ptr(server.URL + "/owner/repo/pulls/13"))
+	if !isNotFoundError(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestConvertGiteaComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		position *api.InlineCommentPosition
+		want     *giteaReviewComment
+	}{
+		{
+			name:     "added line",
+			position: &api.InlineCommentPosition{NewPath: util.Ptr("file.go"), NewLine: util.Ptr(int64(10)), LineType: "ADD"},
+			want:     &giteaReviewComment{Path: "file.go", NewPosition: 10},
+		},
+		{
+			name: "removed line",
+			position: &api.InlineCommentPosition{
+				OldPath: util.Ptr("old.go"), NewPath: util.Ptr("new.go"),
+				OldLine: util.Ptr(int64(7)), NewLine: util.Ptr(int64(8)), LineType: "REMOVE",
+			},
+			want: &giteaReviewComment{Path: "old.go", OldPosition: 7},
+		},
+		{
+			name:     "old line only",
+			position: &api.InlineCommentPosition{OldPath: util.Ptr("file.go"), NewPath: util.Ptr("file.go"), OldLine: util.Ptr(int64(4))},
+			want:     &giteaReviewComment{Path: "file.go", OldPosition: 4},
+		},
+		{
+			name: "multi-line uses the end line",
+			position: &api.InlineCommentPosition{
+				NewPath: util.Ptr("file.go"), NewLine: util.Ptr(int64(10)), CommentType: "MULTI_LINE",
+				LineRange: &api.LineRangeOptions{
+					Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(10))},
+					End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(14))},
+				},
+			},
+			want: &giteaReviewComment{Path: "file.go", NewPosition: 14},
+		},
+		{
+			name:     "no line",
+			position: &api.InlineCommentPosition{NewPath: util.Ptr("file.go")},
+			want:     nil,
+		},
+		{
+			name:     "no position",
+			position: nil,
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertGiteaComment(&api.InlineComment{Body: util.Ptr("body"), Position: tt.position})
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("expected nil, got %+v", got)
+				}
+				return
+			}
+			if got == nil || *got != *tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGiteaService_SendInlineComments(t *testing.T) {
+	var reviews []giteaReview
+	var issueComments int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/owner/repo/pulls/1/reviews":
+			var review giteaReview
+			_ = json.NewDecoder(r.Body).Decode(&review)
+			reviews = append(reviews, review)
+			if review.Comments[0].NewPosition == 999 {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_ = json.NewEncoder(w).Encode(map[string]string{"message": "line is not in the diff"})
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": len(reviews)})
+		case "/api/v1/repos/owner/repo/issues/1/comments":
+			issueComments++
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": 1})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	svc, _ := NewGiteaService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL}, WithHTTPClient(server.Client()))
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1, HeadSha: "head123"}
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("first"), CommitID: util.Ptr("abc123"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(3))}},
+		{Body: util.Ptr("second"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("b.go"), NewLine: util.Ptr(int64(999))}},
+		{Body: util.Ptr("folded"), Folded: true, Position: &api.InlineCommentPosition{NewPath: util.Ptr("c.go"), NewLine: util.Ptr(int64(5))}},
+	}
+
+	err := svc.SendInlineComments(comments, prInfo)
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.Failed != 1 {
+		t.Fatalf("expected one failed comment, got %v", err)
+	}
+	if len(reviews) != 2 {
+		t.Fatalf("reviews = %d, want 2", len(reviews))
+	}
+	first := reviews[0]
+	if first.CommitID != "abc123" || first.Event != "COMMENT" || len(first.Comments) != 1 {
+		t.Errorf("first review = %+v", first)
+	}
+	if c := first.Comments[0]; c.Path != "a.go" || c.NewPosition != 3 || c.Body != "first\n\n"+commentMarker {
+		t.Errorf("first comment = %+v", c)
+	}
+	if reviews[1].CommitID != "head123" {
+		t.Errorf("commit id = %q, want the head sha", reviews[1].CommitID)
+	}
+	if issueComments != 1 {
+		t.Errorf("issue comments = %d, want the folded summary", issueComments)
+	}
+}
+
+func TestGiteaService_SendInlineComments_SingleComment(t *testing.T) {
+	var requests []string
+	var edited map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/owner/repo/issues/1/comments":
+			_ = json.NewEncoder(w).Encode([]map[string]any{
+				{"id": 4, "body": "nice"},
+				{"id": 6, "body": "### gitex review\n\n" + commentMarker + "\n" + singleCommentMarker},
+			})
+		case "PATCH /api/v1/repos/owner/repo/issues/comments/6":
+			_ = json.NewDecoder(r.Body).Decode(&edited)
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": 6})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	svc, _ := NewGiteaService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, SingleCommentMode: true}, WithHTTPClient(server.Client()))
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1, HeadSha: "head123"}
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("first"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(3))}},
+	}
+	if err := svc.SendInlineComments(comments, prInfo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("requests = %v, want the comments listed and the last review edited", requests)
+	}
+	if body := edited["body"]; !strings.Contains(body, "a.go:3") || !strings.HasSuffix(body, commentMarker+"\n"+singleCommentMarker) {
+		t.Errorf("edited body = %q", body)
+	}
+}
+
+func TestGiteaService_SendInlineComments_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "token is required"})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGiteaService(&api.Config{VcsRemoteUrl: server.URL}, WithHTTPClient(server.Client()))
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1}
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("first"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(3))}},
+	}
+	if err := svc.SendInlineComments(comments, prInfo); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestGiteaBlobURL(t *testing.T) {
+	got := giteaBlobURL("https://git.example.com/owner/repo/", "abc", "dir/my file.go", 3, 5)
+	want := "https://git.example.com/owner/repo/src/commit/abc/dir/my%20file.go#L3-L5"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package vcs_provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/google/go-github/v81/github"
+)
+
+// githubCompareMaxFiles is the number of files the compare API returns at most, a comparison with that many files
+// may have more.
+const githubCompareMaxFiles = 300
+
+// emptyBlobSha is git's object id of an empty file.
+const emptyBlobSha = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+// binarySniffLength is how much of a file git reads to tell binary files, which have a NUL byte there, from text.
+const binarySniffLength = 8000
+
+// CompareDiff assembles the pull request diff from the compare API. The comparison uses the merge base like the
+// pull request view does, a queued pull request's merge queue commit is compared to the commit it merges onto. It
+// fails with ErrDiffTruncated when GitHub left files or patches out.
+func (g *GitHubService) CompareDiff(pullRequestInfo *api.PullRequestInfo) (string, error) {
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultInfoTimeout)
+	defer cancelFunc()
+
+	base, head := pullRequestInfo.BaseSha, pullRequestInfo.HeadSha
+	if pullRequestInfo.MergeQueueSha != "" {
+		base, head = pullRequestInfo.MergeQueueBaseSha, pullRequestInfo.MergeQueueSha
+	}
+	// files come with the first page only, a small page keeps the commit list short
+	comparison, _, err := g.client.Repositories.CompareCommits(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName,
+		base, head, &github.ListOptions{PerPage: 1})
+	if err != nil {
+		if isAuthError(err) {
+			return "", fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		}
+		return "", fmt.Errorf("failed to compare commits: %w", err)
+	}
+	if len(comparison.Files) >= githubCompareMaxFiles {
+		return "", fmt.Errorf("%w: %d files or more changed", ErrDiffTruncated, githubCompareMaxFiles)
+	}
+	return githubCompareDiff(comparison.Files, func(f *github.CommitFile) (bool, error) {
+		return g.isBinaryBlob(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, f.GetSHA())
+	})
+}
+
+// isBinaryBlob reports whether the blob sha of the repository is binary the way git tells it, by a NUL byte in its
+// start. Without a blob there is no content to be binary.
+func (g *GitHubService) isBinaryBlob(ctx context.Context, owner, repo, sha string) (bool, error) {
+	if sha == "" || sha == emptyBlobSha {
+		return false, nil
+	}
+	content, _, err := g.client.Git.GetBlobRaw(ctx, owner, repo, sha)
+	if err != nil {
+		return false, err
+	}
+	return bytes.IndexByte(content[:min(len(content), binarySniffLength)], 0) >= 0, nil
+}
+
+// githubCompareDiff renders compare API files as git diff output. GitHub only sends the hunks, the file headers are
+// rebuilt from the file status. isBinary tells the binary files among the changed files without a patch from empty
+// files and mode changes.
+func githubCompareDiff(files []*github.CommitFile, isBinary func(f *github.CommitFile) (bool, error)) (string, error) {
+	var sb strings.Builder
+	for _, f := range files {
+		newPath := f.GetFilename()
+		oldPath := newPath
+		if f.GetPreviousFilename() != "" {
+			oldPath = f.GetPreviousFilename()
+		}
+		patch := f.GetPatch()
+		if patch == "" && f.GetChanges() > 0 {
+			return "", fmt.Errorf("%w: no patch for %s", ErrDiffTruncated, newPath)
+		}
+
+		fromPath, toPath := "a/"+oldPath, "b/"+newPath
+		switch f.GetStatus() {
+		case "added":
+			fromPath = devNull
+		case "removed":
+			toPath = devNull
+		}
+
+		fmt.Fprintf(&sb, "diff --git a/%s b/%s\n", oldPath, newPath)
+		if oldPath != newPath {
+			fmt.Fprintf(&sb, "rename from %s\nrename to %s\n", oldPath, newPath)
+		}
+		if patch != "" {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n%s\n", fromPath, toPath, strings.TrimSuffix(patch, "\n"))
+			continue
+		}
+		if f.GetStatus() == "renamed" {
+			continue
+		}
+		// without a patch and changed lines the file is binary, empty or only changed its mode
+		binary, err := isBinary(f)
+		if err != nil {
+			return "", fmt.Errorf("%w: cannot tell whether %s is binary: %w", ErrDiffTruncated, newPath, err)
+		}
+		if binary {
+			fmt.Fprintf(&sb, "Binary files %s and %s differ\n", fromPath, toPath)
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,156 @@
+package vcs_provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/google/go-github/v81/github"
+)
+
+func TestGithubCompareDiff(t *testing.T) {
+	files := []*github.CommitFile{
+		{Filename: github.Ptr("main.go"), Status: github.Ptr("modified"), Changes: github.Ptr(2), Patch: github.Ptr("@@ -1,2 +1,2 @@\n package main\n-var a = 1\n+var a = 2")},
+		{Filename: github.Ptr("new.go"), Status: github.Ptr("added"), Changes: github.Ptr(1), Patch: github.Ptr("@@ -0,0 +1 @@\n+package new")},
+		{Filename: github.Ptr("gone.go"), Status: github.Ptr("removed"), Changes: github.Ptr(1), Patch: github.Ptr("@@ -1 +0,0 @@\n-package gone")},
+		{Filename: github.Ptr("b.go"), PreviousFilename: github.Ptr("a.go"), Status: github.Ptr("renamed")},
+		{Filename: github.Ptr("logo.png"), Status: github.Ptr("added"), SHA: github.Ptr("png")},
+		{Filename: github.Ptr("run.sh"), Status: github.Ptr("changed"), SHA: github.Ptr("script")},
+		{Filename: github.Ptr("empty.txt"), Status: github.Ptr("added"), SHA: github.Ptr(emptyBlobSha)},
+	}
+	isBinary := func(f *github.CommitFile) (bool, error) {
+		return f.GetSHA() == "png", nil
+	}
+	text, err := githubCompareDiff(files, isBinary)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n",
+		"--- /dev/null\n+++ b/new.go\n",
+		"--- a/gone.go\n+++ /dev/null\n",
+		"diff --git a/a.go b/b.go\nrename from a.go\nrename to b.go\ndiff --git",
+		"Binary files /dev/null and b/logo.png differ\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("diff missing %q:\n%s", want, text)
+		}
+	}
+
+	parsed, err := diff.Parse(text)
+	if err != nil {
+		t.Fatalf("assembled diff does not parse: %v", err)
+	}
+	if f := parsed.File("main.go"); f == nil || f.Hunks[0].Added != 1 || f.Hunks[0].Removed != 1 {
+		t.Errorf("unexpected main.go diff: %+v", f)
+	}
+	if f := parsed.File("gone.go"); f == nil || f.NewPath != "/dev/null" {
+		t.Errorf("unexpected gone.go diff: %+v", f)
+	}
+	for _, notBinary := range []string{"run.sh", "empty.txt"} {
+		if strings.Contains(text, "b/"+notBinary+" differ") {
+			t.Errorf("%s is marked binary:\n%s", notBinary, text)
+		}
+	}
+
+	_, err = githubCompareDiff([]*github.CommitFile{{Filename: github.Ptr("huge.go"), Status: github.Ptr("modified"), Changes: github.Ptr(5000)}}, isBinary)
+	if !errors.Is(err, ErrDiffTruncated) {
+		t.Errorf("expected ErrDiffTruncated for a missing patch, got %v", err)
+	}
+
+	_, err = githubCompareDiff([]*github.CommitFile{{Filename: github.Ptr("logo.png"), Status: github.Ptr("modified")}}, func(f *github.CommitFile) (bool, error) {
+		return false, errors.New("blob unavailable")
+	})
+	if !errors.Is(err, ErrDiffTruncated) {
+		t.Errorf("expected ErrDiffTruncated when the content cannot be read, got %v", err)
+	}
+}
+
+func TestGitHubService_CompareDiff(t *testing.T) {
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", BaseSha: "base", HeadSha: "head"}
+
+	t.Run("fetches the comparison", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v3/repos/owner/repo/compare/base...head" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"files": [{"filename": "main.go", "status": "modified", "changes": 1, "patch": "@@ -1 +1 @@\n-a\n+b"}]}`)
+		}))
+		defer server.Close()
+
+		svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+		text, err := svc.CompareDiff(prInfo)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(text, "diff --git a/main.go b/main.go\n") {
+			t.Errorf("unexpected diff: %q", text)
+		}
+	})
+
+	t.Run("reads files without a patch to tell binary ones", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v3/repos/owner/repo/compare/base...head":
+				_, _ = fmt.Fprint(w, `{"files": [{"filename": "logo.png", "status": "modified", "sha": "png"}, {"filename": "run.sh", "status": "modified", "sha": "script"}]}`)
+			case "/api/v3/repos/owner/repo/git/blobs/png":
+				_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+			case "/api/v3/repos/owner/repo/git/blobs/script":
+				_, _ = w.Write([]byte("#!/bin/sh\necho hi\n"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+		text, err := svc.CompareDiff(prInfo)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(text, "Binary files a/logo.png and b/logo.png differ\n") || strings.Contains(text, "b/run.sh differ") {
+			t.Errorf("unexpected diff: %q", text)
+		}
+	})
+
+	t.Run("merge queue commit", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v3/repos/owner/repo/compare/queue-base...queued" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"files": []}`)
+		}))
+		defer server.Close()
+
+		queued := *prInfo
+		queued.MergeQueueSha, queued.MergeQueueBaseSha = "queued", "queue-base"
+		svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+		if _, err := svc.CompareDiff(&queued); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("too many files", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			files := make([]map[string]any, githubCompareMaxFiles)
+			for i := range files {
+				files[i] = map[string]any{"filename": fmt.Sprintf("f%d.go", i), "status": "modified", "changes": 1, "patch": "@@ -1 +1 @@\n-a\n+b"}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"files": files})
+		}))
+		defer server.Close()
+
+		svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+		if _, err := svc.CompareDiff(prInfo); !errors.Is(err, ErrDiffTruncated) {
+			t.Errorf("expected ErrDiffTruncated, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package vcs_provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v81/github"
+)
+
+// githubMergeQueuePrefix is the branch prefix of the temporary merge commits GitHub tests queued pull requests with,
+// the full name is gh-readonly-queue/<base branch>/pr-<number>-<head sha>.
+const githubMergeQueuePrefix = "gh-readonly-queue/"
+
+// mergeQueueCandidate returns the merge commit a pull request waits in the merge queue with and the commit it was
+// merged onto, the base branch or the pull request ahead of it. Both are empty when the pull request is not queued.
+func (g *GitHubService) mergeQueueCandidate(ctx context.Context, owner, repo string, pr *github.PullRequest) (string, string, error) {
+	prefix := fmt.Sprintf("heads/%s%s/pr-%d-", githubMergeQueuePrefix, pr.Base.GetRef(), pr.GetNumber())
+	refs, _, err := g.client.Git.ListMatchingRefs(ctx, owner, repo, &github.ReferenceListOptions{Ref: prefix})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list merge queue branches: %w", err)
+	}
+	// a pull request queued again after a push gets a new branch, the one for the current head is the candidate
+	var sha string
+	for _, ref := range refs {
+		if strings.HasSuffix(ref.GetRef(), "-"+pr.Head.GetSHA()) {
+			sha = ref.GetObject().GetSHA()
+		}
+	}
+	if sha == "" {
+		return "", "", nil
+	}
+
+	commit, _, err := g.client.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get merge queue commit %s: %w", sha, err)
+	}
+	if len(commit.Parents) == 0 {
+		return "", "", fmt.Errorf("merge queue commit %s has no parent", sha)
+	}
+	return sha, commit.Parents[0].GetSHA(), nil
+}
@@ -0,0 +1,64 @@
+package vcs_provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestGitHubService_GetPullRequestInfo_MergeQueue(t *testing.T) {
+	newServer := func(refs string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v3/repos/owner/repo/pulls/7":
+				_, _ = fmt.Fprint(w, `{"number": 7,
+					"head": {"ref": "feature", "sha": "head", "repo": {"clone_url": "https://github.com/fork/repo.git"}},
+					"base": {"ref": "main", "sha": "base", "repo": {"name": "repo", "clone_url": "https://github.com/owner/repo.git", "owner": {"login": "owner"}}}}`)
+			case "/api/v3/repos/owner/repo/git/matching-refs/heads/gh-readonly-queue/main/pr-7-":
+				_, _ = fmt.Fprint(w, refs)
+			case "/api/v3/repos/owner/repo/git/commits/queued":
+				_, _ = fmt.Fprint(w, `{"sha": "queued", "parents": [{"sha": "queue-base"}, {"sha": "head"}]}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+	prURL := "https://github.com/owner/repo/pull/7"
+
+	tests := []struct {
+		name         string
+		refs         string
+		wantSha      string
+		wantBaseSha  string
+		wantCloneURL string
+	}{
+		{name: "queued", wantSha: "queued", wantBaseSha: "queue-base", wantCloneURL: "https://github.com/owner/repo.git",
+			refs: `[{"ref": "refs/heads/gh-readonly-queue/main/pr-7-old", "object": {"sha": "stale"}},
+				{"ref": "refs/heads/gh-readonly-queue/main/pr-7-head", "object": {"sha": "queued"}}]`},
+		{name: "not queued", refs: `[]`, wantCloneURL: "https://github.com/fork/repo.git"},
+		{name: "queued with an earlier head", refs: `[{"ref": "refs/heads/gh-readonly-queue/main/pr-7-old", "object": {"sha": "stale"}}]`,
+			wantCloneURL: "https://github.com/fork/repo.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newServer(tt.refs)
+			defer server.Close()
+
+			svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+			info, err := svc.GetPullRequestInfo(&prURL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if info.MergeQueueSha != tt.wantSha || info.MergeQueueBaseSha != tt.wantBaseSha {
+				t.Errorf("merge queue = %q onto %q, want %q onto %q", info.MergeQueueSha, info.MergeQueueBaseSha, tt.wantSha, tt.wantBaseSha)
+			}
+			if info.ProjectHttpUrl != tt.wantCloneURL {
+				t.Errorf("clone url = %q, want %q", info.ProjectHttpUrl, tt.wantCloneURL)
+			}
+		})
+	}
+}
@@ -13,21 +13,39 @@ import (
 	"github.com/eridan-ltu/gitex/api"
 	"github.com/eridan-ltu/gitex/internal/util"
 	"github.com/google/go-github/v81/github"
-	"github.com/hashicorp/go-retryablehttp"
 )
 
 type GitHubService struct {
-	client *github.Client
+	client             *github.Client
+	checklist          bool
+	singleComment      bool
+	failFast           bool
+	splitLongComments  bool
+	commentConcurrency int
+	commentRetries     int
+	retryWaitMin       time.Duration
+	retryWaitMax       time.Duration
+	apiTimeout         time.Duration
+	identity           string
 }
 
-func NewGitHubService(cfg *api.Config) (*GitHubService, error) {
-	retryClient := retryablehttp.NewClient()
-	retryClient.RetryMax = 3
-	retryClient.Logger = nil
-	retryClient.CheckRetry = RetryPolicy
-	retryClient.ErrorHandler = retryablehttp.PassthroughErrorHandler
+var _ api.ReactionTracker = (*GitHubService)(nil)
+var _ api.PullRequestFinder = (*GitHubService)(nil)
+var _ api.CommitStatusReporter = (*GitHubService)(nil)
+var _ api.IdentityResolver = (*GitHubService)(nil)
+var _ api.Labeler = (*GitHubService)(nil)
+var _ api.CompareDiffFetcher = (*GitHubService)(nil)
+var _ api.OwnerResolver = (*GitHubService)(nil)
+var _ api.ThreadTracker = (*GitHubService)(nil)
+var _ api.PullRequestCommenter = (*GitHubService)(nil)
+var _ api.BlobLinker = (*GitHubService)(nil)
 
-	httpClient := retryClient.StandardClient()
+func NewGitHubService(cfg *api.Config, opts ...Option) (*GitHubService, error) {
+	o := applyOptions(opts)
+	httpClient := o.httpClient
+	if httpClient == nil {
+		httpClient = retryingHTTPClient(cfg)
+	}
 
 	client := github.NewClient(httpClient).WithAuthToken(cfg.VcsApiKey)
 	if cfg.VcsRemoteUrl != "" {
@@ -38,8 +56,18 @@ func NewGitHubService(cfg *api.Config) (*GitHubService, error) {
 		}
 		client = enterpriseClient
 	}
+	waitMin, waitMax := retryWaits(cfg)
 	return &GitHubService{
-		client: client,
+		client:             client,
+		checklist:          cfg.SummaryMode == summaryModeChecklist || cfg.SingleCommentMode,
+		singleComment:      cfg.SingleCommentMode,
+		failFast:           cfg.FailFast,
+		splitLongComments:  cfg.SplitLongComments,
+		commentConcurrency: cfg.CommentConcurrency,
+		commentRetries:     cfg.CommentRetries,
+		retryWaitMin:       waitMin,
+		retryWaitMax:       waitMax,
+		apiTimeout:         cfg.ApiTimeout,
 	}, nil
 }
 
@@ -48,48 +76,317 @@ func (g *GitHubService) GetPullRequestInfo(pullRequestURL *string) (*api.PullReq
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse pull request URL: %w", err)
 	}
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 2*time.Minute)
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultInfoTimeout)
 	defer cancelFunc()
 
 	pr, _, err := g.client.PullRequests.Get(ctx, owner, repo, number)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get merge request: %w", err)
 	}
-	cloneUrl := pr.Head.Repo.GetCloneURL()
+	cloneUrl, sshUrl := pr.Head.Repo.GetCloneURL(), pr.Head.Repo.GetSSHURL()
 	projectName := pr.Base.Repo.GetName() // pr is created against base project
 
+	mergeQueueSha, mergeQueueBaseSha, err := g.mergeQueueCandidate(ctx, owner, repo, pr)
+	if err != nil {
+		log.Printf("reviewing the pull request head: %v", err)
+	}
+	if mergeQueueSha != "" {
+		// the merge queue branches live in the base repository, forks don't have them
+		cloneUrl, sshUrl = pr.Base.Repo.GetCloneURL(), pr.Base.Repo.GetSSHURL()
+	}
+
 	return &api.PullRequestInfo{
-		HeadSha:        pr.Head.GetSHA(),
-		BaseSha:        pr.Base.GetSHA(),
-		ProjectName:    projectName,
-		ProjectHttpUrl: cloneUrl,
-		ProjectId:      pr.Base.Repo.GetID(), //should not be used
-		SourceBranch:   pr.Head.GetRef(),
-		PullRequestId:  int64(pr.GetNumber()), //github accepts pr number instead of internal id
-		Owner:          pr.Base.Repo.GetOwner().GetLogin(),
+		HeadSha:           pr.Head.GetSHA(),
+		BaseSha:           pr.Base.GetSHA(),
+		ProjectName:       projectName,
+		ProjectHttpUrl:    cloneUrl,
+		ProjectSshUrl:     sshUrl,
+		ProjectWebUrl:     pr.Base.Repo.GetHTMLURL(),
+		ProjectId:         pr.Base.Repo.GetID(), //should not be used
+		SourceBranch:      pr.Head.GetRef(),
+		PullRequestId:     int64(pr.GetNumber()), //github accepts pr number instead of internal id
+		Owner:             pr.Base.Repo.GetOwner().GetLogin(),
+		Title:             pr.GetTitle(),
+		Description:       pr.GetBody(),
+		MergeStatus:       githubMergeStatus(pr),
+		MergeQueueSha:     mergeQueueSha,
+		MergeQueueBaseSha: mergeQueueBaseSha,
 	}, nil
 }
 
+// githubMergeStatus maps mergeable, which GitHub leaves null while a background job computes it after the pull
+// request or its base changed.
+func githubMergeStatus(pr *github.PullRequest) string {
+	switch {
+	case pr.Mergeable == nil || pr.GetMergeableState() == "unknown":
+		return api.MergeStatusChecking
+	case !pr.GetMergeable() || pr.GetMergeableState() == "dirty":
+		return api.MergeStatusConflict
+	default:
+		return api.MergeStatusClean
+	}
+}
+
 func (g *GitHubService) SendInlineComments(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
-	var failedCount int
+	if g.checklist {
+		return g.sendChecklist(comments, pullRequestInfo)
+	}
+	comments, folded := splitFolded(comments)
+
+	failed, err := sendConcurrently(comments, g.commentConcurrency, g.failFast, func(ctx context.Context, comment *api.InlineComment) *CommentError {
+		return sendWithRetry(ctx, comment, g.commentRetries, g.retryWaitMin, g.retryWaitMax, func(comment *api.InlineComment) *CommentError {
+			return g.sendInlineComment(comment, pullRequestInfo)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	failedCount := len(failed)
+	if len(folded) > 0 {
+		if err := g.sendFoldedSummary(folded, pullRequestInfo); err != nil {
+			if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrPermissionDenied) || g.failFast {
+				return err
+			}
+			log.Printf("%v", err)
+			failedCount++
+		}
+	}
+
+	if failedCount > 0 {
+		return &SendError{Failed: failedCount, Comments: failed}
+	}
+	return nil
+}
+
+// sendInlineComment posts one comment, with the rest of an over-long body as replies in its thread.
+func (g *GitHubService) sendInlineComment(comment *api.InlineComment, pullRequestInfo *api.PullRequestInfo) *CommentError {
+	githubComment := g.convertApiComment(comment)
+	if githubComment == nil {
+		return nil
+	}
+	chunks := g.commentChunks(renderCommentBody(comment, githubSuggestionFence))
+	githubComment.Body = withMarker(&chunks[0], commentMarker)
+	ctx, cancel := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancel()
+
+	created, _, err := g.client.PullRequests.CreateComment(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), githubComment)
+	if err == nil {
+		err = g.sendReplies(ctx, pullRequestInfo, created.GetID(), chunks[1:])
+	}
+	if err != nil {
+		path, line := util.GetOrDefault(githubComment.Path, "unknown"), int64(util.GetOrDefaultInt(githubComment.Line, 0))
+		if authErr := commentAuthError(err); authErr != nil {
+			return newCommentError(path, line, authErr)
+		}
+		g.logGithubError(githubComment, err)
+		return newCommentError(path, line, err)
+	}
+	return nil
+}
 
-	for _, comment := range comments {
-		githubComment := g.convertApiComment(comment)
-		if githubComment == nil {
-			continue
+// sendFoldedSummary lists the folded findings in one pull request conversation comment.
+func (g *GitHubService) sendFoldedSummary(folded []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+	ctx, cancel := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancel()
+
+	body := withMarker(util.Ptr(renderFoldedSummary(folded, pullRequestInfo, githubBlobURL)), commentMarker)
+	_, _, err := g.client.Issues.CreateComment(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), &github.IssueComment{
+		Body: body,
+	})
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to create summary of folded findings: %w", err)
+	}
+	return nil
+}
+
+// CommentOnPullRequest posts body in the pull request conversation.
+func (g *GitHubService) CommentOnPullRequest(pullRequestInfo *api.PullRequestInfo, body string) error {
+	ctx, cancel := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancel()
+
+	_, _, err := g.client.Issues.CreateComment(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), &github.IssueComment{
+		Body: withMarker(util.Ptr(body), commentMarker),
+	})
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		_, _, err := g.client.PullRequests.CreateComment(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), githubComment)
-		cancel()
+		return fmt.Errorf("failed to create pull request comment: %w", err)
+	}
+	return nil
+}
 
+// commentChunks splits an over-long body into the comment and its replies when enabled, otherwise it is sent whole.
+func (g *GitHubService) commentChunks(body *string) []string {
+	text := util.GetOrDefault(body, "")
+	if !g.splitLongComments {
+		return []string{text}
+	}
+	return splitCommentBody(text, githubMaxCommentLength-splitReserve)
+}
+
+// sendReplies posts the remaining chunks of a split comment as replies to it.
+func (g *GitHubService) sendReplies(ctx context.Context, pullRequestInfo *api.PullRequestInfo, commentID int64, chunks []string) error {
+	for _, chunk := range chunks {
+		_, _, err := g.client.PullRequests.CreateCommentInReplyTo(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), chunk, commentID)
 		if err != nil {
-			g.logGithubError(githubComment, err)
-			failedCount++
+			return fmt.Errorf("%w: %w", errReplyFailed, err)
 		}
 	}
+	return nil
+}
 
-	if failedCount > 0 {
-		return fmt.Errorf("failed to send %d comments", failedCount)
+// sendChecklist posts all findings as one pull request conversation comment and leaves no inline threads. In single
+// comment mode the comment an earlier run posted is edited instead.
+func (g *GitHubService) sendChecklist(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+	ctx, cancel := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancel()
+
+	markers := []string{commentMarker}
+	if g.singleComment {
+		markers = append(markers, singleCommentMarker)
+	}
+	body := withMarker(util.Ptr(renderChecklist(comments, pullRequestInfo, githubBlobURL)), markers...)
+	if g.singleComment {
+		id, err := g.findSingleComment(ctx, pullRequestInfo)
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			_, _, err := g.client.Issues.EditComment(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, id, &github.IssueComment{Body: body})
+			if err != nil {
+				if authErr := commentAuthError(err); authErr != nil {
+					return authErr
+				}
+				return fmt.Errorf("failed to update review comment: %w", err)
+			}
+			return nil
+		}
+	}
+	_, _, err := g.client.Issues.CreateComment(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), &github.IssueComment{
+		Body: body,
+	})
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to create review checklist: %w", err)
+	}
+	return nil
+}
+
+// findSingleComment returns the id of the latest conversation comment single comment mode posted, 0 when there is
+// none yet.
+func (g *GitHubService) findSingleComment(ctx context.Context, pullRequestInfo *api.PullRequestInfo) (int64, error) {
+	var id int64
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := g.client.Issues.ListComments(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), opts)
+		if err != nil {
+			if authErr := commentAuthError(err); authErr != nil {
+				return 0, authErr
+			}
+			return 0, fmt.Errorf("failed to list pull request comments: %w", err)
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), singleCommentMarker) {
+				id = comment.GetID()
+			}
+		}
+		if resp.NextPage == 0 {
+			return id, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *GitHubService) GetReactionStats(pullRequestInfo *api.PullRequestInfo) (*api.ReactionStats, error) {
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultInfoTimeout)
+	defer cancelFunc()
+
+	stats := &api.ReactionStats{}
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := g.client.PullRequests.ListComments(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, int(pullRequestInfo.PullRequestId), opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull request comments: %w", err)
+		}
+		for _, comment := range comments {
+			if !hasMarker(comment.GetBody()) {
+				continue
+			}
+			stats.Comments++
+			stats.ThumbsUp += comment.GetReactions().GetPlusOne()
+			stats.ThumbsDown += comment.GetReactions().GetMinusOne()
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return stats, nil
+}
+
+func (g *GitHubService) FindPullRequestURL(remoteURL, branch string) (string, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse remote URL: %w", err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("failed to parse repository from remote URL: %s", remoteURL)
+	}
+	owner, repo := parts[0], parts[1]
+
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultInfoTimeout)
+	defer cancelFunc()
+
+	prs, _, err := g.client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "open",
+		Head:  owner + ":" + branch,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list pull requests: %w", err)
+	}
+	if len(prs) == 0 {
+		return "", fmt.Errorf("no open pull request for branch %s in %s/%s", branch, owner, repo)
+	}
+	return prs[0].GetHTMLURL(), nil
+}
+
+// AuthenticatedUser returns the login the token belongs to. It is fetched once per run.
+func (g *GitHubService) AuthenticatedUser() (string, error) {
+	if g.identity != "" {
+		return g.identity, nil
+	}
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancelFunc()
+
+	user, _, err := g.client.Users.Get(ctx, "")
+	if err != nil {
+		if isAuthError(err) {
+			return "", fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		}
+		return "", fmt.Errorf("failed to get authenticated user: %w", err)
+	}
+	g.identity = user.GetLogin()
+	return g.identity, nil
+}
+
+func (g *GitHubService) SetCommitStatus(pullRequestInfo *api.PullRequestInfo, status *api.CommitStatus) error {
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancelFunc()
+
+	_, _, err := g.client.Repositories.CreateStatus(ctx, pullRequestInfo.Owner, pullRequestInfo.ProjectName, pullRequestInfo.HeadSha, github.RepoStatus{
+		State:       util.Ptr(string(status.State)),
+		Context:     util.Ptr(status.Context),
+		Description: util.Ptr(truncateStatusDescription(status)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create commit status: %w", err)
 	}
 	return nil
 }
@@ -100,11 +397,14 @@ func (g *GitHubService) logGithubError(githubComment *github.PullRequestComment,
 
 	var ghErr *github.ErrorResponse
 	if errors.As(err, &ghErr) {
-		log.Printf("failed to create comment on %s:%d: %s (status %d)",
+		// one log call, comments are sent concurrently and separate lines could interleave with another's
+		var msg strings.Builder
+		_, _ = fmt.Fprintf(&msg, "failed to create comment on %s:%d: %s (status %d)",
 			path, line, ghErr.Message, ghErr.Response.StatusCode)
 		for _, e := range ghErr.Errors {
-			log.Printf("  - %s.%s: %s (%s)", e.Resource, e.Field, e.Message, e.Code)
+			_, _ = fmt.Fprintf(&msg, "\n  - %s.%s: %s (%s)", e.Resource, e.Field, e.Message, e.Code)
 		}
+		log.Print(msg.String())
 	} else {
 		log.Printf("failed to create comment on %s:%d: %v", path, line, err)
 	}
@@ -148,11 +448,17 @@ func (g *GitHubService) convertApiComment(
 	}
 
 	pos := in.Position
+	normalizeImagePosition(pos)
+	normalizeDeletedFilePosition(pos)
+	normalizePaths(pos)
 
-	if pos.NewPath != nil {
-		out.Path = pos.NewPath
-	} else if pos.OldPath != nil {
-		out.Path = pos.OldPath
+	// GitHub anchors every comment, including old side lines of a renamed file, on the path in the head commit
+	out.Path = pos.NewPath
+
+	// GitHub has no image positions, the comment goes on the file instead
+	if pos.IsImage() {
+		out.SubjectType = util.Ptr("file")
+		return out
 	}
 
 	//multiline
@@ -186,3 +492,8 @@ func (g *GitHubService) convertApiComment(
 
 	return out
 }
+
+// BlobURL links to lines start to end of path at sha, a single line when end is not after start.
+func (g *GitHubService) BlobURL(pullRequestInfo *api.PullRequestInfo, sha, path string, start, end int64) string {
+	return githubBlobURL(pullRequestInfo.ProjectWebUrl, sha, path, start, end)
+}
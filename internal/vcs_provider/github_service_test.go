@@ -1,11 +1,17 @@
 package vcs_provider
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/eridan-ltu/gitex/api"
 	"github.com/eridan-ltu/gitex/internal/util"
@@ -453,7 +459,7 @@ func TestGitHubService_SendInlineComments(t *testing.T) {
 			var requestCount int
 			tt.setupMock(mux, &requestCount)
 
-			cfg := &api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL}
+			cfg := &api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, RetryMax: 3, RetryWaitMin: time.Millisecond, RetryWaitMax: time.Millisecond}
 			svc, _ := NewGitHubService(cfg)
 
 			err := svc.SendInlineComments(tt.comments, tt.prInfo)
@@ -507,3 +513,671 @@ func TestGitHubService_SendInlineComments_ErrorMessage(t *testing.T) {
 		t.Errorf("error should mention failed count: %v", err)
 	}
 }
+
+func TestGitHubService_GetReactionStats(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v3/repos/owner/repo/pulls/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			_ = json.NewEncoder(w).Encode([]github.PullRequestComment{
+				{Body: github.Ptr("second page\n\n" + commentMarker), Reactions: &github.Reactions{MinusOne: github.Ptr(1)}},
+			})
+			return
+		}
+		w.Header().Set("Link", `<`+server.URL+`/api/v3/repos/owner/repo/pulls/1/comments?page=2>; rel="next"`)
+		_ = json.NewEncoder(w).Encode([]github.PullRequestComment{
+			{Body: github.Ptr("finding\n\n" + commentMarker), Reactions: &github.Reactions{PlusOne: github.Ptr(2)}},
+			{Body: github.Ptr("human comment"), Reactions: &github.Reactions{PlusOne: github.Ptr(5)}},
+			{Body: github.Ptr("no reactions\n\n" + commentMarker)},
+		})
+	})
+
+	cfg := &api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL}
+	svc, _ := NewGitHubService(cfg)
+
+	stats, err := svc.GetReactionStats(&api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Comments != 3 {
+		t.Errorf("Comments = %d, want 3", stats.Comments)
+	}
+	if stats.ThumbsUp != 2 {
+		t.Errorf("ThumbsUp = %d, want 2", stats.ThumbsUp)
+	}
+	if stats.ThumbsDown != 1 {
+		t.Errorf("ThumbsDown = %d, want 1", stats.ThumbsDown)
+	}
+}
+
+func TestGitHubService_FindPullRequestURL(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v3/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("head"); got != "owner:feature" {
+			_ = json.NewEncoder(w).Encode([]github.PullRequest{})
+			return
+		}
+		if got := r.URL.Query().Get("state"); got != "open" {
+			t.Errorf("state = %q, want open", got)
+		}
+		_ = json.NewEncoder(w).Encode([]github.PullRequest{
+			{HTMLURL: github.Ptr("https://github.com/owner/repo/pull/7")},
+		})
+	})
+
+	cfg := &api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL}
+	svc, _ := NewGitHubService(cfg)
+
+	t.Run("finds open pull request", func(t *testing.T) {
+		got, err := svc.FindPullRequestURL("https://github.com/owner/repo", "feature")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != "https://github.com/owner/repo/pull/7" {
+			t.Errorf("got %q, want %q", got, "https://github.com/owner/repo/pull/7")
+		}
+	})
+
+	t.Run("error when no pull request is open", func(t *testing.T) {
+		if _, err := svc.FindPullRequestURL("https://github.com/owner/repo", "other"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("error on invalid remote", func(t *testing.T) {
+		if _, err := svc.FindPullRequestURL("https://github.com/owner", "feature"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestGitHubService_convertApiComment_DeletedFile(t *testing.T) {
+	svc := &GitHubService{}
+
+	t.Run("single line on deleted file uses LEFT side and old path", func(t *testing.T) {
+		got := svc.convertApiComment(&api.InlineComment{
+			Body: util.Ptr("removed code"),
+			Position: &api.InlineCommentPosition{
+				OldPath:     util.Ptr("legacy.go"),
+				NewPath:     util.Ptr("/dev/null"),
+				NewLine:     util.Ptr(int64(12)),
+				CommentType: "SINGLE_LINE",
+				LineType:    "ADD",
+			},
+		})
+		if util.GetOrDefault(got.Path, "") != "legacy.go" {
+			t.Errorf("Path = %v, want legacy.go", util.GetOrDefault(got.Path, ""))
+		}
+		if util.GetOrDefault(got.Side, "") != "LEFT" {
+			t.Errorf("Side = %v, want LEFT", util.GetOrDefault(got.Side, ""))
+		}
+		if util.GetOrDefaultInt(got.Line, 0) != 12 {
+			t.Errorf("Line = %v, want 12", util.GetOrDefaultInt(got.Line, 0))
+		}
+	})
+
+	t.Run("multi line on deleted file flagged by the model", func(t *testing.T) {
+		got := svc.convertApiComment(&api.InlineComment{
+			Body: util.Ptr("removed block"),
+			Position: &api.InlineCommentPosition{
+				NewPath:     util.Ptr("legacy.go"),
+				DeletedFile: true,
+				CommentType: "MULTI_LINE",
+				LineRange: &api.LineRangeOptions{
+					Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(3))},
+					End:   &api.LinePositionOptions{OldLine: util.Ptr(int64(8))},
+				},
+			},
+		})
+		if util.GetOrDefault(got.Path, "") != "legacy.go" {
+			t.Errorf("Path = %v, want legacy.go", util.GetOrDefault(got.Path, ""))
+		}
+		if util.GetOrDefault(got.Side, "") != "LEFT" || util.GetOrDefault(got.StartSide, "") != "LEFT" {
+			t.Errorf("Side = %v, StartSide = %v, want LEFT", util.GetOrDefault(got.Side, ""), util.GetOrDefault(got.StartSide, ""))
+		}
+		if util.GetOrDefaultInt(got.StartLine, 0) != 3 || util.GetOrDefaultInt(got.Line, 0) != 8 {
+			t.Errorf("lines = %d-%d, want 3-8", util.GetOrDefaultInt(got.StartLine, 0), util.GetOrDefaultInt(got.Line, 0))
+		}
+	})
+}
+
+func TestGitHubService_SetCommitStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var got github.RepoStatus
+	mux.HandleFunc("/api/v3/repos/owner/repo/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(got)
+	})
+
+	cfg := &api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL}
+	svc, _ := NewGitHubService(cfg)
+
+	err := svc.SetCommitStatus(
+		&api.PullRequestInfo{Owner: "owner", ProjectName: "repo", HeadSha: "abc123"},
+		&api.CommitStatus{State: api.CommitStatusSuccess, Context: "gitex-security", Description: "Review finished, 2 comments"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.GetState() != "success" || got.GetContext() != "gitex-security" || got.GetDescription() != "Review finished, 2 comments" {
+		t.Errorf("unexpected status: state=%s context=%s description=%s", got.GetState(), got.GetContext(), got.GetDescription())
+	}
+}
+
+func TestGitHubService_convertApiComment_Rename(t *testing.T) {
+	svc := &GitHubService{}
+
+	// diff --git a/old_name.go b/new_name.go
+	// rename from old_name.go
+	// rename to new_name.go
+	// @@ -10,3 +10,3 @@
+	tests := []struct {
+		name     string
+		position *api.InlineCommentPosition
+		wantPath string
+		wantSide string
+		wantLine int
+	}{
+		{
+			name:     "added line on renamed file",
+			position: &api.InlineCommentPosition{OldPath: util.Ptr("old_name.go"), NewPath: util.Ptr("new_name.go"), NewLine: util.Ptr(int64(11)), LineType: "ADD"},
+			wantPath: "new_name.go",
+			wantSide: "RIGHT",
+			wantLine: 11,
+		},
+		{
+			name:     "removed line on renamed file keeps new path",
+			position: &api.InlineCommentPosition{OldPath: util.Ptr("old_name.go"), NewPath: util.Ptr("new_name.go"), OldLine: util.Ptr(int64(11)), LineType: "REMOVE"},
+			wantPath: "new_name.go",
+			wantSide: "LEFT",
+			wantLine: 11,
+		},
+		{
+			name:     "only old path given",
+			position: &api.InlineCommentPosition{OldPath: util.Ptr("main.go"), OldLine: util.Ptr(int64(4)), LineType: "REMOVE"},
+			wantPath: "main.go",
+			wantSide: "LEFT",
+			wantLine: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := svc.convertApiComment(&api.InlineComment{Body: util.Ptr("finding"), Position: tt.position})
+			if util.GetOrDefault(got.Path, "") != tt.wantPath {
+				t.Errorf("Path = %q, want %q", util.GetOrDefault(got.Path, ""), tt.wantPath)
+			}
+			if util.GetOrDefault(got.Side, "") != tt.wantSide {
+				t.Errorf("Side = %q, want %q", util.GetOrDefault(got.Side, ""), tt.wantSide)
+			}
+			if util.GetOrDefaultInt(got.Line, 0) != tt.wantLine {
+				t.Errorf("Line = %d, want %d", util.GetOrDefaultInt(got.Line, 0), tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestGitHubService_convertApiComment_Image(t *testing.T) {
+	svc := &GitHubService{}
+	got := svc.convertApiComment(&api.InlineComment{
+		Body: util.Ptr("the logo is cropped"),
+		Position: &api.InlineCommentPosition{
+			PositionType: util.Ptr(api.PositionTypeImage),
+			NewPath:      util.Ptr("assets/logo.png"),
+			Width:        util.Ptr(int64(200)),
+			Height:       util.Ptr(int64(100)),
+			X:            util.Ptr(10.0),
+			Y:            util.Ptr(20.0),
+		},
+	})
+	if util.GetOrDefault(got.SubjectType, "") != "file" {
+		t.Errorf("SubjectType = %q, want file", util.GetOrDefault(got.SubjectType, ""))
+	}
+	if util.GetOrDefault(got.Path, "") != "assets/logo.png" {
+		t.Errorf("Path = %q, want assets/logo.png", util.GetOrDefault(got.Path, ""))
+	}
+	if got.Line != nil || got.Side != nil {
+		t.Error("expected no line on a file comment")
+	}
+}
+
+func TestGitHubService_SendInlineComments_FailFast(t *testing.T) {
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("c1"), CommitID: util.Ptr("abc"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1))}},
+		{Body: util.Ptr("c2"), CommitID: util.Ptr("abc"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("b.go"), NewLine: util.Ptr(int64(2))}},
+	}
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1}
+
+	tests := []struct {
+		name      string
+		status    int
+		failFast  bool
+		message   string
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "validation errors continue by default", status: http.StatusUnprocessableEntity, wantCalls: 2},
+		{name: "validation error stops with fail-fast", status: http.StatusUnprocessableEntity, failFast: true, wantCalls: 1},
+		{name: "bad credentials always stop", status: http.StatusUnauthorized, wantCalls: 1, wantErr: ErrUnauthorized},
+		{name: "missing permission always stops", status: http.StatusForbidden, wantCalls: 1, wantErr: ErrPermissionDenied},
+		{name: "rate limit 403 is not a permission problem", status: http.StatusForbidden, message: "You have exceeded a secondary rate limit", wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				message := tt.message
+				if message == "" {
+					message = "rejected"
+				}
+				w.WriteHeader(tt.status)
+				_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+			}))
+			defer server.Close()
+
+			svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, FailFast: tt.failFast})
+			err := svc.SendInlineComments(comments, prInfo)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			var commentErr *CommentError
+			if tt.wantErr == nil && (!errors.As(err, &commentErr) || commentErr.Path != "a.go" || commentErr.Line != 1 || commentErr.StatusCode != tt.status) {
+				t.Errorf("expected the first comment's error with status %d, got %v", tt.status, err)
+			}
+			for _, sentinel := range []error{ErrUnauthorized, ErrPermissionDenied} {
+				if errors.Is(err, sentinel) != (sentinel == tt.wantErr) {
+					t.Errorf("errors.Is(err, %q) = %v, want %v", sentinel, !(sentinel == tt.wantErr), sentinel == tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestGitHubService_SendInlineComments_Concurrency(t *testing.T) {
+	const total, concurrency = 12, 4
+	var comments []*api.InlineComment
+	for i := range total {
+		path := "a.go"
+		if i%4 == 0 {
+			path = "reject.go"
+		}
+		comments = append(comments, &api.InlineComment{Body: util.Ptr(fmt.Sprintf("c%d", i)), CommitID: util.Ptr("abc"),
+			Position: &api.InlineCommentPosition{NewPath: util.Ptr(path), NewLine: util.Ptr(int64(i + 1))}})
+	}
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1}
+
+	var mu sync.Mutex
+	var calls, inFlight, maxInFlight int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body github.PullRequestComment
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		calls++
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if body.GetPath() == "reject.go" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "rejected"})
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 1})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, CommentConcurrency: concurrency})
+	err := svc.SendInlineComments(comments, prInfo)
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.Failed != total/4 {
+		t.Fatalf("expected %d failed comments, got %v", total/4, err)
+	}
+	if err.Error() != fmt.Sprintf("failed to send %d comments", total/4) {
+		t.Errorf("error = %q", err)
+	}
+	for i, commentErr := range sendErr.Comments {
+		// ordered by line although they finished in any order
+		if commentErr.Path != "reject.go" || commentErr.Line != int64(i*4+1) || commentErr.StatusCode != http.StatusUnprocessableEntity || commentErr.Message != "rejected" {
+			t.Errorf("comment error %d = %+v", i, commentErr)
+		}
+	}
+	if calls != total {
+		t.Errorf("calls = %d, want %d", calls, total)
+	}
+	if maxInFlight > concurrency || maxInFlight < 2 {
+		t.Errorf("%d comments sent at once, want between 2 and %d", maxInFlight, concurrency)
+	}
+}
+
+func TestGitHubService_AuthenticatedUser(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/user" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		calls++
+		_ = json.NewEncoder(w).Encode(map[string]any{"login": "gitex-bot"})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+	for range 2 {
+		user, err := svc.AuthenticatedUser()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user != "gitex-bot" {
+			t.Errorf("user = %q, want gitex-bot", user)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestGitHubService_ApiTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, ApiTimeout: 50 * time.Millisecond})
+	start := time.Now()
+	_, err := svc.GetPullRequestInfo(util.Ptr("https://github.com/owner/repo/pull/7"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("loading the pull request took %v", elapsed)
+	}
+
+	comments := []*api.InlineComment{{Body: util.Ptr("c"), CommitID: util.Ptr("abc"),
+		Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1))}}}
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 7, HeadSha: "abc"}
+	err = svc.SendInlineComments(comments, prInfo)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	requests := map[string]func() error{
+		"comment": func() error { return svc.CommentOnPullRequest(prInfo, "body") },
+		"reactions": func() error {
+			_, err := svc.GetReactionStats(prInfo)
+			return err
+		},
+		"find pull request": func() error {
+			_, err := svc.FindPullRequestURL("https://github.com/owner/repo", "feature")
+			return err
+		},
+		"user": func() error {
+			_, err := svc.AuthenticatedUser()
+			return err
+		},
+		"commit status": func() error {
+			return svc.SetCommitStatus(prInfo, &api.CommitStatus{State: api.CommitStatusPending, Context: "gitex"})
+		},
+	}
+	for name, request := range requests {
+		start := time.Now()
+		if err := request(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected a deadline error, got %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s took %v", name, elapsed)
+		}
+	}
+}
+
+func TestGitHubService_SendInlineComments_Checklist(t *testing.T) {
+	var paths, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body github.IssueComment
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, body.GetBody())
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 1})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, SummaryMode: summaryModeChecklist})
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("c1"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1))}},
+		{Body: util.Ptr("c2"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("b.go"), NewLine: util.Ptr(int64(2))}},
+	}
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1, HeadSha: "abc", ProjectWebUrl: "https://github.com/owner/repo"}
+	if err := svc.SendInlineComments(comments, prInfo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/api/v3/repos/owner/repo/issues/1/comments" {
+		t.Fatalf("requests = %v, want one issue comment", paths)
+	}
+	if !strings.Contains(bodies[0], "- [ ] [`b.go:2`](https://github.com/owner/repo/blob/abc/b.go#L2) c2") {
+		t.Errorf("unexpected checklist: %q", bodies[0])
+	}
+}
+
+func TestGitHubService_SendInlineComments_SingleComment(t *testing.T) {
+	run := func(t *testing.T, existing []map[string]any) (requests, bodies []string) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			if r.Method == http.MethodGet {
+				_ = json.NewEncoder(w).Encode(existing)
+				return
+			}
+			var body github.IssueComment
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body.GetBody())
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": 9})
+		}))
+		defer server.Close()
+
+		svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, SingleCommentMode: true})
+		comments := []*api.InlineComment{
+			{Body: util.Ptr("c1"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1))}},
+		}
+		prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1, HeadSha: "abc"}
+		if err := svc.SendInlineComments(comments, prInfo); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return requests, bodies
+	}
+
+	t.Run("edits the comment of the last run", func(t *testing.T) {
+		requests, bodies := run(t, []map[string]any{
+			{"id": 3, "body": "a reviewer's comment"},
+			{"id": 5, "body": "### gitex review\n\n" + commentMarker + "\n" + singleCommentMarker},
+			{"id": 7, "body": "a checklist\n\n" + commentMarker},
+		})
+		want := []string{"GET /api/v3/repos/owner/repo/issues/1/comments", "PATCH /api/v3/repos/owner/repo/issues/comments/5"}
+		if !slices.Equal(requests, want) {
+			t.Fatalf("requests = %v, want %v", requests, want)
+		}
+		if !strings.Contains(bodies[0], "`a.go:1` c1") || !strings.HasSuffix(bodies[0], singleCommentMarker) {
+			t.Errorf("unexpected body: %q", bodies[0])
+		}
+	})
+
+	t.Run("posts the comment on the first run", func(t *testing.T) {
+		requests, bodies := run(t, []map[string]any{{"id": 3, "body": "a reviewer's comment"}})
+		want := []string{"GET /api/v3/repos/owner/repo/issues/1/comments", "POST /api/v3/repos/owner/repo/issues/1/comments"}
+		if !slices.Equal(requests, want) {
+			t.Fatalf("requests = %v, want %v", requests, want)
+		}
+		if !strings.HasSuffix(bodies[0], singleCommentMarker) {
+			t.Errorf("body lacks the single comment marker: %q", bodies[0])
+		}
+	})
+}
+
+func TestGitHubService_SendInlineComments_SplitLongComments(t *testing.T) {
+	var bodies []string
+	var replyTo []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body["body"].(string))
+		replyTo = append(replyTo, body["in_reply_to"])
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 42})
+	}))
+	defer server.Close()
+
+	long := strings.Repeat("finding details\n\n", githubMaxCommentLength/10)
+	comments := []*api.InlineComment{
+		{Body: util.Ptr(long), CommitID: util.Ptr("abc"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1))}},
+	}
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1}
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, SplitLongComments: true})
+	if err := svc.SendInlineComments(comments, prInfo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("posted %d comments, want 2", len(bodies))
+	}
+	for i, body := range bodies {
+		if len(body) > githubMaxCommentLength {
+			t.Errorf("comment %d is %d bytes", i, len(body))
+		}
+	}
+	if !strings.Contains(bodies[0], commentMarker) || strings.Contains(bodies[1], commentMarker) {
+		t.Error("only the first chunk should carry the marker")
+	}
+	if replyTo[0] != nil || replyTo[1] != float64(42) {
+		t.Errorf("in_reply_to = %v, want [nil 42]", replyTo)
+	}
+}
+
+func TestGitHubService_CommentOnPullRequest(t *testing.T) {
+	var paths, bodies []string
+	status := http.StatusCreated
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body github.IssueComment
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, body.GetBody())
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 1})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1}
+	if err := svc.CommentOnPullRequest(prInfo, "description review"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/api/v3/repos/owner/repo/issues/1/comments" {
+		t.Fatalf("requests = %v, want one issue comment", paths)
+	}
+	if bodies[0] != "description review\n\n"+commentMarker {
+		t.Errorf("body = %q", bodies[0])
+	}
+
+	status = http.StatusForbidden
+	if err := svc.CommentOnPullRequest(prInfo, "description review"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("expected ErrPermissionDenied, got %v", err)
+	}
+}
+
+func TestGithubMergeStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		mergeable *bool
+		state     string
+		want      string
+	}{
+		{name: "clean", mergeable: github.Ptr(true), state: "clean", want: api.MergeStatusClean},
+		{name: "blocked by checks", mergeable: github.Ptr(true), state: "blocked", want: api.MergeStatusClean},
+		{name: "conflicts", mergeable: github.Ptr(false), state: "dirty", want: api.MergeStatusConflict},
+		{name: "not computed yet", state: "unknown", want: api.MergeStatusChecking},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &github.PullRequest{Mergeable: tt.mergeable, MergeableState: github.Ptr(tt.state)}
+			if got := githubMergeStatus(pr); got != tt.want {
+				t.Errorf("githubMergeStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubService_SendInlineComments_Retries(t *testing.T) {
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("rejected"), CommitID: util.Ptr("abc"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("reject.go"), NewLine: util.Ptr(int64(1))}},
+		{Body: util.Ptr("rate limited"), CommitID: util.Ptr("abc"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("flaky.go"), NewLine: util.Ptr(int64(2))}},
+		{Body: util.Ptr("dropped"), CommitID: util.Ptr("abc"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("dropped.go"), NewLine: util.Ptr(int64(3))}},
+	}
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body github.PullRequestComment
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		calls[body.GetPath()]++
+		attempt := calls[body.GetPath()]
+		mu.Unlock()
+
+		switch {
+		case body.GetPath() == "reject.go":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_ = json.NewEncoder(w).Encode(map[string]string{"message": "line must be part of the diff"})
+		case body.GetPath() == "dropped.go":
+			// the connection drops after the request was written, the comment may have been posted
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		case attempt == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": 1})
+		}
+	}))
+	defer server.Close()
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL, CommentRetries: 1})
+	err := svc.SendInlineComments(comments, prInfo)
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.Failed != 2 || sendErr.Comments[0].Path != "dropped.go" || sendErr.Comments[1].Path != "reject.go" {
+		t.Fatalf("expected the rejected and the dropped comment to fail, got %v", err)
+	}
+	if calls["reject.go"] != 1 {
+		t.Errorf("422 sent %d times, want once", calls["reject.go"])
+	}
+	if calls["flaky.go"] != 2 {
+		t.Errorf("comment after a 429 sent %d times, want 2", calls["flaky.go"])
+	}
+	if calls["dropped.go"] != 1 {
+		t.Errorf("comment whose connection broke after the request sent %d times, want once", calls["dropped.go"])
+	}
+}
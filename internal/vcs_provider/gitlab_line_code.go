@@ -0,0 +1,146 @@
+package vcs_provider
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/diff"
+	"github.com/eridan-ltu/gitex/internal/util"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// gitlabDiffLine is a line of a merge request diff with GitLab's old and new positions. GitLab counts the side a
+// line is missing from as well: an added line keeps the old position of the line that follows it.
+type gitlabDiffLine struct {
+	oldPos, newPos int64
+	kind           byte
+}
+
+// gitlabFileLines indexes the diff lines of one file by their old and new line numbers.
+type gitlabFileLines struct {
+	path  string
+	byOld map[int64]gitlabDiffLine
+	byNew map[int64]gitlabDiffLine
+}
+
+// gitlabDiffIndex holds the diff lines of a merge request by new and old file path.
+type gitlabDiffIndex map[string]*gitlabFileLines
+
+// diffIndex fetches the merge request diffs, GitLab only accepts line ranges with line codes computed from them.
+func (g *GitLabService) diffIndex(pullRequestInfo *api.PullRequestInfo) (gitlabDiffIndex, error) {
+	index := gitlabDiffIndex{}
+	opts := &gitlab.ListMergeRequestDiffsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	ctx, cancel := requestContext(g.apiTimeout, 0)
+	defer cancel()
+	for {
+		diffs, resp, err := g.client.MergeRequests.ListMergeRequestDiffs(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge request diffs: %w", err)
+		}
+		for _, d := range diffs {
+			if err := index.add(d); err != nil {
+				return nil, err
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return index, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (idx gitlabDiffIndex) add(d *gitlab.MergeRequestDiff) error {
+	parsed, err := diff.Parse(fmt.Sprintf("diff --git a/%s b/%s\n%s", d.OldPath, d.NewPath, d.Diff))
+	if err != nil {
+		return fmt.Errorf("failed to parse diff of %s: %w", d.NewPath, err)
+	}
+	file := &gitlabFileLines{path: d.NewPath, byOld: map[int64]gitlabDiffLine{}, byNew: map[int64]gitlabDiffLine{}}
+	for _, f := range parsed.Files {
+		for _, h := range f.Hunks {
+			oldPos, newPos := int64(h.OldStart), int64(h.NewStart)
+			for _, l := range h.Lines {
+				line := gitlabDiffLine{oldPos: oldPos, newPos: newPos, kind: ' '}
+				switch {
+				case l.OldLine == 0:
+					line.kind = '+'
+					file.byNew[newPos] = line
+					newPos++
+				case l.NewLine == 0:
+					line.kind = '-'
+					file.byOld[oldPos] = line
+					oldPos++
+				default:
+					file.byNew[newPos] = line
+					file.byOld[oldPos] = line
+					oldPos++
+					newPos++
+				}
+			}
+		}
+	}
+	idx[d.NewPath] = file
+	if d.OldPath != d.NewPath {
+		idx[d.OldPath] = file
+	}
+	return nil
+}
+
+// anchor completes a position from the diff: unchanged lines get both line numbers and line ranges get the line codes
+// and types GitLab requires. Positions outside the diff are left alone.
+func (idx gitlabDiffIndex) anchor(pos *gitlab.PositionOptions) {
+	if pos == nil || idx == nil {
+		return
+	}
+	file := idx[util.GetOrDefault(pos.NewPath, util.GetOrDefault(pos.OldPath, ""))]
+	if file == nil {
+		return
+	}
+
+	if pos.LineRange != nil {
+		for _, lp := range []*gitlab.LinePositionOptions{pos.LineRange.Start, pos.LineRange.End} {
+			if lp == nil {
+				continue
+			}
+			if line, ok := file.lookup(lp.NewLine, lp.OldLine); ok {
+				lp.LineCode = util.Ptr(gitlabLineCode(file.path, line.oldPos, line.newPos))
+				lp.Type = line.positionType()
+			}
+		}
+		return
+	}
+
+	if line, ok := file.lookup(pos.NewLine, pos.OldLine); ok && line.kind == ' ' {
+		pos.OldLine, pos.NewLine = util.Ptr(line.oldPos), util.Ptr(line.newPos)
+	}
+}
+
+func (f *gitlabFileLines) lookup(newLine, oldLine *int64) (gitlabDiffLine, bool) {
+	if newLine != nil {
+		if line, ok := f.byNew[*newLine]; ok {
+			return line, true
+		}
+	}
+	if oldLine != nil {
+		line, ok := f.byOld[*oldLine]
+		return line, ok
+	}
+	return gitlabDiffLine{}, false
+}
+
+func (l gitlabDiffLine) positionType() *string {
+	switch l.kind {
+	case '+':
+		return util.Ptr("new")
+	case '-':
+		return util.Ptr("old")
+	}
+	return nil
+}
+
+// gitlabLineCode builds GitLab's line code, the sha1 of the file path followed by the old and new positions.
+func gitlabLineCode(path string, oldPos, newPos int64) string {
+	sum := sha1.Sum([]byte(path))
+	return fmt.Sprintf("%s_%d_%d", hex.EncodeToString(sum[:]), oldPos, newPos)
+}
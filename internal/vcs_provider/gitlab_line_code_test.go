@@ -0,0 +1,154 @@
+package vcs_provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+const mergeRequestDiffsPayload = `[
+	{
+		"old_path": "main.go",
+		"new_path": "main.go",
+		"diff": "@@ -1,4 +1,5 @@\n package main\n-var a = 1\n+var a = 2\n+var b = 3\n \n func main() {}\n"
+	},
+	{
+		"old_path": "old.go",
+		"new_path": "new.go",
+		"renamed_file": true,
+		"diff": "@@ -10,2 +10,2 @@\n x := 1\n-y := 2\n+y := 3\n"
+	}
+]`
+
+func TestGitlabLineCode(t *testing.T) {
+	// sha1 of "main.go" followed by the old and new positions
+	want := "0607f785dfa3c3861b3239f6723eb276d8056461_2_3"
+	if got := gitlabLineCode("main.go", 2, 3); got != want {
+		t.Errorf("gitlabLineCode() = %q, want %q", got, want)
+	}
+}
+
+func TestGitLabService_diffIndex(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/diffs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, mergeRequestDiffsPayload)
+	})
+
+	svc := &GitLabService{client: client}
+	index, err := svc.diffIndex(&api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code := func(path string, oldPos, newPos int64) *string {
+		return util.Ptr(gitlabLineCode(path, oldPos, newPos))
+	}
+
+	t.Run("unchanged line gets both line numbers", func(t *testing.T) {
+		pos := &gitlab.PositionOptions{NewPath: util.Ptr("main.go"), OldPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(5))}
+		index.anchor(pos)
+		if pos.OldLine == nil || *pos.OldLine != 4 || *pos.NewLine != 5 {
+			t.Errorf("lines = %v/%v, want 4/5", pos.OldLine, pos.NewLine)
+		}
+	})
+
+	t.Run("added line keeps only the new line", func(t *testing.T) {
+		pos := &gitlab.PositionOptions{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(3))}
+		index.anchor(pos)
+		if pos.OldLine != nil {
+			t.Errorf("OldLine = %d, want nil", *pos.OldLine)
+		}
+	})
+
+	t.Run("line range gets line codes and types", func(t *testing.T) {
+		pos := &gitlab.PositionOptions{
+			NewPath: util.Ptr("main.go"),
+			LineRange: &gitlab.LineRangeOptions{
+				Start: &gitlab.LinePositionOptions{OldLine: util.Ptr(int64(2))},
+				End:   &gitlab.LinePositionOptions{NewLine: util.Ptr(int64(3))},
+			},
+		}
+		index.anchor(pos)
+		start, end := pos.LineRange.Start, pos.LineRange.End
+		if *start.LineCode != *code("main.go", 2, 2) || *start.Type != "old" {
+			t.Errorf("start = %s %v, want removed line code", *start.LineCode, *start.Type)
+		}
+		if *end.LineCode != *code("main.go", 3, 3) || *end.Type != "new" {
+			t.Errorf("end = %s %v, want added line code", *end.LineCode, *end.Type)
+		}
+	})
+
+	t.Run("renamed file is found by its old path and coded by the new one", func(t *testing.T) {
+		pos := &gitlab.PositionOptions{
+			OldPath: util.Ptr("old.go"),
+			LineRange: &gitlab.LineRangeOptions{
+				Start: &gitlab.LinePositionOptions{OldLine: util.Ptr(int64(10)), NewLine: util.Ptr(int64(10))},
+				End:   &gitlab.LinePositionOptions{NewLine: util.Ptr(int64(11))},
+			},
+		}
+		index.anchor(pos)
+		if *pos.LineRange.Start.LineCode != *code("new.go", 10, 10) || pos.LineRange.Start.Type != nil {
+			t.Errorf("unexpected start %s", *pos.LineRange.Start.LineCode)
+		}
+		if *pos.LineRange.End.LineCode != *code("new.go", 12, 11) {
+			t.Errorf("unexpected end %s", *pos.LineRange.End.LineCode)
+		}
+	})
+
+	t.Run("positions outside the diff are untouched", func(t *testing.T) {
+		pos := &gitlab.PositionOptions{NewPath: util.Ptr("other.go"), NewLine: util.Ptr(int64(1))}
+		index.anchor(pos)
+		if pos.OldLine != nil {
+			t.Error("expected no old line for a file outside the diff")
+		}
+		var nilIndex gitlabDiffIndex
+		nilIndex.anchor(pos)
+	})
+}
+
+func TestGitLabService_SendInlineComments_LineCodes(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/diffs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, mergeRequestDiffsPayload)
+	})
+	var posted gitlab.CreateMergeRequestDiscussionOptions
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&posted)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": "d1", "notes": []}`)
+	})
+
+	svc := &GitLabService{client: client}
+	comments := []*api.InlineComment{{
+		Body: util.Ptr("block"),
+		Position: &api.InlineCommentPosition{
+			NewPath:     util.Ptr("main.go"),
+			CommentType: "MULTI_LINE",
+			LineType:    "ADD",
+			LineRange: &api.LineRangeOptions{
+				Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(2))},
+				End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(3))},
+			},
+		},
+	}}
+	if err := svc.SendInlineComments(comments, &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lr := posted.Position.LineRange
+	if lr == nil || lr.Start.LineCode == nil || *lr.Start.LineCode != gitlabLineCode("main.go", 3, 2) {
+		t.Errorf("start line code = %v, want %s", lr.Start.LineCode, gitlabLineCode("main.go", 3, 2))
+	}
+	if lr.End.LineCode == nil || *lr.End.LineCode != gitlabLineCode("main.go", 3, 3) {
+		t.Errorf("end line code = %v, want %s", lr.End.LineCode, gitlabLineCode("main.go", 3, 3))
+	}
+}
@@ -1,38 +1,88 @@
 package vcs_provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/eridan-ltu/gitex/api"
 	"github.com/eridan-ltu/gitex/internal/util"
 	"github.com/hashicorp/go-retryablehttp"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/sync/errgroup"
 )
 
 type GitLabService struct {
-	client *gitlab.Client
+	client             *gitlab.Client
+	consolidatedReview bool
+	checklist          bool
+	singleComment      bool
+	failFast           bool
+	splitLongComments  bool
+	commentConcurrency int
+	commentRetries     int
+	retryWaitMin       time.Duration
+	retryWaitMax       time.Duration
+	apiTimeout         time.Duration
+	identity           string
 }
 
-func NewGitLabService(cfg *api.Config) (*GitLabService, error) {
+var _ api.ReactionTracker = (*GitLabService)(nil)
+var _ api.PullRequestFinder = (*GitLabService)(nil)
+var _ api.CommitStatusReporter = (*GitLabService)(nil)
+var _ api.IdentityResolver = (*GitLabService)(nil)
+var _ api.Labeler = (*GitLabService)(nil)
+var _ api.OwnerResolver = (*GitLabService)(nil)
+var _ api.ThreadTracker = (*GitLabService)(nil)
+var _ api.PullRequestCommenter = (*GitLabService)(nil)
+var _ api.BlobLinker = (*GitLabService)(nil)
+
+func NewGitLabService(cfg *api.Config, opts ...Option) (*GitLabService, error) {
 	baseUrl := util.GetOrDefault(&cfg.VcsRemoteUrl, "https://gitlab.com/")
 
-	client, err := gitlab.NewClient(
-		cfg.VcsApiKey,
+	o := applyOptions(opts)
+	httpClient := o.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Transport: withRateLimit(http.DefaultTransport.(*http.Transport).Clone(), cfg.RequestsPerSecond),
+		}
+	}
+
+	clientOpts := []gitlab.ClientOptionFunc{
 		gitlab.WithBaseURL(baseUrl),
 		gitlab.WithCustomRetry(RetryPolicy),
-		gitlab.WithCustomRetryMax(3),
+		gitlab.WithCustomRetryMax(cfg.RetryMax),
 		gitlab.WithErrorHandler(retryablehttp.PassthroughErrorHandler),
-	)
+		gitlab.WithHTTPClient(httpClient),
+	}
+	// the client's own backoff waits a fixed 700-900ms on server errors, use the one the GitHub client uses so both
+	// providers honor the rate limit headers and the same bounds
+	waitMin, waitMax := retryWaits(cfg)
+	clientOpts = append(clientOpts,
+		gitlab.WithCustomBackoff(Backoff),
+		gitlab.WithCustomRetryWaitMinMax(waitMin, waitMax))
+	client, err := gitlab.NewClient(cfg.VcsApiKey, clientOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
 	}
 	return &GitLabService{
-		client: client,
+		client:             client,
+		consolidatedReview: cfg.ConsolidatedReview,
+		checklist:          cfg.SummaryMode == summaryModeChecklist || cfg.SingleCommentMode,
+		singleComment:      cfg.SingleCommentMode,
+		failFast:           cfg.FailFast,
+		splitLongComments:  cfg.SplitLongComments,
+		commentConcurrency: cfg.CommentConcurrency,
+		commentRetries:     cfg.CommentRetries,
+		retryWaitMin:       waitMin,
+		retryWaitMax:       waitMax,
+		apiTimeout:         cfg.ApiTimeout,
 	}, nil
 }
 
@@ -41,11 +91,14 @@ func (g *GitLabService) GetPullRequestInfo(pullRequestURL *string) (*api.PullReq
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse merge request URL: %w", err)
 	}
-	mr, _, err := g.client.MergeRequests.GetMergeRequest(projectPath, int64(mrId), nil)
+	ctx, cancel := requestContext(g.apiTimeout, 0)
+	defer cancel()
+
+	mr, _, err := g.client.MergeRequests.GetMergeRequest(projectPath, int64(mrId), nil, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get merge request: %w", err)
 	}
-	project, _, err := g.client.Projects.GetProject(mr.ProjectID, nil)
+	project, _, err := g.client.Projects.GetProject(mr.ProjectID, nil, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get project: %w", err)
 	}
@@ -56,43 +109,490 @@ func (g *GitLabService) GetPullRequestInfo(pullRequestURL *string) (*api.PullReq
 		StartSha:       mr.DiffRefs.StartSha,
 		ProjectName:    project.Name,
 		ProjectHttpUrl: project.HTTPURLToRepo,
+		ProjectSshUrl:  project.SSHURLToRepo,
+		ProjectWebUrl:  project.WebURL,
 		ProjectId:      project.ID,
 		SourceBranch:   mr.SourceBranch,
 		TargetBranch:   mr.TargetBranch,
 		ProjectPath:    project.PathWithNamespace,
 		PullRequestId:  mr.IID,
+		Title:          mr.Title,
+		Description:    mr.Description,
+		MergeStatus:    gitlabMergeStatus(mr.HasConflicts, mr.DetailedMergeStatus),
 	}, nil
 }
 
+// gitlabMergeStatus maps detailed_merge_status, which also covers approvals and pipelines that do not change the diff.
+func gitlabMergeStatus(hasConflicts bool, detailed string) string {
+	switch {
+	case hasConflicts || detailed == "conflict":
+		return api.MergeStatusConflict
+	case detailed == "checking" || detailed == "unchecked" || detailed == "preparing":
+		return api.MergeStatusChecking
+	case detailed == "":
+		return ""
+	default:
+		return api.MergeStatusClean
+	}
+}
+
 func (g *GitLabService) SendInlineComments(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
-	var failedCount int
+	if g.checklist {
+		return g.sendChecklist(comments, pullRequestInfo)
+	}
+	if g.consolidatedReview {
+		return g.sendConsolidatedReview(comments, pullRequestInfo)
+	}
+	threads, folded := splitFolded(comments)
+	sendErr := g.sendDiscussions(threads, pullRequestInfo, commentMarker)
+	if len(folded) == 0 || (sendErr != nil && (g.failFast || errors.Is(sendErr, ErrUnauthorized) || errors.Is(sendErr, ErrPermissionDenied))) {
+		return sendErr
+	}
+	body := withMarker(util.Ptr(renderFoldedSummary(folded, pullRequestInfo, gitlabBlobURL)), commentMarker)
+	ctx, cancel := requestContext(g.apiTimeout, 0)
+	defer cancel()
+	_, _, err := g.client.Discussions.CreateMergeRequestDiscussion(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, &gitlab.CreateMergeRequestDiscussionOptions{
+		Body: body,
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return errors.Join(sendErr, fmt.Errorf("failed to create summary of folded findings: %w", err))
+	}
+	return sendErr
+}
+
+// CommentOnPullRequest posts body as a discussion on the merge request, outside the diff.
+func (g *GitLabService) CommentOnPullRequest(pullRequestInfo *api.PullRequestInfo, body string) error {
+	_, _, err := g.client.Discussions.CreateMergeRequestDiscussion(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, &gitlab.CreateMergeRequestDiscussionOptions{
+		Body: withMarker(util.Ptr(body), commentMarker),
+	})
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to create merge request discussion: %w", err)
+	}
+	return nil
+}
+
+// sendConsolidatedReview posts the run as one unit: the positioned findings plus a non-positioned summary
+// discussion, all tagged with the same review marker. The summary goes last, so a run that has one is complete: a
+// rerun for the same head SHA is skipped. Otherwise the discussions of earlier runs are superseded once the new run
+// is posted.
+func (g *GitLabService) sendConsolidatedReview(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+	previous, err := g.previousReviews(pullRequestInfo)
+	if err != nil {
+		return fmt.Errorf("failed to look up previous reviews: %w", err)
+	}
+	for _, discussion := range previous {
+		if discussion.summary && discussion.ref.HeadSha == pullRequestInfo.HeadSha {
+			log.Printf("review of %s already posted, skipping", pullRequestInfo.HeadSha)
+			return nil
+		}
+	}
+
+	// folded findings are only listed in the summary, which lists every finding
+	threads, _ := splitFolded(comments)
+	marker := reviewMarker(pullRequestInfo.HeadSha, newRunID())
+	sendErr := g.sendDiscussions(threads, pullRequestInfo, marker)
+	if sendErr != nil && (g.failFast || errors.Is(sendErr, ErrUnauthorized) || errors.Is(sendErr, ErrPermissionDenied)) {
+		return sendErr
+	}
+
+	// the identity is only decoration here, a failed lookup must not block the review
+	reviewer, _ := g.AuthenticatedUser()
+	summary := withMarker(util.Ptr(renderReviewSummary(comments, pullRequestInfo, reviewer)), summaryMarker, marker)
+	ctx, cancel := requestContext(g.apiTimeout, 0)
+	defer cancel()
+	_, _, err = g.client.Discussions.CreateMergeRequestDiscussion(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, &gitlab.CreateMergeRequestDiscussionOptions{
+		Body: summary,
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to create review summary: %w", err)
+	}
+
+	if err := g.supersedeReviews(pullRequestInfo, previous); err != nil {
+		return fmt.Errorf("failed to supersede previous review: %w", err)
+	}
+	return sendErr
+}
+
+// sendChecklist posts all findings as one non-positioned discussion and leaves no inline threads. In single comment
+// mode the note an earlier run posted is edited instead.
+func (g *GitLabService) sendChecklist(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo) error {
+	markers := []string{commentMarker}
+	if g.singleComment {
+		markers = append(markers, singleCommentMarker)
+	}
+	body := withMarker(util.Ptr(renderChecklist(comments, pullRequestInfo, gitlabBlobURL)), markers...)
+	ctx, cancel := requestContext(g.apiTimeout, 0)
+	defer cancel()
+	if g.singleComment {
+		id, err := g.findSingleComment(ctx, pullRequestInfo)
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			_, _, err := g.client.Notes.UpdateMergeRequestNote(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, id, &gitlab.UpdateMergeRequestNoteOptions{Body: body}, gitlab.WithContext(ctx))
+			if err != nil {
+				if authErr := commentAuthError(err); authErr != nil {
+					return authErr
+				}
+				return fmt.Errorf("failed to update review comment: %w", err)
+			}
+			return nil
+		}
+	}
+	_, _, err := g.client.Discussions.CreateMergeRequestDiscussion(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, &gitlab.CreateMergeRequestDiscussionOptions{
+		Body: body,
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		if authErr := commentAuthError(err); authErr != nil {
+			return authErr
+		}
+		return fmt.Errorf("failed to create review checklist: %w", err)
+	}
+	return nil
+}
+
+func (g *GitLabService) sendDiscussions(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo, marker string) error {
+	// without the diff the positions are sent as the model produced them, which GitLab accepts for most lines
+	lines, err := g.diffIndex(pullRequestInfo)
+	if err != nil {
+		log.Printf("failed to compute line codes: %v", err)
+	}
+
+	failed, err := sendConcurrently(comments, g.commentConcurrency, g.failFast, func(ctx context.Context, comment *api.InlineComment) *CommentError {
+		return sendWithRetry(ctx, comment, g.commentRetries, g.retryWaitMin, g.retryWaitMax, func(comment *api.InlineComment) *CommentError {
+			return g.sendDiscussion(comment, pullRequestInfo, lines, marker)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return &SendError{Failed: len(failed), Comments: failed}
+	}
+	return nil
+}
+
+// sendDiscussion posts one comment as a discussion, with the rest of an over-long body as notes in it.
+func (g *GitLabService) sendDiscussion(comment *api.InlineComment, pullRequestInfo *api.PullRequestInfo, lines gitlabDiffIndex, marker string) *CommentError {
+	gitlabComment := convertApiComment(comment)
+	if gitlabComment == nil {
+		return nil
+	}
+	lines.anchor(gitlabComment.Position)
+
+	chunks := g.commentChunks(renderCommentBody(comment, gitlabSuggestionFence))
+	gitlabComment.Body = withMarker(&chunks[0], marker)
+	ctx, cancel := requestContext(g.apiTimeout, 0)
+	defer cancel()
+	discussion, _, err := g.client.Discussions.CreateMergeRequestDiscussion(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, gitlabComment, gitlab.WithContext(ctx))
+	if err == nil {
+		err = g.sendReplies(ctx, pullRequestInfo, discussion.ID, chunks[1:])
+	}
+	if err != nil {
+		path := "unknown"
+		var line int64
+		if gitlabComment.Position != nil {
+			path = util.GetOrDefault(gitlabComment.Position.NewPath, util.GetOrDefault(gitlabComment.Position.OldPath, "unknown"))
+			if gitlabComment.Position.NewLine != nil {
+				line = *gitlabComment.Position.NewLine
+			} else if gitlabComment.Position.OldLine != nil {
+				line = *gitlabComment.Position.OldLine
+			}
+		}
+
+		if authErr := commentAuthError(err); authErr != nil {
+			return newCommentError(path, line, authErr)
+		}
+		g.logGitlabError(err, path, line)
+		return newCommentError(path, line, err)
+	}
+	return nil
+}
+
+// commentChunks splits an over-long body into the note and its replies when enabled, otherwise it is sent whole.
+func (g *GitLabService) commentChunks(body *string) []string {
+	text := util.GetOrDefault(body, "")
+	if !g.splitLongComments {
+		return []string{text}
+	}
+	return splitCommentBody(text, gitlabMaxNoteLength-splitReserve)
+}
+
+// sendReplies posts the remaining chunks of a split comment as notes in its discussion.
+func (g *GitLabService) sendReplies(ctx context.Context, pullRequestInfo *api.PullRequestInfo, discussionID string, chunks []string) error {
+	for _, chunk := range chunks {
+		_, _, err := g.client.Discussions.AddMergeRequestDiscussionNote(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, discussionID, &gitlab.AddMergeRequestDiscussionNoteOptions{
+			Body: util.Ptr(chunk),
+		}, gitlab.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("%w: %w", errReplyFailed, err)
+		}
+	}
+	return nil
+}
+
+// reviewDiscussion is a discussion posted by a consolidated review run.
+type reviewDiscussion struct {
+	id       string
+	note     *gitlab.Note
+	ref      reviewRef
+	summary  bool
+	resolved bool
+}
+
+// previousReviews lists the discussions earlier consolidated review runs posted on the merge request.
+func (g *GitLabService) previousReviews(pullRequestInfo *api.PullRequestInfo) ([]*reviewDiscussion, error) {
+	var reviews []*reviewDiscussion
+	opts := &gitlab.ListMergeRequestDiscussionsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		discussions, resp, err := g.client.Discussions.ListMergeRequestDiscussions(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge request discussions: %w", err)
+		}
+		for _, discussion := range discussions {
+			if discussion == nil || len(discussion.Notes) == 0 || discussion.Notes[0] == nil {
+				continue
+			}
+			first := discussion.Notes[0]
+			ref, ok := parseReviewMarker(first.Body)
+			if !ok {
+				continue
+			}
+			reviews = append(reviews, &reviewDiscussion{
+				id:       discussion.ID,
+				note:     first,
+				ref:      ref,
+				summary:  strings.Contains(first.Body, summaryMarker),
+				resolved: first.Resolved,
+			})
+		}
+		if resp.NextPage == 0 {
+			return reviews, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// supersedeConcurrency is how many discussions of earlier runs are updated at once, a long-lived merge request
+// collects hundreds. The requests still share the client's rate limit.
+const supersedeConcurrency = 4
+
+// supersedeReviews resolves the unresolved discussions of earlier runs and points their summaries at the new run.
+func (g *GitLabService) supersedeReviews(pullRequestInfo *api.PullRequestInfo, previous []*reviewDiscussion) error {
+	headSha := pullRequestInfo.HeadSha
+	if len(headSha) > 8 {
+		headSha = headSha[:8]
+	}
+	var group errgroup.Group
+	group.SetLimit(supersedeConcurrency)
+	for _, discussion := range previous {
+		group.Go(func() error {
+			return g.supersedeReview(pullRequestInfo, discussion, headSha)
+		})
+	}
+	return group.Wait()
+}
+
+// supersedeReview resolves one discussion of an earlier run, marking its summary superseded by the review of headSha.
+func (g *GitLabService) supersedeReview(pullRequestInfo *api.PullRequestInfo, discussion *reviewDiscussion, headSha string) error {
+	if discussion.summary && !strings.HasPrefix(discussion.note.Body, supersededPrefix) {
+		body := fmt.Sprintf("%s the review of `%s`._\n\n%s", supersededPrefix, headSha, discussion.note.Body)
+		_, _, err := g.client.Notes.UpdateMergeRequestNote(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, discussion.note.ID, &gitlab.UpdateMergeRequestNoteOptions{
+			Body: util.Ptr(body),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update summary of discussion %s: %w", discussion.id, err)
+		}
+	}
+	if discussion.resolved {
+		return nil
+	}
+	_, _, err := g.client.Discussions.ResolveMergeRequestDiscussion(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, discussion.id, &gitlab.ResolveMergeRequestDiscussionOptions{
+		Resolved: util.Ptr(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resolve discussion %s: %w", discussion.id, err)
+	}
+	return nil
+}
 
+// renderReviewSummary lists the findings of a consolidated review, signed by the reviewer account when known.
+func renderReviewSummary(comments []*api.InlineComment, pullRequestInfo *api.PullRequestInfo, reviewer string) string {
+	var sb strings.Builder
+	sb.WriteString("### gitex review\n\n")
+	sb.WriteString(pullRequestInfo.ChangedFilesTable())
+
+	var findings []string
 	for _, comment := range comments {
-		gitlabComment := convertApiComment(comment)
-		if gitlabComment == nil {
+		if comment == nil || comment.Position == nil {
 			continue
 		}
+		pos := comment.Position
+		path := util.GetOrDefault(pos.NewPath, util.GetOrDefault(pos.OldPath, "unknown"))
+		var line int64
+		if pos.NewLine != nil {
+			line = *pos.NewLine
+		} else if pos.OldLine != nil {
+			line = *pos.OldLine
+		}
+		title, _, _ := strings.Cut(strings.TrimSpace(util.GetOrDefault(comment.Body, "")), "\n")
+		findings = append(findings, fmt.Sprintf("- `%s:%d` %s", path, line, title))
+	}
+
+	headSha := pullRequestInfo.HeadSha
+	if len(headSha) > 8 {
+		headSha = headSha[:8]
+	}
+	if len(findings) == 0 {
+		fmt.Fprintf(&sb, "Reviewed `%s`: no findings.", headSha)
+	} else {
+		fmt.Fprintf(&sb, "Reviewed `%s`: %d findings.\n\n", headSha, len(findings))
+		sb.WriteString(strings.Join(findings, "\n"))
+	}
+	if reviewer != "" {
+		fmt.Fprintf(&sb, "\n\nReviewed by @%s", reviewer)
+	}
+	return sb.String()
+}
 
-		_, _, err := g.client.Discussions.CreateMergeRequestDiscussion(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, gitlabComment)
+// findSingleComment returns the id of the latest note single comment mode posted, 0 when there is none yet.
+func (g *GitLabService) findSingleComment(ctx context.Context, pullRequestInfo *api.PullRequestInfo) (int64, error) {
+	var id int64
+	opts := &gitlab.ListMergeRequestNotesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+		OrderBy:     util.Ptr("created_at"),
+		Sort:        util.Ptr("asc"),
+	}
+	for {
+		notes, resp, err := g.client.Notes.ListMergeRequestNotes(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, opts, gitlab.WithContext(ctx))
 		if err != nil {
-			path := "unknown"
-			var line int64
-			if gitlabComment.Position != nil {
-				path = util.GetOrDefault(gitlabComment.Position.NewPath, util.GetOrDefault(gitlabComment.Position.OldPath, "unknown"))
-				if gitlabComment.Position.NewLine != nil {
-					line = *gitlabComment.Position.NewLine
-				} else if gitlabComment.Position.OldLine != nil {
-					line = *gitlabComment.Position.OldLine
+			if authErr := commentAuthError(err); authErr != nil {
+				return 0, authErr
+			}
+			return 0, fmt.Errorf("failed to list merge request notes: %w", err)
+		}
+		for _, note := range notes {
+			if note != nil && strings.Contains(note.Body, singleCommentMarker) {
+				id = note.ID
+			}
+		}
+		if resp.NextPage == 0 {
+			return id, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *GitLabService) GetReactionStats(pullRequestInfo *api.PullRequestInfo) (*api.ReactionStats, error) {
+	stats := &api.ReactionStats{}
+	opts := &gitlab.ListMergeRequestDiscussionsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		discussions, resp, err := g.client.Discussions.ListMergeRequestDiscussions(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge request discussions: %w", err)
+		}
+		for _, discussion := range discussions {
+			for _, note := range discussion.Notes {
+				if note == nil || !hasMarker(note.Body) {
+					continue
+				}
+				stats.Comments++
+				if err := g.countNoteReactions(pullRequestInfo, note.ID, stats); err != nil {
+					return nil, err
 				}
 			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return stats, nil
+}
 
-			g.logGitlabError(err, path, line)
-			failedCount++
+func (g *GitLabService) countNoteReactions(pullRequestInfo *api.PullRequestInfo, noteID int64, stats *api.ReactionStats) error {
+	opts := &gitlab.ListAwardEmojiOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		emojis, resp, err := g.client.AwardEmoji.ListMergeRequestAwardEmojiOnNote(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, noteID, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list reactions on note %d: %w", noteID, err)
 		}
+		for _, emoji := range emojis {
+			switch emoji.Name {
+			case "thumbsup":
+				stats.ThumbsUp++
+			case "thumbsdown":
+				stats.ThumbsDown++
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
 	}
+}
 
-	if failedCount > 0 {
-		return fmt.Errorf("failed to send %d comments", failedCount)
+func (g *GitLabService) FindPullRequestURL(remoteURL, branch string) (string, error) {
+	parsed, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid remote URL: %w", err)
+	}
+	projectPath := strings.Trim(parsed.Path, "/")
+	if !strings.Contains(projectPath, "/") {
+		return "", fmt.Errorf("failed to parse project from remote URL: %s", remoteURL)
+	}
+
+	mrs, _, err := g.client.MergeRequests.ListProjectMergeRequests(projectPath, &gitlab.ListProjectMergeRequestsOptions{
+		State:        util.Ptr("opened"),
+		SourceBranch: util.Ptr(branch),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list merge requests: %w", err)
+	}
+	if len(mrs) == 0 {
+		return "", fmt.Errorf("no open merge request for branch %s in %s", branch, projectPath)
+	}
+	return mrs[0].WebURL, nil
+}
+
+// AuthenticatedUser returns the username the token belongs to. It is fetched once per run.
+func (g *GitLabService) AuthenticatedUser() (string, error) {
+	if g.identity != "" {
+		return g.identity, nil
+	}
+	user, _, err := g.client.Users.CurrentUser()
+	if err != nil {
+		if isAuthError(err) {
+			return "", fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		}
+		return "", fmt.Errorf("failed to get authenticated user: %w", err)
+	}
+	g.identity = user.Username
+	return g.identity, nil
+}
+
+func (g *GitLabService) SetCommitStatus(pullRequestInfo *api.PullRequestInfo, status *api.CommitStatus) error {
+	state := gitlab.BuildStateValue(status.State)
+	if status.State == api.CommitStatusFailure {
+		state = gitlab.Failed
+	}
+	_, _, err := g.client.Commits.SetCommitStatus(pullRequestInfo.ProjectPath, pullRequestInfo.HeadSha, &gitlab.SetCommitStatusOptions{
+		State:       state,
+		Name:        util.Ptr(status.Context),
+		Description: util.Ptr(truncateStatusDescription(status)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
 	}
 	return nil
 }
@@ -153,6 +653,9 @@ func convertInlineCommentPosition(p *api.InlineCommentPosition) *gitlab.Position
 	if p == nil {
 		return nil
 	}
+	normalizeImagePosition(p)
+	normalizeDeletedFilePosition(p)
+	normalizePaths(p)
 	var multilineBlock *api.LineRangeOptions = nil
 	var newLine *int64 = nil
 	var oldLine *int64 = nil
@@ -164,7 +667,7 @@ func convertInlineCommentPosition(p *api.InlineCommentPosition) *gitlab.Position
 		}
 		if p.LineType == "ADD" {
 			p.LineRange.Start.OldLine = nil
-			p.LineRange.End.NewLine = nil
+			p.LineRange.End.OldLine = nil
 		}
 	} else {
 		if p.LineType != "REMOVE" {
@@ -215,3 +718,8 @@ func convertInlineLinePosition(p *api.LinePositionOptions) *gitlab.LinePositionO
 		NewLine:  p.NewLine,
 	}
 }
+
+// BlobURL links to lines start to end of path at sha, a single line when end is not after start.
+func (g *GitLabService) BlobURL(pullRequestInfo *api.PullRequestInfo, sha, path string, start, end int64) string {
+	return gitlabBlobURL(pullRequestInfo.ProjectWebUrl, sha, path, start, end)
+}
@@ -1,9 +1,16 @@
 package vcs_provider
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -422,6 +429,9 @@ func TestGitLabService_GetPullRequestInfo(t *testing.T) {
 						"id": 1,
 						"iid": 1,
 						"project_id": 123,
+						"title": "Add retries",
+						"description": "Retries failed uploads.",
+						"detailed_merge_status": "mergeable",
 						"source_branch": "feature",
 						"target_branch": "main",
 						"diff_refs": {
@@ -438,7 +448,8 @@ func TestGitLabService_GetPullRequestInfo(t *testing.T) {
 						"id": 123,
 						"name": "project",
 						"path_with_namespace": "test/project",
-						"http_url_to_repo": "https://gitlab.com/test/project.git"
+						"http_url_to_repo": "https://gitlab.com/test/project.git",
+						"ssh_url_to_repo": "git@gitlab.com:test/project.git"
 					}`)
 				})
 			},
@@ -455,12 +466,21 @@ func TestGitLabService_GetPullRequestInfo(t *testing.T) {
 				if info.ProjectName != "project" {
 					t.Errorf("ProjectName = %q, want %q", info.ProjectName, "project")
 				}
+				if info.ProjectSshUrl != "git@gitlab.com:test/project.git" {
+					t.Errorf("ProjectSshUrl = %q, want %q", info.ProjectSshUrl, "git@gitlab.com:test/project.git")
+				}
 				if info.SourceBranch != "feature" {
 					t.Errorf("SourceBranch = %q, want %q", info.SourceBranch, "feature")
 				}
 				if info.TargetBranch != "main" {
 					t.Errorf("TargetBranch = %q, want %q", info.TargetBranch, "main")
 				}
+				if info.Title != "Add retries" || info.Description != "Retries failed uploads." {
+					t.Errorf("Title, Description = %q, %q", info.Title, info.Description)
+				}
+				if info.MergeStatus != api.MergeStatusClean {
+					t.Errorf("MergeStatus = %q, want %q", info.MergeStatus, api.MergeStatusClean)
+				}
 				if info.ProjectId != 123 {
 					t.Errorf("ProjectId = %d, want %d", info.ProjectId, 123)
 				}
@@ -518,6 +538,27 @@ func TestGitLabService_GetPullRequestInfo(t *testing.T) {
 	}
 }
 
+func TestGitLabService_ApiTimeout(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+	release := make(chan struct{})
+	defer close(release)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+
+	svc := &GitLabService{client: client, apiTimeout: 50 * time.Millisecond}
+	_, err := svc.GetPullRequestInfo(util.Ptr("https://gitlab.com/test/project/-/merge_requests/1"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	err = svc.SendInlineComments([]*api.InlineComment{{Body: util.Ptr("c")}}, &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+}
+
 func TestGitLabService_SendInlineComments(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -658,6 +699,200 @@ func TestGitLabService_SendInlineComments(t *testing.T) {
 	}
 }
 
+func TestGitLabService_SendInlineComments_Consolidated(t *testing.T) {
+	const previous = `[
+		{"id": "old-summary", "notes": [{"id": 1, "body": "summary\n\n<!-- gitex summary -->\n<!-- gitex review=old run=a1 -->", "resolved": false}]},
+		{"id": "old-finding", "notes": [{"id": 2, "body": "finding\n\n<!-- gitex review=old run=a1 -->", "resolved": false}]},
+		{"id": "partial-finding", "notes": [{"id": 3, "body": "finding\n\n<!-- gitex review=abcdef1234567890 run=b2 -->", "resolved": false}]},
+		{"id": "resolved-finding", "notes": [{"id": 4, "body": "finding\n\n<!-- gitex review=older -->", "resolved": true}]},
+		{"id": "standalone", "notes": [{"id": 5, "body": "finding\n\n<!-- gitex -->", "resolved": false}]},
+		{"id": "human", "notes": [{"id": 6, "body": "please fix", "resolved": false}]}
+	]`
+	const completed = `[
+		{"id": "summary", "notes": [{"id": 1, "body": "summary\n\n<!-- gitex summary -->\n<!-- gitex review=abcdef1234567890 run=c3 -->", "resolved": false}]}
+	]`
+
+	type result struct {
+		posted   []string
+		resolved []string
+		updated  map[string]string
+	}
+	run := func(t *testing.T, existing string) result {
+		t.Helper()
+		mux, server, client := setupMockServer(t)
+		defer server.Close()
+
+		res := result{updated: map[string]string{}}
+		// earlier runs are superseded concurrently
+		var mu sync.Mutex
+		mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method {
+			case http.MethodGet:
+				_, _ = fmt.Fprint(w, existing)
+			case http.MethodPost:
+				var body struct {
+					Body string `json:"body"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				res.posted = append(res.posted, body.Body)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = fmt.Fprint(w, `{"id": "new", "notes": []}`)
+			}
+		})
+		mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				mu.Lock()
+				res.resolved = append(res.resolved, strings.TrimPrefix(r.URL.Path, "/api/v4/projects/test/project/merge_requests/1/discussions/"))
+				mu.Unlock()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"id": "x", "notes": []}`)
+		})
+		mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/notes/", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Body string `json:"body"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			res.updated[strings.TrimPrefix(r.URL.Path, "/api/v4/projects/test/project/merge_requests/1/notes/")] = body.Body
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"id": 1}`)
+		})
+		mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"id": 7, "username": "gitex-bot"}`)
+		})
+
+		svc := &GitLabService{client: client, consolidatedReview: true}
+		comments := []*api.InlineComment{
+			{
+				Body: util.Ptr("Possible nil dereference\nDetails"),
+				Position: &api.InlineCommentPosition{
+					NewPath:      util.Ptr("file.go"),
+					PositionType: util.Ptr("text"),
+					NewLine:      util.Ptr(int64(10)),
+				},
+			},
+		}
+		prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1, HeadSha: "abcdef1234567890"}
+		if err := svc.SendInlineComments(comments, prInfo); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return res
+	}
+
+	t.Run("supersedes earlier runs", func(t *testing.T) {
+		res := run(t, previous)
+		if len(res.posted) != 2 {
+			t.Fatalf("posted %d discussions, want 2", len(res.posted))
+		}
+		finding, summary := res.posted[0], res.posted[1]
+		ref, ok := parseReviewMarker(summary)
+		if !ok || ref.HeadSha != "abcdef1234567890" || ref.RunID == "" {
+			t.Fatalf("summary has no review marker: %q", summary)
+		}
+		if findingRef, _ := parseReviewMarker(finding); findingRef != ref {
+			t.Errorf("finding marker %+v, want the summary's %+v", findingRef, ref)
+		}
+		if !strings.Contains(summary, summaryMarker) || strings.Contains(finding, summaryMarker) {
+			t.Errorf("summary marker on the wrong discussion: %q, %q", summary, finding)
+		}
+		if !strings.Contains(summary, "`file.go:10` Possible nil dereference") {
+			t.Errorf("summary missing finding: %q", summary)
+		}
+		if !strings.Contains(summary, "Reviewed by @gitex-bot") {
+			t.Errorf("summary missing reviewer: %q", summary)
+		}
+
+		slices.Sort(res.resolved)
+		if strings.Join(res.resolved, ",") != "old-finding,old-summary,partial-finding" {
+			t.Errorf("resolved = %v, want [old-finding old-summary partial-finding]", res.resolved)
+		}
+		if len(res.updated) != 1 || !strings.HasPrefix(res.updated["1"], "_Superseded by the review of `abcdef12`._") {
+			t.Errorf("updated notes = %v, want the old summary marked superseded", res.updated)
+		}
+		if !strings.Contains(res.updated["1"], reviewMarker("old", "a1")) {
+			t.Errorf("superseded summary lost its marker: %q", res.updated["1"])
+		}
+	})
+
+	t.Run("skips a head that was already reviewed", func(t *testing.T) {
+		res := run(t, completed)
+		if len(res.posted) != 0 || len(res.resolved) != 0 || len(res.updated) != 0 {
+			t.Errorf("expected no changes, got posted %d, resolved %v, updated %v", len(res.posted), res.resolved, res.updated)
+		}
+	})
+}
+
+func TestRenderReviewSummary(t *testing.T) {
+	t.Run("no findings", func(t *testing.T) {
+		got := renderReviewSummary(nil, &api.PullRequestInfo{HeadSha: "abcdef1234567890"}, "")
+		if !strings.Contains(got, "Reviewed `abcdef12`: no findings.") || strings.Contains(got, "Reviewed by") {
+			t.Errorf("unexpected summary: %q", got)
+		}
+	})
+
+	t.Run("old line finding", func(t *testing.T) {
+		comments := []*api.InlineComment{
+			nil,
+			{Body: util.Ptr("Removed check"), Position: &api.InlineCommentPosition{OldPath: util.Ptr("a.go"), OldLine: util.Ptr(int64(4))}},
+		}
+		got := renderReviewSummary(comments, &api.PullRequestInfo{HeadSha: "abc"}, "")
+		if !strings.Contains(got, "Reviewed `abc`: 1 findings.") || !strings.Contains(got, "- `a.go:4` Removed check") {
+			t.Errorf("unexpected summary: %q", got)
+		}
+	})
+
+	t.Run("signed by reviewer", func(t *testing.T) {
+		got := renderReviewSummary(nil, &api.PullRequestInfo{HeadSha: "abc"}, "gitex-bot")
+		if !strings.HasSuffix(got, "Reviewed by @gitex-bot") {
+			t.Errorf("unexpected summary: %q", got)
+		}
+	})
+}
+
+func TestGitLabService_GetReactionStats(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "2" {
+			_, _ = fmt.Fprint(w, `[{"id": "d2", "notes": [{"id": 12, "body": "second\n\n<!-- gitex -->"}]}]`)
+			return
+		}
+		w.Header().Set("X-Next-Page", "2")
+		_, _ = fmt.Fprint(w, `[
+			{"id": "d1", "notes": [{"id": 10, "body": "finding\n\n<!-- gitex -->"}, {"id": 11, "body": "human reply"}]}
+		]`)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/notes/10/award_emoji", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `[{"id": 1, "name": "thumbsup"}, {"id": 2, "name": "thumbsup"}, {"id": 3, "name": "rocket"}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/notes/12/award_emoji", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `[{"id": 4, "name": "thumbsdown"}]`)
+	})
+
+	svc := &GitLabService{client: client}
+	stats, err := svc.GetReactionStats(&api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Comments != 2 {
+		t.Errorf("Comments = %d, want 2", stats.Comments)
+	}
+	if stats.ThumbsUp != 2 {
+		t.Errorf("ThumbsUp = %d, want 2", stats.ThumbsUp)
+	}
+	if stats.ThumbsDown != 1 {
+		t.Errorf("ThumbsDown = %d, want 1", stats.ThumbsDown)
+	}
+}
+
 func setupMockServer(t *testing.T) (*http.ServeMux, *httptest.Server, *gitlab.Client) {
 	t.Helper()
 	mux := http.NewServeMux()
@@ -670,3 +905,672 @@ func setupMockServer(t *testing.T) (*http.ServeMux, *httptest.Server, *gitlab.Cl
 
 	return mux, server, client
 }
+
+func TestGitLabService_FindPullRequestURL(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/group%2Fsub%2Fproject/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("state") != "opened" || r.URL.Query().Get("source_branch") != "feature" {
+			_, _ = fmt.Fprint(w, `[]`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `[{"iid": 3, "web_url": "https://gitlab.com/group/sub/project/-/merge_requests/3"}]`)
+	})
+
+	svc := &GitLabService{client: client}
+
+	t.Run("finds open merge request", func(t *testing.T) {
+		got, err := svc.FindPullRequestURL("https://gitlab.com/group/sub/project", "feature")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != "https://gitlab.com/group/sub/project/-/merge_requests/3" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("error when no merge request is open", func(t *testing.T) {
+		if _, err := svc.FindPullRequestURL("https://gitlab.com/group/sub/project", "other"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("error on invalid remote", func(t *testing.T) {
+		if _, err := svc.FindPullRequestURL("https://gitlab.com/project", "feature"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestConvertInlineCommentPosition_DeletedFile(t *testing.T) {
+	t.Run("single line on deleted file uses old path and old line", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			OldPath:     util.Ptr("legacy.go"),
+			NewPath:     util.Ptr("/dev/null"),
+			NewLine:     util.Ptr(int64(12)),
+			CommentType: "SINGLE_LINE",
+			LineType:    "UNCHANGED",
+		})
+		if got.NewLine != nil {
+			t.Errorf("NewLine = %d, want nil", *got.NewLine)
+		}
+		if got.OldLine == nil || *got.OldLine != 12 {
+			t.Errorf("OldLine = %v, want 12", got.OldLine)
+		}
+		if *got.OldPath != "legacy.go" || *got.NewPath != "legacy.go" {
+			t.Errorf("paths = %s -> %s, want legacy.go for both", *got.OldPath, *got.NewPath)
+		}
+	})
+
+	t.Run("multi line on deleted file flagged by the model", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			OldPath:     util.Ptr("legacy.go"),
+			NewPath:     util.Ptr("legacy.go"),
+			DeletedFile: true,
+			CommentType: "MULTI_LINE",
+			LineType:    "ADD",
+			LineRange: &api.LineRangeOptions{
+				Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(3))},
+				End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(8))},
+			},
+		})
+		start, end := got.LineRange.Start, got.LineRange.End
+		if start.NewLine != nil || end.NewLine != nil {
+			t.Error("expected no new lines in line range")
+		}
+		if start.OldLine == nil || *start.OldLine != 3 || end.OldLine == nil || *end.OldLine != 8 {
+			t.Errorf("line range = %v-%v, want 3-8", start.OldLine, end.OldLine)
+		}
+	})
+}
+
+func TestGitLabService_SetCommitStatus(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	var got map[string]any
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id": 1}`)
+	})
+
+	svc := &GitLabService{client: client}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", HeadSha: "abc123"}
+
+	tests := []struct {
+		state     api.CommitStatusState
+		wantState string
+	}{
+		{state: api.CommitStatusPending, wantState: "pending"},
+		{state: api.CommitStatusSuccess, wantState: "success"},
+		{state: api.CommitStatusFailure, wantState: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			err := svc.SetCommitStatus(prInfo, &api.CommitStatus{State: tt.state, Context: "gitex-style", Description: "desc"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got["state"] != tt.wantState {
+				t.Errorf("state = %v, want %s", got["state"], tt.wantState)
+			}
+			if got["name"] != "gitex-style" {
+				t.Errorf("name = %v, want gitex-style", got["name"])
+			}
+		})
+	}
+}
+
+func TestConvertInlineCommentPosition_MultiLine(t *testing.T) {
+	lineRange := func() *api.LineRangeOptions {
+		return &api.LineRangeOptions{
+			Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(10)), OldLine: util.Ptr(int64(8))},
+			End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(14)), OldLine: util.Ptr(int64(12))},
+		}
+	}
+
+	t.Run("added lines keep only new lines on both ends", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			NewPath: util.Ptr("main.go"), CommentType: "MULTI_LINE", LineType: "ADD", LineRange: lineRange(),
+		})
+		start, end := got.LineRange.Start, got.LineRange.End
+		if start.NewLine == nil || *start.NewLine != 10 || end.NewLine == nil || *end.NewLine != 14 {
+			t.Errorf("new lines = %v..%v, want 10..14", start.NewLine, end.NewLine)
+		}
+		if start.OldLine != nil || end.OldLine != nil {
+			t.Errorf("old lines = %v..%v, want none", start.OldLine, end.OldLine)
+		}
+	})
+
+	t.Run("removed lines keep only old lines on both ends", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			OldPath: util.Ptr("main.go"), CommentType: "MULTI_LINE", LineType: "REMOVE", LineRange: lineRange(),
+		})
+		start, end := got.LineRange.Start, got.LineRange.End
+		if start.OldLine == nil || *start.OldLine != 8 || end.OldLine == nil || *end.OldLine != 12 {
+			t.Errorf("old lines = %v..%v, want 8..12", start.OldLine, end.OldLine)
+		}
+		if start.NewLine != nil || end.NewLine != nil {
+			t.Errorf("new lines = %v..%v, want none", start.NewLine, end.NewLine)
+		}
+	})
+}
+
+func TestConvertInlineCommentPosition_Rename(t *testing.T) {
+	t.Run("renamed file keeps both paths", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			OldPath:  util.Ptr("old_name.go"),
+			NewPath:  util.Ptr("new_name.go"),
+			OldLine:  util.Ptr(int64(10)),
+			NewLine:  util.Ptr(int64(10)),
+			LineType: "UNCHANGED",
+		})
+		if *got.OldPath != "old_name.go" || *got.NewPath != "new_name.go" {
+			t.Errorf("paths = %s -> %s, want old_name.go -> new_name.go", *got.OldPath, *got.NewPath)
+		}
+		if got.OldLine == nil || got.NewLine == nil {
+			t.Error("expected both lines for an unchanged line")
+		}
+	})
+
+	t.Run("missing old path is filled from new path", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			NewPath:  util.Ptr("main.go"),
+			NewLine:  util.Ptr(int64(3)),
+			LineType: "ADD",
+		})
+		if got.OldPath == nil || *got.OldPath != "main.go" {
+			t.Errorf("OldPath = %v, want main.go", got.OldPath)
+		}
+	})
+
+	t.Run("missing new path is filled from old path", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			OldPath:  util.Ptr("main.go"),
+			OldLine:  util.Ptr(int64(3)),
+			LineType: "REMOVE",
+		})
+		if got.NewPath == nil || *got.NewPath != "main.go" {
+			t.Errorf("NewPath = %v, want main.go", got.NewPath)
+		}
+	})
+}
+
+func TestConvertInlineCommentPosition_Image(t *testing.T) {
+	t.Run("image position forwards coordinates only", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			PositionType: util.Ptr(api.PositionTypeImage),
+			NewPath:      util.Ptr("assets/logo.png"),
+			NewLine:      util.Ptr(int64(1)),
+			CommentType:  "SINGLE_LINE",
+			Width:        util.Ptr(int64(200)),
+			Height:       util.Ptr(int64(100)),
+			X:            util.Ptr(10.0),
+			Y:            util.Ptr(20.0),
+		})
+		if got.NewLine != nil || got.OldLine != nil || got.LineRange != nil {
+			t.Error("expected no line fields on an image position")
+		}
+		if got.Width == nil || *got.Width != 200 || got.Height == nil || *got.Height != 100 {
+			t.Errorf("size = %v x %v, want 200 x 100", got.Width, got.Height)
+		}
+		if got.X == nil || *got.X != 10 || got.Y == nil || *got.Y != 20 {
+			t.Errorf("point = %v, %v, want 10, 20", got.X, got.Y)
+		}
+		if got.OldPath == nil || *got.OldPath != "assets/logo.png" {
+			t.Errorf("OldPath = %v, want assets/logo.png", got.OldPath)
+		}
+	})
+
+	t.Run("text position drops image fields", func(t *testing.T) {
+		got := convertInlineCommentPosition(&api.InlineCommentPosition{
+			PositionType: util.Ptr(api.PositionTypeText),
+			NewPath:      util.Ptr("main.go"),
+			NewLine:      util.Ptr(int64(3)),
+			LineType:     "ADD",
+			Width:        util.Ptr(int64(200)),
+			X:            util.Ptr(10.0),
+		})
+		if got.Width != nil || got.Height != nil || got.X != nil || got.Y != nil {
+			t.Error("expected image fields to be dropped on a text position")
+		}
+		if got.NewLine == nil || *got.NewLine != 3 {
+			t.Errorf("NewLine = %v, want 3", got.NewLine)
+		}
+	})
+}
+
+func TestGitLabService_SendInlineComments_FailFast(t *testing.T) {
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("c1"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("a.go"), NewLine: util.Ptr(int64(1))}},
+		{Body: util.Ptr("c2"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("b.go"), NewLine: util.Ptr(int64(2))}},
+	}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1}
+
+	tests := []struct {
+		name      string
+		status    int
+		failFast  bool
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "validation errors continue by default", status: http.StatusBadRequest, wantCalls: 2},
+		{name: "validation error stops with fail-fast", status: http.StatusBadRequest, failFast: true, wantCalls: 1},
+		{name: "unauthorized always stops", status: http.StatusUnauthorized, wantCalls: 1, wantErr: ErrUnauthorized},
+		{name: "forbidden always stops", status: http.StatusForbidden, wantCalls: 1, wantErr: ErrPermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, server, client := setupMockServer(t)
+			defer server.Close()
+
+			calls := 0
+			mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, `{"message": "rejected"}`)
+			})
+
+			svc := &GitLabService{client: client, failFast: tt.failFast}
+			err := svc.SendInlineComments(comments, prInfo)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			var commentErr *CommentError
+			if tt.wantErr == nil && (!errors.As(err, &commentErr) || commentErr.Path != "a.go" || commentErr.Line != 1 || commentErr.StatusCode != tt.status) {
+				t.Errorf("expected the first comment's error with status %d, got %v", tt.status, err)
+			}
+			for _, sentinel := range []error{ErrUnauthorized, ErrPermissionDenied} {
+				if errors.Is(err, sentinel) != (sentinel == tt.wantErr) {
+					t.Errorf("errors.Is(err, %q) = %v, want %v", sentinel, !(sentinel == tt.wantErr), sentinel == tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestGitLabService_SendInlineComments_Concurrency(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	const total, concurrency = 12, 4
+	var comments []*api.InlineComment
+	for i := range total {
+		path := "a.go"
+		if i%4 == 0 {
+			path = "reject.go"
+		}
+		comments = append(comments, &api.InlineComment{Body: util.Ptr(fmt.Sprintf("c%d", i)),
+			Position: &api.InlineCommentPosition{NewPath: util.Ptr(path), NewLine: util.Ptr(int64(i + 1))}})
+	}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1}
+
+	var mu sync.Mutex
+	var calls, inFlight, maxInFlight int
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		var body gitlab.CreateMergeRequestDiscussionOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		calls++
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if body.Position != nil && util.GetOrDefault(body.Position.NewPath, "") == "reject.go" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"message": "rejected"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": "d1", "notes": []}`)
+	})
+
+	svc := &GitLabService{client: client, commentConcurrency: concurrency}
+	err := svc.SendInlineComments(comments, prInfo)
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.Failed != total/4 {
+		t.Fatalf("expected %d failed comments, got %v", total/4, err)
+	}
+	if err.Error() != fmt.Sprintf("failed to send %d comments", total/4) {
+		t.Errorf("error = %q", err)
+	}
+	for i, commentErr := range sendErr.Comments {
+		// ordered by line although they finished in any order
+		if commentErr.Path != "reject.go" || commentErr.Line != int64(i*4+1) || commentErr.StatusCode != http.StatusBadRequest || commentErr.Message != "{message: rejected}" {
+			t.Errorf("comment error %d = %+v", i, commentErr)
+		}
+	}
+	if calls != total {
+		t.Errorf("calls = %d, want %d", calls, total)
+	}
+	if maxInFlight > concurrency || maxInFlight < 2 {
+		t.Errorf("%d comments sent at once, want between 2 and %d", maxInFlight, concurrency)
+	}
+}
+
+func TestGitLabService_AuthenticatedUser(t *testing.T) {
+	t.Run("fetches the user once", func(t *testing.T) {
+		mux, server, client := setupMockServer(t)
+		defer server.Close()
+
+		calls := 0
+		mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"id": 7, "username": "gitex-bot"}`)
+		})
+
+		svc := &GitLabService{client: client}
+		for range 2 {
+			user, err := svc.AuthenticatedUser()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user != "gitex-bot" {
+				t.Errorf("user = %q, want gitex-bot", user)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+
+	t.Run("rejected token", func(t *testing.T) {
+		mux, server, client := setupMockServer(t)
+		defer server.Close()
+
+		mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"message": "401 Unauthorized"}`)
+		})
+
+		svc := &GitLabService{client: client}
+		if _, err := svc.AuthenticatedUser(); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("expected ErrUnauthorized, got %v", err)
+		}
+	})
+}
+
+func TestGitLabService_SendInlineComments_Checklist(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	var posted []gitlab.CreateMergeRequestDiscussionOptions
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		var body gitlab.CreateMergeRequestDiscussionOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		posted = append(posted, body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": "new", "notes": []}`)
+	})
+
+	svc := &GitLabService{client: client, checklist: true}
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("Possible nil dereference"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("file.go"), NewLine: util.Ptr(int64(10))}},
+		{Body: util.Ptr("Unused variable"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("other.go"), NewLine: util.Ptr(int64(3))}},
+	}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1, HeadSha: "abc", ProjectWebUrl: "https://gitlab.com/test/project"}
+
+	if err := svc.SendInlineComments(comments, prInfo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(posted) != 1 {
+		t.Fatalf("posted %d discussions, want 1", len(posted))
+	}
+	if posted[0].Position != nil {
+		t.Error("checklist must not be positioned")
+	}
+	body := util.GetOrDefault(posted[0].Body, "")
+	if !strings.Contains(body, "- [ ] [`file.go:10`](https://gitlab.com/test/project/-/blob/abc/file.go#L10) Possible nil dereference") ||
+		!strings.Contains(body, commentMarker) {
+		t.Errorf("unexpected checklist: %q", body)
+	}
+}
+
+func TestGitLabService_SendInlineComments_SingleComment(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	var updated []string
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `[{"id": 11, "body": "lgtm"}, {"id": 12, "body": %q}]`, "### gitex review\n\n"+commentMarker+"\n"+singleCommentMarker)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/notes/12", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("method = %s, want PUT", r.Method)
+		}
+		var body gitlab.UpdateMergeRequestNoteOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		updated = append(updated, util.GetOrDefault(body.Body, ""))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id": 12}`)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the note of the last run to be edited, not a new discussion")
+	})
+
+	svc := &GitLabService{client: client, checklist: true, singleComment: true}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1, HeadSha: "abc"}
+	if err := svc.SendInlineComments(nil, prInfo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updated) != 1 || !strings.Contains(updated[0], "Reviewed `abc`: no findings.") || !strings.HasSuffix(updated[0], singleCommentMarker) {
+		t.Errorf("updated = %q", updated)
+	}
+}
+
+func TestGitLabService_SendInlineComments_SplitLongComments(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	var discussions int
+	var replies []string
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		discussions++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": "d1", "notes": []}`)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions/d1/notes", func(w http.ResponseWriter, r *http.Request) {
+		var body gitlab.AddMergeRequestDiscussionNoteOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		replies = append(replies, util.GetOrDefault(body.Body, ""))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": 2}`)
+	})
+
+	svc := &GitLabService{client: client, splitLongComments: true}
+	comments := []*api.InlineComment{{
+		Body:     util.Ptr(strings.Repeat("x", gitlabMaxNoteLength) + "\n\ntail"),
+		Position: &api.InlineCommentPosition{NewPath: util.Ptr("file.go"), NewLine: util.Ptr(int64(10))},
+	}}
+	if err := svc.SendInlineComments(comments, &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if discussions != 1 || len(replies) != 1 || !strings.HasPrefix(replies[0], "_(continued 2/2)_") {
+		t.Errorf("discussions = %d, replies = %d, want 1 and 1", discussions, len(replies))
+	}
+}
+
+func TestGitLabService_CommentOnPullRequest(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	var body map[string]any
+	mux.HandleFunc("/api/v4/projects/group%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": "abc", "notes": [{"id": 1}]}`)
+	})
+
+	svc := &GitLabService{client: client}
+	err := svc.CommentOnPullRequest(&api.PullRequestInfo{ProjectPath: "group/project", PullRequestId: 1}, "description review")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["body"] != "description review\n\n"+commentMarker {
+		t.Errorf("body = %v", body["body"])
+	}
+	if _, ok := body["position"]; ok {
+		t.Error("description review must not be positioned on the diff")
+	}
+}
+
+func TestGitlabMergeStatus(t *testing.T) {
+	tests := []struct {
+		hasConflicts bool
+		detailed     string
+		want         string
+	}{
+		{detailed: "mergeable", want: api.MergeStatusClean},
+		{detailed: "not_approved", want: api.MergeStatusClean},
+		{detailed: "conflict", want: api.MergeStatusConflict},
+		{hasConflicts: true, detailed: "ci_must_pass", want: api.MergeStatusConflict},
+		{detailed: "checking", want: api.MergeStatusChecking},
+		{detailed: "unchecked", want: api.MergeStatusChecking},
+		{detailed: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := gitlabMergeStatus(tt.hasConflicts, tt.detailed); got != tt.want {
+			t.Errorf("gitlabMergeStatus(%v, %q) = %q, want %q", tt.hasConflicts, tt.detailed, got, tt.want)
+		}
+	}
+}
+
+func TestGitLabService_SupersedeReviews_ManyPages(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	const pages, perPage = 3, 100
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		if page < pages {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		}
+		var discussions []string
+		for i := range perPage {
+			id := fmt.Sprintf("d%d", (page-1)*perPage+i)
+			discussions = append(discussions, fmt.Sprintf(`{"id": %q, "notes": [{"id": 1, "body": "finding\n\n<!-- gitex review=old run=a1 -->"}]}`, id))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, "[%s]", strings.Join(discussions, ","))
+	})
+
+	var mu sync.Mutex
+	resolved := map[string]bool{}
+	var inFlight, maxInFlight int
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		resolved[strings.TrimPrefix(r.URL.Path, "/api/v4/projects/test/project/merge_requests/1/discussions/")] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id": "x", "notes": []}`)
+	})
+
+	svc := &GitLabService{client: client}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1, HeadSha: "abcdef1234567890"}
+	previous, err := svc.previousReviews(prInfo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(previous) != pages*perPage {
+		t.Fatalf("listed %d discussions, want %d", len(previous), pages*perPage)
+	}
+	if err := svc.supersedeReviews(prInfo, previous); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resolved) != pages*perPage || !resolved["d0"] || !resolved[fmt.Sprintf("d%d", pages*perPage-1)] {
+		t.Errorf("resolved %d discussions, want all %d", len(resolved), pages*perPage)
+	}
+	if maxInFlight > supersedeConcurrency {
+		t.Errorf("%d discussions resolved at once, want at most %d", maxInFlight, supersedeConcurrency)
+	}
+}
+
+func TestGitLabService_SendInlineComments_Retries(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// the client's own retries are off, only the comment retries resend
+	client, err := gitlab.NewClient("test-token", gitlab.WithBaseURL(server.URL), gitlab.WithoutRetries())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comments := []*api.InlineComment{
+		{Body: util.Ptr("rejected"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("reject.go"), NewLine: util.Ptr(int64(1))}},
+		{Body: util.Ptr("rate limited"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("flaky.go"), NewLine: util.Ptr(int64(2))}},
+		{Body: util.Ptr("dropped"), Position: &api.InlineCommentPosition{NewPath: util.Ptr("dropped.go"), NewLine: util.Ptr(int64(3))}},
+	}
+	prInfo := &api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1}
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		var body gitlab.CreateMergeRequestDiscussionOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		path := util.GetOrDefault(body.Position.NewPath, "")
+		mu.Lock()
+		calls[path]++
+		attempt := calls[path]
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case path == "reject.go":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = fmt.Fprint(w, `{"message": "line_code can't be blank"}`)
+		case path == "dropped.go":
+			// the connection drops after the request was written, the comment may have been posted
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		case attempt == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `{"id": "d1", "notes": []}`)
+		}
+	})
+
+	svc := &GitLabService{client: client, commentRetries: 1}
+	err = svc.SendInlineComments(comments, prInfo)
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.Failed != 2 || sendErr.Comments[0].Path != "dropped.go" || sendErr.Comments[1].Path != "reject.go" {
+		t.Fatalf("expected the rejected and the dropped comment to fail, got %v", err)
+	}
+	if calls["reject.go"] != 1 {
+		t.Errorf("422 sent %d times, want once", calls["reject.go"])
+	}
+	if calls["flaky.go"] != 2 {
+		t.Errorf("comment after a 429 sent %d times, want 2", calls["flaky.go"])
+	}
+	if calls["dropped.go"] != 1 {
+		t.Errorf("comment whose connection broke after the request sent %d times, want once", calls["dropped.go"])
+	}
+}
@@ -0,0 +1,60 @@
+package vcs_provider
+
+import (
+	"fmt"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+	"github.com/google/go-github/v81/github"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// labelColor is used for labels gitex has to create.
+const labelColor = "5319e7"
+
+// AddLabel adds label to the pull request, creating it in the repository first when it does not exist.
+func (g *GitHubService) AddLabel(pullRequestInfo *api.PullRequestInfo, label string) error {
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancelFunc()
+
+	owner, repo := pullRequestInfo.Owner, pullRequestInfo.ProjectName
+	if _, _, err := g.client.Issues.GetLabel(ctx, owner, repo, label); err != nil {
+		if !isNotFoundError(err) {
+			return labelError("failed to look up label", label, err)
+		}
+		if _, _, err := g.client.Issues.CreateLabel(ctx, owner, repo, &github.Label{Name: util.Ptr(label), Color: util.Ptr(labelColor)}); err != nil {
+			return labelError("label does not exist and could not be created", label, err)
+		}
+	}
+	if _, _, err := g.client.Issues.AddLabelsToIssue(ctx, owner, repo, int(pullRequestInfo.PullRequestId), []string{label}); err != nil {
+		return labelError("failed to add label", label, err)
+	}
+	return nil
+}
+
+// AddLabel adds label to the merge request, creating it in the project first when it does not exist.
+func (g *GitLabService) AddLabel(pullRequestInfo *api.PullRequestInfo, label string) error {
+	project := pullRequestInfo.ProjectPath
+	if _, _, err := g.client.Labels.GetLabel(project, label); err != nil {
+		if !isNotFoundError(err) {
+			return labelError("failed to look up label", label, err)
+		}
+		if _, _, err := g.client.Labels.CreateLabel(project, &gitlab.CreateLabelOptions{Name: util.Ptr(label), Color: util.Ptr("#" + labelColor)}); err != nil {
+			return labelError("label does not exist and could not be created", label, err)
+		}
+	}
+	_, _, err := g.client.MergeRequests.UpdateMergeRequest(project, pullRequestInfo.PullRequestId, &gitlab.UpdateMergeRequestOptions{
+		AddLabels: &gitlab.LabelOptions{label},
+	})
+	if err != nil {
+		return labelError("failed to add label", label, err)
+	}
+	return nil
+}
+
+func labelError(msg, label string, err error) error {
+	if isAuthError(err) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	return fmt.Errorf("%s %q: %w", msg, label, err)
+}
@@ -0,0 +1,106 @@
+package vcs_provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestGitHubService_AddLabel(t *testing.T) {
+	prInfo := &api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 7}
+
+	tests := []struct {
+		name      string
+		getStatus int
+		create    int
+		wantCalls []string
+		wantErr   bool
+		wantAuth  bool
+	}{
+		{name: "existing label", getStatus: http.StatusOK,
+			wantCalls: []string{"GET /labels/gitex-reviewed", "POST /issues/7/labels"}},
+		{name: "missing label is created", getStatus: http.StatusNotFound, create: http.StatusCreated,
+			wantCalls: []string{"GET /labels/gitex-reviewed", "POST /labels", "POST /issues/7/labels"}},
+		{name: "label cannot be created", getStatus: http.StatusNotFound, create: http.StatusUnprocessableEntity,
+			wantCalls: []string{"GET /labels/gitex-reviewed", "POST /labels"}, wantErr: true},
+		{name: "rejected token", getStatus: http.StatusUnauthorized,
+			wantCalls: []string{"GET /labels/gitex-reviewed"}, wantErr: true, wantAuth: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path := r.URL.Path[len("/api/v3/repos/owner/repo"):]
+				calls = append(calls, r.Method+" "+path)
+				switch {
+				case r.Method == http.MethodGet:
+					w.WriteHeader(tt.getStatus)
+				case path == "/labels":
+					var label map[string]any
+					_ = json.NewDecoder(r.Body).Decode(&label)
+					if label["name"] != "gitex-reviewed" || label["color"] != labelColor {
+						t.Errorf("unexpected label %v", label)
+					}
+					w.WriteHeader(tt.create)
+				default:
+					_, _ = fmt.Fprint(w, `[]`)
+					return
+				}
+				_, _ = fmt.Fprint(w, `{}`)
+			}))
+			defer server.Close()
+
+			svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+			err := svc.AddLabel(prInfo, "gitex-reviewed")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrUnauthorized) != tt.wantAuth {
+				t.Errorf("errors.Is(err, ErrUnauthorized) = %v, want %v", !tt.wantAuth, tt.wantAuth)
+			}
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGitLabService_AddLabel(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	var created, added bool
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/labels/gitex-reviewed", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"message": "404 Label Not Found"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/labels", func(w http.ResponseWriter, r *http.Request) {
+		var label map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&label)
+		created = label["name"] == "gitex-reviewed" && label["color"] == "#"+labelColor
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": 1, "name": "gitex-reviewed"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/test%2Fproject/merge_requests/1", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		added = r.Method == http.MethodPut && body["add_labels"] == "gitex-reviewed"
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"iid": 1}`)
+	})
+
+	svc := &GitLabService{client: client}
+	if err := svc.AddLabel(&api.PullRequestInfo{ProjectPath: "test/project", PullRequestId: 1}, "gitex-reviewed"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !created || !added {
+		t.Errorf("created = %v, added = %v, want both", created, added)
+	}
+}
@@ -0,0 +1,66 @@
+package vcs_provider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+const (
+	// markerPrefix starts every invisible tag gitex appends to the comments it posts, so later runs can find them.
+	markerPrefix = "<!-- gitex"
+	// commentMarker tags a standalone comment.
+	commentMarker = "<!-- gitex -->"
+	// summaryMarker tags the summary discussion of a consolidated review.
+	summaryMarker = "<!-- gitex summary -->"
+	// singleCommentMarker tags the one comment single comment mode keeps editing.
+	singleCommentMarker = "<!-- gitex single -->"
+	// supersededPrefix starts the summary of a consolidated review that a later run replaced.
+	supersededPrefix = "_Superseded by"
+)
+
+var reviewMarkerRegex = regexp.MustCompile(`<!-- gitex review=([0-9a-zA-Z]*)(?: run=([0-9a-zA-Z]+))? -->`)
+
+// reviewMarker tags every discussion of one consolidated review with the head SHA it was generated for and the id
+// of the run that posted it.
+func reviewMarker(headSha, runID string) string {
+	if runID == "" {
+		return fmt.Sprintf("<!-- gitex review=%s -->", headSha)
+	}
+	return fmt.Sprintf("<!-- gitex review=%s run=%s -->", headSha, runID)
+}
+
+// reviewRef identifies the consolidated review run a discussion belongs to. Discussions posted before runs had ids
+// have an empty RunID and count as one run per head SHA.
+type reviewRef struct {
+	HeadSha string
+	RunID   string
+}
+
+// newRunID returns a random id for the discussions of one consolidated review run.
+func newRunID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func withMarker(body *string, markers ...string) *string {
+	return util.Ptr(util.GetOrDefault(body, "") + "\n\n" + strings.Join(markers, "\n"))
+}
+
+func hasMarker(body string) bool {
+	return strings.Contains(body, markerPrefix)
+}
+
+// parseReviewMarker returns the consolidated review run a discussion body belongs to.
+func parseReviewMarker(body string) (reviewRef, bool) {
+	match := reviewMarkerRegex.FindStringSubmatch(body)
+	if match == nil {
+		return reviewRef{}, false
+	}
+	return reviewRef{HeadSha: match[1], RunID: match[2]}, true
+}
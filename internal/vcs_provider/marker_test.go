@@ -0,0 +1,73 @@
+package vcs_provider
+
+import (
+	"testing"
+
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestWithMarker(t *testing.T) {
+	t.Run("appends marker to body", func(t *testing.T) {
+		got := withMarker(util.Ptr("finding"), commentMarker)
+		if *got != "finding\n\n"+commentMarker {
+			t.Errorf("withMarker() = %q", *got)
+		}
+		if !hasMarker(*got) {
+			t.Error("expected marked body to be detected")
+		}
+	})
+
+	t.Run("multiple markers", func(t *testing.T) {
+		got := withMarker(util.Ptr("summary"), summaryMarker, reviewMarker("abc123", ""))
+		if *got != "summary\n\n"+summaryMarker+"\n"+reviewMarker("abc123", "") {
+			t.Errorf("withMarker() = %q", *got)
+		}
+	})
+
+	t.Run("nil body", func(t *testing.T) {
+		got := withMarker(nil, commentMarker)
+		if !hasMarker(*got) {
+			t.Error("expected marker on nil body")
+		}
+	})
+
+	t.Run("plain body has no marker", func(t *testing.T) {
+		if hasMarker("looks good to me") {
+			t.Error("expected no marker")
+		}
+	})
+}
+
+func TestParseReviewMarker(t *testing.T) {
+	t.Run("marked body", func(t *testing.T) {
+		ref, ok := parseReviewMarker("finding\n\n" + reviewMarker("abc123", "f00d42"))
+		if !ok || ref != (reviewRef{HeadSha: "abc123", RunID: "f00d42"}) {
+			t.Errorf("parseReviewMarker() = %+v, %v", ref, ok)
+		}
+	})
+
+	t.Run("marker without run id", func(t *testing.T) {
+		ref, ok := parseReviewMarker("finding\n\n<!-- gitex review=abc123 -->")
+		if !ok || ref != (reviewRef{HeadSha: "abc123"}) {
+			t.Errorf("parseReviewMarker() = %+v, %v", ref, ok)
+		}
+	})
+
+	t.Run("standalone comment", func(t *testing.T) {
+		if _, ok := parseReviewMarker("finding\n\n" + commentMarker); ok {
+			t.Error("expected no review marker")
+		}
+	})
+
+	t.Run("run ids differ", func(t *testing.T) {
+		if newRunID() == newRunID() {
+			t.Error("expected distinct run ids")
+		}
+	})
+
+	t.Run("review marker counts as gitex marker", func(t *testing.T) {
+		if !hasMarker(reviewMarker("abc123", "")) {
+			t.Error("expected review marker to be detected")
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package vcs_provider
+
+import "net/http"
+
+type serviceOptions struct {
+	httpClient *http.Client
+}
+
+// Option customizes a provider service created by NewGitHubService or NewGitLabService.
+type Option func(*serviceOptions)
+
+// WithHTTPClient makes the provider use the given client as is, instead of the default retrying and rate limited one.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *serviceOptions) {
+		o.httpClient = client
+	}
+}
+
+func applyOptions(opts []Option) *serviceOptions {
+	o := &serviceOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
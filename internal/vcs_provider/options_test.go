@@ -0,0 +1,57 @@
+package vcs_provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests = append(r.requests, req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	t.Run("github uses the injected client", func(t *testing.T) {
+		recorder := &recordingTransport{}
+		svc, err := NewGitHubService(&api.Config{VcsRemoteUrl: server.URL}, WithHTTPClient(&http.Client{Transport: recorder}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _ = svc.GetReactionStats(&api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1})
+		if len(recorder.requests) != 1 {
+			t.Errorf("expected 1 request through the injected client, got %d", len(recorder.requests))
+		}
+	})
+
+	t.Run("gitlab uses the injected client", func(t *testing.T) {
+		recorder := &recordingTransport{}
+		svc, err := NewGitLabService(&api.Config{VcsRemoteUrl: server.URL}, WithHTTPClient(&http.Client{Transport: recorder}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, _ = svc.GetReactionStats(&api.PullRequestInfo{ProjectPath: "group/project", PullRequestId: 1})
+		if len(recorder.requests) != 1 {
+			t.Errorf("expected 1 request through the injected client, got %d", len(recorder.requests))
+		}
+	})
+
+	t.Run("no option keeps the default client", func(t *testing.T) {
+		if o := applyOptions(nil); o.httpClient != nil {
+			t.Error("expected no client without options")
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package vcs_provider
+
+import (
+	"fmt"
+
+	"github.com/google/go-github/v81/github"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// OwnerHandles returns @login and the @org/team handles of the teams the token's user is a member of. Listing teams
+// needs the read:org scope for classic tokens.
+func (g *GitHubService) OwnerHandles() ([]string, error) {
+	login, err := g.AuthenticatedUser()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultCommentTimeout)
+	defer cancelFunc()
+
+	handles := []string{"@" + login}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		teams, resp, err := g.client.Teams.ListUserTeams(ctx, opts)
+		if err != nil {
+			return nil, ownersError(err)
+		}
+		for _, team := range teams {
+			handles = append(handles, "@"+team.GetOrganization().GetLogin()+"/"+team.GetSlug())
+		}
+		if resp.NextPage == 0 {
+			return handles, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// OwnerHandles returns @username and the @group/subgroup handles of the groups the token's user is a member of.
+func (g *GitLabService) OwnerHandles() ([]string, error) {
+	username, err := g.AuthenticatedUser()
+	if err != nil {
+		return nil, err
+	}
+
+	handles := []string{"@" + username}
+	opts := &gitlab.ListGroupsOptions{
+		ListOptions:    gitlab.ListOptions{PerPage: 100},
+		MinAccessLevel: gitlab.Ptr(gitlab.GuestPermissions),
+	}
+	for {
+		groups, resp, err := g.client.Groups.ListGroups(opts)
+		if err != nil {
+			return nil, ownersError(err)
+		}
+		for _, group := range groups {
+			handles = append(handles, "@"+group.FullPath)
+		}
+		if resp.NextPage == 0 {
+			return handles, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func ownersError(err error) error {
+	if isAuthError(err) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	return fmt.Errorf("failed to list the teams of the token's user: %w", err)
+}
@@ -0,0 +1,92 @@
+package vcs_provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestGitHubService_OwnerHandles(t *testing.T) {
+	tests := []struct {
+		name        string
+		teamsStatus int
+		want        []string
+		wantAuth    bool
+	}{
+		{name: "user and teams", teamsStatus: http.StatusOK, want: []string{"@gitex-bot", "@acme/payments", "@acme/platform"}},
+		{name: "token without read:org", teamsStatus: http.StatusForbidden, wantAuth: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/user":
+					_ = json.NewEncoder(w).Encode(map[string]any{"login": "gitex-bot"})
+				case "/api/v3/user/teams":
+					w.WriteHeader(tt.teamsStatus)
+					if tt.teamsStatus != http.StatusOK {
+						_, _ = fmt.Fprint(w, `{"message": "Resource not accessible"}`)
+						return
+					}
+					_ = json.NewEncoder(w).Encode([]map[string]any{
+						{"slug": "payments", "organization": map[string]any{"login": "acme"}},
+						{"slug": "platform", "organization": map[string]any{"login": "acme"}},
+					})
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+			handles, err := svc.OwnerHandles()
+			if tt.wantAuth {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Errorf("expected ErrUnauthorized, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(handles, tt.want) {
+				t.Errorf("handles = %v, want %v", handles, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitLabService_OwnerHandles(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id": 7, "username": "gitex-bot"}`)
+	})
+	var minAccessLevel string
+	mux.HandleFunc("/api/v4/groups", func(w http.ResponseWriter, r *http.Request) {
+		minAccessLevel = r.URL.Query().Get("min_access_level")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `[{"id": 1, "full_path": "acme"}, {"id": 2, "full_path": "acme/payments"}]`)
+	})
+
+	svc := &GitLabService{client: client}
+	handles, err := svc.OwnerHandles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"@gitex-bot", "@acme", "@acme/payments"}; !slices.Equal(handles, want) {
+		t.Errorf("handles = %v, want %v", handles, want)
+	}
+	if minAccessLevel != "10" {
+		t.Errorf("min_access_level = %q, want 10 to list only groups the user is a member of", minAccessLevel)
+	}
+}
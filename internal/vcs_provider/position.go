@@ -0,0 +1,75 @@
+package vcs_provider
+
+import "github.com/eridan-ltu/gitex/api"
+
+const devNull = "/dev/null"
+
+// isDeletedFile reports whether the comment targets a file removed by the pull request.
+func isDeletedFile(pos *api.InlineCommentPosition) bool {
+	return pos.DeletedFile || (pos.NewPath != nil && *pos.NewPath == devNull)
+}
+
+// normalizeDeletedFilePosition pins comments on deleted files to the old side of the diff. A deleted file has no
+// new lines, so any line the model reported is an old line and both paths must point at the removed file,
+// otherwise the providers reject the comment with 422.
+func normalizeDeletedFilePosition(pos *api.InlineCommentPosition) {
+	if pos == nil || !isDeletedFile(pos) {
+		return
+	}
+
+	if isEmptyPath(pos.OldPath) || *pos.OldPath == devNull {
+		pos.OldPath = pos.NewPath
+	}
+	if pos.OldPath != nil && *pos.OldPath != devNull {
+		pos.NewPath = pos.OldPath
+	}
+	pos.LineType = "REMOVE"
+	pos.OldLine, pos.NewLine = oldLineOnly(pos.OldLine, pos.NewLine)
+	if pos.LineRange != nil {
+		for _, lp := range []*api.LinePositionOptions{pos.LineRange.Start, pos.LineRange.End} {
+			if lp != nil {
+				lp.OldLine, lp.NewLine = oldLineOnly(lp.OldLine, lp.NewLine)
+			}
+		}
+	}
+}
+
+func oldLineOnly(oldLine, newLine *int64) (*int64, *int64) {
+	if oldLine == nil {
+		return newLine, nil
+	}
+	return oldLine, nil
+}
+
+// normalizePaths fills in a missing old or new path from the other one. Both providers need the pair to anchor a
+// comment, and for an unchanged path the two are equal. Renames keep their distinct paths, GitHub anchors them on
+// the new path with the side picking the old or new line numbers.
+func normalizePaths(pos *api.InlineCommentPosition) {
+	if pos == nil {
+		return
+	}
+	if isEmptyPath(pos.NewPath) && !isEmptyPath(pos.OldPath) && *pos.OldPath != devNull {
+		pos.NewPath = pos.OldPath
+	}
+	if isEmptyPath(pos.OldPath) && !isEmptyPath(pos.NewPath) && *pos.NewPath != devNull {
+		pos.OldPath = pos.NewPath
+	}
+}
+
+func isEmptyPath(p *string) bool {
+	return p == nil || *p == ""
+}
+
+// normalizeImagePosition keeps only the fields that belong to the position type. Image positions carry the
+// image size and the point on it, text positions carry lines, and a mix of both is rejected by GitLab.
+func normalizeImagePosition(pos *api.InlineCommentPosition) {
+	if pos == nil {
+		return
+	}
+	if !pos.IsImage() {
+		pos.Width, pos.Height, pos.X, pos.Y = nil, nil, nil, nil
+		return
+	}
+	pos.NewLine, pos.OldLine, pos.LineRange = nil, nil, nil
+	pos.CommentType, pos.LineType = "", ""
+}
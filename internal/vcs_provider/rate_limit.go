@@ -0,0 +1,35 @@
+package vcs_provider
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitedTransport spaces out outgoing requests, including retries and every comment post,
+// so providers see a smooth request rate instead of bursts that trip abuse detection.
+type rateLimitedTransport struct {
+	limiter *rate.Limiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// withRateLimit wraps the transport with a limiter allowing requestsPerSecond requests. Non-positive rates disable limiting.
+func withRateLimit(next http.RoundTripper, requestsPerSecond float64) http.RoundTripper {
+	if requestsPerSecond <= 0 {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &rateLimitedTransport{
+		limiter: rate.NewLimiter(rate.Limit(requestsPerSecond), 1),
+		next:    next,
+	}
+}
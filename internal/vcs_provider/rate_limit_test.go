@@ -0,0 +1,68 @@
+package vcs_provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	t.Run("disabled for non-positive rate", func(t *testing.T) {
+		next := http.DefaultTransport
+		if got := withRateLimit(next, 0); got != next {
+			t.Error("expected transport to be returned unchanged")
+		}
+		if got := withRateLimit(next, -1); got != next {
+			t.Error("expected transport to be returned unchanged")
+		}
+	})
+
+	t.Run("spaces out requests", func(t *testing.T) {
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: withRateLimit(http.DefaultTransport, 20)}
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+		}
+		elapsed := time.Since(start)
+
+		if count != 3 {
+			t.Errorf("request count = %d, want 3", count)
+		}
+		// first request passes immediately, the next two wait 50ms each
+		if elapsed < 90*time.Millisecond {
+			t.Errorf("requests were not rate limited, took %v", elapsed)
+		}
+	})
+
+	t.Run("respects request context", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: withRateLimit(http.DefaultTransport, 0.01)}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+
+		client.Timeout = 50 * time.Millisecond
+		if _, err := client.Get(server.URL); err == nil {
+			t.Error("expected error when limiter wait exceeds the deadline")
+		}
+	})
+}
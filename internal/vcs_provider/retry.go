@@ -3,9 +3,49 @@ package vcs_provider
 import (
 	"context"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// defaultRetryWaitMin and defaultRetryWaitMax are the exponential backoff bounds of the GitHub client, used on
+// GitLab and for the comment retries as well for the bound that is not configured.
+const (
+	defaultRetryWaitMin = 1 * time.Second
+	defaultRetryWaitMax = 30 * time.Second
 )
 
+// retryWaits returns the backoff bounds cfg asks for, the defaults for the ones it leaves unset. The max is never
+// below the min.
+func retryWaits(cfg *api.Config) (waitMin, waitMax time.Duration) {
+	waitMin, waitMax = defaultRetryWaitMin, defaultRetryWaitMax
+	if cfg.RetryWaitMin > 0 {
+		waitMin = cfg.RetryWaitMin
+	}
+	if cfg.RetryWaitMax > 0 {
+		waitMax = cfg.RetryWaitMax
+	}
+	return waitMin, max(waitMin, waitMax)
+}
+
+// retryingHTTPClient is the default client of the providers that take a plain http.Client: rate limited, and
+// retrying as RetryPolicy and the -retry-* options say.
+func retryingHTTPClient(cfg *api.Config) *http.Client {
+	retryClient := retryablehttp.NewClient()
+	retryClient.RetryMax = cfg.RetryMax
+	retryClient.RetryWaitMin, retryClient.RetryWaitMax = retryWaits(cfg)
+	retryClient.Logger = nil
+	retryClient.CheckRetry = RetryPolicy
+	retryClient.Backoff = Backoff
+	retryClient.ErrorHandler = retryablehttp.PassthroughErrorHandler
+	retryClient.HTTPClient.Transport = withRateLimit(retryClient.HTTPClient.Transport, cfg.RequestsPerSecond)
+	return retryClient.StandardClient()
+}
+
 func RetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
 	if ctx.Err() != nil {
 		return false, ctx.Err()
@@ -38,3 +78,47 @@ func RetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, err
 
 	return false, nil
 }
+
+// Backoff is the wait of the provider clients before retrying a request. A rate limited response says when to retry
+// in its Retry-After header, or in X-RateLimit-Reset once GitHub's X-RateLimit-Remaining or GitLab's RateLimit-Remaining
+// is 0. Other failures wait waitMin doubled on every attempt, with jitter so concurrent requests do not retry in step.
+// No wait is longer than waitMax.
+func Backoff(waitMin, waitMax time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := rateLimitWait(resp, time.Now()); ok {
+			return min(wait, waitMax)
+		}
+	}
+
+	wait := waitMax
+	if attemptNum < 32 && waitMin<<attemptNum > 0 && waitMin<<attemptNum < waitMax {
+		wait = waitMin << attemptNum
+	}
+	// equal jitter: at least half of the wait, so the backoff still grows
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// rateLimitWait returns how long a rate limited response asks to wait, which the headers tell relative to now.
+func rateLimitWait(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			return max(at.Sub(now), 0), true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" && resp.Header.Get("RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset := resp.Header.Get("X-RateLimit-Reset")
+	if reset == "" {
+		reset = resp.Header.Get("RateLimit-Reset")
+	}
+	epoch, err := strconv.ParseInt(reset, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return max(time.Unix(epoch, 0).Sub(now), 0), true
+}
@@ -2,8 +2,14 @@ package vcs_provider
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
 )
 
 func TestRetryPolicy(t *testing.T) {
@@ -130,3 +136,136 @@ func TestRetryPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestRetrySettings(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(t *testing.T, cfg *api.Config) error
+	}{
+		{
+			name: "github",
+			call: func(t *testing.T, cfg *api.Config) error {
+				svc, err := NewGitHubService(cfg)
+				if err != nil {
+					t.Fatalf("NewGitHubService: %v", err)
+				}
+				_, _, err = svc.client.Users.Get(context.Background(), "")
+				return err
+			},
+		},
+		{
+			name: "gitlab",
+			call: func(t *testing.T, cfg *api.Config) error {
+				svc, err := NewGitLabService(cfg)
+				if err != nil {
+					t.Fatalf("NewGitLabService: %v", err)
+				}
+				_, _, err = svc.client.Users.CurrentUser()
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, retries := range []int{2, 0} {
+			t.Run(fmt.Sprintf("%s/%d retries", tt.name, retries), func(t *testing.T) {
+				var calls int
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					calls++
+					w.WriteHeader(http.StatusBadGateway)
+				}))
+				defer server.Close()
+
+				cfg := &api.Config{
+					VcsApiKey:    "test-token",
+					VcsRemoteUrl: server.URL,
+					RetryMax:     retries,
+					RetryWaitMin: time.Millisecond,
+					RetryWaitMax: 2 * time.Millisecond,
+				}
+				start := time.Now()
+				if err := tt.call(t, cfg); err == nil {
+					t.Fatal("expected error after the retries ran out")
+				}
+				if calls != retries+1 {
+					t.Errorf("calls = %d, want %d", calls, retries+1)
+				}
+				if elapsed := time.Since(start); elapsed > 2*time.Second {
+					t.Errorf("retries took %v, the configured waits were not applied", elapsed)
+				}
+			})
+		}
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantWait time.Duration
+		wantOk   bool
+	}{
+		{name: "retry after seconds", headers: map[string]string{"Retry-After": "7"}, wantWait: 7 * time.Second, wantOk: true},
+		{name: "retry after date", headers: map[string]string{"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat)}, wantWait: 90 * time.Second, wantOk: true},
+		{name: "retry after in the past", headers: map[string]string{"Retry-After": now.Add(-time.Minute).Format(http.TimeFormat)}, wantWait: 0, wantOk: true},
+		{name: "github rate limit reset", headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(42*time.Second).Unix(), 10)},
+			wantWait: 42 * time.Second, wantOk: true},
+		{name: "gitlab rate limit reset", headers: map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": strconv.FormatInt(now.Add(5*time.Second).Unix(), 10)},
+			wantWait: 5 * time.Second, wantOk: true},
+		{name: "reset with requests remaining", headers: map[string]string{"X-RateLimit-Remaining": "12", "X-RateLimit-Reset": strconv.FormatInt(now.Add(time.Hour).Unix(), 10)}},
+		{name: "malformed reset", headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "soon"}},
+		{name: "malformed retry after", headers: map[string]string{"Retry-After": "later"}},
+		{name: "no headers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			for k, v := range tt.headers {
+				resp.Header.Set(k, v)
+			}
+			wait, ok := rateLimitWait(resp, now)
+			if ok != tt.wantOk || wait != tt.wantWait {
+				t.Errorf("rateLimitWait() = %v, %v, want %v, %v", wait, ok, tt.wantWait, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Run("grows exponentially with jitter", func(t *testing.T) {
+		for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+			for range 20 {
+				if wait := Backoff(time.Second, time.Minute, attempt, nil); wait < want/2 || wait > want {
+					t.Fatalf("attempt %d waited %v, want between %v and %v", attempt, wait, want/2, want)
+				}
+			}
+		}
+	})
+
+	t.Run("capped at the max", func(t *testing.T) {
+		for _, attempt := range []int{6, 40, 100} {
+			if wait := Backoff(time.Second, 10*time.Second, attempt, nil); wait < 5*time.Second || wait > 10*time.Second {
+				t.Errorf("attempt %d waited %v, want at most 10s", attempt, wait)
+			}
+		}
+	})
+
+	t.Run("rate limit headers", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"3"}}}
+		if wait := Backoff(time.Second, time.Minute, 5, resp); wait != 3*time.Second {
+			t.Errorf("waited %v, want the 3s of Retry-After", wait)
+		}
+	})
+
+	t.Run("rate limit reset capped at the max", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{
+			"X-Ratelimit-Remaining": {"0"},
+			"X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+		}}
+		if wait := Backoff(time.Second, 30*time.Second, 0, resp); wait != 30*time.Second {
+			t.Errorf("waited %v, want the 30s max", wait)
+		}
+	})
+}
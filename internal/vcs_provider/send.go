@@ -0,0 +1,105 @@
+package vcs_provider
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"golang.org/x/sync/errgroup"
+)
+
+// errReplyFailed marks a split comment whose first part was posted but not the rest. Trying it again would post the
+// first part twice.
+var errReplyFailed = errors.New("failed to reply with the rest of the comment")
+
+// sendConcurrently calls send for every comment, at most concurrency at a time. A rejected token or, with failFast,
+// any failure is returned and the comments not started yet are skipped, comments already being sent finish within
+// their own timeout. Otherwise it returns the comments that failed, ordered by file and line.
+func sendConcurrently(comments []*api.InlineComment, concurrency int, failFast bool, send func(ctx context.Context, comment *api.InlineComment) *CommentError) ([]*CommentError, error) {
+	group, ctx := errgroup.WithContext(context.Background())
+	group.SetLimit(max(concurrency, 1))
+	var mu sync.Mutex
+	var failed []*CommentError
+
+	for _, comment := range comments {
+		group.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			commentErr := send(ctx, comment)
+			if commentErr == nil {
+				return nil
+			}
+			if errors.Is(commentErr, ErrUnauthorized) || errors.Is(commentErr, ErrPermissionDenied) {
+				return commentErr.Err
+			}
+			if failFast {
+				return commentErr
+			}
+			mu.Lock()
+			failed = append(failed, commentErr)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	sortCommentErrors(failed)
+	return failed, nil
+}
+
+// sendWithRetry posts a comment, trying it again up to retries times while it fails in a way another try may not,
+// see retryableCommentError. Between tries it waits as Backoff says, so a rate limited comment waits as long as the
+// response asks, and it stops waiting when ctx is done. The error of the last try is returned.
+func sendWithRetry(ctx context.Context, comment *api.InlineComment, retries int, waitMin, waitMax time.Duration, send func(comment *api.InlineComment) *CommentError) *CommentError {
+	for attempt := 0; ; attempt++ {
+		commentErr := send(comment)
+		if commentErr == nil || attempt >= retries || !retryableCommentError(commentErr) {
+			return commentErr
+		}
+		wait := Backoff(waitMin, waitMax, attempt, errorResponse(commentErr.Err))
+		log.Printf("retrying comment on %s:%d in %v (attempt %d/%d)", commentErr.Path, commentErr.Line, wait, attempt+1, retries)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return commentErr
+		case <-timer.C:
+		}
+	}
+}
+
+// retryableCommentError reports whether a comment failed with a server error, rate limited, or before its request
+// was sent, independently of the API client's own retries. A comment the provider rejected, like a 422 for a line
+// outside the diff, fails the same way every time, and a rejected token fails every other comment as well. A
+// connection that broke after the request was written may have posted the comment already, so it is not sent again.
+func retryableCommentError(commentErr *CommentError) bool {
+	err := commentErr.Err
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrPermissionDenied) || errors.Is(err, errReplyFailed) {
+		return false
+	}
+	switch status := responseStatus(err); {
+	case status >= http.StatusInternalServerError, status == http.StatusTooManyRequests:
+		return true
+	case status != 0:
+		return false
+	}
+	return requestNotSent(err)
+}
+
+// requestNotSent reports whether err failed a request before any of it reached the provider, like a refused
+// connection or a failed DNS lookup.
+func requestNotSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
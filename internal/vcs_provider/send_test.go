@@ -0,0 +1,59 @@
+package vcs_provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/google/go-github/v81/github"
+)
+
+func TestRetryableCommentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "refused connection", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: true},
+		{name: "failed lookup", err: &net.DNSError{Err: "no such host", Name: "github.example"}, want: true},
+		{name: "connection broken after the request", err: &net.OpError{Op: "read", Net: "tcp", Err: io.ErrUnexpectedEOF}},
+		{name: "server error", err: &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}, want: true},
+		{name: "rate limited", err: &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusTooManyRequests}}, want: true},
+		{name: "rejected", err: &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}}},
+		{name: "half posted", err: errReplyFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableCommentError(&CommentError{Err: tt.err}); got != tt.want {
+				t.Errorf("retryableCommentError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendWithRetry_StopsWaitingWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rateLimited := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"3600"}}}}
+
+	var calls int
+	start := time.Now()
+	commentErr := sendWithRetry(ctx, &api.InlineComment{}, 2, time.Millisecond, time.Hour, func(comment *api.InlineComment) *CommentError {
+		calls++
+		return newCommentError("main.go", 1, rateLimited)
+	})
+	if commentErr == nil || commentErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("sendWithRetry() = %v, want the rate limited error", commentErr)
+	}
+	if calls != 1 {
+		t.Errorf("sent %d times, want once before the context was done", calls)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %v for the Retry-After of an hour, want to stop with the context", elapsed)
+	}
+}
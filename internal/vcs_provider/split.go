@@ -0,0 +1,57 @@
+package vcs_provider
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// githubMaxCommentLength is the longest review comment body GitHub accepts.
+	githubMaxCommentLength = 65536
+	// gitlabMaxNoteLength is the longest note body GitLab accepts.
+	gitlabMaxNoteLength = 1000000
+	// splitReserve leaves room in every chunk for the markers and the continuation header.
+	splitReserve = 256
+)
+
+// splitCommentBody cuts body into chunks of at most limit bytes, the first posted as the comment and the rest as
+// replies. Cuts fall on paragraph or line breaks when possible and never inside a code block, so suggestions stay
+// intact. Every chunk after the first starts with a continuation header.
+func splitCommentBody(body string, limit int) []string {
+	if len(body) <= limit {
+		return []string{body}
+	}
+	var chunks []string
+	for len(body) > limit {
+		cut := splitPoint(body, limit)
+		chunks = append(chunks, strings.TrimRight(body[:cut], "\n"))
+		body = strings.TrimLeft(body[cut:], "\n")
+	}
+	if body != "" {
+		chunks = append(chunks, body)
+	}
+	for i := 1; i < len(chunks); i++ {
+		chunks[i] = fmt.Sprintf("_(continued %d/%d)_\n\n%s", i+1, len(chunks), chunks[i])
+	}
+	return chunks
+}
+
+func splitPoint(body string, limit int) int {
+	head := body[:limit]
+	cut := strings.LastIndex(head, "\n\n")
+	if cut <= 0 {
+		cut = strings.LastIndex(head, "\n")
+	}
+	if cut > 0 && strings.Count(head[:cut], "```")%2 == 1 {
+		// the cut is inside a code block, move it before the block opens
+		cut = strings.LastIndex(head[:cut], "```")
+	}
+	if cut > 0 {
+		return cut
+	}
+	// one line longer than the limit, cut on a rune boundary
+	for cut = limit; cut > 0 && !utf8.RuneStart(body[cut]); cut-- {
+	}
+	return cut
+}
@@ -0,0 +1,56 @@
+package vcs_provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitCommentBody(t *testing.T) {
+	t.Run("short body is kept whole", func(t *testing.T) {
+		chunks := splitCommentBody("short", 100)
+		if len(chunks) != 1 || chunks[0] != "short" {
+			t.Errorf("chunks = %q", chunks)
+		}
+	})
+
+	t.Run("splits on paragraphs", func(t *testing.T) {
+		body := strings.Repeat("a", 40) + "\n\n" + strings.Repeat("b", 40) + "\n\n" + strings.Repeat("c", 40)
+		chunks := splitCommentBody(body, 90)
+		if len(chunks) != 2 {
+			t.Fatalf("got %d chunks: %q", len(chunks), chunks)
+		}
+		if chunks[0] != strings.Repeat("a", 40)+"\n\n"+strings.Repeat("b", 40) {
+			t.Errorf("first chunk = %q", chunks[0])
+		}
+		if chunks[1] != "_(continued 2/2)_\n\n"+strings.Repeat("c", 40) {
+			t.Errorf("second chunk = %q", chunks[1])
+		}
+	})
+
+	t.Run("keeps code blocks together", func(t *testing.T) {
+		fence := "```suggestion\n" + strings.Repeat("x", 20) + "\n\n" + strings.Repeat("y", 20) + "\n```"
+		body := strings.Repeat("a", 30) + "\n\n" + fence
+		chunks := splitCommentBody(body, 70)
+		if len(chunks) != 2 || !strings.HasSuffix(chunks[1], fence) {
+			t.Errorf("code block was cut: %q", chunks)
+		}
+	})
+
+	t.Run("cuts long lines on rune boundaries", func(t *testing.T) {
+		body := strings.Repeat("é", 50)
+		chunks := splitCommentBody(body, 15)
+		var joined string
+		for i, chunk := range chunks {
+			if i > 0 {
+				chunk = chunk[strings.Index(chunk, "\n\n")+2:]
+			}
+			if len(chunk) > 15 {
+				t.Errorf("chunk %d is %d bytes", i, len(chunk))
+			}
+			joined += chunk
+		}
+		if joined != body {
+			t.Errorf("content lost: %q", joined)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package vcs_provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+// maxStatusContextLength is GitLab's limit for a commit status name, GitHub accepts the same.
+const maxStatusContextLength = 255
+
+// maxStatusDescriptionLength is GitHub's limit for a commit status description.
+const maxStatusDescriptionLength = 140
+
+// ValidateStatusContext checks a commit status context name against the constraints of all supported providers.
+func ValidateStatusContext(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("status context must not be empty")
+	}
+	if len(name) > maxStatusContextLength {
+		return fmt.Errorf("status context must be at most %d characters", maxStatusContextLength)
+	}
+	if strings.TrimSpace(name) != name {
+		return errors.New("status context must not start or end with whitespace")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return errors.New("status context must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// truncateStatusDescription cuts the description to maxStatusDescriptionLength characters, whole runes only, so a
+// multi-byte character is never split into invalid UTF-8.
+func truncateStatusDescription(status *api.CommitStatus) string {
+	runes := []rune(status.Description)
+	if len(runes) > maxStatusDescriptionLength {
+		return string(runes[:maxStatusDescriptionLength-3]) + "..."
+	}
+	return status.Description
+}
@@ -0,0 +1,54 @@
+package vcs_provider
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestValidateStatusContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		context string
+		wantErr bool
+	}{
+		{name: "default", context: "gitex"},
+		{name: "with separators", context: "gitex/security pass"},
+		{name: "empty", context: "", wantErr: true},
+		{name: "blank", context: "   ", wantErr: true},
+		{name: "surrounding whitespace", context: " gitex", wantErr: true},
+		{name: "newline", context: "gitex\nsecurity", wantErr: true},
+		{name: "too long", context: strings.Repeat("a", maxStatusContextLength+1), wantErr: true},
+		{name: "max length", context: strings.Repeat("a", maxStatusContextLength)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStatusContext(tt.context)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStatusContext(%q) error = %v, wantErr %v", tt.context, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTruncateStatusDescription(t *testing.T) {
+	short := &api.CommitStatus{Description: "Review finished"}
+	if got := truncateStatusDescription(short); got != "Review finished" {
+		t.Errorf("got %q, want unchanged description", got)
+	}
+
+	long := &api.CommitStatus{Description: strings.Repeat("a", 200)}
+	got := truncateStatusDescription(long)
+	if len(got) != maxStatusDescriptionLength || !strings.HasSuffix(got, "...") {
+		t.Errorf("got %d characters %q, want %d ending with ...", len(got), got, maxStatusDescriptionLength)
+	}
+
+	multiByte := &api.CommitStatus{Description: strings.Repeat("é", 200)}
+	got = truncateStatusDescription(multiByte)
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != maxStatusDescriptionLength || !strings.HasSuffix(got, "...") {
+		t.Errorf("got %d characters %q, want %d valid UTF-8 ending with ...", utf8.RuneCountInString(got), got, maxStatusDescriptionLength)
+	}
+}
@@ -0,0 +1,69 @@
+package vcs_provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+const confidenceHigh = "high"
+
+// renderCommentBody appends the commented diff hunk, the model's suggested fix and the comment category to the
+// comment body. Only high-confidence fixes on new lines are rendered as an applicable suggestion block, anything else
+// is offered as plain code so it is not applied blindly.
+// suggestionFence builds the suggestion block header, as GitHub and GitLab express multi-line suggestions differently.
+func renderCommentBody(comment *api.InlineComment, suggestionFence func(pos *api.InlineCommentPosition) string) *string {
+	if comment.Suggestion == nil && comment.Category == "" && comment.Hunk == "" {
+		return comment.Body
+	}
+
+	var sb strings.Builder
+	sb.WriteString(util.GetOrDefault(comment.Body, ""))
+	if comment.Hunk != "" {
+		fmt.Fprintf(&sb, "\n\n```diff\n%s\n```", comment.Hunk)
+	}
+	if comment.Suggestion != nil {
+		suggestion := strings.TrimSuffix(*comment.Suggestion, "\n")
+		if strings.EqualFold(comment.Confidence, confidenceHigh) && suggestsOnNewLines(comment.Position) {
+			fmt.Fprintf(&sb, "\n\n```%s\n%s\n```", suggestionFence(comment.Position), suggestion)
+		} else {
+			fmt.Fprintf(&sb, "\n\nPossible fix, review before applying:\n\n```\n%s\n```", suggestion)
+		}
+	}
+	// the category id is what repositories list in .gitex/suppress.yaml to silence this kind of comment
+	if comment.Category != "" {
+		fmt.Fprintf(&sb, "\n\n<sub>gitex category: `%s`</sub>", comment.Category)
+	}
+	return util.Ptr(sb.String())
+}
+
+// suggestsOnNewLines reports whether the comment targets lines that exist after the change, the only ones a
+// suggestion can replace.
+func suggestsOnNewLines(pos *api.InlineCommentPosition) bool {
+	if pos == nil || pos.DeletedFile || pos.LineType == "REMOVE" {
+		return false
+	}
+	if pos.CommentType == "MULTI_LINE" {
+		return pos.LineRange != nil && pos.LineRange.Start != nil && pos.LineRange.End != nil &&
+			pos.LineRange.Start.NewLine != nil && pos.LineRange.End.NewLine != nil
+	}
+	return pos.NewLine != nil
+}
+
+func githubSuggestionFence(*api.InlineCommentPosition) string {
+	return "suggestion"
+}
+
+// gitlabSuggestionFence anchors the suggestion on the last commented line and extends it up to the first one.
+func gitlabSuggestionFence(pos *api.InlineCommentPosition) string {
+	if pos.CommentType != "MULTI_LINE" {
+		return "suggestion:-0+0"
+	}
+	above := *pos.LineRange.End.NewLine - *pos.LineRange.Start.NewLine
+	if above < 0 {
+		above = 0
+	}
+	return fmt.Sprintf("suggestion:-%d+0", above)
+}
@@ -0,0 +1,111 @@
+package vcs_provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/util"
+)
+
+func TestRenderCommentBody(t *testing.T) {
+	singleLine := &api.InlineCommentPosition{NewPath: util.Ptr("main.go"), NewLine: util.Ptr(int64(10)), LineType: "ADD"}
+	multiLine := &api.InlineCommentPosition{
+		NewPath:     util.Ptr("main.go"),
+		CommentType: "MULTI_LINE",
+		LineType:    "ADD",
+		LineRange: &api.LineRangeOptions{
+			Start: &api.LinePositionOptions{NewLine: util.Ptr(int64(10))},
+			End:   &api.LinePositionOptions{NewLine: util.Ptr(int64(13))},
+		},
+	}
+	removedLine := &api.InlineCommentPosition{OldPath: util.Ptr("main.go"), OldLine: util.Ptr(int64(4)), LineType: "REMOVE"}
+
+	tests := []struct {
+		name     string
+		comment  *api.InlineComment
+		fence    func(*api.InlineCommentPosition) string
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "no suggestion keeps body",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Position: singleLine},
+			fence:    githubSuggestionFence,
+			contains: []string{"finding"},
+			excludes: []string{"```"},
+		},
+		{
+			name:     "category is appended",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Category: "performance", Suggestion: util.Ptr("x := 1"), Position: singleLine},
+			fence:    githubSuggestionFence,
+			contains: []string{"finding", "Possible fix", "gitex category: `performance`"},
+		},
+		{
+			name:     "hunk is rendered as a diff block",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Hunk: "@@ -1,1 +1,1 @@\n-a\n+b", Position: singleLine},
+			fence:    githubSuggestionFence,
+			contains: []string{"finding\n\n```diff\n@@ -1,1 +1,1 @@\n-a\n+b\n```"},
+		},
+		{
+			name:     "high confidence renders suggestion block",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Suggestion: util.Ptr("x := 1\n"), Confidence: "high", Position: singleLine},
+			fence:    githubSuggestionFence,
+			contains: []string{"finding\n\n```suggestion\nx := 1\n```"},
+		},
+		{
+			name:     "confidence is case insensitive",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Suggestion: util.Ptr("x := 1"), Confidence: "HIGH", Position: singleLine},
+			fence:    githubSuggestionFence,
+			contains: []string{"```suggestion\n"},
+		},
+		{
+			name:     "medium confidence renders prose",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Suggestion: util.Ptr("x := 1"), Confidence: "medium", Position: singleLine},
+			fence:    githubSuggestionFence,
+			contains: []string{"Possible fix", "```\nx := 1\n```"},
+			excludes: []string{"```suggestion"},
+		},
+		{
+			name:     "missing confidence renders prose",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Suggestion: util.Ptr("x := 1"), Position: singleLine},
+			fence:    githubSuggestionFence,
+			excludes: []string{"```suggestion"},
+		},
+		{
+			name:     "removed lines cannot take suggestions",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Suggestion: util.Ptr("x := 1"), Confidence: "high", Position: removedLine},
+			fence:    githubSuggestionFence,
+			contains: []string{"Possible fix"},
+			excludes: []string{"```suggestion"},
+		},
+		{
+			name:     "gitlab single line fence",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Suggestion: util.Ptr("x := 1"), Confidence: "high", Position: singleLine},
+			fence:    gitlabSuggestionFence,
+			contains: []string{"```suggestion:-0+0\n"},
+		},
+		{
+			name:     "gitlab multi line fence covers the range",
+			comment:  &api.InlineComment{Body: util.Ptr("finding"), Suggestion: util.Ptr("a\nb"), Confidence: "high", Position: multiLine},
+			fence:    gitlabSuggestionFence,
+			contains: []string{"```suggestion:-3+0\na\nb\n```"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := util.GetOrDefault(renderCommentBody(tt.comment, tt.fence), "")
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected body to contain %q, got:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("expected body not to contain %q, got:\n%s", unwanted, got)
+				}
+			}
+		})
+	}
+}
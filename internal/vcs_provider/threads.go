@@ -0,0 +1,144 @@
+package vcs_provider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/eridan-ltu/gitex/api"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// reviewThreadsQuery pages through the review threads of a pull request. The REST API has no resolved state, only
+// GraphQL does. line is null for threads on code that changed since, which no longer point at the diff.
+const reviewThreadsQuery = `query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          isResolved
+          path
+          line
+          diffSide
+          comments(first: 1) { nodes { body } }
+        }
+      }
+    }
+  }
+}`
+
+type reviewThreadsResponse struct {
+	Data struct {
+		Repository struct {
+			PullRequest struct {
+				ReviewThreads struct {
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+					Nodes []struct {
+						IsResolved bool   `json:"isResolved"`
+						Path       string `json:"path"`
+						Line       *int64 `json:"line"`
+						DiffSide   string `json:"diffSide"`
+						Comments   struct {
+							Nodes []struct {
+								Body string `json:"body"`
+							} `json:"nodes"`
+						} `json:"comments"`
+					} `json:"nodes"`
+				} `json:"reviewThreads"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// PriorThreads returns the review threads gitex opened on lines of the current diff, outdated threads are left out.
+func (g *GitHubService) PriorThreads(pullRequestInfo *api.PullRequestInfo) ([]*api.PriorThread, error) {
+	ctx, cancelFunc := requestContext(g.apiTimeout, defaultInfoTimeout)
+	defer cancelFunc()
+
+	var threads []*api.PriorThread
+	variables := map[string]any{
+		"owner":  pullRequestInfo.Owner,
+		"name":   pullRequestInfo.ProjectName,
+		"number": pullRequestInfo.PullRequestId,
+	}
+	for {
+		// GraphQL lives next to the REST root, at /graphql on github.com and /api/graphql on Enterprise Server
+		req, err := g.client.NewRequest("POST", "../graphql", map[string]any{"query": reviewThreadsQuery, "variables": variables})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build review threads query: %w", err)
+		}
+		var resp reviewThreadsResponse
+		if _, err := g.client.Do(ctx, req, &resp); err != nil {
+			return nil, threadsError(err)
+		}
+		if len(resp.Errors) > 0 {
+			return nil, threadsError(errors.New(resp.Errors[0].Message))
+		}
+		page := resp.Data.Repository.PullRequest.ReviewThreads
+		for _, node := range page.Nodes {
+			if node.Line == nil || len(node.Comments.Nodes) == 0 || !hasMarker(node.Comments.Nodes[0].Body) {
+				continue
+			}
+			thread := &api.PriorThread{Path: node.Path, Resolved: node.IsResolved}
+			if node.DiffSide == "LEFT" {
+				thread.OldLine = *node.Line
+			} else {
+				thread.NewLine = *node.Line
+			}
+			threads = append(threads, thread)
+		}
+		if !page.PageInfo.HasNextPage {
+			return threads, nil
+		}
+		variables["cursor"] = page.PageInfo.EndCursor
+	}
+}
+
+// PriorThreads returns the diff discussions gitex opened on the merge request.
+func (g *GitLabService) PriorThreads(pullRequestInfo *api.PullRequestInfo) ([]*api.PriorThread, error) {
+	var threads []*api.PriorThread
+	opts := &gitlab.ListMergeRequestDiscussionsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	for {
+		discussions, resp, err := g.client.Discussions.ListMergeRequestDiscussions(pullRequestInfo.ProjectPath, pullRequestInfo.PullRequestId, opts)
+		if err != nil {
+			return nil, threadsError(err)
+		}
+		for _, discussion := range discussions {
+			if discussion == nil || len(discussion.Notes) == 0 || discussion.Notes[0] == nil {
+				continue
+			}
+			first := discussion.Notes[0]
+			if first.Position == nil || !first.Resolvable || !hasMarker(first.Body) {
+				continue
+			}
+			path := first.Position.NewPath
+			if path == "" {
+				path = first.Position.OldPath
+			}
+			thread := &api.PriorThread{Path: path, Resolved: first.Resolved}
+			if first.Position.NewLine != 0 {
+				thread.NewLine = first.Position.NewLine
+			} else {
+				thread.OldLine = first.Position.OldLine
+			}
+			threads = append(threads, thread)
+		}
+		if resp.NextPage == 0 {
+			return threads, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func threadsError(err error) error {
+	if isAuthError(err) {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	return fmt.Errorf("failed to list review threads: %w", err)
+}
@@ -0,0 +1,148 @@
+package vcs_provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eridan-ltu/gitex/api"
+)
+
+func TestGitHubService_PriorThreads(t *testing.T) {
+	var cursors []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/graphql" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req struct {
+			Variables map[string]any `json:"variables"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		cursors = append(cursors, req.Variables["cursor"])
+		thread := func(resolved bool, line any, side, body string) map[string]any {
+			return map[string]any{
+				"isResolved": resolved, "path": "main.go", "line": line, "diffSide": side,
+				"comments": map[string]any{"nodes": []map[string]any{{"body": body}}},
+			}
+		}
+		threads := map[string]any{
+			"pageInfo": map[string]any{"hasNextPage": true, "endCursor": "page2"},
+			"nodes": []any{
+				thread(false, 3, "RIGHT", "finding\n\n"+commentMarker),
+				thread(true, 7, "RIGHT", "finding\n\n"+commentMarker),
+				thread(false, 9, "RIGHT", "a human comment"),
+			},
+		}
+		if req.Variables["cursor"] == "page2" {
+			threads = map[string]any{
+				"pageInfo": map[string]any{"hasNextPage": false},
+				"nodes": []any{
+					thread(false, 4, "LEFT", "finding\n\n"+commentMarker),
+					thread(false, nil, "RIGHT", "outdated\n\n"+commentMarker),
+				},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"repository": map[string]any{"pullRequest": map[string]any{"reviewThreads": threads}},
+		}})
+	}))
+	defer server.Close()
+
+	svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+	threads, err := svc.PriorThreads(&api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []api.PriorThread{
+		{Path: "main.go", NewLine: 3},
+		{Path: "main.go", NewLine: 7, Resolved: true},
+		{Path: "main.go", OldLine: 4},
+	}
+	if len(threads) != len(want) {
+		t.Fatalf("got %d threads, want %d", len(threads), len(want))
+	}
+	for i, thread := range threads {
+		if *thread != want[i] {
+			t.Errorf("thread %d = %+v, want %+v", i, *thread, want[i])
+		}
+	}
+	if len(cursors) != 2 || cursors[0] != nil || cursors[1] != "page2" {
+		t.Errorf("cursors = %v, want [<nil> page2]", cursors)
+	}
+}
+
+func TestGitHubService_PriorThreads_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantAuth bool
+	}{
+		{name: "rejected token", status: http.StatusUnauthorized, body: `{"message": "Bad credentials"}`, wantAuth: true},
+		{name: "graphql error", status: http.StatusOK, body: `{"errors": [{"message": "Could not resolve to a Repository"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			svc, _ := NewGitHubService(&api.Config{VcsApiKey: "test-token", VcsRemoteUrl: server.URL})
+			_, err := svc.PriorThreads(&api.PullRequestInfo{Owner: "owner", ProjectName: "repo", PullRequestId: 1})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if errors.Is(err, ErrUnauthorized) != tt.wantAuth {
+				t.Errorf("errors.Is(err, ErrUnauthorized) = %v, want %v: %v", !tt.wantAuth, tt.wantAuth, err)
+			}
+		})
+	}
+}
+
+func TestGitLabService_PriorThreads(t *testing.T) {
+	mux, server, client := setupMockServer(t)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/group%2Fproject/merge_requests/1/discussions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `[
+			{"id": "a", "notes": [{"id": 1, "body": "finding\n\n%[1]s", "resolvable": true, "resolved": false,
+				"position": {"new_path": "main.go", "old_path": "main.go", "new_line": 3}}]},
+			{"id": "b", "notes": [{"id": 2, "body": "finding\n\n%[1]s", "resolvable": true, "resolved": true,
+				"position": {"new_path": "main.go", "old_path": "main.go", "new_line": 7, "old_line": 6}}]},
+			{"id": "c", "notes": [{"id": 3, "body": "finding\n\n%[1]s", "resolvable": true, "resolved": false,
+				"position": {"new_path": "main.go", "old_path": "main.go", "old_line": 4}}]},
+			{"id": "d", "notes": [{"id": 4, "body": "summary\n\n%[1]s", "resolvable": true, "resolved": false}]},
+			{"id": "e", "notes": [{"id": 5, "body": "a human comment", "resolvable": true, "resolved": false,
+				"position": {"new_path": "main.go", "new_line": 9}}]}
+		]`, commentMarker)
+	})
+
+	svc := &GitLabService{client: client}
+	threads, err := svc.PriorThreads(&api.PullRequestInfo{ProjectPath: "group/project", PullRequestId: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []api.PriorThread{
+		{Path: "main.go", NewLine: 3},
+		{Path: "main.go", NewLine: 7, Resolved: true},
+		{Path: "main.go", OldLine: 4},
+	}
+	if len(threads) != len(want) {
+		t.Fatalf("got %d threads, want %d", len(threads), len(want))
+	}
+	for i, thread := range threads {
+		if *thread != want[i] {
+			t.Errorf("thread %d = %+v, want %+v", i, *thread, want[i])
+		}
+	}
+}
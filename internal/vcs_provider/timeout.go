@@ -0,0 +1,24 @@
+package vcs_provider
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts of single GitHub and Gitea requests when -api-timeout does not set one. GitLab requests have none.
+const (
+	defaultInfoTimeout    = 2 * time.Minute
+	defaultCommentTimeout = 30 * time.Second
+)
+
+// requestContext bounds one API request by timeout, the configured -api-timeout, or by def when it is not set.
+// Without either the request is not bounded.
+func requestContext(timeout, def time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = def
+	}
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
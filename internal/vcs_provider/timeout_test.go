@@ -0,0 +1,42 @@
+package vcs_provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		def     time.Duration
+		want    time.Duration
+	}{
+		{name: "default", def: defaultCommentTimeout, want: defaultCommentTimeout},
+		{name: "configured", timeout: 5 * time.Second, def: defaultInfoTimeout, want: 5 * time.Second},
+		{name: "configured without default", timeout: time.Minute, want: time.Minute},
+		{name: "unbounded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			ctx, cancel := requestContext(tt.timeout, tt.def)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if tt.want == 0 {
+				if ok {
+					t.Errorf("deadline = %v, want none", deadline)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no deadline, want %v", tt.want)
+			}
+			if got := deadline.Sub(start); got < tt.want || got > tt.want+time.Second {
+				t.Errorf("timeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
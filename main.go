@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/eridan-ltu/gitex/api"
+	"github.com/eridan-ltu/gitex/internal/ai"
 	"github.com/eridan-ltu/gitex/internal/core"
+	"github.com/eridan-ltu/gitex/internal/diff"
 )
 
 func main() {
@@ -23,57 +31,213 @@ func main() {
 	}
 
 	factory := core.NewServiceFactory(cfg)
-	app := core.NewApp(factory)
+	if cfg.Serve {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := core.NewServer(cfg, factory).Serve(ctx); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	if cfg.DiffFile != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := core.NewServer(cfg, factory).ReviewFile(ctx, cfg.DiffFile); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	app := core.NewApp(cfg, factory)
 	if err := app.Run(mrUrl); err != nil {
 		log.Fatalf("Error: %v", err)
 	}
 }
 
 func parseInput(args []string) (string, *api.Config, error) {
-	if len(args) < 1 {
-		return "", nil, errors.New("usage: gitex <pull-request-url> [flags]")
+	// without a url the pull request is detected from the local checkout
+	var mrUrl string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		mrUrl = args[0]
+		args = args[1:]
 	}
-	mrUrl := args[0]
 
 	cfg := &api.Config{}
 	fs := flag.NewFlagSet("gitex", flag.ContinueOnError)
 	fs.StringVar(&cfg.VcsApiKey, "vcs-api-key", "", "VCS provider API Key")
 	fs.StringVar(&cfg.VcsRemoteUrl, "vcs-url", "", "VCS provider url")
-	fs.StringVar(&cfg.AiModel, "ai-model", "gpt-5.1-codex-mini", "Codex model")
+	fs.StringVar(&cfg.VcsProvider, "vcs-provider", "", "Provider running at -vcs-url: github, gitlab or gitea (also Forgejo), for self-hosted instances whose URLs don't tell")
+	fs.StringVar(&cfg.AiModel, "ai-model", "", "Model of the AI agent (default gpt-5.1-codex-mini for codex and openai, claude-sonnet-4-5 for claude)")
+	fs.Func("ai-model-chain", "Comma separated codex models to try in order, the next one is used when a model is unavailable or overloaded", func(v string) error {
+		cfg.AiModelChain = append(cfg.AiModelChain, splitList(v)...)
+		return nil
+	})
+	fs.StringVar(&cfg.AiAgent, "ai-agent", string(api.AIAgentTypeCodex), "AI agent: codex, claude, openai to call the OpenAI API without installing codex, or replay to post comments saved in -replay-file")
+	fs.Func("ai-env", "KEY=VALUE added to the environment of the AI agent process, repeatable, e.g. HTTPS_PROXY=http://proxy:3128", func(v string) error {
+		cfg.AiEnv = append(cfg.AiEnv, v)
+		return nil
+	})
+	fs.StringVar(&cfg.Tone, "tone", "concise", "How comments are phrased: concise, friendly or strict, changes the wording only, not what is found")
+	fs.StringVar(&cfg.ReplayFile, "replay-file", "", "Comments JSON returned by the replay agent")
 	fs.StringVar(&cfg.AiApiKey, "ai-api-key", "", "AI API Key")
 	fs.BoolVar(&cfg.Verbose, "verbose", false, "Verbose output")
+	fs.Float64Var(&cfg.RequestsPerSecond, "requests-per-second", 2, "Maximum VCS provider API requests per second, 0 disables the limit")
+	fs.IntVar(&cfg.CommentConcurrency, "comment-concurrency", 4, "Comments posted at once, 0 or 1 posts them one after another")
+	fs.IntVar(&cfg.CommentRetries, "comment-retries", 2, "Retries for a comment whose request failed with a server error, rate limit or before it was sent, rejected comments are not retried")
+	fs.IntVar(&cfg.RetryMax, "retry-max", 3, "Retries for VCS provider API requests that failed with a server error, rate limit or connection error, 0 disables them")
+	fs.DurationVar(&cfg.RetryWaitMin, "retry-wait-min", 0, "Shortest wait before retrying a VCS provider API request, doubled on every retry with jitter, 0 waits 1s")
+	fs.DurationVar(&cfg.RetryWaitMax, "retry-wait-max", 0, "Longest wait before retrying a VCS provider API request, also caps the wait rate limit headers ask for, 0 waits at most 30s")
+	fs.StringVar(&cfg.CodexHome, "codex-home", "", "Codex home directory (default $GITEX_HOME/.codex)")
+	fs.StringVar(&cfg.CodexVersion, "codex-version", ai.DefaultCodexVersion, "Version of the @openai/codex npm package to install, another installed version is replaced")
+	fs.BoolVar(&cfg.TrackReactions, "track-reactions", false, "Report reactions on comments left by previous runs")
+	fs.BoolVar(&cfg.SingleCommentMode, "single-comment-mode", false, "Post the findings as one checklist comment that later runs edit in place instead of adding new comments")
+	fs.BoolVar(&cfg.ConsolidatedReview, "consolidated-review", false, "GitLab: post the run as one summary discussion plus findings, resolving the previous run's discussions")
+	fs.BoolVar(&cfg.CommitStatus, "commit-status", false, "Report the review outcome as a commit status on the pull request head")
+	fs.StringVar(&cfg.StatusContext, "status-context", "gitex", "Commit status context name, use distinct names for several gitex passes on one repo")
+	fs.StringVar(&cfg.ApplyLabel, "apply-label", "", "Label to add to the pull request after a successful review, created when missing, e.g. gitex-reviewed")
+	fs.BoolVar(&cfg.SummaryFileList, "summary-file-list", false, "Start summaries with a table of the changed files and their added and removed lines")
+	fs.BoolVar(&cfg.PostSummary, "post-summary", false, "Post the plain text review summary of the agent as a general comment after the inline comments")
+	fs.StringVar(&cfg.SummaryFile, "summary-file", "", "Write the plain text review summary to this file, e.g. for a CI artifact, also in -dry-run")
+	fs.StringVar(&cfg.OutputFile, "output", "", "Write the generated comments and the review summary to this JSON file, e.g. for a CI artifact, written before posting and in -dry-run")
+	fs.StringVar(&cfg.DroppedReport, "dropped-report", "", "Write comments dropped before posting, with the reason for each, to this JSON file")
+	fs.StringVar(&cfg.RepoPath, "repo-path", ".", "Local checkout used to detect the pull request when no URL is given")
+	fs.Func("exclude", "Comma separated gitignore-like patterns to leave out of the review", func(v string) error {
+		cfg.Exclude = append(cfg.Exclude, splitList(v)...)
+		return nil
+	})
+	fs.Func("include", "Comma separated gitignore-like patterns of the files to review, the rest of the PR is skipped", func(v string) error {
+		cfg.Include = append(cfg.Include, splitList(v)...)
+		return nil
+	})
+	fs.BoolVar(&cfg.ReviewGenerated, "review-generated", false, "Also review vendored and generated files, skipped by default")
+	fs.Func("generated-patterns", "Comma separated patterns replacing the default vendored and generated file list ("+strings.Join(diff.DefaultGeneratedPatterns, ",")+")", func(v string) error {
+		cfg.GeneratedPatterns = splitList(v)
+		return nil
+	})
+	fs.IntVar(&cfg.DiffContext, "diff-context", diff.DefaultContextLines, "Lines of unchanged context around each change in the reviewed diff, 0 shows the changed lines only")
+	fs.StringVar(&cfg.DiffAlgorithm, "diff-algorithm", diff.DefaultAlgorithm, "Algorithm of the reviewed diff: myers, as GitHub and GitLab show it, minimal, patience or histogram, which group moved code into cleaner hunks")
+	fs.IntVar(&cfg.MinHunkLines, "min-hunk-lines", 1, "Drop comments on hunks with fewer changed lines than this, 1 keeps all")
+	fs.StringVar(&cfg.BaseTag, "base-tag", "", "Review the changes since this tag instead of the pull request base, e.g. the last release v1.2.3")
+	fs.BoolVar(&cfg.NoClone, "no-clone", false, "GitHub: review the diff from the compare API without cloning, clones when the diff is truncated")
+	fs.StringVar(&cfg.CloneFallback, "clone-fallback", core.CloneFallbackCommit, "When the source branch cannot be cloned: commit fetches the head commit, default-branch clones the default branch and checks the head commit out, none fails")
+	fs.StringVar(&cfg.CloneTags, "clone-tags", core.CloneTagsNone, "Tags the clone fetches: none, or all, slow on repositories with thousands of tags")
+	fs.IntVar(&cfg.CloneDepth, "clone-depth", 1, "Commits of history the clone fetches, the review base is fetched as well, 0 clones the full history")
+	fs.StringVar(&cfg.GitTransport, "git-transport", core.GitTransportHTTPS, "Transport the repository is cloned over: https with the api key, or ssh with -ssh-key or the ssh agent")
+	fs.StringVar(&cfg.SSHKey, "ssh-key", "", "Private key file for -git-transport ssh, uses the keys of the ssh agent when empty")
+	fs.IntVar(&cfg.CloneRetries, "clone-retries", 3, "Retries for a clone that failed with a transient network error, with backoff")
+	fs.IntVar(&cfg.RunRetries, "run-retries", 0, "Retries of the whole review, with a fresh clone, after a transient failure before any comment was posted, e.g. a network error or a crashed AI agent")
+	fs.IntVar(&cfg.MinDiffLines, "min-diff-lines", 0, "Skip the review of PRs with fewer changed lines than this in the reviewed files, 0 reviews all")
+	fs.Func("files", "Comma separated repository paths of the changed files to review, the rest of the PR is skipped", func(v string) error {
+		cfg.Files = append(cfg.Files, splitList(v)...)
+		return nil
+	})
+	fs.Func("commits", "Comma separated SHAs of the PR commits to review, the changes of the other commits are skipped", func(v string) error {
+		cfg.Commits = append(cfg.Commits, splitList(v)...)
+		return nil
+	})
+	fs.IntVar(&cfg.TopFiles, "top-files", 0, "Review only the N files with the most changed lines, 0 reviews all")
+	fs.IntVar(&cfg.MaxFiles, "max-files", 0, "Most changed files a review covers, larger PRs are handled as -on-too-many-files says, 0 has no limit")
+	fs.IntVar(&cfg.MaxDiffBytes, "max-diff-bytes", 0, "Largest diff the agent is given, the largest files are skipped until it fits and a note lists them, 0 has no limit")
+	fs.IntVar(&cfg.RepoContext, "repo-context", 0, "Give the agent an index of the repository's files and top-level symbols of at most N bytes, 0 leaves it out")
+	fs.StringVar(&cfg.OnTooManyFiles, "on-too-many-files", core.TooManyFilesLargest, "PRs changing more than -max-files files: largest reviews the largest ones and notes it in the summary, abort fails the run")
+	fs.IntVar(&cfg.MaxAiProcesses, "max-ai-processes", runtime.NumCPU(), "Maximum AI agent processes running at once across all reviews of this process")
+	fs.StringVar(&cfg.SummaryMode, "summary-mode", "", "Findings posting: inline threads, or checklist to post one summary comment with a task list of findings")
+	fs.BoolVar(&cfg.LinkifyReferences, "linkify-references", false, "Turn path:line references in comments into links to the lines at the head commit, references to missing files stay text")
+	fs.BoolVar(&cfg.IncludeHunk, "include-hunk", false, "Quote the diff hunk a comment is on below it, so the comment shows what changed")
+	fs.BoolVar(&cfg.SplitLongComments, "split-long-comments", false, "Post comments over the provider length limit as a comment plus replies in its thread")
+	fs.BoolVar(&cfg.ReviewDescription, "review-description", false, "Also check the PR title and description against the changes and post the result as a general comment")
+	fs.BoolVar(&cfg.SkipConflicts, "skip-conflicts", false, "Skip the review of a PR with merge conflicts instead of warning, its diff changes once they are resolved")
+	fs.BoolVar(&cfg.SkipOpenThreads, "skip-open-threads", false, "Skip lines where a thread from an earlier run is still unresolved, lines whose thread was resolved get a new one")
+	fs.BoolVar(&cfg.UsePartialOnTimeout, "use-partial-on-timeout", false, "When the AI agent runs out of time, post the complete comments it saved so far with a note that the review was truncated")
+	fs.BoolVar(&cfg.FailFast, "fail-fast", false, "Stop posting comments on the first failure and fail the run")
+	fs.StringVar(&cfg.OutputFormat, "output-format", "", "Findings output: text, github-actions to also print workflow annotations (default inside GitHub Actions), or json to print the comments as a JSON array, with -dry-run in place of the comment lines")
+	fs.StringVar(&cfg.ExpectUser, "expect-user", "", "Fail unless the VCS API key belongs to this user, e.g. gitex-bot")
+	fs.IntVar(&cfg.LineOffsetTolerance, "line-offset-tolerance", 0, "Move comments on lines missing from the diff to the nearest diff line at most N lines away, 0 disables")
+	fs.StringVar(&cfg.OnCrossHunk, "on-cross-hunk", "", "Multi-line comments spanning several hunks, which providers reject: clamp to the last hunk, split into one comment per hunk, or drop; unset posts them as they are")
+	fs.StringVar(&cfg.IgnoreMarker, "ignore-marker", core.DefaultIgnoreMarker, "Drop comments on lines with this marker or below it, e.g. // gitex:ignore, empty disables")
+	fs.BoolVar(&cfg.VerifyLineContent, "verify-line-content", false, "Drop comments whose quoted line does not match the file content")
+	fs.Float64Var(&cfg.LineMatchThreshold, "line-match-threshold", core.DefaultLineMatchThreshold, "Token similarity between 0 and 1 below which -verify-line-content drops a comment")
+	fs.IntVar(&cfg.MaxCommentsPerFile, "max-comments-per-file", 0, "Keep the N best comments of a file as threads and list the rest in a summary comment, 0 is unlimited")
+	fs.StringVar(&cfg.RedactPatternsFile, "redact-patterns-file", "", "File of regular expressions, one per line, whose matches in the diff are replaced by placeholders before the model sees it and restored in the comments. Requires running without a clone (-no-clone, -serve or -diff-file): the cloned checkout is not redacted, so a review that would clone fails")
+	fs.StringVar(&cfg.OwnershipFile, "ownership-file", "", "YAML mapping of path patterns to context for the model, e.g. \"services/billing/: PCI-sensitive\"")
+	fs.BoolVar(&cfg.OwnFilesOnly, "own-files-only", false, "Only comment on files CODEOWNERS assigns to the token's user or one of its teams")
+	fs.StringVar(&cfg.PostHook, "post-hook", "", "Shell command run after the comments are posted, with the result JSON on stdin and GITEX_PR_URL, GITEX_COMMENT_COUNT and GITEX_FAILED_COUNT set")
+	fs.DurationVar(&cfg.PostHookTimeout, "post-hook-timeout", time.Minute, "How long -post-hook may run before it is killed")
+	fs.DurationVar(&cfg.CloneTimeout, "clone-timeout", core.DefaultCloneTimeout, "How long cloning the repository may take")
+	fs.DurationVar(&cfg.AgentTimeout, "agent-timeout", core.DefaultAgentTimeout, "How long the AI agent may review before it is stopped")
+	fs.DurationVar(&cfg.ApiTimeout, "api-timeout", 0, "How long one provider API request may take (default: 2m to load the pull request and 30s per comment, unbounded on GitLab), also bounds the requests of the openai agent")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "Print the comments instead of posting them, without an AI key placeholder comments stand in for the review")
+	fs.BoolVar(&cfg.Serve, "serve", false, "Editor backend: review diffs sent as JSON lines on stdin and print JSON comment arrays on stdout")
+	fs.DurationVar(&cfg.DrainTimeout, "drain-timeout", 30*time.Second, "In -serve mode, how long a running review may continue after SIGTERM or interrupt")
+	fs.StringVar(&cfg.PendingFile, "pending-file", "", "In -serve mode, append requests left unanswered at shutdown to this file, to pipe into the next run")
+	fs.StringVar(&cfg.DiffFile, "diff-file", "", "Review this saved unified diff and print the JSON comment array, without cloning or calling the VCS provider")
+	fs.StringVar(&cfg.BaseSha, "base-sha", "", "With -diff-file, the commit the diff starts from")
+	fs.StringVar(&cfg.HeadSha, "head-sha", "", "With -diff-file, the commit the diff ends at")
+	fs.StringVar(&cfg.SubPath, "subpath", "", "Review only changes under this repository sub directory (monorepos)")
 
 	fs.Usage = func() {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: gitex <pull-request-url> [flags]\n\n")
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: gitex [pull-request-url] [flags]\n\n")
 		_, _ = fmt.Fprintf(os.Stderr, "Arguments:\n")
-		_, _ = fmt.Fprintf(os.Stderr, "  pull-request-url    Pull request URL\n\n")
+		_, _ = fmt.Fprintf(os.Stderr, "  pull-request-url    Pull request URL, detected from the origin remote and current branch of -repo-path when omitted\n\n")
 		_, _ = fmt.Fprintf(os.Stderr, "Flags:\n")
 		fs.PrintDefaults()
 	}
 
-	if err := fs.Parse(args[1:]); err != nil {
+	if err := fs.Parse(args); err != nil {
 		return "", nil, fmt.Errorf("failed to parse flags: %w", err)
 	}
+	if cfg.Serve && mrUrl != "" {
+		return "", nil, errors.New("a pull request url cannot be combined with -serve")
+	}
+	if cfg.DiffFile != "" && mrUrl != "" {
+		return "", nil, errors.New("a pull request url cannot be combined with -diff-file")
+	}
+	if cfg.AiModel == "" && len(cfg.AiModelChain) > 0 {
+		cfg.AiModel = cfg.AiModelChain[0]
+	}
+	if cfg.AiModel == "" {
+		cfg.AiModel = defaultAiModels[cfg.AiAgent]
+	}
 
 	return mrUrl, cfg, nil
 }
 
+// defaultAiModels is the model each agent runs when -ai-model is not given.
+var defaultAiModels = map[string]string{
+	string(api.AIAgentTypeCodex):  "gpt-5.1-codex-mini",
+	string(api.AIAgentTypeClaude): "claude-sonnet-4-5",
+	string(api.AIAgentTypeOpenAI): "gpt-5.1-codex-mini",
+}
+
+func splitList(v string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func populateFromEnv(cfg *api.Config) error {
 	if cfg.VcsApiKey == "" {
 		cfg.VcsApiKey = os.Getenv("VCS_API_KEY")
-		if cfg.VcsApiKey == "" {
+		if cfg.VcsApiKey == "" && !cfg.Serve && cfg.DiffFile == "" {
 			return errors.New("vcs-api-key is not set. Provide it as an argument or set VCS_API_KEY environment variable")
 		}
 	}
 
 	if cfg.AiApiKey == "" {
 		cfg.AiApiKey = os.Getenv("AI_API_KEY")
-		if cfg.AiApiKey == "" {
+		// a dry run without a key posts nothing and stands in placeholder comments for the review
+		if cfg.AiApiKey == "" && cfg.AiAgent != string(api.AIAgentTypeReplay) && !cfg.DryRun {
 			return errors.New("ai-api-key is not set. Provide it as an argument or set AI_API_KEY environment variable")
 		}
 	}
 
 	cfg.CI = os.Getenv("CI") == "true"
+	if cfg.OutputFormat == "" && os.Getenv("GITHUB_ACTIONS") == "true" {
+		cfg.OutputFormat = core.OutputFormatGitHubActions
+	}
 	cfg.HomeDir = os.Getenv("GITEX_HOME")
 	if cfg.HomeDir == "" {
 		dir, err := os.UserHomeDir()
@@ -83,5 +247,8 @@ func populateFromEnv(cfg *api.Config) error {
 		cfg.HomeDir = filepath.Join(dir, ".gitex")
 	}
 	cfg.BinDir = filepath.Join(cfg.HomeDir, "bin")
+	if cfg.CodexHome == "" {
+		cfg.CodexHome = filepath.Join(cfg.HomeDir, ".codex")
+	}
 	return nil
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/eridan-ltu/gitex/api"
@@ -21,7 +22,8 @@ func TestParseInput(t *testing.T) {
 			args:    []string{"https://github.com/owner/repo/pull/123"},
 			wantUrl: "https://github.com/owner/repo/pull/123",
 			wantCfg: &api.Config{
-				AiModel: "gpt-5.1-codex-mini",
+				AiModel:  "gpt-5.1-codex-mini",
+				RepoPath: ".",
 			},
 		},
 		{
@@ -31,6 +33,7 @@ func TestParseInput(t *testing.T) {
 			wantCfg: &api.Config{
 				VcsApiKey: "token123",
 				AiModel:   "gpt-5.1-codex-mini",
+				RepoPath:  ".",
 			},
 		},
 		{
@@ -43,11 +46,50 @@ func TestParseInput(t *testing.T) {
 				AiApiKey:     "ai-token",
 				AiModel:      "gpt-4",
 				Verbose:      true,
+				RepoPath:     ".",
 			},
 		},
 		{
-			name:        "no args - error",
-			args:        []string{},
+			name:    "with subpath flag",
+			args:    []string{"https://github.com/owner/repo/pull/1", "-subpath", "services/foo"},
+			wantUrl: "https://github.com/owner/repo/pull/1",
+			wantCfg: &api.Config{
+				AiModel:  "gpt-5.1-codex-mini",
+				RepoPath: ".",
+				SubPath:  "services/foo",
+			},
+		},
+		{
+			name:    "no args - detect from local repo",
+			args:    []string{},
+			wantUrl: "",
+			wantCfg: &api.Config{
+				AiModel:  "gpt-5.1-codex-mini",
+				RepoPath: ".",
+			},
+		},
+		{
+			name:    "flags only with repo path",
+			args:    []string{"-repo-path", "/work/repo", "-verbose"},
+			wantUrl: "",
+			wantCfg: &api.Config{
+				AiModel:  "gpt-5.1-codex-mini",
+				Verbose:  true,
+				RepoPath: "/work/repo",
+			},
+		},
+		{
+			name:    "claude agent default model",
+			args:    []string{"-ai-agent", "claude"},
+			wantUrl: "",
+			wantCfg: &api.Config{
+				AiModel:  "claude-sonnet-4-5",
+				RepoPath: ".",
+			},
+		},
+		{
+			name:        "serve with url - error",
+			args:        []string{"https://github.com/owner/repo/pull/1", "-serve"},
 			expectError: true,
 		},
 		{
@@ -88,9 +130,15 @@ func TestParseInput(t *testing.T) {
 			if cfg.AiModel != tt.wantCfg.AiModel {
 				t.Errorf("AiModel = %q, want %q", cfg.AiModel, tt.wantCfg.AiModel)
 			}
+			if cfg.RepoPath != tt.wantCfg.RepoPath {
+				t.Errorf("RepoPath = %q, want %q", cfg.RepoPath, tt.wantCfg.RepoPath)
+			}
 			if cfg.Verbose != tt.wantCfg.Verbose {
 				t.Errorf("Verbose = %v, want %v", cfg.Verbose, tt.wantCfg.Verbose)
 			}
+			if cfg.SubPath != tt.wantCfg.SubPath {
+				t.Errorf("SubPath = %q, want %q", cfg.SubPath, tt.wantCfg.SubPath)
+			}
 		})
 	}
 }
@@ -100,7 +148,9 @@ func TestPopulateFromEnv(t *testing.T) {
 	origAiKey := os.Getenv("AI_API_KEY")
 	origCI := os.Getenv("CI")
 	origHome := os.Getenv("GITEX_HOME")
+	origActions := os.Getenv("GITHUB_ACTIONS")
 	defer func() {
+		_ = os.Setenv("GITHUB_ACTIONS", origActions)
 		_ = os.Setenv("VCS_API_KEY", origVcsKey)
 		_ = os.Setenv("AI_API_KEY", origAiKey)
 		_ = os.Setenv("CI", origCI)
@@ -134,6 +184,9 @@ func TestPopulateFromEnv(t *testing.T) {
 		if cfg.BinDir != "/custom/home/bin" {
 			t.Errorf("BinDir = %q, want %q", cfg.BinDir, "/custom/home/bin")
 		}
+		if cfg.CodexHome != "/custom/home/.codex" {
+			t.Errorf("CodexHome = %q, want %q", cfg.CodexHome, "/custom/home/.codex")
+		}
 	})
 
 	t.Run("flags take precedence over env", func(t *testing.T) {
@@ -181,6 +234,26 @@ func TestPopulateFromEnv(t *testing.T) {
 		}
 	})
 
+	t.Run("AI_API_KEY not required for replay agent", func(t *testing.T) {
+		_ = os.Setenv("VCS_API_KEY", "vcs-key")
+		_ = os.Unsetenv("AI_API_KEY")
+
+		cfg := &api.Config{AiAgent: "replay"}
+		if err := populateFromEnv(cfg); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("AI_API_KEY not required for dry run", func(t *testing.T) {
+		_ = os.Setenv("VCS_API_KEY", "vcs-key")
+		_ = os.Unsetenv("AI_API_KEY")
+
+		cfg := &api.Config{DryRun: true}
+		if err := populateFromEnv(cfg); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
 	t.Run("default home dir when GITEX_HOME not set", func(t *testing.T) {
 		_ = os.Setenv("VCS_API_KEY", "vcs-key")
 		_ = os.Setenv("AI_API_KEY", "ai-key")
@@ -200,6 +273,45 @@ func TestPopulateFromEnv(t *testing.T) {
 		}
 	})
 
+	t.Run("codex home flag is kept", func(t *testing.T) {
+		_ = os.Setenv("VCS_API_KEY", "vcs-key")
+		_ = os.Setenv("AI_API_KEY", "ai-key")
+		_ = os.Setenv("GITEX_HOME", "/custom/home")
+
+		cfg := &api.Config{CodexHome: "/job/codex"}
+		err := populateFromEnv(cfg)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.CodexHome != "/job/codex" {
+			t.Errorf("CodexHome = %q, want %q", cfg.CodexHome, "/job/codex")
+		}
+	})
+
+	t.Run("github actions output inside GitHub Actions", func(t *testing.T) {
+		_ = os.Setenv("VCS_API_KEY", "vcs-key")
+		_ = os.Setenv("AI_API_KEY", "ai-key")
+		_ = os.Setenv("GITHUB_ACTIONS", "true")
+
+		cfg := &api.Config{}
+		if err := populateFromEnv(cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.OutputFormat != "github-actions" {
+			t.Errorf("OutputFormat = %q, want github-actions", cfg.OutputFormat)
+		}
+
+		cfg = &api.Config{OutputFormat: "text"}
+		if err := populateFromEnv(cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.OutputFormat != "text" {
+			t.Errorf("OutputFormat = %q, want the explicit text", cfg.OutputFormat)
+		}
+		_ = os.Unsetenv("GITHUB_ACTIONS")
+	})
+
 	t.Run("CI false when not set to true", func(t *testing.T) {
 		_ = os.Setenv("VCS_API_KEY", "vcs-key")
 		_ = os.Setenv("AI_API_KEY", "ai-key")
@@ -216,3 +328,47 @@ func TestPopulateFromEnv(t *testing.T) {
 		}
 	})
 }
+
+func TestParseInput_AiEnv(t *testing.T) {
+	_, cfg, err := parseInput([]string{
+		"https://github.com/owner/repo/pull/1",
+		"-ai-env", "HTTPS_PROXY=http://proxy:3128",
+		"-ai-env", "CODEX_FLAGS=a,b",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.AiEnv, []string{"HTTPS_PROXY=http://proxy:3128", "CODEX_FLAGS=a,b"}) {
+		t.Errorf("AiEnv = %v", cfg.AiEnv)
+	}
+}
+
+func TestParseInput_ExcludeFlags(t *testing.T) {
+	_, cfg, err := parseInput([]string{
+		"https://github.com/owner/repo/pull/1",
+		"-exclude", "docs/, *.md",
+		"-exclude", "testdata/",
+		"-generated-patterns", "gen/",
+		"-review-generated",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Exclude, []string{"docs/", "*.md", "testdata/"}) {
+		t.Errorf("Exclude = %v", cfg.Exclude)
+	}
+	if !reflect.DeepEqual(cfg.GeneratedPatterns, []string{"gen/"}) {
+		t.Errorf("GeneratedPatterns = %v", cfg.GeneratedPatterns)
+	}
+	if !cfg.ReviewGenerated {
+		t.Error("expected ReviewGenerated to be set")
+	}
+
+	_, cfg, err = parseInput([]string{"https://github.com/owner/repo/pull/1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.GeneratedPatterns != nil {
+		t.Errorf("expected default generated patterns, got %v", cfg.GeneratedPatterns)
+	}
+}